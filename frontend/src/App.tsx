@@ -7,7 +7,7 @@ import { sessionAPI } from './services/api';
 import { wsService } from './services/websocket';
 
 function App() {
-  const { setSessions, updateSession } = useAppStore();
+  const { setSessions, updateSession, setCats, updateCat } = useAppStore();
 
   const loadSessions = async () => {
     try {
@@ -30,6 +30,16 @@ function App() {
       });
     });
 
+    // 猫猫上下线、开始/结束任务时更新状态
+    const unsubCatPresence = wsService.onCatPresence((cat) => {
+      updateCat(cat);
+    });
+
+    // 注册、修改或删除猫猫后替换整个列表
+    const unsubCats = wsService.onCats((cats) => {
+      setCats(cats);
+    });
+
     // 断线重连后全量刷新 sessions，补偿断线期间丢失的 session_updated 事件
     const unsubReconnect = wsService.onReconnect(() => {
       loadSessions();
@@ -37,6 +47,8 @@ function App() {
 
     return () => {
       unsubSessionUpdate();
+      unsubCatPresence();
+      unsubCats();
       unsubReconnect();
     };
   }, []);
@@ -5,12 +5,31 @@ import { MessageInput } from './MessageInput';
 import ModeStatusBar from './ModeStatusBar';
 import { messageAPI, modeAPI } from '@/services/api';
 import { wsService } from '@/services/websocket';
-import { Message } from '@/types';
+import { Message, MessageDelta } from '@/types';
+
+// 草稿消息的增量状态
+interface DraftState {
+  seq: number;
+  text: string;
+  tools: { id: string; name: string; done: boolean; isError: boolean }[];
+}
+
+const draftMessageId = (taskId: string) => `draft_${taskId}`;
+
+// 草稿内容：已生成的文本 + 工具调用进度
+const renderDraft = (draft: DraftState) => {
+  const toolLines = draft.tools.map(t =>
+    t.done ? `${t.isError ? '✗' : '✓'} ${t.name}` : `🔧 ${t.name}…`
+  );
+  return [draft.text, ...toolLines].filter(Boolean).join('\n\n') || '…';
+};
 
 export const ChatArea: React.FC = () => {
   const currentSession = useAppStore(state => state.currentSession);
   const setMessages = useAppStore(state => state.setMessages);
   const addMessageIfNotExists = useAppStore(state => state.addMessageIfNotExists);
+  const upsertMessage = useAppStore(state => state.upsertMessage);
+  const removeMessage = useAppStore(state => state.removeMessage);
   const sessionMode = useAppStore(state => state.sessionMode);
   const setSessionMode = useAppStore(state => state.setSessionMode);
   const messageListRef = useRef<MessageListHandle>(null);
@@ -18,6 +37,7 @@ export const ChatArea: React.FC = () => {
   const isUserScrollingRef = useRef<boolean>(false);
   const messagesLoadedRef = useRef<boolean>(false);
   const pendingWsMessagesRef = useRef<Message[]>([]);
+  const draftsRef = useRef<Map<string, DraftState>>(new Map());
 
   // 使用 session ID 字符串作为依赖，避免对象引用变化触发无意义的重载
   const currentSessionId = currentSession?.id;
@@ -27,6 +47,7 @@ export const ChatArea: React.FC = () => {
 
     messagesLoadedRef.current = false;
     pendingWsMessagesRef.current = [];
+    draftsRef.current.clear();
 
     loadMessages(currentSessionId);
     loadSessionMode(currentSessionId);
@@ -41,6 +62,12 @@ export const ChatArea: React.FC = () => {
         return;
       }
 
+      // 最终回复替换增量草稿
+      if (message.taskId && draftsRef.current.has(message.taskId)) {
+        draftsRef.current.delete(message.taskId);
+        removeMessage(draftMessageId(message.taskId));
+      }
+
       addMessageIfNotExists(message);
 
       if (!isUserScrollingRef.current) {
@@ -50,6 +77,50 @@ export const ChatArea: React.FC = () => {
       }
     });
 
+    const unsubscribeDelta = wsService.onMessageDelta((delta: MessageDelta) => {
+      if (!messagesLoadedRef.current || delta.sessionId !== currentSessionId) return;
+
+      if (delta.type === 'discard') {
+        draftsRef.current.delete(delta.taskId);
+        removeMessage(draftMessageId(delta.taskId));
+        return;
+      }
+
+      const draft = draftsRef.current.get(delta.taskId) || { seq: 0, text: '', tools: [] };
+      if (delta.seq <= draft.seq) return; // 乱序的旧事件
+      draft.seq = delta.seq;
+
+      if (delta.type === 'text' && delta.text) {
+        draft.text += delta.text;
+      } else if (delta.type === 'tool_start') {
+        draft.tools.push({ id: delta.toolId || '', name: delta.tool || '工具', done: false, isError: false });
+      } else if (delta.type === 'tool_end') {
+        const tool = draft.tools.find(t => t.id === delta.toolId && !t.done);
+        if (tool) {
+          tool.done = true;
+          tool.isError = !!delta.isError;
+        }
+      }
+      draftsRef.current.set(delta.taskId, draft);
+
+      upsertMessage({
+        id: draftMessageId(delta.taskId),
+        type: 'cat',
+        content: renderDraft(draft),
+        sender: delta.sender,
+        timestamp: new Date(),
+        sessionId: delta.sessionId,
+        taskId: delta.taskId,
+        draft: true,
+      });
+
+      if (!isUserScrollingRef.current) {
+        requestAnimationFrame(() => {
+          messageListRef.current?.scrollToBottom();
+        });
+      }
+    });
+
     // 订阅 WS 重连事件，重连后重新拉取消息，避免断连期间消息丢失
     const unsubscribeReconnect = wsService.onReconnect(() => {
       console.log('[ChatArea] WS reconnected, reloading messages');
@@ -58,6 +129,7 @@ export const ChatArea: React.FC = () => {
 
     return () => {
       unsubscribeMessage();
+      unsubscribeDelta();
       unsubscribeReconnect();
     };
   }, [currentSessionId]);
@@ -68,6 +140,7 @@ export const ChatArea: React.FC = () => {
     try {
       const response = await messageAPI.getMessages(targetSessionId);
       setMessages(response.data);
+      draftsRef.current.clear();
       messagesLoadedRef.current = true;
 
       if (pendingWsMessagesRef.current.length > 0) {
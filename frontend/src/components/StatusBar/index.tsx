@@ -27,6 +27,7 @@ export const StatusBar: React.FC = () => {
       const unsubscribeHistory = wsService.onHistory((newHistory: CallHistory[]) => {
         console.log('[StatusBar] 收到调用历史更新:', newHistory);
         setHistory(newHistory);
+        loadStats();
       });
 
       return () => {
@@ -99,6 +100,32 @@ export const StatusBar: React.FC = () => {
             <p className="text-xl font-bold">{stats.catMessages.toLocaleString()}</p>
           </div>
         </div>
+        {stats.usage && stats.usage.invocations > 0 && (
+          <div className="mt-4 space-y-2">
+            <div className="flex gap-4">
+              <div className="flex-1 bg-gray-100 rounded-lg p-4">
+                <p className="text-xs text-gray-500 mb-1">
+                  Token（输入 / 输出）{stats.usage.estimated > 0 && <span title="部分调用的用量为估算值"> *</span>}
+                </p>
+                <p className="text-sm font-bold">
+                  {stats.usage.tokensIn.toLocaleString()} / {stats.usage.tokensOut.toLocaleString()}
+                </p>
+              </div>
+              <div className="flex-1 bg-gray-100 rounded-lg p-4">
+                <p className="text-xs text-gray-500 mb-1">费用</p>
+                <p className="text-sm font-bold">${stats.usage.costUsd.toFixed(4)}</p>
+              </div>
+            </div>
+            {Object.entries(stats.byCat || {}).map(([catName, usage]) => (
+              <div key={catName} className="flex items-center justify-between text-xs text-gray-600 px-1">
+                <span>{catName}</span>
+                <span>
+                  {usage.invocations} 次 · {(usage.tokensIn + usage.tokensOut).toLocaleString()} tokens · ${usage.costUsd.toFixed(4)} · {(usage.durationMs / 1000).toFixed(0)}s
+                </span>
+              </div>
+            ))}
+          </div>
+        )}
       </div>
 
       {/* Session Chain 状态 */}
@@ -1,5 +1,5 @@
 import axios from 'axios';
-import { Cat, Message, Session, MessageStats, CallHistory, ModeInfo, SessionMode, Workspace, SessionChainStatus, HindsightHealth } from '@/types';
+import { Cat, CatDetail, CatConfig, SpawnedWorker, Message, Session, MessageStats, CallHistory, ModeInfo, SessionMode, ModeActionList, ModeActionResult, SubtaskGroupStatus, OwnerRequest, CancelTaskResult, BudgetOverview, BudgetLimit, UpdateBudgetRequest, Workspace, Worktree, SessionChainStatus, HindsightHealth } from '@/types';
 
 const api = axios.create({
   baseURL: '/api',
@@ -44,16 +44,46 @@ export const catAPI = {
   getCats: () => api.get<Cat[]>('/cats'),
 
   // 获取猫猫状态
-  getCatStatus: (catId: string) => api.get<Cat>(`/cats/${catId}`),
+  getCatStatus: (catId: string) => api.get<CatDetail>(`/cats/${catId}`),
 
   // 获取可用的猫猫（待命状态）
   getAvailableCats: () => api.get<Cat[]>('/cats/available'),
+
+  // 注册新猫猫
+  createCat: (config: CatConfig) => api.post<CatDetail>('/cats', config),
+
+  // 修改猫猫配置（名字、ID、管道不能修改）
+  updateCat: (catId: string, config: CatConfig) => api.put<CatDetail>(`/cats/${catId}`, config),
+
+  // 删除猫猫
+  deleteCat: (catId: string) => api.delete(`/cats/${catId}`),
+
+  // 为猫猫启动一个工作进程
+  spawnWorker: (catId: string) => api.post<SpawnedWorker>(`/cats/${catId}/workers`),
 };
 
 export const historyAPI = {
   // 获取调用历史
   getCallHistory: (sessionId: string) =>
     api.get<CallHistory[]>(`/sessions/${sessionId}/history`),
+
+  // 取消单个猫猫任务
+  cancelTask: (sessionId: string, taskId: string) =>
+    api.delete<CancelTaskResult>(`/sessions/${sessionId}/tasks/${taskId}`),
+
+  // 取消会话中所有未完成的任务
+  cancelAllTasks: (sessionId: string) =>
+    api.delete<{ cancelled: CancelTaskResult[]; count: number }>(`/sessions/${sessionId}/tasks`),
+};
+
+export const budgetAPI = {
+  // 获取会话相关的预算使用情况
+  getBudget: (sessionId: string) =>
+    api.get<BudgetOverview>(`/sessions/${sessionId}/budget`),
+
+  // 调整预算上限，返回因此恢复执行的排队任务数
+  updateBudget: (data: UpdateBudgetRequest) =>
+    api.put<{ scope: string; limit: BudgetLimit; resumed: number }>('/budgets', data),
 };
 
 export const modeAPI = {
@@ -67,6 +97,22 @@ export const modeAPI = {
   // 切换会话模式
   switchMode: (sessionId: string, mode: string, config?: Record<string, any>) =>
     api.put<SessionMode>(`/sessions/${sessionId}/mode`, { mode, modeConfig: config || {} }),
+
+  // 获取当前步骤可执行的模式动作
+  getModeActions: (sessionId: string) =>
+    api.get<ModeActionList>(`/sessions/${sessionId}/mode/actions`),
+
+  // 执行模式动作
+  executeModeAction: (sessionId: string, action: string, params?: Record<string, any>) =>
+    api.post<ModeActionResult>(`/sessions/${sessionId}/mode/action`, { action, params: params || {} }),
+
+  // 获取正在等待汇合的子任务组
+  getSubtaskGroups: (sessionId: string) =>
+    api.get<SubtaskGroupStatus[]>(`/sessions/${sessionId}/groups`),
+
+  // 获取等待铲屎官回复的提问
+  getOwnerRequests: (sessionId: string) =>
+    api.get<{ awaitingOwner: boolean; requests: OwnerRequest[] }>(`/sessions/${sessionId}/owner-requests`),
 };
 
 export const workspaceAPI = {
@@ -74,8 +120,8 @@ export const workspaceAPI = {
   getWorkspaces: () => api.get<Workspace[]>('/workspaces'),
 
   // 创建工作区
-  createWorkspace: (path: string, type: 'self' | 'external') =>
-    api.post<Workspace>('/workspaces', { path, type }),
+  createWorkspace: (path: string, type: 'self' | 'external', isolation?: Workspace['isolation']) =>
+    api.post<Workspace>('/workspaces', { path, type, isolation }),
 
   // 获取工作区详情
   getWorkspace: (workspaceId: string) => api.get<Workspace>(`/workspaces/${workspaceId}`),
@@ -86,6 +132,17 @@ export const workspaceAPI = {
 
   // 删除工作区
   deleteWorkspace: (workspaceId: string) => api.delete(`/workspaces/${workspaceId}`),
+
+  // 获取等待合并或丢弃的隔离分支
+  getWorktrees: (workspaceId: string) => api.get<Worktree[]>(`/workspaces/${workspaceId}/worktrees`),
+
+  // 将隔离分支合并到工作区
+  mergeWorktree: (workspaceId: string, worktreeId: string) =>
+    api.post<Worktree>(`/workspaces/${workspaceId}/worktrees/${encodeURIComponent(worktreeId)}/merge`),
+
+  // 丢弃隔离分支
+  discardWorktree: (workspaceId: string, worktreeId: string) =>
+    api.delete(`/workspaces/${workspaceId}/worktrees/${encodeURIComponent(worktreeId)}`),
 };
 
 export const chainAPI = {
@@ -1,6 +1,6 @@
-import { Message, CallHistory, SessionChainStatus } from '@/types';
+import { Cat, Message, MessageDelta, CallHistory, TaskFailedEvent, BudgetWarningEvent, SessionChainStatus, ModeActionResult, VoteProgress, SubtaskGroupStatus, OwnerRequestEvent, OwnerRequestResolved } from '@/types';
 
-type WSMessageType = 'message' | 'history' | 'stats' | 'cats' | 'chain_status' | 'session_updated';
+type WSMessageType = 'message' | 'message_delta' | 'history' | 'stats' | 'cats' | 'chain_status' | 'session_updated' | 'mode_action' | 'vote_progress' | 'group_status' | 'owner_request' | 'owner_request_resolved' | 'task_failed' | 'budget_warning' | 'cat_presence';
 
 interface WSMessage {
   type: WSMessageType;
@@ -10,18 +10,38 @@ interface WSMessage {
 }
 
 type MessageHandler = (message: Message) => void;
+type MessageDeltaHandler = (delta: MessageDelta) => void;
 type HistoryHandler = (history: CallHistory[]) => void;
 type ChainStatusHandler = (status: SessionChainStatus) => void;
 type SessionUpdatedHandler = (data: { id: string; summary: string; updatedAt: string; messageCount: number }) => void;
+type ModeActionHandler = (result: ModeActionResult) => void;
+type VoteProgressHandler = (progress: VoteProgress) => void;
+type GroupStatusHandler = (status: SubtaskGroupStatus) => void;
+type OwnerRequestHandler = (event: OwnerRequestEvent) => void;
+type OwnerRequestResolvedHandler = (event: OwnerRequestResolved) => void;
+type TaskFailedHandler = (event: TaskFailedEvent) => void;
+type BudgetWarningHandler = (event: BudgetWarningEvent) => void;
+type CatPresenceHandler = (cat: Cat) => void;
+type CatsHandler = (cats: Cat[]) => void;
 
 export class WebSocketService {
   private ws: WebSocket | null = null;
   private sessionId: string | null = null;
   private reconnectTimer: ReturnType<typeof setTimeout> | null = null;
   private messageHandlers: Set<MessageHandler> = new Set();
+  private messageDeltaHandlers: Set<MessageDeltaHandler> = new Set();
   private historyHandlers: Set<HistoryHandler> = new Set();
   private chainStatusHandlers: Set<ChainStatusHandler> = new Set();
   private sessionUpdatedHandlers: Set<SessionUpdatedHandler> = new Set();
+  private modeActionHandlers: Set<ModeActionHandler> = new Set();
+  private voteProgressHandlers: Set<VoteProgressHandler> = new Set();
+  private groupStatusHandlers: Set<GroupStatusHandler> = new Set();
+  private ownerRequestHandlers: Set<OwnerRequestHandler> = new Set();
+  private ownerRequestResolvedHandlers: Set<OwnerRequestResolvedHandler> = new Set();
+  private taskFailedHandlers: Set<TaskFailedHandler> = new Set();
+  private budgetWarningHandlers: Set<BudgetWarningHandler> = new Set();
+  private catPresenceHandlers: Set<CatPresenceHandler> = new Set();
+  private catsHandlers: Set<CatsHandler> = new Set();
   private reconnectHandlers: Set<() => void> = new Set();
   private reconnectAttempts = 0;
   private maxReconnectAttempts = 5;
@@ -111,6 +131,9 @@ export class WebSocketService {
       case 'message':
         this.messageHandlers.forEach(handler => handler(wsMessage.data));
         break;
+      case 'message_delta':
+        this.messageDeltaHandlers.forEach(handler => handler(wsMessage.data));
+        break;
       case 'history':
         this.historyHandlers.forEach(handler => handler(wsMessage.data));
         break;
@@ -120,6 +143,33 @@ export class WebSocketService {
       case 'session_updated':
         this.sessionUpdatedHandlers.forEach(handler => handler(wsMessage.data));
         break;
+      case 'mode_action':
+        this.modeActionHandlers.forEach(handler => handler(wsMessage.data));
+        break;
+      case 'vote_progress':
+        this.voteProgressHandlers.forEach(handler => handler(wsMessage.data));
+        break;
+      case 'group_status':
+        this.groupStatusHandlers.forEach(handler => handler(wsMessage.data));
+        break;
+      case 'owner_request':
+        this.ownerRequestHandlers.forEach(handler => handler(wsMessage.data));
+        break;
+      case 'owner_request_resolved':
+        this.ownerRequestResolvedHandlers.forEach(handler => handler(wsMessage.data));
+        break;
+      case 'task_failed':
+        this.taskFailedHandlers.forEach(handler => handler(wsMessage.data));
+        break;
+      case 'budget_warning':
+        this.budgetWarningHandlers.forEach(handler => handler(wsMessage.data));
+        break;
+      case 'cat_presence':
+        this.catPresenceHandlers.forEach(handler => handler(wsMessage.data));
+        break;
+      case 'cats':
+        this.catsHandlers.forEach(handler => handler(wsMessage.data));
+        break;
       default:
         console.warn('[WS] 未知消息类型:', wsMessage.type);
     }
@@ -130,6 +180,11 @@ export class WebSocketService {
     return () => this.messageHandlers.delete(handler);
   }
 
+  onMessageDelta(handler: MessageDeltaHandler) {
+    this.messageDeltaHandlers.add(handler);
+    return () => this.messageDeltaHandlers.delete(handler);
+  }
+
   onHistory(handler: HistoryHandler) {
     this.historyHandlers.add(handler);
     return () => this.historyHandlers.delete(handler);
@@ -145,6 +200,51 @@ export class WebSocketService {
     return () => this.sessionUpdatedHandlers.delete(handler);
   }
 
+  onModeAction(handler: ModeActionHandler) {
+    this.modeActionHandlers.add(handler);
+    return () => this.modeActionHandlers.delete(handler);
+  }
+
+  onVoteProgress(handler: VoteProgressHandler) {
+    this.voteProgressHandlers.add(handler);
+    return () => this.voteProgressHandlers.delete(handler);
+  }
+
+  onGroupStatus(handler: GroupStatusHandler) {
+    this.groupStatusHandlers.add(handler);
+    return () => this.groupStatusHandlers.delete(handler);
+  }
+
+  onOwnerRequest(handler: OwnerRequestHandler) {
+    this.ownerRequestHandlers.add(handler);
+    return () => this.ownerRequestHandlers.delete(handler);
+  }
+
+  onOwnerRequestResolved(handler: OwnerRequestResolvedHandler) {
+    this.ownerRequestResolvedHandlers.add(handler);
+    return () => this.ownerRequestResolvedHandlers.delete(handler);
+  }
+
+  onTaskFailed(handler: TaskFailedHandler) {
+    this.taskFailedHandlers.add(handler);
+    return () => this.taskFailedHandlers.delete(handler);
+  }
+
+  onBudgetWarning(handler: BudgetWarningHandler) {
+    this.budgetWarningHandlers.add(handler);
+    return () => this.budgetWarningHandlers.delete(handler);
+  }
+
+  onCatPresence(handler: CatPresenceHandler) {
+    this.catPresenceHandlers.add(handler);
+    return () => this.catPresenceHandlers.delete(handler);
+  }
+
+  onCats(handler: CatsHandler) {
+    this.catsHandlers.add(handler);
+    return () => this.catsHandlers.delete(handler);
+  }
+
   onReconnect(handler: () => void) {
     this.reconnectHandlers.add(handler);
     return () => this.reconnectHandlers.delete(handler);
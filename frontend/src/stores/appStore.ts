@@ -18,10 +18,13 @@ interface AppState {
   setMessages: (messages: Message[]) => void;
   addMessage: (message: Message) => void;
   addMessageIfNotExists: (message: Message) => void;
+  upsertMessage: (message: Message) => void;
+  removeMessage: (messageId: string) => void;
 
   // 猫猫列表
   cats: Cat[];
   setCats: (cats: Cat[]) => void;
+  updateCat: (cat: Cat) => void;
 
   // 输入框内容
   inputValue: string;
@@ -78,9 +81,22 @@ export const useAppStore = create<AppState>((set) => ({
 
     return { messages: [...state.messages, message] };
   }),
+  upsertMessage: (message) => set((state) => {
+    const index = state.messages.findIndex(m => m.id === message.id);
+    if (index === -1) return { messages: [...state.messages, message] };
+    const messages = [...state.messages];
+    messages[index] = message;
+    return { messages };
+  }),
+  removeMessage: (messageId) => set((state) => ({
+    messages: state.messages.filter(m => m.id !== messageId)
+  })),
 
   cats: [],
   setCats: (cats) => set({ cats }),
+  updateCat: (cat) => set((state) => ({
+    cats: state.cats.map(c => c.id === cat.id ? { ...c, ...cat } : c)
+  })),
 
   inputValue: '',
   setInputValue: (value) => set({ inputValue: value }),
@@ -3,7 +3,68 @@ export interface Cat {
   name: string;
   avatar: string;
   color: string;
-  status: 'idle' | 'busy' | 'offline';
+  status: 'idle' | 'busy' | 'offline'; // 由工作进程心跳得出
+  workers?: number; // 存活的工作进程数
+  running?: number; // 正在执行的任务数
+  capacity?: number; // 同时执行的任务数上限
+  currentTask?: string; // 忙碌时正在执行的任务
+  lastSeen?: string; // 最近一次心跳
+}
+
+// 猫猫实际生效的 CLI 调用选项（默认值与 config.yaml 合并后）
+export interface BackendOptions {
+  backend: string; // 后端名称，如 claude/claude-sonnet-4-5
+  cliType: string;
+  model?: string;
+  permissionMode?: string;
+  approvalMode?: string;
+  allowedTools?: string[];
+  deniedTools?: string[];
+  extraArgs?: string[];
+  env?: string[]; // 只包含变量名
+}
+
+export interface CatOptions extends BackendOptions {
+  timeout: number; // 秒
+  concurrency: number; // 每个工作进程同时执行的任务数
+  fallbacks?: BackendOptions[]; // 备用后端，按尝试顺序
+}
+
+export type BreakerStateName = 'closed' | 'open' | 'half_open';
+
+// 后端熔断状态
+export interface BreakerState {
+  backend: string;
+  state: BreakerStateName;
+  failures: number; // 连续失败次数
+  openedAt: string;
+  lastError?: string;
+}
+
+export interface CatDetail extends Cat {
+  options?: CatOptions;
+  backends?: BreakerState[]; // 配置了备用后端时返回
+}
+
+// 注册或修改猫猫的请求体，字段与 config.yaml 中的 agents 条目相同
+// 未指定的 id、color、pipe 自动分配；其余字段（调用选项、fallbacks、提示词等）同配置文件
+export interface CatConfig {
+  name: string;
+  id?: string;
+  color?: string;
+  pipe?: string;
+  cli_type: string;
+  system_prompt_path: string;
+  avatar?: string;
+  [key: string]: unknown;
+}
+
+// 启动工作进程的结果
+export interface SpawnedWorker {
+  catId: string;
+  name: string;
+  pid: number;
+  log: string; // 工作进程的日志文件
 }
 
 export interface Message {
@@ -13,6 +74,22 @@ export interface Message {
   sender?: Cat | { id: string; name: string; avatar: string };
   timestamp: Date;
   sessionId: string;
+  taskId?: string; // 猫猫回复对应的任务，最终消息据此替换增量草稿
+  draft?: boolean; // 正在生成中的草稿消息
+}
+
+// 猫猫运行过程中的增量输出
+export interface MessageDelta {
+  taskId: string;
+  sessionId: string;
+  agentName: string;
+  seq: number;
+  type: 'text' | 'tool_start' | 'tool_end' | 'discard';
+  text?: string;
+  tool?: string;
+  toolId?: string;
+  isError?: boolean;
+  sender?: Cat | { id: string; name: string; avatar: string };
 }
 
 export interface Session {
@@ -25,9 +102,21 @@ export interface Session {
   workspacePath?: string; // 新增：工作区路径（用于显示）
 }
 
+export interface UsageTotals {
+  invocations: number;
+  tokensIn: number;
+  tokensOut: number;
+  cacheReadTokens: number;
+  costUsd: number;
+  durationMs: number;
+  estimated: number; // 用量为估算值的调用次数
+}
+
 export interface MessageStats {
   totalMessages: number;
   catMessages: number;
+  usage?: UsageTotals;
+  byCat?: Record<string, UsageTotals>;
 }
 
 export interface CallHistory {
@@ -37,6 +126,67 @@ export interface CallHistory {
   timestamp: Date;
   prompt: string;
   response: string;
+  taskId?: string;
+  status?: 'pending' | 'completed' | 'cancelled' | 'failed';
+  error?: string;
+}
+
+// 猫猫任务失败通知（如 CLI 调用超时）
+export interface TaskFailedEvent {
+  sessionId: string;
+  taskId: string;
+  agentName: string;
+  reason: string; // timeout 等
+  error: string;
+}
+
+export interface CancelTaskResult {
+  taskId: string;
+  agentName: string;
+  removed: boolean;
+  signalled: boolean;
+}
+
+// 预算相关类型
+export type BudgetScope = 'session' | 'cat' | 'daily';
+
+export interface BudgetLimit {
+  maxCostUsd: number;
+  maxTokens: number;
+}
+
+export interface BudgetStatus {
+  scope: BudgetScope;
+  catName?: string;
+  limit: BudgetLimit;
+  usedCostUsd: number;
+  usedTokens: number;
+  ratio: number; // 已用比例，不限制时为 0
+}
+
+export interface BudgetOverview {
+  onExceed: 'refuse' | 'queue';
+  warnAt: number;
+  session: BudgetStatus;
+  daily: BudgetStatus;
+  cats: BudgetStatus[];
+  queued: string[]; // 因预算排队的任务 ID
+}
+
+export interface BudgetWarningEvent {
+  level: 'warning' | 'exceeded';
+  status: BudgetStatus;
+  action?: 'refuse' | 'queue'; // 有任务因预算被拒绝或排队时设置
+  taskId?: string;
+  agentName?: string;
+}
+
+export interface UpdateBudgetRequest {
+  scope: BudgetScope;
+  sessionId?: string;
+  catName?: string;
+  maxCostUsd?: number;
+  maxTokens?: number;
 }
 
 // 模式相关类型
@@ -63,6 +213,86 @@ export interface SessionMode {
   state: ModeState;
 }
 
+export interface ModeActionParam {
+  name: string;
+  type: 'string' | 'number' | 'boolean' | 'object' | 'array';
+  required: boolean;
+  description?: string;
+}
+
+export interface ModeAction {
+  name: string;
+  description: string;
+  params?: ModeActionParam[];
+}
+
+export interface ModeActionList {
+  mode: string;
+  step: string;
+  actions: ModeAction[];
+}
+
+export interface ModeActionResult {
+  sessionId: string;
+  mode: string;
+  action: string;
+  step: string;
+  state: ModeState;
+  calls: number;
+  actions: ModeAction[];
+}
+
+export interface VoteProgress {
+  sessionId: string;
+  round: number;
+  phase: 'idle' | 'proposing' | 'voting' | 'done';
+  received: number;
+  total: number;
+  quorum: number;
+  tally: Record<string, number>;
+  result?: {
+    scores: Record<string, number>;
+    winner?: string;
+    tie?: string[];
+    quorum_met: boolean;
+    valid_votes: number;
+  } | null;
+  final: boolean;
+}
+
+export interface OwnerRequest {
+  id: string;
+  agentName: string;
+  question: string;
+  askedAt: string;
+}
+
+export interface OwnerRequestEvent {
+  sessionId: string;
+  request: OwnerRequest;
+  pending: OwnerRequest[];
+}
+
+export interface OwnerRequestResolved {
+  sessionId: string;
+  messageId: string;
+  requests: OwnerRequest[];
+}
+
+export interface SubtaskGroupStatus {
+  sessionId: string;
+  groupId: string;
+  status: 'waiting' | 'completed' | 'timeout';
+  finished: number;
+  total: number;
+  deadline?: string;
+  subtasks: {
+    id: string;
+    agentName: string;
+    status: 'pending' | 'completed' | 'failed' | 'timeout';
+  }[];
+}
+
 // 工作区相关类型
 export interface Workspace {
   id: string;
@@ -72,11 +302,31 @@ export interface Workspace {
   testCmd?: string;
   startCmd?: string;
   healthCheck?: string;
+  isolation?: '' | 'task' | 'session'; // 隔离模式，为空时猫猫直接修改工作区
   state: string;
   createdAt: Date;
   updatedAt: Date;
 }
 
+// 隔离模式下猫猫执行任务的分支，等待合并或丢弃
+export interface Worktree {
+  id: string;
+  workspaceId: string;
+  agentName: string;
+  sessionId?: string;
+  taskId: string; // 最近一次在分支上执行的任务
+  branch: string;
+  path: string;
+  base: string; // 创建分支时工作区的 HEAD
+  commit?: string;
+  status: 'running' | 'ready';
+  changed: boolean;
+  diffStat?: string;
+  diff?: string;
+  diffTruncated?: boolean;
+  updatedAt: string;
+}
+
 // Session Chain 相关类型
 export interface SessionChainItem {
   id: string;
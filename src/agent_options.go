@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"cat-cafe/src/agentcli"
+)
+
+// cliOptionSupport 一种 CLI 支持的 Agent 调用选项
+type cliOptionSupport struct {
+	PermissionModes []string // permission_mode 的可选值，为空表示不支持
+	ApprovalModes   []string // approval_mode 的可选值，为空表示不支持
+	AllowedTools    bool
+	DeniedTools     bool
+}
+
+// cliOptionSupports 按 cli_type 索引；未列出的 CLI 只支持 model、extra_args 和 env
+// （codex 的权限由 --full-auto 控制，opencode 的工具权限由 opencode.json 配置）
+var cliOptionSupports = map[string]cliOptionSupport{
+	"claude": {
+		PermissionModes: []string{"default", "acceptEdits", "plan", "bypassPermissions"},
+		AllowedTools:    true,
+		DeniedTools:     true,
+	},
+	"gemini": {
+		ApprovalModes: []string{"default", "auto_edit", "yolo"},
+		AllowedTools:  true,
+	},
+}
+
+// envNamePattern 合法的环境变量名
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// validateAgentConfigs 启动时校验所有 Agent 主后端和备用后端的调用选项
+func validateAgentConfigs(agents []AgentConfig) error {
+	for i := range agents {
+		agent := &agents[i]
+		if agent.Concurrency < 0 {
+			return fmt.Errorf("Agent %s 配置无效: concurrency 不能为负数", agent.Name)
+		}
+		if err := agent.validateOptions(); err != nil {
+			return fmt.Errorf("Agent %s 配置无效: %w", agent.Name, err)
+		}
+		for j := range agent.Fallbacks {
+			if err := agent.Fallbacks[j].validateOptions(); err != nil {
+				return fmt.Errorf("Agent %s 的备用后端 %d 配置无效: %w", agent.Name, j+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateOptions 校验 CLI 调用选项是否被该 cli_type 支持、取值是否合法
+func (c *AgentBackend) validateOptions() error {
+	adapter, err := agentcli.Get(c.CLIType)
+	if err != nil {
+		return err
+	}
+	support := cliOptionSupports[c.CLIType]
+
+	if c.PermissionMode != "" && !containsString(support.PermissionModes, c.PermissionMode) {
+		return unsupportedOptionError(c.CLIType, "permission_mode", c.PermissionMode, support.PermissionModes)
+	}
+	if c.ApprovalMode != "" && !containsString(support.ApprovalModes, c.ApprovalMode) {
+		return unsupportedOptionError(c.CLIType, "approval_mode", c.ApprovalMode, support.ApprovalModes)
+	}
+	if len(c.AllowedTools) > 0 && !support.AllowedTools {
+		return fmt.Errorf("cli_type %s 不支持 allowed_tools", c.CLIType)
+	}
+	if len(c.DeniedTools) > 0 && !support.DeniedTools {
+		return fmt.Errorf("cli_type %s 不支持 denied_tools", c.CLIType)
+	}
+	for _, tool := range append(append([]string{}, c.AllowedTools...), c.DeniedTools...) {
+		if strings.TrimSpace(tool) == "" || strings.Contains(tool, ",") {
+			return fmt.Errorf("工具名称无效: %q（每项一个工具，不能为空或包含逗号）", tool)
+		}
+	}
+
+	if _, direct := adapter.(agentcli.DirectAdapter); direct {
+		if len(c.ExtraArgs) > 0 || len(c.Env) > 0 {
+			return fmt.Errorf("cli_type %s 不启动子进程，不支持 extra_args 和 env", c.CLIType)
+		}
+		return nil
+	}
+
+	reserved := reservedCLIFlags(adapter)
+	for _, arg := range c.ExtraArgs {
+		if arg == "" {
+			return fmt.Errorf("extra_args 不能包含空参数")
+		}
+		flag, _, _ := strings.Cut(arg, "=")
+		if reserved[flag] {
+			return fmt.Errorf("extra_args 不能包含 %s：该参数由 CLI 适配器设置（模型、权限、工具请使用对应的配置项）", flag)
+		}
+	}
+	for name := range c.Env {
+		if !envNamePattern.MatchString(name) {
+			return fmt.Errorf("环境变量名无效: %q", name)
+		}
+	}
+	return nil
+}
+
+// reservedCLIFlags 适配器自己生成的命令行参数（新建会话和 --resume 两种情况）
+// extra_args 重复设置这些参数会导致输出格式或会话恢复出错
+func reservedCLIFlags(adapter agentcli.Adapter) map[string]bool {
+	probe := AgentOptions{
+		Model:           "-",
+		AllowedTools:    "-",
+		DisallowedTools: "-",
+		PermissionMode:  "-",
+		ApprovalMode:    "-",
+		MCPConfigPath:   "-",
+	}
+	reserved := make(map[string]bool)
+	for _, sessionID := range []string{"", "-"} {
+		probe.SessionID = sessionID
+		_, args := adapter.BuildCommand("", probe)
+		for _, arg := range args {
+			if strings.HasPrefix(arg, "-") && arg != "-" {
+				reserved[arg] = true
+			}
+		}
+	}
+	return reserved
+}
+
+// unsupportedOptionError 选项取值不合法或该 CLI 不支持该选项
+func unsupportedOptionError(cliType, option, value string, allowed []string) error {
+	if len(allowed) == 0 {
+		return fmt.Errorf("cli_type %s 不支持 %s", cliType, option)
+	}
+	return fmt.Errorf("%s 取值无效: %s（cli_type %s 可选: %s）", option, value, cliType, strings.Join(allowed, ", "))
+}
+
+// CatOptions 猫猫实际生效的 CLI 调用选项（默认值与配置合并后），用于 GET /api/cats/:catId
+type CatOptions struct {
+	BackendOptions
+	Timeout     int              `json:"timeout"`             // 单次调用超时（秒）
+	Concurrency int              `json:"concurrency"`         // 每个工作进程同时执行的任务数
+	Fallbacks   []BackendOptions `json:"fallbacks,omitempty"` // 备用后端，按尝试顺序
+}
+
+// BackendOptions 一个后端实际生效的调用选项
+type BackendOptions struct {
+	Backend        string   `json:"backend"` // 后端名称，与熔断状态、故障转移提示中的名称一致
+	CLIType        string   `json:"cliType"`
+	Model          string   `json:"model,omitempty"`
+	PermissionMode string   `json:"permissionMode,omitempty"`
+	ApprovalMode   string   `json:"approvalMode,omitempty"`
+	AllowedTools   []string `json:"allowedTools,omitempty"`
+	DeniedTools    []string `json:"deniedTools,omitempty"`
+	ExtraArgs      []string `json:"extraArgs,omitempty"`
+	Env            []string `json:"env,omitempty"` // 只返回变量名，值可能包含密钥
+}
+
+// effectiveOptions 主后端和备用后端实际生效的调用选项
+func (c *AgentConfig) effectiveOptions() CatOptions {
+	options := CatOptions{
+		BackendOptions: c.AgentBackend.effectiveOptions(),
+		Timeout:        int(resolveTaskTimeout(*c, nil).Seconds()),
+		Concurrency:    resolveConcurrency(*c),
+	}
+	for i := range c.Fallbacks {
+		options.Fallbacks = append(options.Fallbacks, c.Fallbacks[i].effectiveOptions())
+	}
+	return options
+}
+
+// effectiveOptions 以 CLI 适配器的默认选项为基础合并后端配置
+func (c *AgentBackend) effectiveOptions() BackendOptions {
+	options := agentcli.MergeOptions(agentcli.DefaultOptions(c.CLIType), c.invokeOptions())
+
+	env := make([]string, 0, len(options.Env))
+	for name := range options.Env {
+		env = append(env, name)
+	}
+	sort.Strings(env)
+
+	return BackendOptions{
+		Backend:        c.Name(),
+		CLIType:        c.CLIType,
+		Model:          options.Model,
+		PermissionMode: options.PermissionMode,
+		ApprovalMode:   options.ApprovalMode,
+		AllowedTools:   splitToolList(options.AllowedTools),
+		DeniedTools:    splitToolList(options.DisallowedTools),
+		ExtraArgs:      options.ExtraArgs,
+		Env:            env,
+	}
+}
+
+// splitToolList 拆分逗号分隔的工具列表
+func splitToolList(tools string) []string {
+	if tools == "" {
+		return nil
+	}
+	return strings.Split(tools, ",")
+}
+
+// catOptions 按猫猫名字查找实际生效的调用选项（注册表中没有该猫猫时返回 nil）
+func (sm *SessionManager) catOptions(name string) *CatOptions {
+	agent, ok := sm.cats.Get(name)
+	if !ok {
+		return nil
+	}
+	options := agent.effectiveOptions()
+	return &options
+}
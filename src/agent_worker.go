@@ -3,10 +3,12 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -16,7 +18,7 @@ import (
 // AgentWorker Agent 工作进程
 type AgentWorker struct {
 	config           *AgentConfig
-	systemPrompt     string
+	prompts          *PromptComposer
 	redisClient      *redis.Client
 	ctx              context.Context
 	cancel           context.CancelFunc
@@ -27,10 +29,27 @@ type AgentWorker struct {
 	workspaceManager *WorkspaceManager      // 工作区管理器
 	chainManager     *SessionChainManager   // Session Chain 管理器
 	hindsightCfg     *HindsightConfig       // Hindsight 长期记忆配置
+	pricing          map[string]ModelPrice  // 模型价格表，用于计算调用费用
+	peers            []AgentConfig          // 启动时配置文件中的猫猫（Redis 中没有注册表时用于查找管道）
+	budgets          *BudgetConfig          // 用量预算，worker 路由派发后续任务前检查
+
+	runningMu sync.Mutex
+	running   map[string]context.CancelFunc // 正在执行的任务，收到取消信号时调用
+
+	presenceMu    sync.Mutex
+	presence      WorkerPresence          // 当前心跳内容
+	presenceTasks map[string]presenceTask // 正在执行的任务，按任务 ID 索引
+
+	// 并发执行（见 worker_pool.go）
+	slots   chan struct{}                // 每个正在执行的任务占用一个槽位
+	waiting chan struct{}                // 每条等待同会话前序任务的消息占用一个排队名额
+	lanesMu sync.Mutex
+	lanes   map[string][]redis.XMessage // 正在执行任务的会话 → 等待执行的后续消息
+	tasks   sync.WaitGroup
 }
 
 // NewAgentWorker 创建 Agent 工作进程
-func NewAgentWorker(config *AgentConfig, systemPrompt string, redisAddr, redisPassword string, redisDB int, workspaceManager *WorkspaceManager, chainManager *SessionChainManager, hindsightCfg *HindsightConfig) (*AgentWorker, error) {
+func NewAgentWorker(config *AgentConfig, prompts *PromptComposer, redisAddr, redisPassword string, redisDB int, workspaceManager *WorkspaceManager, chainManager *SessionChainManager, hindsightCfg *HindsightConfig, pricing map[string]ModelPrice) (*AgentWorker, error) {
 	rdb := redis.NewClient(&redis.Options{
 		Addr:     redisAddr,
 		Password: redisPassword,
@@ -51,7 +70,7 @@ func NewAgentWorker(config *AgentConfig, systemPrompt string, redisAddr, redisPa
 
 	worker := &AgentWorker{
 		config:           config,
-		systemPrompt:     systemPrompt,
+		prompts:          prompts,
 		redisClient:      rdb,
 		ctx:              ctx,
 		cancel:           cancel,
@@ -62,6 +81,13 @@ func NewAgentWorker(config *AgentConfig, systemPrompt string, redisAddr, redisPa
 		workspaceManager: workspaceManager,
 		chainManager:     chainManager,
 		hindsightCfg:     hindsightCfg,
+		pricing:          pricing,
+		running:          make(map[string]context.CancelFunc),
+		presence:         WorkerPresence{AgentName: config.Name, Worker: consumerName, Status: CatStatusIdle, Capacity: resolveConcurrency(*config)},
+		presenceTasks:    make(map[string]presenceTask),
+		slots:            make(chan struct{}, resolveConcurrency(*config)),
+		waiting:          make(chan struct{}, resolveConcurrency(*config)),
+		lanes:            make(map[string][]redis.XMessage),
 	}
 
 	// 创建消费者组
@@ -89,6 +115,7 @@ func (w *AgentWorker) Start() error {
 	LogInfo("[Agent-%s] 监听: %s", w.config.Name, w.streamKey)
 	LogInfo("[Agent-%s] 消费者组: %s", w.config.Name, w.consumerGroup)
 	LogInfo("[Agent-%s] 消费者: %s", w.config.Name, w.consumerName)
+	LogInfo("[Agent-%s] 并发数: %d", w.config.Name, cap(w.slots))
 
 	// 处理信号
 	sigChan := make(chan os.Signal, 1)
@@ -100,10 +127,19 @@ func (w *AgentWorker) Start() error {
 		w.cancel()
 	}()
 
+	// 监听任务取消信号
+	go w.listenForCancellations()
+
+	// 发布心跳，API 服务器据此判断猫猫是否在线
+	go w.heartbeat()
+
 	// 主循环
 	for {
 		select {
 		case <-w.ctx.Done():
+			// 等待正在执行的任务结束（任务上下文随工作进程一起取消）
+			w.tasks.Wait()
+			w.clearPresence()
 			LogInfo("[Agent-%s] 已停止", w.config.Name)
 			return nil
 		default:
@@ -115,41 +151,6 @@ func (w *AgentWorker) Start() error {
 	}
 }
 
-// processMessages 处理消息
-func (w *AgentWorker) processMessages() error {
-	// 从消费者组读取消息
-	streams, err := w.redisClient.XReadGroup(w.ctx, &redis.XReadGroupArgs{
-		Group:    w.consumerGroup,
-		Consumer: w.consumerName,
-		Streams:  []string{w.streamKey, ">"},
-		Count:    1,
-		Block:    1 * time.Second,
-	}).Result()
-
-	if err != nil {
-		if err == redis.Nil {
-			return nil // 没有新消息
-		}
-		return err
-	}
-
-	// 处理每条消息
-	for _, stream := range streams {
-		for _, message := range stream.Messages {
-			if err := w.handleMessage(message); err != nil {
-				fmt.Fprintf(os.Stderr, "处理消息 %s 失败: %v\n", message.ID, err)
-				// 重试逻辑
-				w.retryMessage(message)
-			} else {
-				// 确认消息
-				w.redisClient.XAck(w.ctx, w.streamKey, w.consumerGroup, message.ID)
-			}
-		}
-	}
-
-	return nil
-}
-
 // handleMessage 处理单条消息
 func (w *AgentWorker) handleMessage(message redis.XMessage) error {
 	LogDebug("[Agent-%s] 收到 Redis 消息: %s", w.config.Name, message.ID)
@@ -169,21 +170,76 @@ func (w *AgentWorker) handleMessage(message redis.XMessage) error {
 	LogInfo("[Agent-%s] 📥 收到任务: %s", w.config.Name, task.TaskID)
 	LogInfo("[Agent-%s] 任务内容: %s", w.config.Name, task.Content)
 
+	// 任务在被取走之前已经取消
+	if isTaskCancelled(w.ctx, w.redisClient, task.TaskID) {
+		LogInfo("[Agent-%s] ⏹ 任务已取消，跳过执行: %s", w.config.Name, task.TaskID)
+		w.reportCancelled(&task)
+		return nil
+	}
+
 	// 更新状态为 processing
 	task.Status = "processing"
+	setTaskStatus(w.ctx, w.redisClient, task.TaskID, TaskStatusRunning)
+
+	// 会话任务的增量输出实时发布给 API 服务器
+	var deltas *deltaPublisher
+	var onEvent StreamHandler
+	if task.SessionID != "" {
+		deltas = newDeltaPublisher(w.ctx, w.redisClient, &task)
+		onEvent = deltas.Publish
+	}
 
-	// 执行任务
+	// 执行任务（登记取消函数，收到取消信号或超时时终止 CLI 进程组）
+	timeout := resolveTaskTimeout(*w.config, &task)
+	taskCtx, cancelTask := context.WithTimeout(w.ctx, timeout)
+	w.trackRunning(task.TaskID, cancelTask)
+	w.startPresence(&task)
 	startTime := time.Now()
-	result, err := w.executeTask(&task)
+	result, err := w.executeTask(taskCtx, &task, onEvent)
 	duration := time.Since(startTime)
+	w.untrackRunning(task.TaskID)
+	w.finishPresence(task.TaskID)
+	cancelTask()
 
 	if err != nil {
+		// 已推送的草稿作废（重试时会重新推送）
+		if deltas != nil {
+			deltas.Publish(StreamEvent{Type: StreamEventDiscard})
+		}
+		// 被 API 取消（而不是工作进程退出）时不重试
+		if errors.Is(err, context.Canceled) && w.ctx.Err() == nil {
+			LogInfo("[Agent-%s] ⏹ 任务已取消: %s (耗时: %v)", w.config.Name, task.TaskID, duration)
+			w.reportCancelled(&task)
+			return nil
+		}
+		// 超时不重试（挂起的 CLI 重试大概率还会挂起），直接报告失败
+		if errors.Is(err, ErrCLITimeout) {
+			LogError("[Agent-%s] ⏱ 任务执行超时: %s (超时: %v)", w.config.Name, task.TaskID, timeout)
+			setTaskStatus(w.ctx, w.redisClient, task.TaskID, TaskStatusFailed)
+			w.reportFailed(&task, TaskFailTimeout, fmt.Sprintf("执行超时（%d 秒），CLI 进程已终止", int(timeout.Seconds())))
+			return nil
+		}
+		// 后端致命失败（未安装、额度用尽、认证失败）或全部熔断，重试无意义
+		if errors.Is(err, ErrBackendUnavailable) {
+			LogError("[Agent-%s] ❌ 没有可用的后端: %s (%v)", w.config.Name, task.TaskID, err)
+			setTaskStatus(w.ctx, w.redisClient, task.TaskID, TaskStatusFailed)
+			w.reportFailed(&task, TaskFailBackend, err.Error())
+			return nil
+		}
+		// 工作区开启了隔离但无法创建 worktree，重试同样会失败
+		if errors.Is(err, ErrWorktreeUnavailable) {
+			LogError("[Agent-%s] ❌ 无法创建隔离工作目录: %s (%v)", w.config.Name, task.TaskID, err)
+			setTaskStatus(w.ctx, w.redisClient, task.TaskID, TaskStatusFailed)
+			w.reportFailed(&task, TaskFailWorkspace, err.Error())
+			return nil
+		}
 		task.Status = "failed"
 		LogError("[Agent-%s] ❌ 任务执行失败: %v (耗时: %v)", w.config.Name, err, duration)
 		return err
 	}
 
 	task.Status = "completed"
+	setTaskStatus(w.ctx, w.redisClient, task.TaskID, TaskStatusCompleted)
 	LogInfo("[Agent-%s] ✓ 任务完成: %s (耗时: %v)", w.config.Name, task.TaskID, duration)
 	LogDebug("[Agent-%s] 任务结果: %s", w.config.Name, result)
 
@@ -192,27 +248,78 @@ func (w *AgentWorker) handleMessage(message redis.XMessage) error {
 		LogError("[Agent-%s] 发送结果失败: %v", w.config.Name, err)
 	}
 
-	// 解析输出中的 @标记，触发后续任务
-	if err := w.parseAndDispatchTasks(result, &task); err != nil {
-		LogWarn("[Agent-%s] 解析后续任务失败: %v", w.config.Name, err)
+	// 后续 @ 调用默认由编排器统一派发；只有显式选择 worker 路由的独立任务才在这里派发
+	if task.Routing == RoutingWorker {
+		if err := w.parseAndDispatchTasks(result, &task); err != nil {
+			LogWarn("[Agent-%s] 解析后续任务失败: %v", w.config.Name, err)
+		}
 	}
 
 	return nil
 }
 
+// listenForCancellations 订阅取消信号，终止本进程中正在执行的对应任务
+func (w *AgentWorker) listenForCancellations() {
+	sub := w.redisClient.Subscribe(w.ctx, taskCancelChannel)
+	defer sub.Close()
+
+	ch := sub.Channel()
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			w.runningMu.Lock()
+			cancel, exists := w.running[msg.Payload]
+			w.runningMu.Unlock()
+			if exists {
+				LogInfo("[Agent-%s] 收到取消信号，终止任务: %s", w.config.Name, msg.Payload)
+				cancel()
+			}
+		}
+	}
+}
+
+// trackRunning 登记正在执行的任务
+func (w *AgentWorker) trackRunning(taskID string, cancel context.CancelFunc) {
+	w.runningMu.Lock()
+	defer w.runningMu.Unlock()
+	w.running[taskID] = cancel
+}
+
+// untrackRunning 移除已结束的任务
+func (w *AgentWorker) untrackRunning(taskID string) {
+	w.runningMu.Lock()
+	defer w.runningMu.Unlock()
+	delete(w.running, taskID)
+}
+
 // executeTask 执行任务
-func (w *AgentWorker) executeTask(task *TaskMessage) (string, error) {
+// ctx 取消时终止 CLI 进程组并返回包装了 context.Canceled 的错误；onEvent 接收 CLI 的增量输出（可为 nil）
+func (w *AgentWorker) executeTask(ctx context.Context, task *TaskMessage, onEvent StreamHandler) (string, error) {
 	LogDebug("[Agent-%s] 开始执行任务: %s", w.config.Name, task.TaskID)
 	LogDebug("[Agent-%s] CLI 类型: %s, 上下文模式: %s", w.config.Name, w.config.CLIType, w.config.ContextMode)
 
-	// 查询工作区路径
+	// 查询工作区路径（开启隔离时在任务自己的 worktree 中执行）
 	var workDir string
 	if task.WorkspaceID != "" {
-		workspace, err := w.workspaceManager.GetWorkspace(task.WorkspaceID)
+		workspace, err := w.workspaceManager.ReloadWorkspace(task.WorkspaceID)
 		if err != nil {
 			LogWarn("[Agent-%s] 获取工作区失败: %v", w.config.Name, err)
 		} else {
 			workDir = workspace.Path
+			worktree, err := w.workspaceManager.PrepareWorktree(workspace, task)
+			if err != nil {
+				return "", err
+			}
+			if worktree != nil {
+				workDir = worktree.Path
+				task.Worktree = worktree
+				defer w.workspaceManager.FinishWorktree(worktree)
+			}
 			LogInfo("[Agent-%s] 工作目录: %s", w.config.Name, workDir)
 		}
 	}
@@ -220,21 +327,22 @@ func (w *AgentWorker) executeTask(task *TaskMessage) (string, error) {
 	// 根据 context_mode 构建 prompt 和获取 AI session ID
 	var fullPrompt string
 	var aiSessionID string
+	promptData := w.promptData(task, workDir)
 
 	switch w.config.ContextMode {
 	case "orchestrated":
 		// 策略 A：从 Session Chain 读取全部 Event，不使用 --resume
-		fullPrompt = w.buildOrchestratedPrompt(task)
+		fullPrompt = w.buildOrchestratedPrompt(task, promptData)
 		aiSessionID = ""
 
 	case "cli_managed":
 		// 策略 B：读取增量 Event + 使用 AI session ID
-		fullPrompt, aiSessionID = w.buildCLIManagedPrompt(task)
+		fullPrompt, aiSessionID = w.buildCLIManagedPrompt(task, promptData)
 
 	default:
 		// 兼容旧逻辑：回退到当前实现
 		chatHistory := w.getSessionHistory(task.SessionID)
-		fullPrompt = w.buildLegacyPrompt(chatHistory, task)
+		fullPrompt = w.buildLegacyPrompt(chatHistory, promptData)
 		// 从 Redis 获取 AI Session ID 映射（旧逻辑）
 		if task.SessionID != "" {
 			mappingKey := fmt.Sprintf("session_mapping:%s:%s", task.SessionID, w.config.Name)
@@ -243,26 +351,32 @@ func (w *AgentWorker) executeTask(task *TaskMessage) (string, error) {
 	}
 
 	// 调用 CLI（如果配置了 context_mode，注入 MCP 配置）
-	var response, newSessionID string
-	var invokeErr error
+	var mcpConfigPath string
 	if w.config.ContextMode != "" && task.SessionID != "" {
-		mcpConfigPath, mcpErr := GenerateMCPConfig(task.SessionID, "", w.config.Name, w.hindsightCfg)
+		path, mcpErr := GenerateMCPConfig(task.SessionID, "", w.config.Name, w.hindsightCfg)
 		if mcpErr != nil {
 			LogWarn("[Agent-%s] 生成 MCP 配置失败: %v（将不注入 MCP）", w.config.Name, mcpErr)
-			response, newSessionID, invokeErr = InvokeAgent(w.config.CLIType, fullPrompt, aiSessionID, workDir)
 		} else {
-			LogDebug("[Agent-%s] MCP 配置已生成: %s", w.config.Name, mcpConfigPath)
-			response, newSessionID, invokeErr = InvokeAgentWithMCP(w.config.CLIType, fullPrompt, aiSessionID, workDir, mcpConfigPath)
+			LogDebug("[Agent-%s] MCP 配置已生成: %s", w.config.Name, path)
+			mcpConfigPath = path
 		}
-	} else {
-		response, newSessionID, invokeErr = InvokeAgent(w.config.CLIType, fullPrompt, aiSessionID, workDir)
 	}
+	startedAt := time.Now()
+	invocation, invokeErr := w.invokeBackends(ctx, task, fullPrompt, AgentOptions{
+		SessionID:     aiSessionID,
+		WorkDir:       workDir,
+		MCPConfigPath: mcpConfigPath,
+		OnEvent:       onEvent,
+	}, promptData)
 	if invokeErr != nil {
-		LogError("[Agent-%s] 调用 CLI 失败: %v", w.config.Name, invokeErr)
-		return "", fmt.Errorf("调用 %s CLI 失败: %w", w.config.CLIType, invokeErr)
+		return "", invokeErr
 	}
+	result, usage := invocation.result, invocation.usage
+	fullPrompt = invocation.prompt
+	response, newSessionID := result.Response, result.SessionID
 
-	LogDebug("[Agent-%s] CLI 返回 - response长度: %d, newSessionID: %s", w.config.Name, len(response), newSessionID)
+	LogDebug("[Agent-%s] CLI 返回 - response长度: %d, newSessionID: %s, tokens: %d/%d, cost: $%.4f",
+		w.config.Name, len(response), newSessionID, usage.TokensIn, usage.TokensOut, usage.CostUSD)
 
 	// 后处理：根据 context_mode 执行不同的持久化逻辑
 	if w.config.ContextMode != "" && w.chainManager != nil && task.SessionID != "" {
@@ -271,9 +385,15 @@ func (w *AgentWorker) executeTask(task *TaskMessage) (string, error) {
 		// 确保 chain 存在
 		w.chainManager.GetOrCreateChain(threadID)
 
-		// 记录 Invocation
+		// 记录 Invocation（以任务 ID 命名，便于从消息查到本次调用；重试时带上重试次数，不覆盖之前的记录）
+		invocationID := task.TaskID
+		if invocationID == "" {
+			invocationID = generateTaskID()
+		} else if task.RetryCount > 0 {
+			invocationID = fmt.Sprintf("%s_retry%d", task.TaskID, task.RetryCount)
+		}
 		inv := InvocationRecord{
-			ID:        generateTaskID(),
+			ID:        invocationID,
 			SessionID: func() string {
 				s, _ := w.chainManager.GetActiveSession(threadID)
 				if s != nil {
@@ -283,8 +403,18 @@ func (w *AgentWorker) executeTask(task *TaskMessage) (string, error) {
 			}(),
 			ThreadID:  threadID,
 			AgentName: w.config.Name,
-			Prompt:    fullPrompt,
-			Response:  response,
+			Prompt:          fullPrompt,
+			Response:        response,
+			AISessionID:     newSessionID,
+			Model:           usage.Model,
+			TokensIn:        usage.TokensIn,
+			TokensOut:       usage.TokensOut,
+			CacheReadTokens: usage.CacheReadTokens,
+			CostUSD:         usage.CostUSD,
+			UsageEstimated:  usage.Estimated,
+			Duration:        usage.DurationMs,
+			Timestamp:       startedAt,
+			ToolCalls:       result.ToolCalls,
 		}
 		w.chainManager.RecordInvocation(threadID, inv)
 
@@ -295,8 +425,8 @@ func (w *AgentWorker) executeTask(task *TaskMessage) (string, error) {
 			w.chainManager.CheckAndSeal(threadID, w.config.SessionChainCfg)
 		}
 
-		// 更新 Cursor（仅 cli_managed 模式）
-		if w.config.ContextMode == "cli_managed" {
+		// 更新 Cursor（仅 cli_managed 模式；备用后端的 AI 会话无法由主后端续接）
+		if w.config.ContextMode == "cli_managed" && invocation.primary {
 			activeSession, err := w.chainManager.GetActiveSession(threadID)
 			if err == nil {
 				w.chainManager.UpdateCursor(
@@ -306,7 +436,7 @@ func (w *AgentWorker) executeTask(task *TaskMessage) (string, error) {
 		}
 	} else {
 		// 旧逻辑：保存 AI Session ID 映射到 Redis
-		if newSessionID != "" && newSessionID != aiSessionID && task.SessionID != "" {
+		if invocation.primary && newSessionID != "" && newSessionID != aiSessionID && task.SessionID != "" {
 			mappingKey := fmt.Sprintf("session_mapping:%s:%s", task.SessionID, w.config.Name)
 			if err := w.redisClient.Set(w.ctx, mappingKey, newSessionID, 0).Err(); err != nil {
 				LogWarn("[Agent-%s] 保存 AI Session ID 映射失败: %v", w.config.Name, err)
@@ -319,6 +449,16 @@ func (w *AgentWorker) executeTask(task *TaskMessage) (string, error) {
 	return response, nil
 }
 
+// recordUsage 将调用用量累加到会话统计
+func (w *AgentWorker) recordUsage(task *TaskMessage, usage InvocationUsage) {
+	if task.SessionID == "" {
+		return
+	}
+	if err := recordUsage(w.ctx, w.redisClient, task.SessionID, w.config.Name, usage); err != nil {
+		LogWarn("[Agent-%s] 记录用量失败: %v", w.config.Name, err)
+	}
+}
+
 // getSessionHistory 从 Session Chain 获取会话历史消息并格式化
 func (w *AgentWorker) getSessionHistory(sessionID string) string {
 	if sessionID == "" || w.chainManager == nil {
@@ -355,6 +495,8 @@ func (w *AgentWorker) getSessionHistory(sessionID string) string {
 				content = content[:maxContentLen] + "...(已截断)"
 			}
 			history.WriteString(fmt.Sprintf("[%s] %s\n", ev.Sender, content))
+		case SCEventOwnerRequest:
+			history.WriteString(fmt.Sprintf("[%s→铲屎官] %s\n", ev.Sender, content))
 		}
 	}
 
@@ -374,6 +516,37 @@ func (w *AgentWorker) sendResult(task *TaskMessage, result string) error {
 	task.Result = result
 	task.Status = "completed"
 
+	return w.publishResult(task)
+}
+
+// reportCancelled 向结果队列报告任务已取消（编排器据此结束对应的子任务）
+func (w *AgentWorker) reportCancelled(task *TaskMessage) {
+	task.Result = ""
+	task.Status = TaskStatusCancelled
+	if task.SessionID == "" {
+		return
+	}
+	if err := w.publishResult(task); err != nil {
+		LogError("[Agent-%s] 报告任务取消失败: %v", w.config.Name, err)
+	}
+}
+
+// reportFailed 向结果队列报告任务失败（编排器据此结束对应的子任务并通知会话）
+func (w *AgentWorker) reportFailed(task *TaskMessage, reason string, message string) {
+	task.Result = ""
+	task.Status = TaskStatusFailed
+	task.FailReason = reason
+	task.Error = message
+	if task.SessionID == "" {
+		return
+	}
+	if err := w.publishResult(task); err != nil {
+		LogError("[Agent-%s] 报告任务失败结果失败: %v", w.config.Name, err)
+	}
+}
+
+// publishResult 将任务写入结果队列
+func (w *AgentWorker) publishResult(task *TaskMessage) error {
 	// 序列化任务
 	taskJSON, err := json.Marshal(task)
 	if err != nil {
@@ -398,6 +571,7 @@ func (w *AgentWorker) sendResult(task *TaskMessage, result string) error {
 }
 
 // parseAndDispatchTasks 解析输出中的 @标记并分发任务
+// 仅用于 routing=worker 的独立任务，派发出的任务沿用同一路由策略
 func (w *AgentWorker) parseAndDispatchTasks(output string, currentTask *TaskMessage) error {
 	lines := strings.Split(output, "\n")
 
@@ -427,16 +601,23 @@ func (w *AgentWorker) parseAndDispatchTasks(output string, currentTask *TaskMess
 			continue
 		}
 
-		// 特殊处理 @铲屎官
-		if targetAgent == "铲屎官" {
+		// 沿调用链计数，超过默认跳数上限时不再继续派发
+		chain := currentTask.Chain.Extend(targetAgent)
+		if DefaultLoopLimits.MaxHops > 0 && chain.Hop > DefaultLoopLimits.MaxHops {
+			LogWarn("[Agent-%s] 调用链超过最大跳数 %d，跳过调用 %s - Path: %s",
+				w.config.Name, DefaultLoopLimits.MaxHops, targetAgent, chain)
+			continue
+		}
+
+		// 特殊处理 @铲屎官（独立运行时没有会话可挂起，只打印提示；会话内由编排器登记提问）
+		if targetAgent == OwnerName {
 			fmt.Printf("📢 %s 完成工作，等待用户输入\n", w.config.Name)
 			fmt.Printf("   消息: %s\n", taskContent)
-			// 留给后续扩展
 			continue
 		}
 
 		// 发送任务到其他 Agent，传递 SessionID
-		if err := w.sendTaskToAgent(targetAgent, taskContent, currentTask.SessionID); err != nil {
+		if err := w.sendTaskToAgent(targetAgent, taskContent, currentTask.SessionID, chain); err != nil {
 			fmt.Fprintf(os.Stderr, "⚠️  发送任务到 %s 失败: %v\n", targetAgent, err)
 			continue
 		}
@@ -451,20 +632,22 @@ func (w *AgentWorker) parseAndDispatchTasks(output string, currentTask *TaskMess
 	return nil
 }
 
+// SetPeers 设置配置文件中的猫猫，API 服务器未运行（Redis 中没有猫猫注册表）时据此查找管道
+func (w *AgentWorker) SetPeers(agents []AgentConfig) {
+	w.peers = agents
+}
+
+// SetBudgets 设置用量预算，worker 路由派发后续任务时与编排器使用同一套检查
+func (w *AgentWorker) SetBudgets(budgets *BudgetConfig) {
+	w.budgets = budgets
+}
+
 // sendTaskToAgent 发送任务到指定 Agent
-func (w *AgentWorker) sendTaskToAgent(agentName, taskContent, sessionID string) error {
-	// 查询 Agent 配置
-	configKey := "config:agents"
-	agentsData, err := w.redisClient.Get(w.ctx, configKey).Result()
+func (w *AgentWorker) sendTaskToAgent(agentName, taskContent, sessionID string, chain *CallChain) error {
+	// 查询猫猫注册表（API 服务器同步到 Redis），没有时使用配置文件中的猫猫
+	agents, err := loadRegisteredAgents(w.ctx, w.redisClient)
 	if err != nil {
-		// 如果 Redis 中没有配置，尝试从本地加载
-		return w.sendTaskByPipeName(agentName, taskContent, sessionID)
-	}
-
-	// 解析配置
-	var agents []AgentConfig
-	if err := json.Unmarshal([]byte(agentsData), &agents); err != nil {
-		return w.sendTaskByPipeName(agentName, taskContent, sessionID)
+		agents = w.peers
 	}
 
 	// 查找目标 Agent
@@ -490,49 +673,20 @@ func (w *AgentWorker) sendTaskToAgent(agentName, taskContent, sessionID string)
 		CreatedAt:  time.Now(),
 		RetryCount: 0,
 		MaxRetries: 3,
+		Chain:      chain,
+		Routing:    RoutingWorker,
 	}
 
-	// 发送到 Redis
-	taskData, err := json.Marshal(task)
-	if err != nil {
-		return fmt.Errorf("序列化任务失败: %w", err)
-	}
-
-	streamKey := fmt.Sprintf("pipe:%s", targetPipe)
-	_, err = w.redisClient.XAdd(w.ctx, &redis.XAddArgs{
-		Stream: streamKey,
-		Values: map[string]interface{}{
-			"task": string(taskData),
-		},
-	}).Result()
-
-	return err
-}
-
-// sendTaskByPipeName 通过管道名发送任务（备用方法）
-func (w *AgentWorker) sendTaskByPipeName(agentName, taskContent, sessionID string) error {
-	// 简单映射：Agent名 -> 管道名
-	pipeMap := map[string]string{
-		"花花": "pipe_huahua",
-		"薇薇": "pipe_weiwei",
-		"小乔": "pipe_xiaoqiao",
-	}
-
-	targetPipe, exists := pipeMap[agentName]
-	if !exists {
-		return fmt.Errorf("未知的 Agent: %s", agentName)
-	}
-
-	// 创建任务
-	task := TaskMessage{
-		TaskID:     generateTaskID(),
-		AgentName:  agentName,
-		Content:    taskContent,
-		SessionID:  sessionID,
-		Status:     "pending",
-		CreatedAt:  time.Now(),
-		RetryCount: 0,
-		MaxRetries: 3,
+	// 预算已用尽：与编排器派发相同，按配置排队（需要会话）或不再派发
+	if status := findExceededBudget(w.ctx, w.redisClient, w.budgets, sessionID, agentName); status != nil {
+		if w.budgets.onExceed() == BudgetOnExceedQueue && sessionID != "" {
+			if err := enqueueBudgetTask(w.ctx, w.redisClient, task); err != nil {
+				return fmt.Errorf("任务排队失败: %w", err)
+			}
+			LogWarn("[Agent-%s] 💸 %s已用尽（%s），%s 的任务已排队", w.config.Name, status.Describe(), status.usageSummary(), agentName)
+			return nil
+		}
+		return fmt.Errorf("%s已用尽（%s），不再派发", status.Describe(), status.usageSummary())
 	}
 
 	// 发送到 Redis
@@ -557,39 +711,33 @@ func generateTaskID() string {
 	return fmt.Sprintf("task_%d", time.Now().UnixNano())
 }
 
-// retryMessage 重试消息
-func (w *AgentWorker) retryMessage(message redis.XMessage) {
+// retryMessage 准备重试消息：返回重试次数加一后的消息（消息 ID 不变，仍未确认）
+// 重试次数用尽时向结果队列报告失败并确认消息，返回 false（cause 为最后一次的错误）
+func (w *AgentWorker) retryMessage(message redis.XMessage, cause error) (redis.XMessage, bool) {
 	taskData, ok := message.Values["task"].(string)
 	if !ok {
-		return
+		return message, false
 	}
 
 	var task TaskMessage
 	if err := json.Unmarshal([]byte(taskData), &task); err != nil {
-		return
+		return message, false
 	}
 
 	task.RetryCount++
 
 	if task.RetryCount >= task.MaxRetries {
 		fmt.Fprintf(os.Stderr, "❌ 任务 %s 重试次数已达上限，放弃\n", task.TaskID)
+		setTaskStatus(w.ctx, w.redisClient, task.TaskID, TaskStatusFailed)
+		w.reportFailed(&task, TaskFailError, cause.Error())
 		w.redisClient.XAck(w.ctx, w.streamKey, w.consumerGroup, message.ID)
-		return
+		return message, false
 	}
 
 	fmt.Printf("🔄 重试任务 %s (第 %d 次)\n", task.TaskID, task.RetryCount)
 
-	// 重新发送任务
 	retryTaskData, _ := json.Marshal(task)
-	w.redisClient.XAdd(w.ctx, &redis.XAddArgs{
-		Stream: w.streamKey,
-		Values: map[string]interface{}{
-			"task": string(retryTaskData),
-		},
-	})
-
-	// 确认原消息
-	w.redisClient.XAck(w.ctx, w.streamKey, w.consumerGroup, message.ID)
+	return redis.XMessage{ID: message.ID, Values: map[string]interface{}{"task": string(retryTaskData)}}, true
 }
 
 // Stop 停止 Agent
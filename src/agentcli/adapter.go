@@ -0,0 +1,254 @@
+// Package agentcli 调用 Agent CLI（claude / codex / gemini / opencode）和模型 HTTP 接口
+// 每种后端由一个 Adapter 负责构建命令行参数和解析流式输出
+package agentcli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DirectAdapter 可选接口：不启动子进程、在进程内直接完成调用的后端（如 HTTP 模型接口）
+// 实现该接口的适配器由 Invoke 直接调用 Invoke，BuildCommand / StdinPrompt 不会被使用
+type DirectAdapter interface {
+	Invoke(ctx context.Context, prompt string, options Options) (*Result, error)
+}
+
+// Adapter 一种 Agent CLI 的适配器
+// 新增后端只需实现该接口并在 newBuiltinRegistry 中注册，不需要修改调用流程
+type Adapter interface {
+	// DefaultOptions Agent 调用时使用的默认选项
+	DefaultOptions() Options
+
+	// BuildCommand 构建可执行文件名和命令行参数，options.ExtraArgs 需放在位置参数之前
+	BuildCommand(prompt string, options Options) (string, []string)
+
+	// StdinPrompt 需要通过 stdin 写入的内容；prompt 已放在参数中时返回 false
+	StdinPrompt(prompt string) (string, bool)
+
+	// ParseLine 解析一行 stdout 输出，state 在同一次调用的各行之间共享
+	ParseLine(line string, state *ParseState) ParsedLine
+}
+
+// ParseState 同一次 CLI 调用中跨行共享的解析状态
+type ParseState struct {
+	// ToolNames 工具调用 ID -> 工具名称（部分 CLI 的结束事件不带工具名称）
+	ToolNames map[string]string
+}
+
+// NewParseState 创建解析状态
+func NewParseState() *ParseState {
+	return &ParseState{ToolNames: make(map[string]string)}
+}
+
+// toolIOText 将 CLI 输出中的工具参数/结果转为文本：
+// JSON 字符串取其内容，[{type:text,text}] 形式的内容块拼接文本，其余保留原始 JSON
+func toolIOText(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var blocks []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if json.Unmarshal(raw, &blocks) == nil {
+		var texts []string
+		for _, block := range blocks {
+			if block.Type == "text" {
+				texts = append(texts, block.Text)
+			}
+		}
+		if len(texts) > 0 {
+			return strings.Join(texts, "\n")
+		}
+	}
+	var compact bytes.Buffer
+	if json.Compact(&compact, raw) == nil {
+		return compact.String()
+	}
+	return string(raw)
+}
+
+// ParsedLine 一行输出的解析结果
+type ParsedLine struct {
+	SessionID string        // 非空时更新 CLI 会话 ID
+	Model     string        // 非空时记录 CLI 实际使用的模型（用于计价）
+	Events    []StreamEvent // 文本增量与工具调用事件，文本按顺序拼接为最终回复
+	Usage     *Usage        // 本行报告的用量（同一次调用中多次报告时累加）
+	Error     string        // 非空时表示输出流中报告了错误，本次调用视为失败
+}
+
+// Usage CLI 报告的用量
+type Usage struct {
+	InputTokens     int     `json:"input_tokens"`
+	OutputTokens    int     `json:"output_tokens"`
+	CacheReadTokens int     `json:"cache_read_tokens,omitempty"`
+	CostUSD         float64 `json:"cost_usd,omitempty"` // CLI 自己报告的费用（没有时由价格表估算）
+}
+
+// Add 累加用量（接收者为 nil 时返回 other 的副本）
+func (u *Usage) Add(other *Usage) *Usage {
+	sum := Usage{}
+	if u != nil {
+		sum = *u
+	}
+	if other != nil {
+		sum.InputTokens += other.InputTokens
+		sum.OutputTokens += other.OutputTokens
+		sum.CacheReadTokens += other.CacheReadTokens
+		sum.CostUSD += other.CostUSD
+	}
+	return &sum
+}
+
+// Registry CLI 适配器注册表，按 cli_type 索引
+type Registry struct {
+	mu       sync.RWMutex
+	adapters map[string]Adapter
+}
+
+// NewRegistry 创建空的适配器注册表
+func NewRegistry() *Registry {
+	return &Registry{adapters: make(map[string]Adapter)}
+}
+
+// Register 注册适配器
+func (r *Registry) Register(cliType string, adapter Adapter) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.adapters[cliType]; exists {
+		return fmt.Errorf("CLI 适配器 %s 已注册", cliType)
+	}
+	r.adapters[cliType] = adapter
+	return nil
+}
+
+// Get 获取适配器
+func (r *Registry) Get(cliType string) (Adapter, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	adapter, exists := r.adapters[cliType]
+	if !exists {
+		return nil, fmt.Errorf("不支持的 CLI 工具: %s", cliType)
+	}
+	return adapter, nil
+}
+
+// List 列出已注册的 cli_type
+func (r *Registry) List() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	types := make([]string, 0, len(r.adapters))
+	for cliType := range r.adapters {
+		types = append(types, cliType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// adapters 内置 CLI 适配器
+var adapters = newBuiltinRegistry()
+
+// newBuiltinRegistry 注册内置的 CLI 适配器
+func newBuiltinRegistry() *Registry {
+	r := NewRegistry()
+	r.Register("claude", ClaudeAdapter{})
+	r.Register("gemini", GeminiAdapter{})
+	r.Register("codex", CodexAdapter{})
+	r.Register("opencode", OpenCodeAdapter{})
+	r.Register("http", HTTPAdapter{})
+	return r
+}
+
+// Get 获取 cli_type 对应的适配器
+func Get(cliType string) (Adapter, error) {
+	return adapters.Get(cliType)
+}
+
+// Register 注册额外的 CLI 适配器
+func Register(cliType string, adapter Adapter) error {
+	return adapters.Register(cliType, adapter)
+}
+
+// Types 列出支持的 cli_type
+func Types() []string {
+	return adapters.List()
+}
+
+// DefaultOptions 返回指定 CLI 类型的默认选项（未注册的类型返回空选项）
+func DefaultOptions(cliType string) Options {
+	adapter, err := Get(cliType)
+	if err != nil {
+		return Options{}
+	}
+	return adapter.DefaultOptions()
+}
+
+// MergeOptions 用 overrides 中的非空字段覆盖 base
+func MergeOptions(base, overrides Options) Options {
+	merged := base
+	if overrides.Model != "" {
+		merged.Model = overrides.Model
+	}
+	if overrides.AllowedTools != "" {
+		merged.AllowedTools = overrides.AllowedTools
+	}
+	if overrides.DisallowedTools != "" {
+		merged.DisallowedTools = overrides.DisallowedTools
+	}
+	if overrides.PermissionMode != "" {
+		merged.PermissionMode = overrides.PermissionMode
+	}
+	if overrides.ApprovalMode != "" {
+		merged.ApprovalMode = overrides.ApprovalMode
+	}
+	if overrides.SessionID != "" {
+		merged.SessionID = overrides.SessionID
+	}
+	if overrides.WorkDir != "" {
+		merged.WorkDir = overrides.WorkDir
+	}
+	if overrides.MCPConfigPath != "" {
+		merged.MCPConfigPath = overrides.MCPConfigPath
+	}
+	if overrides.BaseURL != "" {
+		merged.BaseURL = overrides.BaseURL
+	}
+	if overrides.APIKeyEnv != "" {
+		merged.APIKeyEnv = overrides.APIKeyEnv
+	}
+	if overrides.APIFormat != "" {
+		merged.APIFormat = overrides.APIFormat
+	}
+	if overrides.MaxTokens > 0 {
+		merged.MaxTokens = overrides.MaxTokens
+	}
+	if len(overrides.ExtraArgs) > 0 {
+		merged.ExtraArgs = overrides.ExtraArgs
+	}
+	if len(overrides.Env) > 0 {
+		env := make(map[string]string, len(base.Env)+len(overrides.Env))
+		for name, value := range base.Env {
+			env[name] = value
+		}
+		for name, value := range overrides.Env {
+			env[name] = value
+		}
+		merged.Env = env
+	}
+	if overrides.OnEvent != nil {
+		merged.OnEvent = overrides.OnEvent
+	}
+	return merged
+}
@@ -0,0 +1,119 @@
+package agentcli
+
+import "encoding/json"
+
+// ClaudeAdapter Claude Code CLI（claude -p --output-format stream-json）
+type ClaudeAdapter struct{}
+
+// DefaultOptions 只放行 MCP 工具白名单，权限模式使用 CLI 自身的默认值（未放行的操作被拒绝）
+// 需要无人值守执行时在 config.yaml 中配置 permission_mode: bypassPermissions
+func (ClaudeAdapter) DefaultOptions() Options {
+	return Options{
+		AllowedTools: "mcp__hindsight__*,mcp__session-chain__*,mcp__github__*,mcp__figma__*,mcp__ide__*",
+	}
+}
+
+func (ClaudeAdapter) BuildCommand(prompt string, options Options) (string, []string) {
+	args := []string{"-p", prompt, "--output-format", "stream-json", "--verbose"}
+	if options.Model != "" {
+		args = append(args, "--model", options.Model)
+	}
+	if options.SessionID != "" {
+		args = append(args, "--resume", options.SessionID)
+	}
+	if options.AllowedTools != "" {
+		args = append(args, "--allowedTools", options.AllowedTools)
+	}
+	if options.DisallowedTools != "" {
+		args = append(args, "--disallowedTools", options.DisallowedTools)
+	}
+	if options.PermissionMode != "" {
+		args = append(args, "--permission-mode", options.PermissionMode)
+	}
+	if options.MCPConfigPath != "" {
+		args = append(args, "--mcp-config", options.MCPConfigPath)
+	}
+	return "claude", append(args, options.ExtraArgs...)
+}
+
+func (ClaudeAdapter) StdinPrompt(prompt string) (string, bool) {
+	return "", false
+}
+
+func (ClaudeAdapter) ParseLine(line string, state *ParseState) ParsedLine {
+	var event struct {
+		Type      string `json:"type"`
+		Subtype   string `json:"subtype,omitempty"`
+		SessionID string `json:"session_id,omitempty"`
+		Model     string `json:"model,omitempty"`
+		Message   struct {
+			Content []struct {
+				Type      string          `json:"type"`
+				Text      string          `json:"text"`
+				ID        string          `json:"id,omitempty"`
+				Name      string          `json:"name,omitempty"`
+				Input     json.RawMessage `json:"input,omitempty"`
+				ToolUseID string          `json:"tool_use_id,omitempty"`
+				Content   json.RawMessage `json:"content,omitempty"` // tool_result 的内容：字符串或内容块数组
+				IsError   bool            `json:"is_error,omitempty"`
+			} `json:"content"`
+		} `json:"message,omitempty"`
+		IsError      bool    `json:"is_error,omitempty"`
+		Result       string  `json:"result,omitempty"`
+		TotalCostUSD float64 `json:"total_cost_usd,omitempty"`
+		Usage        *struct {
+			InputTokens              int `json:"input_tokens"`
+			CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+			CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+			OutputTokens             int `json:"output_tokens"`
+		} `json:"usage,omitempty"`
+	}
+
+	var parsed ParsedLine
+	if err := json.Unmarshal([]byte(line), &event); err != nil {
+		return parsed
+	}
+
+	switch event.Type {
+	case "system":
+		if event.Subtype == "init" {
+			parsed.SessionID = event.SessionID
+			parsed.Model = event.Model
+		}
+	case "assistant":
+		for _, block := range event.Message.Content {
+			switch block.Type {
+			case "text":
+				parsed.Events = append(parsed.Events, StreamEvent{Type: StreamEventText, Text: block.Text})
+			case "tool_use":
+				state.ToolNames[block.ID] = block.Name
+				parsed.Events = append(parsed.Events, StreamEvent{Type: StreamEventToolStart, Tool: block.Name, ToolID: block.ID, Input: toolIOText(block.Input)})
+			}
+		}
+	case "user":
+		// 工具结果以 user 消息的形式回传
+		for _, block := range event.Message.Content {
+			if block.Type == "tool_result" {
+				parsed.Events = append(parsed.Events, StreamEvent{Type: StreamEventToolEnd, Tool: state.ToolNames[block.ToolUseID], ToolID: block.ToolUseID, IsError: block.IsError, Output: toolIOText(block.Content)})
+			}
+		}
+	case "result":
+		// 失败的调用同样以 result 结束，is_error 为 true，result 为错误内容（如 Credit balance is too low）
+		if event.IsError {
+			parsed.Error = event.Result
+			if parsed.Error == "" {
+				parsed.Error = event.Subtype
+			}
+		}
+		// 最终结果汇总整次调用的用量和费用
+		if event.Usage != nil {
+			parsed.Usage = &Usage{
+				InputTokens:     event.Usage.InputTokens + event.Usage.CacheCreationInputTokens,
+				OutputTokens:    event.Usage.OutputTokens,
+				CacheReadTokens: event.Usage.CacheReadInputTokens,
+				CostUSD:         event.TotalCostUSD,
+			}
+		}
+	}
+	return parsed
+}
@@ -0,0 +1,111 @@
+package agentcli
+
+import "encoding/json"
+
+// CodexAdapter Codex CLI（codex exec --json），prompt 通过 stdin 传递避免参数解析问题
+type CodexAdapter struct{}
+
+// DefaultOptions 权限由 BuildCommand 中的 --full-auto 控制
+func (CodexAdapter) DefaultOptions() Options {
+	return Options{}
+}
+
+func (CodexAdapter) BuildCommand(prompt string, options Options) (string, []string) {
+	if options.SessionID != "" {
+		args := append([]string{"exec", "resume", "--json", "--skip-git-repo-check"}, options.ExtraArgs...)
+		return "codex", append(args, options.SessionID, "-")
+	}
+	args := []string{"exec", "--json", "--full-auto", "--skip-git-repo-check"}
+	if options.Model != "" {
+		args = append(args, "--model", options.Model)
+	}
+	args = append(args, options.ExtraArgs...)
+	return "codex", append(args, "-")
+}
+
+func (CodexAdapter) StdinPrompt(prompt string) (string, bool) {
+	return prompt, true
+}
+
+func (CodexAdapter) ParseLine(line string, state *ParseState) ParsedLine {
+	var event struct {
+		Type      string `json:"type"`
+		ThreadID  string `json:"thread_id,omitempty"`
+		SessionID string `json:"session_id,omitempty"`
+		Error     *struct {
+			Message string `json:"message"`
+		} `json:"error,omitempty"` // turn.failed 事件的错误（中途的 error 事件可能只是重连提示，不作为失败）
+		Item struct {
+			ID               string          `json:"id"`
+			Type             string          `json:"type"`
+			Text             string          `json:"text"`
+			Command          string          `json:"command,omitempty"`
+			AggregatedOutput string          `json:"aggregated_output,omitempty"`
+			Server           string          `json:"server,omitempty"`
+			Tool             string          `json:"tool,omitempty"`
+			Arguments        json.RawMessage `json:"arguments,omitempty"`
+			Result           json.RawMessage `json:"result,omitempty"`
+			Error            *struct {
+				Message string `json:"message"`
+			} `json:"error,omitempty"`
+			Status string `json:"status,omitempty"`
+		} `json:"item,omitempty"`
+		Usage *struct {
+			InputTokens       int `json:"input_tokens"`
+			CachedInputTokens int `json:"cached_input_tokens"`
+			OutputTokens      int `json:"output_tokens"`
+		} `json:"usage,omitempty"`
+	}
+
+	var parsed ParsedLine
+	if err := json.Unmarshal([]byte(line), &event); err != nil {
+		return parsed
+	}
+
+	// 命令执行和 MCP 调用都视为工具调用
+	toolName, toolInput, toolOutput := "", "", ""
+	switch event.Item.Type {
+	case "command_execution":
+		toolName = event.Item.Command
+		toolInput = event.Item.Command
+		toolOutput = event.Item.AggregatedOutput
+	case "mcp_tool_call":
+		toolName = event.Item.Server + "." + event.Item.Tool
+		toolInput = toolIOText(event.Item.Arguments)
+		toolOutput = toolIOText(event.Item.Result)
+		if event.Item.Error != nil && event.Item.Error.Message != "" {
+			toolOutput = event.Item.Error.Message
+		}
+	}
+
+	switch event.Type {
+	case "thread.started":
+		parsed.SessionID = event.ThreadID
+	case "session_start":
+		parsed.SessionID = event.SessionID
+	case "item.started":
+		if toolName != "" {
+			parsed.Events = append(parsed.Events, StreamEvent{Type: StreamEventToolStart, Tool: toolName, ToolID: event.Item.ID, Input: toolInput})
+		}
+	case "item.completed":
+		if event.Item.Type == "agent_message" && event.Item.Text != "" {
+			parsed.Events = append(parsed.Events, StreamEvent{Type: StreamEventText, Text: event.Item.Text})
+		} else if toolName != "" {
+			parsed.Events = append(parsed.Events, StreamEvent{Type: StreamEventToolEnd, Tool: toolName, ToolID: event.Item.ID, IsError: event.Item.Status == "failed", Input: toolInput, Output: toolOutput})
+		}
+	case "turn.failed":
+		if event.Error != nil {
+			parsed.Error = event.Error.Message
+		}
+	case "turn.completed":
+		// input_tokens 已包含缓存命中的部分
+		if event.Usage != nil {
+			parsed.Usage = &Usage{
+				InputTokens:     event.Usage.InputTokens - event.Usage.CachedInputTokens,
+				OutputTokens:    event.Usage.OutputTokens,
+				CacheReadTokens: event.Usage.CachedInputTokens,
+			}
+		}
+	}
+	return parsed
+}
@@ -0,0 +1,84 @@
+package agentcli
+
+import (
+	"errors"
+	"os/exec"
+	"regexp"
+	"strconv"
+)
+
+// ErrConfig 后端配置不完整（如缺少 model、API Key 环境变量未设置），重试无意义
+var ErrConfig = errors.New("后端配置错误")
+
+// BackendError 后端自己报告的错误：模型接口的 HTTP 状态和错误内容，或 CLI 输出流中的结果/错误事件
+// 失败分类只看这里的内容，不看 CLI 的 stderr（其中可能混有工具输出、文件名和行号等无关内容）
+type BackendError struct {
+	Source     string // 错误来源，如「模型接口返回 429」「命令 claude 报告错误」
+	StatusCode int    // 模型接口的 HTTP 状态码，CLI 输出流中的错误为 0
+	Message    string // 后端返回的错误内容
+}
+
+func (e *BackendError) Error() string {
+	return e.Source + ": " + e.Message
+}
+
+// 失败类型
+const (
+	FailureTransient = "transient" // 网络抖动、限流、超时等，稍后重试可能成功
+	FailureFatal     = "fatal"     // CLI 未安装、额度用尽、认证失败等，重试无意义，直接熔断
+)
+
+// failurePattern 按后端错误内容中的关键词识别失败原因
+type failurePattern struct {
+	class   string
+	reason  string
+	pattern *regexp.Regexp
+}
+
+// failurePatterns 按顺序匹配后端错误内容，未匹配的失败视为临时错误
+// 额度错误常以 429 返回（如 insufficient_quota），必须排在限流之前
+var failurePatterns = []failurePattern{
+	{FailureFatal, "额度已用尽", regexp.MustCompile(`(?i)insufficient_quota|exceeded your current quota|quota exceeded for (quota )?metric|credit balance is too low|billing_hard_limit|usage limit reached`)},
+	{FailureFatal, "认证失败", regexp.MustCompile(`(?i)invalid[ _-]?api[ _-]?key|authentication_error|authentication failed|not logged in|please run /login`)},
+	{FailureTransient, "请求受限", regexp.MustCompile(`(?i)rate[ _-]?limit|too many requests|overloaded`)},
+}
+
+// apiStatusPattern CLI 转述的接口错误中的 HTTP 状态码，如「API Error: 529 Overloaded」
+var apiStatusPattern = regexp.MustCompile(`(?i)\bAPI Error:?\s*(\d{3})\b`)
+
+// ClassifyError 判断后端调用失败是临时的还是致命的，并给出简短原因
+// 只识别 CLI 未安装、配置错误和 BackendError，其余失败（包括只在 stderr 中出现的错误）视为临时错误
+func ClassifyError(err error) (string, string) {
+	if errors.Is(err, exec.ErrNotFound) {
+		return FailureFatal, "CLI 未安装"
+	}
+	if errors.Is(err, ErrConfig) {
+		return FailureFatal, "配置错误"
+	}
+	var backendErr *BackendError
+	if !errors.As(err, &backendErr) {
+		return FailureTransient, "调用失败"
+	}
+
+	for _, p := range failurePatterns {
+		if p.pattern.MatchString(backendErr.Message) {
+			return p.class, p.reason
+		}
+	}
+
+	status := backendErr.StatusCode
+	if status == 0 {
+		if m := apiStatusPattern.FindStringSubmatch(backendErr.Message); m != nil {
+			status, _ = strconv.Atoi(m[1])
+		}
+	}
+	switch status {
+	case 401, 403:
+		return FailureFatal, "认证失败"
+	case 402:
+		return FailureFatal, "额度已用尽"
+	case 429, 529:
+		return FailureTransient, "请求受限"
+	}
+	return FailureTransient, "调用失败"
+}
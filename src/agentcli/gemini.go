@@ -0,0 +1,98 @@
+package agentcli
+
+import "encoding/json"
+
+// GeminiAdapter Gemini CLI（gemini -p --output-format stream-json）
+type GeminiAdapter struct{}
+
+// DefaultOptions 只放行 MCP 工具白名单，审批模式使用 CLI 自身的默认值
+// 需要无人值守执行时在 config.yaml 中配置 approval_mode: yolo
+func (GeminiAdapter) DefaultOptions() Options {
+	return Options{
+		AllowedTools: "mcp__hindsight__*,mcp__session-chain__*,mcp__TalkToFigma__*",
+	}
+}
+
+func (GeminiAdapter) BuildCommand(prompt string, options Options) (string, []string) {
+	args := []string{"-p", prompt, "--output-format", "stream-json"}
+	if options.Model != "" {
+		args = append(args, "--model", options.Model)
+	}
+	if options.SessionID != "" {
+		args = append(args, "--resume", options.SessionID)
+	}
+	if options.AllowedTools != "" {
+		args = append(args, "--allowed-tools", options.AllowedTools)
+	}
+	if options.ApprovalMode != "" {
+		args = append(args, "--approval-mode", options.ApprovalMode)
+	}
+	if options.MCPConfigPath != "" {
+		args = append(args, "--mcp-config", options.MCPConfigPath)
+	}
+	return "gemini", append(args, options.ExtraArgs...)
+}
+
+func (GeminiAdapter) StdinPrompt(prompt string) (string, bool) {
+	return "", false
+}
+
+func (GeminiAdapter) ParseLine(line string, state *ParseState) ParsedLine {
+	var event struct {
+		Type       string          `json:"type"`
+		SessionID  string          `json:"session_id,omitempty"`
+		Model      string          `json:"model,omitempty"`
+		Role       string          `json:"role,omitempty"`
+		Content    string          `json:"content,omitempty"`
+		ToolName   string          `json:"tool_name,omitempty"`
+		ToolID     string          `json:"tool_id,omitempty"`
+		Parameters json.RawMessage `json:"parameters,omitempty"`
+		Status     string          `json:"status,omitempty"`
+		Output     string          `json:"output,omitempty"`
+		Error      *struct {
+			Message string `json:"message"`
+		} `json:"error,omitempty"`
+		Stats *struct {
+			InputTokens  int `json:"input_tokens"`
+			OutputTokens int `json:"output_tokens"`
+			Cached       int `json:"cached"`
+		} `json:"stats,omitempty"`
+	}
+
+	var parsed ParsedLine
+	if err := json.Unmarshal([]byte(line), &event); err != nil {
+		return parsed
+	}
+
+	switch event.Type {
+	case "init":
+		parsed.SessionID = event.SessionID
+		parsed.Model = event.Model
+	case "message":
+		if event.Role == "assistant" && event.Content != "" {
+			parsed.Events = append(parsed.Events, StreamEvent{Type: StreamEventText, Text: event.Content})
+		}
+	case "tool_use":
+		state.ToolNames[event.ToolID] = event.ToolName
+		parsed.Events = append(parsed.Events, StreamEvent{Type: StreamEventToolStart, Tool: event.ToolName, ToolID: event.ToolID, Input: toolIOText(event.Parameters)})
+	case "tool_result":
+		output := event.Output
+		if event.Error != nil && event.Error.Message != "" {
+			output = event.Error.Message
+		}
+		parsed.Events = append(parsed.Events, StreamEvent{Type: StreamEventToolEnd, Tool: state.ToolNames[event.ToolID], ToolID: event.ToolID, IsError: event.Status == "error", Output: output})
+	case "result":
+		// 失败的调用以 status 为 error 的 result 结束
+		if event.Status == "error" && event.Error != nil {
+			parsed.Error = event.Error.Message
+		}
+		if event.Stats != nil {
+			parsed.Usage = &Usage{
+				InputTokens:     event.Stats.InputTokens,
+				OutputTokens:    event.Stats.OutputTokens,
+				CacheReadTokens: event.Stats.Cached,
+			}
+		}
+	}
+	return parsed
+}
@@ -0,0 +1,343 @@
+package agentcli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// HTTP 后端支持的接口格式
+const (
+	HTTPFormatOpenAI    = "openai"    // OpenAI Chat Completions 兼容接口
+	HTTPFormatAnthropic = "anthropic" // Anthropic Messages 接口
+)
+
+const (
+	defaultOpenAIBaseURL    = "https://api.openai.com/v1"
+	defaultAnthropicBaseURL = "https://api.anthropic.com/v1"
+	anthropicAPIVersion     = "2023-06-01"
+
+	// defaultHTTPMaxTokens Anthropic 接口要求必须指定 max_tokens
+	defaultHTTPMaxTokens = 4096
+)
+
+// httpConversationDir HTTP 后端会话历史的保存目录（模型接口本身无状态，多轮对话由我们保存）
+var httpConversationDir = defaultHTTPConversationDir()
+
+func defaultHTTPConversationDir() string {
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "cat-cafe", "http-conversations")
+	}
+	return filepath.Join(os.TempDir(), "cat-cafe-http-conversations")
+}
+
+// httpMessage 对话中的一条消息
+type httpMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// HTTPAdapter 直接调用模型 HTTP 接口的轻量后端（cli_type: http），适合不需要工具的评审类猫猫
+// options.SessionID 为会话历史 ID，为空时开始新会话
+type HTTPAdapter struct{}
+
+func (HTTPAdapter) DefaultOptions() Options {
+	return Options{APIFormat: HTTPFormatOpenAI}
+}
+
+// BuildCommand HTTP 后端不启动子进程（由 Invoke 完成调用）
+func (HTTPAdapter) BuildCommand(prompt string, options Options) (string, []string) {
+	return "", nil
+}
+
+func (HTTPAdapter) StdinPrompt(prompt string) (string, bool) {
+	return "", false
+}
+
+// ParseLine 解析 SSE 流中的一行（同时支持 OpenAI 与 Anthropic 的数据格式）
+func (HTTPAdapter) ParseLine(line string, state *ParseState) ParsedLine {
+	var parsed ParsedLine
+
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "data:") {
+		return parsed
+	}
+	data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+	if data == "" || data == "[DONE]" {
+		return parsed
+	}
+
+	var chunk struct {
+		// OpenAI
+		Choices []struct {
+			Delta struct {
+				Content string `json:"content"`
+			} `json:"delta"`
+		} `json:"choices"`
+		// Anthropic
+		Type  string `json:"type"`
+		Delta struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"delta"`
+		Message struct {
+			Usage *httpUsage `json:"usage"`
+		} `json:"message"`
+		// 两种格式共用
+		Usage *httpUsage `json:"usage"`
+		Error *struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		return parsed
+	}
+
+	// 流中途的错误（Anthropic 的 error 事件、OpenAI 的 error 块），如过载、服务端异常
+	if chunk.Error != nil {
+		parsed.Error = strings.TrimSpace(chunk.Error.Type + ": " + chunk.Error.Message)
+		return parsed
+	}
+
+	for _, choice := range chunk.Choices {
+		if choice.Delta.Content != "" {
+			parsed.Events = append(parsed.Events, StreamEvent{Type: StreamEventText, Text: choice.Delta.Content})
+		}
+	}
+
+	switch chunk.Type {
+	case "content_block_delta":
+		if chunk.Delta.Type == "text_delta" && chunk.Delta.Text != "" {
+			parsed.Events = append(parsed.Events, StreamEvent{Type: StreamEventText, Text: chunk.Delta.Text})
+		}
+	case "message_start":
+		// 输入用量在 message_start 中报告，输出用量以 message_delta 的累计值为准
+		if u := chunk.Message.Usage; u != nil {
+			parsed.Usage = &Usage{InputTokens: u.InputTokens, CacheReadTokens: u.CacheReadInputTokens}
+		}
+	case "message_delta":
+		if u := chunk.Usage; u != nil {
+			parsed.Usage = &Usage{OutputTokens: u.OutputTokens}
+		}
+	case "":
+		// OpenAI 在 stream_options.include_usage 开启时于最后一个块报告用量（prompt_tokens 已包含缓存命中部分）
+		if u := chunk.Usage; u != nil {
+			parsed.Usage = &Usage{
+				InputTokens:     u.PromptTokens - u.PromptTokensDetails.CachedTokens,
+				OutputTokens:    u.CompletionTokens,
+				CacheReadTokens: u.PromptTokensDetails.CachedTokens,
+			}
+		}
+	}
+	return parsed
+}
+
+// httpUsage OpenAI 与 Anthropic 用量字段的并集
+type httpUsage struct {
+	PromptTokens        int `json:"prompt_tokens"`
+	CompletionTokens    int `json:"completion_tokens"`
+	PromptTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
+	InputTokens          int `json:"input_tokens"`
+	OutputTokens         int `json:"output_tokens"`
+	CacheReadInputTokens int `json:"cache_read_input_tokens"`
+}
+
+// Invoke 以流式请求调用模型接口，带上保存的会话历史，完成后把本轮问答追加到历史中
+func (a HTTPAdapter) Invoke(ctx context.Context, prompt string, options Options) (*Result, error) {
+	result := &Result{}
+
+	if options.Model == "" {
+		return result, fmt.Errorf("%w: cli_type http 需要配置 model", ErrConfig)
+	}
+	apiKey := ""
+	if options.APIKeyEnv != "" {
+		apiKey = os.Getenv(options.APIKeyEnv)
+		if apiKey == "" {
+			return result, fmt.Errorf("%w: 环境变量 %s 未设置", ErrConfig, options.APIKeyEnv)
+		}
+	}
+
+	// 读取会话历史（历史丢失时以同一 ID 重新开始）
+	conversationID := options.SessionID
+	var history []httpMessage
+	if conversationID != "" {
+		loaded, err := loadHTTPConversation(conversationID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "读取 HTTP 会话历史失败，将开始新会话: %v\n", err)
+		}
+		history = loaded
+	} else {
+		conversationID = fmt.Sprintf("http_%d", time.Now().UnixNano())
+	}
+	messages := append(history, httpMessage{Role: "user", Content: ensureValidUTF8(prompt)})
+
+	req, err := buildHTTPModelRequest(ctx, options, apiKey, messages)
+	if err != nil {
+		return result, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return result, wrapContextError("http", ctxErr)
+		}
+		return result, fmt.Errorf("请求模型接口失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return result, &BackendError{
+			Source:     fmt.Sprintf("模型接口返回 %d", resp.StatusCode),
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(body)),
+		}
+	}
+
+	state := NewParseState()
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 1024*1024), 1024*1024)
+	for scanner.Scan() {
+		parsed := a.ParseLine(scanner.Text(), state)
+		if parsed.Error != "" {
+			// 不保存本轮问答，交给 failover 按错误内容分类（如 overloaded 为临时错误）
+			return result, &BackendError{Source: "模型接口返回错误", Message: parsed.Error}
+		}
+		if parsed.Usage != nil {
+			result.Usage = result.Usage.Add(parsed.Usage)
+		}
+		for _, event := range parsed.Events {
+			result.Response += event.Text
+			if options.OnEvent != nil {
+				options.OnEvent(event)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return result, wrapContextError("http", ctxErr)
+		}
+		return result, fmt.Errorf("读取模型接口响应失败: %w", err)
+	}
+
+	result.SessionID = conversationID
+	result.Model = options.Model
+	messages = append(messages, httpMessage{Role: "assistant", Content: result.Response})
+	if err := saveHTTPConversation(conversationID, messages); err != nil {
+		fmt.Fprintf(os.Stderr, "保存 HTTP 会话历史失败: %v\n", err)
+	}
+	return result, nil
+}
+
+// buildHTTPModelRequest 按接口格式构建流式请求
+func buildHTTPModelRequest(ctx context.Context, options Options, apiKey string, messages []httpMessage) (*http.Request, error) {
+	body := map[string]interface{}{
+		"model":    options.Model,
+		"messages": messages,
+		"stream":   true,
+	}
+
+	var url string
+	headers := map[string]string{"Content-Type": "application/json"}
+
+	switch options.APIFormat {
+	case "", HTTPFormatOpenAI:
+		baseURL := options.BaseURL
+		if baseURL == "" {
+			baseURL = defaultOpenAIBaseURL
+		}
+		url = strings.TrimRight(baseURL, "/") + "/chat/completions"
+		body["stream_options"] = map[string]bool{"include_usage": true}
+		if options.MaxTokens > 0 {
+			body["max_tokens"] = options.MaxTokens
+		}
+		if apiKey != "" {
+			headers["Authorization"] = "Bearer " + apiKey
+		}
+	case HTTPFormatAnthropic:
+		baseURL := options.BaseURL
+		if baseURL == "" {
+			baseURL = defaultAnthropicBaseURL
+		}
+		url = strings.TrimRight(baseURL, "/") + "/messages"
+		maxTokens := options.MaxTokens
+		if maxTokens <= 0 {
+			maxTokens = defaultHTTPMaxTokens
+		}
+		body["max_tokens"] = maxTokens
+		headers["anthropic-version"] = anthropicAPIVersion
+		if apiKey != "" {
+			headers["x-api-key"] = apiKey
+		}
+	default:
+		return nil, fmt.Errorf("不支持的接口格式: %s", options.APIFormat)
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("序列化请求失败: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	return req, nil
+}
+
+// httpConversationPath 会话历史文件路径（拒绝包含路径分隔符的 ID）
+func httpConversationPath(conversationID string) (string, error) {
+	if conversationID == "" || filepath.Base(conversationID) != conversationID || strings.HasPrefix(conversationID, ".") {
+		return "", fmt.Errorf("无效的会话 ID: %s", conversationID)
+	}
+	return filepath.Join(httpConversationDir, conversationID+".json"), nil
+}
+
+// loadHTTPConversation 读取会话历史（不存在时返回空历史）
+func loadHTTPConversation(conversationID string) ([]httpMessage, error) {
+	path, err := httpConversationPath(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var messages []httpMessage
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return nil, fmt.Errorf("解析会话历史失败: %w", err)
+	}
+	return messages, nil
+}
+
+// saveHTTPConversation 保存会话历史
+func saveHTTPConversation(conversationID string, messages []httpMessage) error {
+	path, err := httpConversationPath(conversationID)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(httpConversationDir, 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(messages)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
@@ -0,0 +1,328 @@
+package agentcli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+)
+
+// processKillGrace ctx 取消后等待 CLI 输出管道关闭的最长时间
+const processKillGrace = 5 * time.Second
+
+// ErrTimeout CLI 调用超过截止时间被终止
+var ErrTimeout = errors.New("CLI 调用超时")
+
+// Options 包含所有可能的代理CLI配置选项
+type Options struct {
+	Model           string
+	AllowedTools    string
+	DisallowedTools string            // 用于 Claude CLI
+	PermissionMode  string            // 用于 Claude CLI
+	ApprovalMode    string            // 用于 Gemini CLI
+	SessionID       string            // 用于 --resume
+	WorkDir         string            // 工作目录
+	MCPConfigPath   string            // MCP 配置文件路径
+	ExtraArgs       []string          // 由适配器放在生成的选项之后、位置参数（prompt、stdin 的 -）之前
+	Env             map[string]string // 额外的环境变量，覆盖继承自当前进程的同名变量
+	OnEvent         StreamHandler     // 可选：运行过程中的增量事件回调
+
+	// 以下用于 cli_type: http（直接调用模型 HTTP 接口）
+	BaseURL   string // 接口地址，如 https://api.openai.com/v1
+	APIKeyEnv string // 保存 API Key 的环境变量名
+	APIFormat string // openai（默认）或 anthropic
+	MaxTokens int    // 单次回复的最大 token 数
+}
+
+// 流式事件类型
+const (
+	StreamEventText      = "text"       // 回复文本增量
+	StreamEventToolStart = "tool_start" // 开始调用工具
+	StreamEventToolEnd   = "tool_end"   // 工具调用结束
+)
+
+// StreamEvent CLI 运行过程中解析出的增量事件
+type StreamEvent struct {
+	Type    string `json:"type"`
+	Text    string `json:"text,omitempty"`
+	Tool    string `json:"tool,omitempty"`   // 工具名称
+	ToolID  string `json:"toolId,omitempty"` // 用于匹配工具调用的开始与结束
+	IsError bool   `json:"isError,omitempty"`
+
+	// 工具的输入参数和输出内容只记录到 ToolCall，不随增量推送给前端
+	Input  string `json:"-"`
+	Output string `json:"-"`
+}
+
+// StreamHandler 增量事件回调，在读取 stdout 的 goroutine 中同步调用
+type StreamHandler func(event StreamEvent)
+
+// Result 一次 CLI 调用的结果
+type Result struct {
+	Response  string
+	SessionID string
+	Model     string     // CLI 报告的模型，未报告时为空
+	Usage     *Usage     // CLI 未报告用量时为 nil
+	ToolCalls []ToolCall // 按开始顺序排列的工具调用
+}
+
+// maxToolIOLength 工具输入/输出记录的最大长度（字节），超出部分截断
+const maxToolIOLength = 8 * 1024
+
+// ToolCall 一次工具调用的记录
+type ToolCall struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Input      string    `json:"input,omitempty"`
+	Output     string    `json:"output,omitempty"`
+	IsError    bool      `json:"isError,omitempty"`
+	Finished   bool      `json:"finished"` // false 表示调用结束前 CLI 已退出
+	StartedAt  time.Time `json:"startedAt"`
+	DurationMs int64     `json:"durationMs"`
+}
+
+// toolCallRecorder 根据工具开始/结束事件汇总 ToolCall，耗时以事件到达时间计算
+type toolCallRecorder struct {
+	calls []ToolCall
+	index map[string]int
+}
+
+func newToolCallRecorder() *toolCallRecorder {
+	return &toolCallRecorder{index: make(map[string]int)}
+}
+
+// Observe 处理一条事件（非工具事件忽略）
+func (r *toolCallRecorder) Observe(event StreamEvent) {
+	if event.Type != StreamEventToolStart && event.Type != StreamEventToolEnd {
+		return
+	}
+	now := time.Now()
+
+	i, exists := r.index[event.ToolID]
+	if !exists || event.ToolID == "" {
+		r.calls = append(r.calls, ToolCall{ID: event.ToolID, Name: event.Tool, StartedAt: now})
+		i = len(r.calls) - 1
+		r.index[event.ToolID] = i
+	}
+	call := &r.calls[i]
+	if call.Name == "" {
+		call.Name = event.Tool
+	}
+	if event.Input != "" {
+		call.Input = truncateToolIO(event.Input)
+	}
+	if event.Type == StreamEventToolEnd {
+		call.Output = truncateToolIO(event.Output)
+		call.IsError = event.IsError
+		call.Finished = true
+		call.DurationMs = now.Sub(call.StartedAt).Milliseconds()
+	}
+}
+
+// Calls 已记录的工具调用（没有时返回 nil）
+func (r *toolCallRecorder) Calls() []ToolCall {
+	return r.calls
+}
+
+// truncateToolIO 截断过长的工具输入/输出（保持 UTF-8 完整）
+func truncateToolIO(s string) string {
+	if len(s) <= maxToolIOLength {
+		return s
+	}
+	cut := maxToolIOLength
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + fmt.Sprintf("\n...（已截断，共 %d 字节）", len(s))
+}
+
+// Invoke 调用指定的 CLI 工具并处理其流式输出，命令行参数构建和输出解析由 cliName 对应的 Adapter 完成
+// ctx 取消时会杀掉 CLI 所在的整个进程组（CLI 可能再拉起 MCP server 等子进程），返回的错误包装了 ctx.Err()；
+// 超过 ctx 截止时间时错误同时包装 ErrTimeout
+// 返回值始终非 nil，出错时包含已收到的部分回复
+func Invoke(ctx context.Context, cliName, prompt string, options Options) (*Result, error) {
+	result := &Result{}
+
+	adapter, err := Get(cliName)
+	if err != nil {
+		return result, err
+	}
+	if direct, ok := adapter.(DirectAdapter); ok {
+		return direct.Invoke(ctx, prompt, options)
+	}
+	binary, args := adapter.BuildCommand(prompt, options)
+
+	cmd := exec.CommandContext(ctx, binary, args...)
+
+	// 放入独立进程组，取消时连同子进程一起结束
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = processKillGrace
+
+	// 设置工作目录
+	if options.WorkDir != "" {
+		cmd.Dir = options.WorkDir
+	}
+
+	// 清理 CLAUDECODE 环境变量，避免嵌套会话错误
+	env := []string{}
+	for _, e := range os.Environ() {
+		name, _, _ := strings.Cut(e, "=")
+		if name == "CLAUDECODE" {
+			continue
+		}
+		if _, overridden := options.Env[name]; overridden {
+			continue
+		}
+		env = append(env, e)
+	}
+	for name, value := range options.Env {
+		env = append(env, name+"="+value)
+	}
+	cmd.Env = env
+
+	// 需要时通过 stdin 传递 prompt（避免参数解析问题）
+	if input, ok := adapter.StdinPrompt(prompt); ok {
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return result, fmt.Errorf("无法获取 stdin: %w", err)
+		}
+		go func() {
+			defer stdin.Close()
+			// 确保 prompt 是有效的 UTF-8
+			stdin.Write([]byte(ensureValidUTF8(input)))
+		}()
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return result, fmt.Errorf("无法获取 stdout: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return result, fmt.Errorf("无法获取 stderr: %w", err)
+	}
+
+	// 使用 WaitGroup 等待所有 goroutine 完成
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	// 收集 stderr 输出
+	var stderrOutput strings.Builder
+
+	// 输出流中报告的最后一个错误（CLI 可能以 0 退出）
+	var streamErr string
+
+	// 处理 stderr
+	go func() {
+		defer wg.Done()
+		scanner := bufio.NewScanner(stderr)
+		// 增加缓冲区大小到 1MB，避免 "token too long" 错误
+		buf := make([]byte, 0, 64*1024)
+		scanner.Buffer(buf, 1024*1024)
+		for scanner.Scan() {
+			line := scanner.Text()
+			stderrOutput.WriteString(line)
+			stderrOutput.WriteString("\n")
+		}
+	}()
+
+	if err := cmd.Start(); err != nil {
+		return result, fmt.Errorf("无法启动 %s 命令: %w", cliName, err)
+	}
+
+	// 处理 stdout
+	go func() {
+		defer wg.Done()
+		state := NewParseState()
+		tools := newToolCallRecorder()
+		defer func() { result.ToolCalls = tools.Calls() }()
+		scanner := bufio.NewScanner(stdout)
+		// 增大 buffer 到 1MB，避免长行被截断导致响应丢失
+		scanner.Buffer(make([]byte, 0, 1024*1024), 1024*1024)
+		for scanner.Scan() {
+			parsed := adapter.ParseLine(scanner.Text(), state)
+			if parsed.Error != "" {
+				streamErr = parsed.Error
+			}
+			if parsed.SessionID != "" {
+				result.SessionID = parsed.SessionID
+			}
+			if parsed.Model != "" {
+				result.Model = parsed.Model
+			}
+			if parsed.Usage != nil {
+				result.Usage = result.Usage.Add(parsed.Usage)
+			}
+			for _, event := range parsed.Events {
+				if event.Type == StreamEventText {
+					result.Response += event.Text
+				}
+				tools.Observe(event)
+				if options.OnEvent != nil {
+					options.OnEvent(event)
+				}
+			}
+		}
+		if err := scanner.Err(); err != nil && err != io.EOF {
+			fmt.Fprintf(os.Stderr, "读取 %s 输出时出错: %v\n", cliName, err)
+		}
+	}()
+
+	wg.Wait() // 等待所有 goroutine 完成
+
+	if err := cmd.Wait(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return result, wrapContextError(cliName, ctxErr)
+		}
+		errMsg := fmt.Sprintf("命令 %s 执行失败: %v", cliName, err)
+		if stderrOutput.Len() > 0 {
+			errMsg += fmt.Sprintf("\nstderr: %s", stderrOutput.String())
+		}
+		if streamErr != "" {
+			// 输出流中的错误放在第一行，失败分类只看它，stderr 仅供排查
+			return result, fmt.Errorf("%w\n%s", streamError(cliName, streamErr), errMsg)
+		}
+		return result, fmt.Errorf("%s", errMsg)
+	}
+	if streamErr != "" {
+		return result, streamError(cliName, streamErr)
+	}
+
+	return result, nil
+}
+
+// streamError CLI 输出流中报告的错误
+func streamError(cliName, message string) error {
+	return &BackendError{Source: fmt.Sprintf("命令 %s 报告错误", cliName), Message: message}
+}
+
+// wrapContextError 包装 ctx 取消导致的调用中止，超过截止时间时同时包装 ErrTimeout
+func wrapContextError(cliName string, ctxErr error) error {
+	if errors.Is(ctxErr, context.DeadlineExceeded) {
+		return fmt.Errorf("命令 %s %w: %w", cliName, ErrTimeout, ctxErr)
+	}
+	return fmt.Errorf("命令 %s 已中止: %w", cliName, ctxErr)
+}
+
+// ensureValidUTF8 确保字符串是有效的 UTF-8 编码
+// 将所有无效的 UTF-8 字节序列替换为 Unicode 替换字符 (U+FFFD)
+func ensureValidUTF8(s string) string {
+	if utf8.ValidString(s) {
+		return s
+	}
+
+	// 使用 strings.ToValidUTF8 替换无效字符
+	// 替换字符使用 � (U+FFFD, Unicode replacement character)
+	return strings.ToValidUTF8(s, "�")
+}
@@ -0,0 +1,105 @@
+package agentcli
+
+import "encoding/json"
+
+// OpenCodeAdapter OpenCode CLI（opencode run --format json）
+// 工具权限和 MCP server 由 opencode.json 配置，这里不传 AllowedTools / MCPConfigPath
+type OpenCodeAdapter struct{}
+
+func (OpenCodeAdapter) DefaultOptions() Options {
+	return Options{}
+}
+
+func (OpenCodeAdapter) BuildCommand(prompt string, options Options) (string, []string) {
+	args := []string{"run", "--format", "json"}
+	if options.Model != "" {
+		args = append(args, "--model", options.Model)
+	}
+	if options.SessionID != "" {
+		args = append(args, "--session", options.SessionID)
+	}
+	args = append(args, options.ExtraArgs...)
+	return "opencode", append(args, prompt)
+}
+
+func (OpenCodeAdapter) StdinPrompt(prompt string) (string, bool) {
+	return "", false
+}
+
+func (OpenCodeAdapter) ParseLine(line string, state *ParseState) ParsedLine {
+	var event struct {
+		Type      string `json:"type"`
+		SessionID string `json:"sessionID,omitempty"`
+		Error     *struct {
+			Name string `json:"name"`
+			Data struct {
+				Message string `json:"message"`
+			} `json:"data"`
+		} `json:"error,omitempty"` // error 事件的错误
+		Part struct {
+			Text   string `json:"text,omitempty"`
+			CallID string `json:"callID,omitempty"`
+			Tool   string `json:"tool,omitempty"`
+			State  struct {
+				Status string          `json:"status,omitempty"`
+				Input  json.RawMessage `json:"input,omitempty"`
+				Output string          `json:"output,omitempty"`
+				Error  string          `json:"error,omitempty"`
+			} `json:"state,omitempty"`
+			Cost   float64 `json:"cost,omitempty"`
+			Tokens *struct {
+				Input  int `json:"input"`
+				Output int `json:"output"`
+				Cache  struct {
+					Read int `json:"read"`
+				} `json:"cache"`
+			} `json:"tokens,omitempty"`
+		} `json:"part"`
+	}
+
+	var parsed ParsedLine
+	if err := json.Unmarshal([]byte(line), &event); err != nil {
+		return parsed
+	}
+	parsed.SessionID = event.SessionID
+
+	switch event.Type {
+	case "text":
+		if event.Part.Text != "" {
+			parsed.Events = append(parsed.Events, StreamEvent{Type: StreamEventText, Text: event.Part.Text})
+		}
+	case "tool_use":
+		// 同一个工具调用可能只在结束时输出一次，此时补发开始事件
+		callID := event.Part.CallID
+		if _, started := state.ToolNames[callID]; !started {
+			state.ToolNames[callID] = event.Part.Tool
+			parsed.Events = append(parsed.Events, StreamEvent{Type: StreamEventToolStart, Tool: event.Part.Tool, ToolID: callID, Input: toolIOText(event.Part.State.Input)})
+		}
+		switch event.Part.State.Status {
+		case "completed", "error":
+			output := event.Part.State.Output
+			if event.Part.State.Error != "" {
+				output = event.Part.State.Error
+			}
+			parsed.Events = append(parsed.Events, StreamEvent{Type: StreamEventToolEnd, Tool: event.Part.Tool, ToolID: callID, IsError: event.Part.State.Status == "error", Input: toolIOText(event.Part.State.Input), Output: output})
+		}
+	case "error":
+		if event.Error != nil {
+			parsed.Error = event.Error.Data.Message
+			if parsed.Error == "" {
+				parsed.Error = event.Error.Name
+			}
+		}
+	case "step_finish":
+		// 每个步骤单独报告用量，同一次调用中累加
+		if event.Part.Tokens != nil {
+			parsed.Usage = &Usage{
+				InputTokens:     event.Part.Tokens.Input,
+				OutputTokens:    event.Part.Tokens.Output,
+				CacheReadTokens: event.Part.Tokens.Cache.Read,
+				CostUSD:         event.Part.Cost,
+			}
+		}
+	}
+	return parsed
+}
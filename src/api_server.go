@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -41,6 +42,11 @@ type SessionManager struct {
 	wsHub            *WSHub             // 新增：WebSocket Hub
 	workspaceManager *WorkspaceManager  // 新增：工作区管理器
 	chainManager     *SessionChainManager // 新增：Session Chain 管理器
+	cats             *CatRegistry         // 猫猫注册表（名字、ID、颜色、管道）
+	configPath       string
+
+	spawnMu sync.Mutex
+	spawned map[string][]*os.Process // 通过 API 启动的工作进程（按猫猫名字）
 }
 
 // SessionContext 会话上下文，每个会话有独立的调度器
@@ -70,6 +76,7 @@ type Message struct {
 	Sender    *Sender     `json:"sender,omitempty"`
 	Timestamp time.Time   `json:"timestamp"`
 	SessionID string      `json:"sessionId"`
+	TaskID    string      `json:"taskId,omitempty"` // 猫猫回复对应的任务，前端据此替换增量草稿
 }
 
 // Sender 发送者信息
@@ -82,11 +89,23 @@ type Sender struct {
 
 // Cat 猫猫信息
 type Cat struct {
-	ID     string `json:"id"`
-	Name   string `json:"name"`
-	Avatar string `json:"avatar"`
-	Color  string `json:"color"`
-	Status string `json:"status"` // idle, busy, offline
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Avatar      string     `json:"avatar"`
+	Color       string     `json:"color"`
+	Status      string     `json:"status"`                // idle, busy, offline（由工作进程心跳得出）
+	Workers     int        `json:"workers"`               // 存活的工作进程数
+	Running     int        `json:"running"`               // 正在执行的任务数
+	Capacity    int        `json:"capacity"`              // 同时执行的任务数上限（各工作进程 concurrency 之和）
+	CurrentTask string     `json:"currentTask,omitempty"` // 忙碌时正在执行的任务
+	LastSeen    *time.Time `json:"lastSeen,omitempty"`    // 最近一次心跳
+}
+
+// CatDetail 猫猫详情，附带实际生效的 CLI 调用选项
+type CatDetail struct {
+	Cat
+	Options  *CatOptions    `json:"options,omitempty"`
+	Backends []BreakerState `json:"backends,omitempty"` // 各后端的熔断状态（配置了 fallbacks 时）
 }
 
 // Session 会话信息
@@ -104,6 +123,9 @@ type Session struct {
 type MessageStats struct {
 	TotalMessages int `json:"totalMessages"`
 	CatMessages   int `json:"catMessages"`
+	// 调用用量：会话合计与按猫猫汇总
+	Usage UsageTotals            `json:"usage"`
+	ByCat map[string]UsageTotals `json:"byCat"`
 }
 
 // CallHistoryItem 调用历史项
@@ -114,6 +136,9 @@ type CallHistoryItem struct {
 	Timestamp time.Time `json:"timestamp"`
 	Prompt    string    `json:"prompt"`    // 调用时的提示词
 	Response  string    `json:"response"`  // 猫猫的回复
+	TaskID    string    `json:"taskId,omitempty"`
+	Status    string    `json:"status,omitempty"` // pending, completed, cancelled, failed
+	Error     string    `json:"error,omitempty"`  // 失败原因
 }
 
 // SendMessageRequest 发送消息请求
@@ -151,6 +176,13 @@ func NewSessionManager(configPath string) (*SessionManager, error) {
 		return nil, fmt.Errorf("Redis 连接失败: %w", err)
 	}
 
+	// 创建猫猫注册表，所有按名字或 ID 查找猫猫的地方都从这里读取
+	cats, err := NewCatRegistry(ctx, rdb, configPath, config.Agents)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("加载猫猫注册表失败: %w", err)
+	}
+
 	// 创建一个临时调度器用于编排器（编排器需要调度器来发送任务）
 	// 注意：每个会话仍然有自己的调度器
 	tempScheduler, err := NewScheduler(configPath)
@@ -158,10 +190,21 @@ func NewSessionManager(configPath string) (*SessionManager, error) {
 		cancel()
 		return nil, fmt.Errorf("创建调度器失败: %w", err)
 	}
+	tempScheduler.UseRegistry(cats)
+
+	// 加载声明式工作流并注册为命名模式
+	workflows, err := LoadWorkflowDefinitions(config)
+	if err != nil {
+		LogWarn("[API] 加载工作流失败: %v", err)
+	} else if len(workflows) > 0 {
+		count := RegisterWorkflowModes(GlobalModeRegistry, workflows)
+		LogInfo("[API] 已注册 %d/%d 个工作流模式", count, len(workflows))
+	}
 
 	// 创建编排器，默认使用自由讨论模式
 	orchestrator := NewOrchestrator(tempScheduler, "free_discussion")
-	orchestrator.SetAgentConfigs(config.Agents)
+	orchestrator.SetAgentConfigs(cats.List())
+	cats.OnChange(orchestrator.SetAgentConfigs)
 
 	// 创建 WebSocket Hub
 	wsHub := NewWSHub()
@@ -186,16 +229,29 @@ func NewSessionManager(configPath string) (*SessionManager, error) {
 		wsHub:            wsHub,
 		workspaceManager: workspaceManager,
 		chainManager:     chainManager,
+		cats:             cats,
+		configPath:       configPath,
+		spawned:          make(map[string][]*os.Process),
 	}
 
-	// 启动结果监听器
+	// 模式通过 SessionManager 发布系统消息、推送事件和异步派发调用
+	orchestrator.SetNotifier(sm)
+
+	// 启动结果与增量输出监听器
 	go sm.listenForResults()
+	go sm.listenForDeltas()
+
+	// 推送猫猫在线状态变化
+	go sm.watchPresence()
 
 	// 从 Redis 加载已有的会话
 	if err := sm.LoadAllSessions(); err != nil {
 		LogWarn("[API] 加载会话失败: %v", err)
 	}
 
+	// 恢复因预算排队的任务（预算已调整或已过了一天）
+	go sm.watchBudgetDay()
+
 	return sm, nil
 }
 
@@ -214,6 +270,7 @@ func (sm *SessionManager) CreateSession() (*Session, error) {
 	if err != nil {
 		return nil, fmt.Errorf("创建调度器失败: %w", err)
 	}
+	scheduler.UseRegistry(sm.cats)
 
 	// 创建默认模式配置
 	LogDebug("[API] 创建模式配置: %s", sessionID)
@@ -258,6 +315,11 @@ func (sm *SessionManager) CreateSession() (*Session, error) {
 		return nil, fmt.Errorf("在编排器中注册会话失败: %w", err)
 	}
 
+	// 模式状态以编排器为准，会话上下文共享同一份状态（用于持久化和查询）
+	if modeState, err := sm.orchestrator.GetModeState(sessionID); err == nil {
+		ctx.ModeState = modeState
+	}
+
 	// 添加系统欢迎消息
 	LogDebug("[API] 添加欢迎消息: %s", sessionID)
 	welcomeMsg := Message{
@@ -396,7 +458,7 @@ func (sm *SessionManager) DeleteSession(sessionID string) error {
 	// 从编排器中删除会话
 	sm.orchestrator.DeleteSession(sessionID)
 
-	// 从 Redis 删除会话
+	// 从 Redis 删除会话（包括因预算排队的任务）
 	if err := sm.DeleteSessionFromRedis(sessionID); err != nil {
 		LogError("[API] 从 Redis 删除会话失败: %v", err)
 	}
@@ -526,78 +588,47 @@ func (sm *SessionManager) SendMessage(sessionID string, req SendMessageRequest)
 		"messageCount": ctx.MessageCount,
 	})
 
+	// 有猫猫在等铲屎官回复时，这条消息自动作为回复交给提问的猫猫
+	resumeCalls, resolved, err := sm.orchestrator.ResumeFromOwner(sessionID, userMsg.ID, req.Content)
+	if err != nil {
+		LogError("[API] 恢复等待铲屎官的猫猫失败: %v", err)
+	}
+	resumed := make(map[string]bool, len(resolved))
+	if len(resolved) > 0 {
+		for _, r := range resolved {
+			resumed[r.AgentName] = true
+		}
+		LogInfo("[API] 铲屎官已回复，恢复 %d 只等待中的猫猫", len(resolved))
+		sm.wsHub.BroadcastToSession(sessionID, "owner_request_resolved", gin.H{
+			"sessionId": sessionID,
+			"messageId": userMsg.ID,
+			"requests":  resolved,
+		})
+		sm.dispatchAgentCalls(ctx, sessionID, resumeCalls)
+	}
+
 	// 如果有提及的猫猫，通过编排器处理
 	if len(req.MentionedCats) > 0 {
 		// 将猫猫 ID 转换为名称
-		catIDToName := map[string]string{
-			"cat_001": "花花",
-			"cat_002": "薇薇",
-			"cat_003": "小乔",
-		}
-
 		mentionedNames := make([]string, 0, len(req.MentionedCats))
 		for _, catID := range req.MentionedCats {
-			if name, ok := catIDToName[catID]; ok {
+			// 已作为铲屎官回复恢复的猫猫不再重复调用
+			if name := sm.cats.NameByID(catID); name != "" && !resumed[name] {
 				mentionedNames = append(mentionedNames, name)
 			}
 		}
 
 		// 通过编排器处理用户消息
-		calls, err := sm.orchestrator.HandleUserMessage(sessionID, req.Content, mentionedNames)
-		if err != nil {
-			LogError("[API] 编排器处理用户消息失败: %v", err)
-			return nil, fmt.Errorf("处理消息失败: %w", err)
-		}
-
-		LogInfo("[API] 编排器返回 %d 个猫猫调用", len(calls))
-
-		// 处理每个调用
-		for _, call := range calls {
-			catID := getCatIDByName(call.AgentName)
-
-			// 只在猫猫第一次加入时添加系统消息
-			if !ctx.JoinedCats[catID] {
-				systemMsg := Message{
-					ID:        fmt.Sprintf("msg_%s", uuid.New().String()[:8]),
-					Type:      "system",
-					Content:   fmt.Sprintf("%s 已加入对话", call.AgentName),
-					Timestamp: time.Now(),
-					SessionID: sessionID,
-				}
-				ctx.SystemMessages = append(ctx.SystemMessages, systemMsg)
-				ctx.JoinedCats[catID] = true
-				LogDebug("[API] 已添加系统消息: %s", systemMsg.ID)
-
-				// 通过 WebSocket 推送系统消息
-				sm.wsHub.BroadcastToSession(sessionID, "message", systemMsg)
-			} else {
-				LogDebug("[API] 猫猫 %s 已在会话中，跳过系统消息", call.AgentName)
+		if len(mentionedNames) > 0 {
+			calls, err := sm.orchestrator.HandleUserMessageWithID(sessionID, userMsg.ID, req.Content, mentionedNames)
+			if err != nil {
+				LogError("[API] 编排器处理用户消息失败: %v", err)
+				return nil, fmt.Errorf("处理消息失败: %w", err)
 			}
 
-			// 记录调用历史
-			ctx.CallHistory = append(ctx.CallHistory, CallHistoryItem{
-				CatID:     catID,
-				CatName:   call.AgentName,
-				SessionID: sessionID,
-				Timestamp: time.Now(),
-				Prompt:    call.Prompt,
-				Response:  "", // 回复稍后在 handleResult 中更新
-			})
-			LogDebug("[API] 已记录调用历史 - Cat: %s", call.AgentName)
-
-			// 通过 WebSocket 推送调用历史更新
-			sm.wsHub.BroadcastToSession(sessionID, "history", ctx.CallHistory)
-
-			// 发送任务到调度器
-			go func(agentCall AgentCall) {
-				LogInfo("[API] 准备发送任务到调度器 - Cat: %s", agentCall.AgentName)
-				taskID, err := ctx.Scheduler.SendTask(agentCall.AgentName, agentCall.Prompt, sessionID)
-				if err != nil {
-					LogError("[API] 发送任务失败 - Cat: %s, Error: %v", agentCall.AgentName, err)
-				} else {
-					LogInfo("[API] 任务已发送 - Cat: %s, TaskID: %s", agentCall.AgentName, taskID)
-				}
-			}(call)
+			LogInfo("[API] 编排器返回 %d 个猫猫调用", len(calls))
+
+			sm.dispatchAgentCalls(ctx, sessionID, calls)
 		}
 	}
 
@@ -630,10 +661,18 @@ func (sm *SessionManager) GetMessageStats(sessionID string) (*MessageStats, erro
 		}
 	}
 
-	return &MessageStats{
+	stats := &MessageStats{
 		TotalMessages: totalMessages,
 		CatMessages:   catMessages,
-	}, nil
+		ByCat:         make(map[string]UsageTotals),
+	}
+	if usage, err := loadUsageStats(sm.ctx, sm.redisClient, sessionID); err != nil {
+		LogWarn("[API] 读取用量统计失败: %v", err)
+	} else {
+		stats.Usage = usage.Total
+		stats.ByCat = usage.ByCat
+	}
+	return stats, nil
 }
 
 // GetCallHistory 获取调用历史
@@ -654,36 +693,29 @@ func (sm *SessionManager) GetCallHistory(sessionID string) ([]CallHistoryItem, e
 
 // GetCats 获取所有猫猫
 func (sm *SessionManager) GetCats() []Cat {
-	// 从配置文件构建猫猫列表
-	cats := make([]Cat, 0, len(sm.config.Agents))
-
-	LogDebug("[API] 配置中的 Agent 数量: %d", len(sm.config.Agents))
+	// 从猫猫注册表构建猫猫列表
+	agents := sm.cats.List()
+	cats := make([]Cat, 0, len(agents))
 
-	catIDMap := map[string]string{
-		"花花": "cat_001",
-		"薇薇": "cat_002",
-		"小乔": "cat_003",
-	}
+	LogDebug("[API] 注册表中的 Agent 数量: %d", len(agents))
 
-	catColorMap := map[string]string{
-		"花花": "#ff9966",
-		"薇薇": "#d9bf99",
-		"小乔": "#cccccc",
+	// 在线状态由工作进程心跳得出，读取失败时视为离线
+	presence, err := loadPresence(sm.ctx, sm.redisClient)
+	if err != nil {
+		LogWarn("[API] 读取猫猫心跳失败: %v", err)
 	}
 
-	for _, agent := range sm.config.Agents {
-		catID := catIDMap[agent.Name]
-		color := catColorMap[agent.Name]
-
+	for _, agent := range agents {
 		LogDebug("[API] aaaa添加猫猫: %s, Avatar: %s", agent.Name, agent.Avatar)
 
-		cats = append(cats, Cat{
-			ID:     catID,
+		cat := Cat{
+			ID:     agent.ID,
 			Name:   agent.Name,
 			Avatar: agent.Avatar,
-			Color:  color,
-			Status: "idle",
-		})
+			Color:  agent.Color,
+		}
+		cat.applyPresence(presence[agent.Name])
+		cats = append(cats, cat)
 	}
 
 	LogDebug("[API] 返回猫猫列表，数量: %d", len(cats))
@@ -817,14 +849,9 @@ func (sm *SessionManager) handleGetCats(c *gin.Context) {
 }
 
 func (sm *SessionManager) handleGetCat(c *gin.Context) {
-	catID := c.Param("catId")
-	cats := sm.GetCats()
-
-	for _, cat := range cats {
-		if cat.ID == catID {
-			c.JSON(http.StatusOK, cat)
-			return
-		}
+	if detail, ok := sm.catDetail(c.Param("catId")); ok {
+		c.JSON(http.StatusOK, detail)
+		return
 	}
 
 	c.JSON(http.StatusNotFound, gin.H{"error": "猫猫不存在"})
@@ -835,7 +862,7 @@ func (sm *SessionManager) handleGetAvailableCats(c *gin.Context) {
 	available := make([]Cat, 0)
 
 	for _, cat := range cats {
-		if cat.Status == "idle" {
+		if cat.Status == CatStatusIdle {
 			available = append(available, cat)
 		}
 	}
@@ -915,14 +942,13 @@ func (sm *SessionManager) handleSwitchMode(c *gin.Context) {
 		return
 	}
 
-	// 更新会话上下文
+	// 更新会话上下文（模式状态与编排器共享）
 	ctx.mu.Lock()
 	mode, _ := sm.orchestrator.registry.GetOrCreate(req.Mode, modeConfig)
 	ctx.Mode = mode
 	ctx.ModeConfig = modeConfig
-	ctx.ModeState = &ModeState{
-		CustomState:    make(map[string]interface{}),
-		LastUpdateTime: time.Now(),
+	if modeState, err := sm.orchestrator.GetModeState(sessionID); err == nil {
+		ctx.ModeState = modeState
 	}
 	ctx.mu.Unlock()
 
@@ -947,6 +973,203 @@ func (sm *SessionManager) handleSwitchMode(c *gin.Context) {
 	})
 }
 
+// ModeActionRequest 模式动作请求
+type ModeActionRequest struct {
+	Action string                 `json:"action" binding:"required"`
+	Params map[string]interface{} `json:"params,omitempty"`
+}
+
+// handleGetModeActions 获取会话当前步骤可执行的模式动作
+func (sm *SessionManager) handleGetModeActions(c *gin.Context) {
+	sessionID := c.Param("sessionId")
+
+	actions, err := sm.orchestrator.GetModeActions(sessionID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	modeName, _ := sm.orchestrator.GetCurrentMode(sessionID)
+	step := ""
+	if modeState, err := sm.orchestrator.GetModeState(sessionID); err == nil {
+		step = modeState.CurrentStep
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"mode":    modeName,
+		"step":    step,
+		"actions": actions,
+	})
+}
+
+// handleGetSubtaskGroups 获取会话中正在等待的子任务组（汇合屏障）状态
+func (sm *SessionManager) handleGetSubtaskGroups(c *gin.Context) {
+	sessionID := c.Param("sessionId")
+
+	groups, err := sm.orchestrator.GetSubtaskGroups(sessionID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, groups)
+}
+
+// handleGetOwnerRequests 获取会话中等待铲屎官回复的提问
+func (sm *SessionManager) handleGetOwnerRequests(c *gin.Context) {
+	sessionID := c.Param("sessionId")
+
+	requests, err := sm.orchestrator.GetOwnerRequests(sessionID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"awaitingOwner": len(requests) > 0,
+		"requests":      requests,
+	})
+}
+
+// handleCancelTask 取消会话中的单个猫猫任务
+func (sm *SessionManager) handleCancelTask(c *gin.Context) {
+	sessionID := c.Param("sessionId")
+	taskID := c.Param("taskId")
+
+	sm.mu.RLock()
+	ctx, exists := sm.sessions[sessionID]
+	sm.mu.RUnlock()
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "会话不存在"})
+		return
+	}
+
+	ctx.mu.Lock()
+	result, err := sm.cancelSessionTask(ctx, sessionID, taskID)
+	ctx.mu.Unlock()
+
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, ErrTaskNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, ErrTaskFinished):
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	sm.AutoSaveSession(sessionID)
+	c.JSON(http.StatusOK, result)
+}
+
+// handleCancelSessionTasks 取消会话中所有未完成的猫猫任务
+func (sm *SessionManager) handleCancelSessionTasks(c *gin.Context) {
+	sessionID := c.Param("sessionId")
+
+	sm.mu.RLock()
+	ctx, exists := sm.sessions[sessionID]
+	sm.mu.RUnlock()
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "会话不存在"})
+		return
+	}
+
+	ctx.mu.Lock()
+	var taskIDs []string
+	for _, item := range ctx.CallHistory {
+		if item.TaskID != "" && item.Status == TaskStatusPending {
+			taskIDs = append(taskIDs, item.TaskID)
+		}
+	}
+	cancelled := make([]*CancelResult, 0, len(taskIDs))
+	for _, taskID := range taskIDs {
+		result, err := sm.cancelSessionTask(ctx, sessionID, taskID)
+		if err != nil {
+			LogWarn("[API] 取消任务失败 - TaskID: %s, Error: %v", taskID, err)
+			continue
+		}
+		cancelled = append(cancelled, result)
+	}
+	ctx.mu.Unlock()
+
+	sm.AutoSaveSession(sessionID)
+	c.JSON(http.StatusOK, gin.H{
+		"cancelled": cancelled,
+		"count":     len(cancelled),
+	})
+}
+
+// handleModeAction 执行模式动作（批准、拒绝、跳过步骤等）
+func (sm *SessionManager) handleModeAction(c *gin.Context) {
+	sm.executeModeAction(c, "")
+}
+
+// handleIPDAction 执行 IPD 模式动作（兼容旧路由，仅允许 ipd_dev 模式）
+func (sm *SessionManager) handleIPDAction(c *gin.Context) {
+	sm.executeModeAction(c, "ipd_dev")
+}
+
+// executeModeAction 执行模式动作，requiredMode 非空时要求会话处于该模式
+func (sm *SessionManager) executeModeAction(c *gin.Context, requiredMode string) {
+	sessionID := c.Param("sessionId")
+
+	var req ModeActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sm.mu.RLock()
+	ctx, exists := sm.sessions[sessionID]
+	sm.mu.RUnlock()
+
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "会话不存在"})
+		return
+	}
+
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+
+	modeName := ctx.Mode.GetName()
+	if requiredMode != "" && modeName != requiredMode {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("当前模式 %s 不支持该动作", modeName)})
+		return
+	}
+
+	calls, err := sm.orchestrator.HandleModeAction(sessionID, req.Action, req.Params)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	step := ctx.ModeState.CurrentStep
+	LogInfo("[API] 模式动作已执行 - SessionID: %s, Mode: %s, Action: %s, Step: %s", sessionID, modeName, req.Action, step)
+	sm.appendSystemMessage(ctx, sessionID, fmt.Sprintf("动作已执行：%s（当前步骤：%s）", req.Action, step))
+	sm.dispatchAgentCalls(ctx, sessionID, calls)
+
+	actions, _ := sm.orchestrator.GetModeActions(sessionID)
+	result := gin.H{
+		"sessionId": sessionID,
+		"mode":      modeName,
+		"action":    req.Action,
+		"step":      step,
+		"state":     ctx.ModeState,
+		"calls":     len(calls),
+		"actions":   actions,
+	}
+
+	// 通过 WebSocket 推送动作结果
+	sm.wsHub.BroadcastToSession(sessionID, "mode_action", result)
+
+	// 自动保存会话
+	sm.AutoSaveSession(sessionID)
+
+	c.JSON(http.StatusOK, result)
+}
+
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true // 允许所有来源，生产环境应该限制
@@ -1045,6 +1268,10 @@ func (sm *SessionManager) SetupRouter() *gin.Engine {
 		api.GET("/cats", sm.handleGetCats)
 		api.GET("/cats/:catId", sm.handleGetCat)
 		api.GET("/cats/available", sm.handleGetAvailableCats)
+		api.POST("/cats", requireOwner, sm.handleCreateCat)
+		api.PUT("/cats/:catId", requireOwner, sm.handleUpdateCat)
+		api.DELETE("/cats/:catId", requireOwner, sm.handleDeleteCat)
+		api.POST("/cats/:catId/workers", requireOwner, sm.handleSpawnCatWorker)
 
 		// 调用历史
 		api.GET("/sessions/:sessionId/history", sm.handleGetCallHistory)
@@ -1053,6 +1280,15 @@ func (sm *SessionManager) SetupRouter() *gin.Engine {
 		api.GET("/modes", sm.handleGetModes)
 		api.GET("/sessions/:sessionId/mode", sm.handleGetSessionMode)
 		api.PUT("/sessions/:sessionId/mode", sm.handleSwitchMode)
+		api.GET("/sessions/:sessionId/mode/actions", sm.handleGetModeActions)
+		api.POST("/sessions/:sessionId/mode/action", sm.handleModeAction)
+		api.POST("/sessions/:sessionId/mode/ipd/action", sm.handleIPDAction)
+		api.GET("/sessions/:sessionId/groups", sm.handleGetSubtaskGroups)
+		api.GET("/sessions/:sessionId/owner-requests", sm.handleGetOwnerRequests)
+		api.DELETE("/sessions/:sessionId/tasks", sm.handleCancelSessionTasks)
+		api.DELETE("/sessions/:sessionId/tasks/:taskId", sm.handleCancelTask)
+		api.GET("/sessions/:sessionId/budget", sm.handleGetBudget)
+		api.PUT("/budgets", requireOwner, sm.handleUpdateBudget)
 
 		// 工作区管理
 		api.GET("/workspaces", sm.handleGetWorkspaces)
@@ -1063,6 +1299,7 @@ func (sm *SessionManager) SetupRouter() *gin.Engine {
 
 		// Session Chain 状态
 		api.GET("/sessions/:sessionId/chain-status", sm.handleGetChainStatus)
+		api.GET("/sessions/:sessionId/invocations/:invocationId", sm.handleGetInvocation)
 
 		// Hindsight 长期记忆状态
 		api.GET("/hindsight/health", sm.handleHindsightHealth)
@@ -1072,6 +1309,11 @@ func (sm *SessionManager) SetupRouter() *gin.Engine {
 		api.POST("/deployments/:deploymentId/promote", sm.handlePromoteToProduction)
 		api.GET("/deployments/:deploymentId", sm.handleGetDeployment)
 		api.GET("/workspaces/:workspaceId/deployments", sm.handleGetDeployments)
+
+		// 隔离分支相关
+		api.GET("/workspaces/:workspaceId/worktrees", sm.handleGetWorktrees)
+		api.POST("/workspaces/:workspaceId/worktrees/:worktreeId/merge", sm.handleMergeWorktree)
+		api.DELETE("/workspaces/:workspaceId/worktrees/:worktreeId", sm.handleDiscardWorktree)
 	}
 
 	return r
@@ -1109,6 +1351,27 @@ type ActiveSessionResponse struct {
 	MaxEventsPerSession int     `json:"maxEventsPerSession"`
 }
 
+// handleGetInvocation 获取一次猫猫调用的详情（含工具调用），Invocation ID 与任务 ID 相同
+func (sm *SessionManager) handleGetInvocation(c *gin.Context) {
+	sessionID := c.Param("sessionId")
+	invocationID := c.Param("invocationId")
+
+	if sm.chainManager == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Session Chain 功能未启用"})
+		return
+	}
+
+	inv, err := sm.chainManager.GetInvocation(sessionID, invocationID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Invocation 不存在: %s", invocationID)})
+		return
+	}
+	if inv.ToolCalls == nil {
+		inv.ToolCalls = []ToolCall{}
+	}
+	c.JSON(http.StatusOK, inv)
+}
+
 // handleGetChainStatus 获取 Session Chain 状态
 func (sm *SessionManager) handleGetChainStatus(c *gin.Context) {
 	sessionID := c.Param("sessionId")
@@ -1281,6 +1544,9 @@ func loadConfig(path string) (*Config, error) {
 	if err := yaml.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("解析配置文件失败: %w", err)
 	}
+	if err := validateAgentConfigs(config.Agents); err != nil {
+		return nil, err
+	}
 
 	return &config, nil
 }
@@ -1371,6 +1637,27 @@ func (sm *SessionManager) handleResult(message redis.XMessage) error {
 	ctx.mu.Lock()
 	defer ctx.mu.Unlock()
 
+	// 调用已结束，用量已由 Agent 记录，检查是否达到预算提醒阈值
+	sm.checkBudgetWarnings(ctx, task.SessionID, task.AgentName)
+
+	// 任务已被取消：不产生猫猫消息，只结束对应的子任务
+	if task.Status == TaskStatusCancelled {
+		LogInfo("[API] ⏹ Agent 任务已取消 - SessionID: %s, Agent: %s, TaskID: %s", task.SessionID, task.AgentName, task.TaskID)
+		sm.finishUnansweredCall(ctx, task.SessionID, &task, TaskStatusCancelled, SubtaskFailed)
+		return nil
+	}
+
+	// 任务执行失败（如超时）：记录系统事件并通知会话
+	if task.Status == TaskStatusFailed {
+		sm.handleTaskFailure(ctx, &task)
+		return nil
+	}
+
+	// 主后端不可用、由备用后端回答：在猫猫消息之前说明实际回答的后端
+	if len(task.Failover) > 0 {
+		sm.recordSystemEvent(ctx, task.SessionID, failoverNotice(&task))
+	}
+
 	agentMsg := Message{
 		ID:        fmt.Sprintf("msg_%s", uuid.New().String()[:8]),
 		Type:      "cat",
@@ -1378,6 +1665,7 @@ func (sm *SessionManager) handleResult(message redis.XMessage) error {
 		Timestamp: time.Now(),
 		SessionID: task.SessionID,
 		Sender:    sm.getCatInfoByName(task.AgentName),
+		TaskID:    task.TaskID,
 	}
 
 	ctx.MessageCount++
@@ -1406,8 +1694,13 @@ func (sm *SessionManager) handleResult(message redis.XMessage) error {
 	// 通过 WebSocket 推送猫猫消息
 	sm.wsHub.BroadcastToSession(task.SessionID, "message", agentMsg)
 
+	// 工作区开启隔离时，修改留在任务的分支上，等待合并或丢弃
+	if task.Worktree != nil && task.Worktree.Changed {
+		sm.recordSystemEvent(ctx, task.SessionID, worktreeNotice(&task))
+	}
+
 	// 更新调用历史中的 Response
-	sm.updateCallHistoryResponse(ctx, task.AgentName, task.Result)
+	sm.updateCallHistoryResponse(ctx, task.TaskID, task.AgentName, task.Result)
 
 	// 通过 WebSocket 推送调用历史更新
 	sm.wsHub.BroadcastToSession(task.SessionID, "history", ctx.CallHistory)
@@ -1424,7 +1717,7 @@ func (sm *SessionManager) handleResult(message redis.XMessage) error {
 	})
 
 	// 通过编排器处理猫猫回复，获取下一步需要调用的猫猫
-	calls, err := sm.orchestrator.HandleAgentResponse(task.SessionID, task.AgentName, task.Result)
+	calls, err := sm.orchestrator.HandleAgentResult(task.SessionID, task.AgentName, task.Result, task.Metadata, task.Chain)
 	if err != nil {
 		LogError("[API] 编排器处理猫猫回复失败: %v", err)
 		return fmt.Errorf("处理猫猫回复失败: %w", err)
@@ -1432,119 +1725,380 @@ func (sm *SessionManager) handleResult(message redis.XMessage) error {
 
 	LogInfo("[API] 编排器返回 %d 个后续猫猫调用", len(calls))
 
-	// 处理每个后续调用
+	sm.dispatchAgentCalls(ctx, task.SessionID, calls)
+
+	// 猫猫 @铲屎官：登记提问，会话进入等待铲屎官回复状态
+	if req := sm.orchestrator.RequestOwnerInput(task.SessionID, task.AgentName, task.Result, task.Chain); req != nil {
+		sm.recordOwnerRequest(ctx, task.SessionID, req)
+		sm.AutoSaveSession(task.SessionID)
+	}
+
+	return nil
+}
+
+// dispatchAgentCalls 记录调用历史并将猫猫调用发送到调度器
+// 调用方需持有 ctx.mu 写锁
+func (sm *SessionManager) dispatchAgentCalls(ctx *SessionContext, sessionID string, calls []AgentCall) {
 	for _, call := range calls {
-		catID := getCatIDByName(call.AgentName)
+		catID := sm.cats.IDByName(call.AgentName)
 
-		// 只在猫猫第一次被调用时添加系统消息
+		// 只在猫猫第一次加入时添加系统消息
 		if !ctx.JoinedCats[catID] {
-			systemMsg := Message{
-				ID:        fmt.Sprintf("msg_%s", uuid.New().String()[:8]),
-				Type:      "system",
-				Content:   fmt.Sprintf("%s 已加入对话", call.AgentName),
-				Timestamp: time.Now(),
-				SessionID: task.SessionID,
-			}
-			ctx.SystemMessages = append(ctx.SystemMessages, systemMsg)
+			sm.appendSystemMessage(ctx, sessionID, fmt.Sprintf("%s 已加入对话", call.AgentName))
 			ctx.JoinedCats[catID] = true
-			LogDebug("[API] 猫猫互相调用 - 已添加系统消息: %s", systemMsg.ID)
-
-			// 通过 WebSocket 推送系统消息
-			sm.wsHub.BroadcastToSession(task.SessionID, "message", systemMsg)
+		} else {
+			LogDebug("[API] 猫猫 %s 已在会话中，跳过系统消息", call.AgentName)
 		}
 
+		// 预先生成任务 ID，调用历史据此支持取消
+		taskID := NewTaskID(call.AgentName)
+
 		// 记录调用历史
 		ctx.CallHistory = append(ctx.CallHistory, CallHistoryItem{
 			CatID:     catID,
 			CatName:   call.AgentName,
-			SessionID: task.SessionID,
+			SessionID: sessionID,
 			Timestamp: time.Now(),
 			Prompt:    call.Prompt,
-			Response:  "", // 回复稍后更新
+			Response:  "", // 回复稍后在 handleResult 中更新
+			TaskID:    taskID,
+			Status:    TaskStatusPending,
 		})
-		LogDebug("[API] 猫猫互相调用 - 已记录调用历史: %s", call.AgentName)
+		LogDebug("[API] 已记录调用历史 - Caller: %s, Cat: %s", call.CallerName, call.AgentName)
 
 		// 通过 WebSocket 推送调用历史更新
-		sm.wsHub.BroadcastToSession(task.SessionID, "history", ctx.CallHistory)
+		sm.wsHub.BroadcastToSession(sessionID, "history", ctx.CallHistory)
+
+		task := TaskMessage{
+			TaskID:      taskID,
+			AgentName:   call.AgentName,
+			Content:     call.Prompt,
+			SessionID:   sessionID,
+			WorkspaceID: ctx.WorkspaceID,
+			Metadata:    taskMetadata(ctx, call.Metadata),
+			Chain:       call.Chain,
+			Timeout:     int(metadataSeconds(call.Metadata[MetaTaskTimeout]) / time.Second),
+		}
 
-		// 发送任务到调度器
-		go func(agentCall AgentCall) {
-			LogInfo("[API] 猫猫互相调用 - 准备发送任务: %s", agentCall.AgentName)
-			taskID, err := ctx.Scheduler.SendTask(agentCall.AgentName, agentCall.Prompt, task.SessionID)
-			if err != nil {
-				LogError("[API] 猫猫互相调用 - 发送任务失败: %s, Error: %v", agentCall.AgentName, err)
-			} else {
-				LogInfo("[API] 猫猫互相调用 - 任务已发送: %s, TaskID: %s", agentCall.AgentName, taskID)
-			}
-		}(call)
+		// 预算已用尽：按配置排队或拒绝
+		if status := sm.exceededBudget(sessionID, call.AgentName); status != nil {
+			sm.holdOverBudgetTask(ctx, sessionID, task, status)
+			continue
+		}
+
+		LogInfo("[API] 准备发送任务到调度器 - Caller: %s, Cat: %s", call.CallerName, call.AgentName)
+		sm.sendTask(ctx, task)
 	}
+}
 
-	return nil
+// taskMetadata 复制调用的元数据，并附上会话当前的模式和步骤
+func taskMetadata(ctx *SessionContext, callMetadata map[string]interface{}) map[string]interface{} {
+	metadata := make(map[string]interface{}, len(callMetadata)+2)
+	for key, value := range callMetadata {
+		metadata[key] = value
+	}
+	if ctx.Mode != nil {
+		metadata[MetaMode] = ctx.Mode.GetName()
+	}
+	if ctx.ModeState != nil && ctx.ModeState.CurrentStep != "" {
+		metadata[MetaModeStep] = ctx.ModeState.CurrentStep
+	}
+	return metadata
 }
 
-// updateCallHistoryResponse 更新调用历史中的 Response
-func (sm *SessionManager) updateCallHistoryResponse(ctx *SessionContext, catName string, response string) {
-	// 从后往前查找最近一次该猫猫的调用记录（Response 为空的）
-	for i := len(ctx.CallHistory) - 1; i >= 0; i-- {
-		if ctx.CallHistory[i].CatName == catName && ctx.CallHistory[i].Response == "" {
-			ctx.CallHistory[i].Response = response
-			LogDebug("[API] 已更新调用历史 Response - Cat: %s", catName)
-			break
+// sendTask 异步发送任务到会话的调度器
+func (sm *SessionManager) sendTask(ctx *SessionContext, task TaskMessage) {
+	go func() {
+		if _, err := ctx.Scheduler.SendTaskMessage(task); err != nil {
+			LogError("[API] 发送任务失败 - Cat: %s, Error: %v", task.AgentName, err)
+		} else {
+			LogInfo("[API] 任务已发送 - Cat: %s, TaskID: %s", task.AgentName, task.TaskID)
 		}
+	}()
+}
+
+// cancelSessionTask 取消会话中的猫猫任务，并在调用历史和 Session Chain 中记录
+// 仍在队列中的任务不会再产生结果，直接结束对应的子任务；正在执行的任务由 Agent 回报取消结果后结束
+// 调用方需持有 ctx.mu 写锁
+func (sm *SessionManager) cancelSessionTask(ctx *SessionContext, sessionID string, taskID string) (*CancelResult, error) {
+	item := findCallHistoryItem(ctx.CallHistory, taskID, "")
+	if item == nil {
+		return nil, fmt.Errorf("%w: %s", ErrTaskNotFound, taskID)
+	}
+	if item.Status != "" && item.Status != TaskStatusPending {
+		return nil, fmt.Errorf("%w: %s (%s)", ErrTaskFinished, taskID, item.Status)
+	}
+
+	// 因预算排队的任务还没有进入调度器，直接移除
+	if task := sm.removeBudgetQueuedTask(sessionID, taskID); task != nil {
+		LogInfo("[API] ⏹ 已取消预算排队中的任务 - Cat: %s, TaskID: %s", task.AgentName, taskID)
+		item.Status = TaskStatusCancelled
+		sm.wsHub.BroadcastToSession(sessionID, "history", ctx.CallHistory)
+		sm.recordSystemEvent(ctx, sessionID, fmt.Sprintf("⏹ 已取消 %s 的任务（%s）", item.CatName, taskID))
+		sm.finishUnansweredCall(ctx, sessionID, task, TaskStatusCancelled, SubtaskFailed)
+		return &CancelResult{TaskID: taskID, AgentName: task.AgentName, Removed: true, Task: task}, nil
+	}
+
+	result, err := ctx.Scheduler.CancelTask(taskID)
+	if err != nil {
+		return nil, err
+	}
+	LogInfo("[API] ⏹ 已取消任务 - Cat: %s, TaskID: %s, 出队: %v", item.CatName, taskID, result.Removed)
+
+	item.Status = TaskStatusCancelled
+	sm.wsHub.BroadcastToSession(sessionID, "history", ctx.CallHistory)
+	sm.recordSystemEvent(ctx, sessionID, fmt.Sprintf("⏹ 已取消 %s 的任务（%s）", item.CatName, taskID))
+
+	if result.Removed && result.Task != nil {
+		sm.finishUnansweredCall(ctx, sessionID, result.Task, TaskStatusCancelled, SubtaskFailed)
 	}
+	return result, nil
 }
 
-// getCatIDByName 根据猫猫名字获取 ID
-func getCatIDByName(name string) string {
-	catMap := map[string]string{
-		"花花": "cat_001",
-		"薇薇": "cat_002",
-		"小乔": "cat_003",
+// handleTaskFailure 处理 Agent 报告的失败任务：写入 Session Chain 系统事件，推送 task_failed 通知，并结束对应的调用
+// 调用方需持有 ctx.mu 写锁
+func (sm *SessionManager) handleTaskFailure(ctx *SessionContext, task *TaskMessage) {
+	LogWarn("[API] ❌ Agent 任务失败 - SessionID: %s, Agent: %s, TaskID: %s, 原因: %s", task.SessionID, task.AgentName, task.TaskID, task.Error)
+
+	subtaskStatus := SubtaskFailed
+	content := fmt.Sprintf("❌ %s 的任务失败：%s", task.AgentName, task.Error)
+	if task.FailReason == TaskFailTimeout {
+		subtaskStatus = SubtaskTimeout
+		content = fmt.Sprintf("⏱ %s 的任务%s", task.AgentName, task.Error)
+	}
+	sm.recordSystemEvent(ctx, task.SessionID, content)
+	sm.wsHub.BroadcastToSession(task.SessionID, "task_failed", gin.H{
+		"sessionId": task.SessionID,
+		"taskId":    task.TaskID,
+		"agentName": task.AgentName,
+		"reason":    task.FailReason,
+		"error":     task.Error,
+	})
+
+	if item := findCallHistoryItem(ctx.CallHistory, task.TaskID, task.AgentName); item != nil {
+		item.Error = task.Error
 	}
-	if id, ok := catMap[name]; ok {
-		return id
+	sm.finishUnansweredCall(ctx, task.SessionID, task, TaskStatusFailed, subtaskStatus)
+}
+
+// finishUnansweredCall 结束没有产生回复的调用（取消、失败）：标记调用历史，并让编排器以 subtaskStatus 结束所属子任务
+// 调用方需持有 ctx.mu 写锁
+func (sm *SessionManager) finishUnansweredCall(ctx *SessionContext, sessionID string, task *TaskMessage, historyStatus string, subtaskStatus string) {
+	if item := findCallHistoryItem(ctx.CallHistory, task.TaskID, task.AgentName); item != nil && item.Status != historyStatus {
+		item.Status = historyStatus
+		sm.wsHub.BroadcastToSession(sessionID, "history", ctx.CallHistory)
 	}
-	return "cat_unknown"
+
+	calls, err := sm.orchestrator.HandleAgentFailure(sessionID, task.AgentName, task.Metadata, subtaskStatus)
+	if err != nil {
+		LogError("[API] 编排器处理未完成任务失败: %v", err)
+		return
+	}
+	sm.dispatchAgentCalls(ctx, sessionID, calls)
+	sm.AutoSaveSession(sessionID)
 }
 
-// getCatInfoByName 根据猫猫名字获取完整信息
-func (sm *SessionManager) getCatInfoByName(name string) *Sender {
-	catIDMap := map[string]string{
-		"花花": "cat_001",
-		"薇薇": "cat_002",
-		"小乔": "cat_003",
+// appendSystemMessage 添加系统消息并通过 WebSocket 推送
+// 调用方需持有 ctx.mu 写锁
+func (sm *SessionManager) appendSystemMessage(ctx *SessionContext, sessionID string, content string) Message {
+	systemMsg := Message{
+		ID:        fmt.Sprintf("msg_%s", uuid.New().String()[:8]),
+		Type:      "system",
+		Content:   content,
+		Timestamp: time.Now(),
+		SessionID: sessionID,
+	}
+	ctx.SystemMessages = append(ctx.SystemMessages, systemMsg)
+	LogDebug("[API] 已添加系统消息: %s", systemMsg.ID)
+
+	sm.wsHub.BroadcastToSession(sessionID, "message", systemMsg)
+	return systemMsg
+}
+
+// recordSystemEvent 记录系统事件：写入 Session Chain（持久化并进入猫猫上下文）并通过 WebSocket 推送
+// Session Chain 不可用时退化为内存中的系统消息。调用方需持有 ctx.mu 写锁
+func (sm *SessionManager) recordSystemEvent(ctx *SessionContext, sessionID string, content string) Message {
+	if sm.chainManager == nil {
+		return sm.appendSystemMessage(ctx, sessionID, content)
+	}
+
+	systemMsg := Message{
+		ID:        fmt.Sprintf("msg_%s", uuid.New().String()[:8]),
+		Type:      "system",
+		Content:   content,
+		Timestamp: time.Now(),
+		SessionID: sessionID,
+	}
+
+	sm.chainManager.GetOrCreateChain(sessionID)
+	if err := sm.chainManager.AppendEvent(sessionID, SessionEvent{
+		Type:    SCEventSystem,
+		Sender:  "system",
+		Content: content,
+		MsgID:   systemMsg.ID,
+	}); err != nil {
+		LogWarn("[API] 系统事件写入 Session Chain 失败: %v", err)
+		return sm.appendSystemMessage(ctx, sessionID, content)
+	}
+	sm.pushChainStatus(sessionID)
+
+	sm.wsHub.BroadcastToSession(sessionID, "message", systemMsg)
+	return systemMsg
+}
+
+// recordOwnerRequest 记录猫猫向铲屎官的提问：写入 Session Chain 并推送 owner_request 通知
+// 调用方需持有 ctx.mu 写锁
+func (sm *SessionManager) recordOwnerRequest(ctx *SessionContext, sessionID string, req *OwnerRequest) {
+	content := formatOwnerRequest(req.AgentName, req.Question)
+
+	recorded := false
+	if sm.chainManager != nil {
+		msgID := fmt.Sprintf("msg_%s", uuid.New().String()[:8])
+		sm.chainManager.GetOrCreateChain(sessionID)
+		if err := sm.chainManager.AppendEvent(sessionID, SessionEvent{
+			Type:    SCEventOwnerRequest,
+			Sender:  req.AgentName,
+			Content: req.Question,
+			MsgID:   msgID,
+		}); err != nil {
+			LogWarn("[API] 铲屎官提问写入 Session Chain 失败: %v", err)
+		} else {
+			sm.pushChainStatus(sessionID)
+			sm.wsHub.BroadcastToSession(sessionID, "message", Message{
+				ID:        msgID,
+				Type:      "system",
+				Content:   content,
+				Timestamp: time.Now(),
+				SessionID: sessionID,
+			})
+			recorded = true
+		}
+	}
+	if !recorded {
+		sm.appendSystemMessage(ctx, sessionID, content)
 	}
 
-	catColorMap := map[string]string{
-		"花花": "#ff9966",
-		"薇薇": "#d9bf99",
-		"小乔": "#cccccc",
+	pending, _ := sm.orchestrator.GetOwnerRequests(sessionID)
+	sm.wsHub.BroadcastToSession(sessionID, "owner_request", gin.H{
+		"sessionId": sessionID,
+		"request":   *req,
+		"pending":   pending,
+	})
+}
+
+// PostSystemMessage 实现 ModeNotifier：异步记录系统事件（模式回调时会话锁可能已被持有）
+func (sm *SessionManager) PostSystemMessage(sessionID string, content string) {
+	go func() {
+		sm.mu.RLock()
+		ctx, exists := sm.sessions[sessionID]
+		sm.mu.RUnlock()
+		if !exists {
+			return
+		}
+
+		ctx.mu.Lock()
+		sm.recordSystemEvent(ctx, sessionID, content)
+		ctx.mu.Unlock()
+
+		sm.AutoSaveSession(sessionID)
+	}()
+}
+
+// BroadcastModeEvent 实现 ModeNotifier：推送模式事件
+func (sm *SessionManager) BroadcastModeEvent(sessionID string, eventType string, data interface{}) {
+	sm.wsHub.BroadcastToSession(sessionID, eventType, data)
+}
+
+// DispatchModeCalls 实现 ModeNotifier：异步派发模式产生的猫猫调用
+func (sm *SessionManager) DispatchModeCalls(sessionID string, calls []AgentCall) {
+	go func() {
+		sm.mu.RLock()
+		ctx, exists := sm.sessions[sessionID]
+		sm.mu.RUnlock()
+		if !exists {
+			return
+		}
+
+		ctx.mu.Lock()
+		sm.dispatchAgentCalls(ctx, sessionID, calls)
+		ctx.mu.Unlock()
+
+		sm.AutoSaveSession(sessionID)
+	}()
+}
+
+// RunModeTimer 实现 ModeNotifier：在会话锁内执行定时器触发的模式逻辑并派发返回的调用
+func (sm *SessionManager) RunModeTimer(sessionID string, fn func() []AgentCall) {
+	sm.mu.RLock()
+	ctx, exists := sm.sessions[sessionID]
+	sm.mu.RUnlock()
+	if !exists {
+		return
+	}
+
+	ctx.mu.Lock()
+	if calls := fn(); len(calls) > 0 {
+		sm.dispatchAgentCalls(ctx, sessionID, calls)
+	}
+	ctx.mu.Unlock()
+
+	sm.AutoSaveSession(sessionID)
+}
+
+// updateCallHistoryResponse 更新调用历史中的 Response
+func (sm *SessionManager) updateCallHistoryResponse(ctx *SessionContext, taskID string, catName string, response string) {
+	if item := findCallHistoryItem(ctx.CallHistory, taskID, catName); item != nil {
+		item.Response = response
+		item.Status = TaskStatusCompleted
+		LogDebug("[API] 已更新调用历史 Response - Cat: %s", catName)
 	}
+}
 
-	// 从配置中查找头像
-	avatar := ""
-	for _, agent := range sm.config.Agents {
-		if agent.Name == name {
-			avatar = agent.Avatar
-			break
+// findCallHistoryItem 查找任务对应的调用记录
+// 优先按任务 ID 匹配；旧记录没有任务 ID 时，从后往前查找该猫猫最近一次未回复且未取消的调用
+func findCallHistoryItem(history []CallHistoryItem, taskID string, catName string) *CallHistoryItem {
+	if taskID != "" {
+		for i := len(history) - 1; i >= 0; i-- {
+			if history[i].TaskID == taskID {
+				return &history[i]
+			}
+		}
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		item := &history[i]
+		if item.CatName == catName && item.Response == "" && item.Status != TaskStatusCancelled {
+			return item
 		}
 	}
+	return nil
+}
+
+// getCatInfoByName 根据猫猫名字获取完整信息
+func (sm *SessionManager) getCatInfoByName(name string) *Sender {
+	// 已删除的猫猫只保留名字
+	agent, _ := sm.cats.Get(name)
 
 	return &Sender{
-		ID:     catIDMap[name],
+		ID:     agent.ID,
 		Name:   name,
-		Avatar: avatar,
-		Color:  catColorMap[name],
+		Avatar: agent.Avatar,
+		Color:  agent.Color,
 	}
 }
 
 // eventToMessage 将 SessionEvent 转换为前端需要的 Message 格式
 func (sm *SessionManager) eventToMessage(ev SessionEvent, threadID string) Message {
 	msgType := "user"
+	content := ev.Content
 	var sender *Sender
 	if ev.Type == SCEventCat {
 		msgType = "cat"
 		sender = sm.getCatInfoByName(ev.Sender)
+	} else if ev.Type == SCEventSystem {
+		msgType = "system"
+	} else if ev.Type == SCEventOwnerRequest {
+		msgType = "system"
+		content = formatOwnerRequest(ev.Sender, ev.Content)
 	} else {
 		sender = &Sender{
 			ID:     "user_001",
@@ -1559,7 +2113,7 @@ func (sm *SessionManager) eventToMessage(ev SessionEvent, threadID string) Messa
 	return Message{
 		ID:        msgID,
 		Type:      msgType,
-		Content:   ev.Content,
+		Content:   content,
 		Sender:    sender,
 		Timestamp: ev.Timestamp,
 		SessionID: threadID,
@@ -1575,19 +2129,31 @@ func (sm *SessionManager) handleGetWorkspaces(c *gin.Context) {
 
 func (sm *SessionManager) handleCreateWorkspace(c *gin.Context) {
 	var req struct {
-		Path string        `json:"path" binding:"required"`
-		Type WorkspaceType `json:"type" binding:"required"`
+		Path      string        `json:"path" binding:"required"`
+		Type      WorkspaceType `json:"type" binding:"required"`
+		Isolation string        `json:"isolation"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := validateIsolation(req.Isolation); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	workspace, err := sm.workspaceManager.CreateWorkspace(req.Path, req.Type)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if req.Isolation != WorkspaceIsolationShared {
+		workspace, err = sm.workspaceManager.UpdateWorkspace(workspace.ID, map[string]interface{}{"isolation": req.Isolation})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
 	c.JSON(http.StatusOK, workspace)
 }
@@ -1610,6 +2176,12 @@ func (sm *SessionManager) handleUpdateWorkspace(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if isolation, ok := updates["isolation"].(string); ok {
+		if err := validateIsolation(isolation); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
 	workspace, err := sm.workspaceManager.UpdateWorkspace(workspaceID, updates)
 	if err != nil {
@@ -1673,3 +2245,50 @@ func (sm *SessionManager) handleGetDeployments(c *gin.Context) {
 	deployments := sm.workspaceManager.ListDeployments(workspaceID)
 	c.JSON(http.StatusOK, deployments)
 }
+
+// handleGetWorktrees 列出工作区中等待合并或丢弃的隔离分支
+func (sm *SessionManager) handleGetWorktrees(c *gin.Context) {
+	workspaceID := c.Param("workspaceId")
+	if _, err := sm.workspaceManager.GetWorkspace(workspaceID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	worktrees, err := sm.workspaceManager.ListWorktrees(workspaceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, worktrees)
+}
+
+// handleMergeWorktree 将隔离分支合并到工作区
+func (sm *SessionManager) handleMergeWorktree(c *gin.Context) {
+	worktree, err := sm.workspaceManager.MergeWorktree(c.Param("workspaceId"), c.Param("worktreeId"))
+	if err != nil {
+		c.JSON(worktreeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, worktree)
+}
+
+// handleDiscardWorktree 丢弃隔离分支
+func (sm *SessionManager) handleDiscardWorktree(c *gin.Context) {
+	if _, err := sm.workspaceManager.DiscardWorktree(c.Param("workspaceId"), c.Param("worktreeId")); err != nil {
+		c.JSON(worktreeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// worktreeErrorStatus 隔离分支操作错误对应的 HTTP 状态码
+func worktreeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrWorktreeNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrWorktreeBusy), errors.Is(err, ErrWorktreeConflict):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
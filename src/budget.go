@@ -0,0 +1,594 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// 预算范围
+const (
+	BudgetScopeSession = "session" // 单个会话的累计用量
+	BudgetScopeCat     = "cat"     // 单只猫猫当天在全部会话中的用量
+	BudgetScopeDaily   = "daily"   // 全部猫猫当天的用量
+)
+
+// 超出预算时的处理方式
+const (
+	BudgetOnExceedRefuse = "refuse" // 拒绝任务（按失败结束）
+	BudgetOnExceedQueue  = "queue"  // 任务排队，提高预算后继续
+)
+
+// 预算提醒级别
+const (
+	BudgetLevelWarning  = "warning"
+	BudgetLevelExceeded = "exceeded"
+)
+
+// defaultBudgetWarnAt 未配置 warn_at 时的提醒阈值
+const defaultBudgetWarnAt = 0.8
+
+// BudgetLimit 一个预算范围的上限，两项都为 0 表示不限制
+type BudgetLimit struct {
+	MaxCostUSD float64 `yaml:"max_cost_usd,omitempty" json:"maxCostUsd"`
+	MaxTokens  int64   `yaml:"max_tokens,omitempty" json:"maxTokens"` // 输入 + 输出 token
+}
+
+// Unlimited 是否不限制
+func (l BudgetLimit) Unlimited() bool {
+	return l.MaxCostUSD <= 0 && l.MaxTokens <= 0
+}
+
+// BudgetConfig 预算配置
+type BudgetConfig struct {
+	Session  BudgetLimit `yaml:"session,omitempty"`
+	PerCat   BudgetLimit `yaml:"per_cat,omitempty"`
+	Daily    BudgetLimit `yaml:"daily,omitempty"`
+	WarnAt   float64     `yaml:"warn_at,omitempty"`   // 用量达到上限的该比例时提醒，默认 0.8
+	OnExceed string      `yaml:"on_exceed,omitempty"` // "refuse"（默认）| "queue"
+}
+
+func (c *BudgetConfig) warnAt() float64 {
+	if c == nil || c.WarnAt <= 0 || c.WarnAt >= 1 {
+		return defaultBudgetWarnAt
+	}
+	return c.WarnAt
+}
+
+func (c *BudgetConfig) onExceed() string {
+	if c != nil && c.OnExceed == BudgetOnExceedQueue {
+		return BudgetOnExceedQueue
+	}
+	return BudgetOnExceedRefuse
+}
+
+// onExceedText 超出预算后任务的去向，用于系统消息
+func onExceedText(action string) string {
+	if action == BudgetOnExceedQueue {
+		return "排队等待"
+	}
+	return "被拒绝"
+}
+
+// limitFor 配置中某个范围的上限
+func (c *BudgetConfig) limitFor(scope string) BudgetLimit {
+	if c == nil {
+		return BudgetLimit{}
+	}
+	switch scope {
+	case BudgetScopeSession:
+		return c.Session
+	case BudgetScopeCat:
+		return c.PerCat
+	default:
+		return c.Daily
+	}
+}
+
+// BudgetStatus 一个预算范围的使用情况
+type BudgetStatus struct {
+	Scope       string      `json:"scope"`
+	CatName     string      `json:"catName,omitempty"`
+	Limit       BudgetLimit `json:"limit"`
+	UsedCostUSD float64     `json:"usedCostUsd"`
+	UsedTokens  int64       `json:"usedTokens"`
+	Ratio       float64     `json:"ratio"` // 已用比例（费用与 token 取较大者），不限制时为 0
+}
+
+// Exceeded 是否已用尽
+func (s BudgetStatus) Exceeded() bool {
+	return s.Ratio >= 1
+}
+
+// Describe 用于系统消息的范围描述
+func (s BudgetStatus) Describe() string {
+	switch s.Scope {
+	case BudgetScopeSession:
+		return "会话预算"
+	case BudgetScopeCat:
+		return fmt.Sprintf("%s 今日预算", s.CatName)
+	default:
+		return "今日总预算"
+	}
+}
+
+// usageSummary 已用量与上限，如 "$4.10 / $5.00，12000 / 20000 tokens"
+func (s BudgetStatus) usageSummary() string {
+	var parts []string
+	if s.Limit.MaxCostUSD > 0 {
+		parts = append(parts, fmt.Sprintf("$%.2f / $%.2f", s.UsedCostUSD, s.Limit.MaxCostUSD))
+	}
+	if s.Limit.MaxTokens > 0 {
+		parts = append(parts, fmt.Sprintf("%d / %d tokens", s.UsedTokens, s.Limit.MaxTokens))
+	}
+	return strings.Join(parts, "，")
+}
+
+// newBudgetStatus 根据上限和累计用量计算使用情况
+func newBudgetStatus(scope, catName string, limit BudgetLimit, used UsageTotals) BudgetStatus {
+	status := BudgetStatus{
+		Scope:       scope,
+		CatName:     catName,
+		Limit:       limit,
+		UsedCostUSD: used.CostUSD,
+		UsedTokens:  used.TokensIn + used.TokensOut,
+	}
+	if limit.MaxCostUSD > 0 {
+		status.Ratio = status.UsedCostUSD / limit.MaxCostUSD
+	}
+	if limit.MaxTokens > 0 {
+		if ratio := float64(status.UsedTokens) / float64(limit.MaxTokens); ratio > status.Ratio {
+			status.Ratio = ratio
+		}
+	}
+	return status
+}
+
+// budgetLevel 预算提醒级别，未达到提醒阈值（或不限制）时返回空
+func budgetLevel(status BudgetStatus, warnAt float64) string {
+	switch {
+	case status.Limit.Unlimited():
+		return ""
+	case status.Exceeded():
+		return BudgetLevelExceeded
+	case status.Ratio >= warnAt:
+		return BudgetLevelWarning
+	}
+	return ""
+}
+
+// budgetScopeKey 预算范围的标识，按天计算的范围带日期（次日自动重置）
+func budgetScopeKey(scope, sessionID, catName, date string) string {
+	switch scope {
+	case BudgetScopeSession:
+		return "session:" + sessionID
+	case BudgetScopeCat:
+		return "cat:" + catName + ":" + date
+	default:
+		return "daily:" + date
+	}
+}
+
+// budgetLimitKey 通过 API 调整后的上限（覆盖配置）
+func budgetLimitKey(scopeKey string) string {
+	return "budget_limit:" + scopeKey
+}
+
+// budgetWarnedKey 已发出的提醒级别，避免重复提醒
+func budgetWarnedKey(scopeKey string) string {
+	return "budget_warned:" + scopeKey
+}
+
+// budgetQueueKey 因预算用尽排队的任务（按会话保存，API 服务器重启后继续排队）
+func budgetQueueKey(sessionID string) string {
+	return "budget_queue:" + sessionID
+}
+
+// budgetDayCheckInterval 检查日期变化的间隔（按天计算的预算在次日重置）
+const budgetDayCheckInterval = time.Minute
+
+// queuedBudgetTask 预算队列中的任务，raw 为队列中保存的原始数据（按值移除）
+type queuedBudgetTask struct {
+	task TaskMessage
+	raw  string
+}
+
+// enqueueBudgetTask 将任务追加到会话的预算队列
+func enqueueBudgetTask(ctx context.Context, rdb *redis.Client, task TaskMessage) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("序列化任务失败: %w", err)
+	}
+	return rdb.RPush(ctx, budgetQueueKey(task.SessionID), data).Err()
+}
+
+// loadBudgetQueue 按排队顺序读取会话的预算队列（无法解析的条目跳过）
+func loadBudgetQueue(ctx context.Context, rdb *redis.Client, sessionID string) ([]queuedBudgetTask, error) {
+	values, err := rdb.LRange(ctx, budgetQueueKey(sessionID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	queue := make([]queuedBudgetTask, 0, len(values))
+	for _, raw := range values {
+		var task TaskMessage
+		if err := json.Unmarshal([]byte(raw), &task); err != nil {
+			LogWarn("[Budget] 跳过无法解析的排队任务: %v", err)
+			continue
+		}
+		queue = append(queue, queuedBudgetTask{task: task, raw: raw})
+	}
+	return queue, nil
+}
+
+// takeBudgetQueuedTask 从队列中移除一个任务，已被其他调用方移除时返回 false
+func takeBudgetQueuedTask(ctx context.Context, rdb *redis.Client, sessionID string, queued queuedBudgetTask) bool {
+	removed, err := rdb.LRem(ctx, budgetQueueKey(sessionID), 1, queued.raw).Result()
+	if err != nil {
+		LogWarn("[Budget] 移除排队任务失败: %v", err)
+		return false
+	}
+	return removed > 0
+}
+
+// loadBudgetLimit 某个范围当前生效的上限：API 调整值 > 配置值
+func loadBudgetLimit(ctx context.Context, rdb *redis.Client, cfg *BudgetConfig, scope, scopeKey string) BudgetLimit {
+	values, err := rdb.HGetAll(ctx, budgetLimitKey(scopeKey)).Result()
+	if err != nil || len(values) == 0 {
+		return cfg.limitFor(scope)
+	}
+	var limit BudgetLimit
+	limit.MaxCostUSD, _ = strconv.ParseFloat(values["max_cost_usd"], 64)
+	limit.MaxTokens, _ = strconv.ParseInt(values["max_tokens"], 10, 64)
+	return limit
+}
+
+// loadBudgetStatuses 与某只猫猫在会话中的调用相关的预算范围（会话、猫猫当天、当天总量）
+func loadBudgetStatuses(ctx context.Context, rdb *redis.Client, cfg *BudgetConfig, sessionID, catName string) ([]BudgetStatus, error) {
+	date := usageDate(time.Now())
+	sessionUsage, err := loadUsageStats(ctx, rdb, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	dailyUsage, err := loadDailyUsage(ctx, rdb, date)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := func(scope string) BudgetLimit {
+		return loadBudgetLimit(ctx, rdb, cfg, scope, budgetScopeKey(scope, sessionID, catName, date))
+	}
+	return []BudgetStatus{
+		newBudgetStatus(BudgetScopeSession, "", limit(BudgetScopeSession), sessionUsage.Total),
+		newBudgetStatus(BudgetScopeCat, catName, limit(BudgetScopeCat), dailyUsage.ByCat[catName]),
+		newBudgetStatus(BudgetScopeDaily, "", limit(BudgetScopeDaily), dailyUsage.Total),
+	}, nil
+}
+
+// findExceededBudget 返回猫猫在会话中已用尽的预算范围，未用尽时返回 nil
+// 编排器和 worker 路由派发任务前都通过这里检查；读取用量失败时放行，避免 Redis 抖动阻塞对话
+func findExceededBudget(ctx context.Context, rdb *redis.Client, cfg *BudgetConfig, sessionID, catName string) *BudgetStatus {
+	statuses, err := loadBudgetStatuses(ctx, rdb, cfg, sessionID, catName)
+	if err != nil {
+		LogWarn("[Budget] 读取用量失败，跳过预算检查: %v", err)
+		return nil
+	}
+	for i := range statuses {
+		if statuses[i].Exceeded() {
+			return &statuses[i]
+		}
+	}
+	return nil
+}
+
+// budgetLimit 某个范围当前生效的上限
+func (sm *SessionManager) budgetLimit(scope, scopeKey string) BudgetLimit {
+	return loadBudgetLimit(sm.ctx, sm.redisClient, sm.config.Budgets, scope, scopeKey)
+}
+
+// budgetStatuses 与某只猫猫在会话中的调用相关的预算范围
+func (sm *SessionManager) budgetStatuses(sessionID, catName string) ([]BudgetStatus, error) {
+	return loadBudgetStatuses(sm.ctx, sm.redisClient, sm.config.Budgets, sessionID, catName)
+}
+
+// exceededBudget 返回猫猫在会话中已用尽的预算范围，未用尽时返回 nil
+func (sm *SessionManager) exceededBudget(sessionID, catName string) *BudgetStatus {
+	return findExceededBudget(sm.ctx, sm.redisClient, sm.config.Budgets, sessionID, catName)
+}
+
+// holdOverBudgetTask 处理超出预算的任务：按配置排队或拒绝
+// 调用方需持有 ctx.mu 写锁
+func (sm *SessionManager) holdOverBudgetTask(ctx *SessionContext, sessionID string, task TaskMessage, status *BudgetStatus) {
+	action := sm.config.Budgets.onExceed()
+	if action == BudgetOnExceedQueue {
+		task.SessionID = sessionID
+		if err := enqueueBudgetTask(sm.ctx, sm.redisClient, task); err != nil {
+			LogError("[Budget] 任务排队失败，按拒绝处理: %v", err)
+			action = BudgetOnExceedRefuse
+		}
+	}
+	LogWarn("[Budget] 💸 %s已用尽（%s），%s 的任务%s", status.Describe(), status.usageSummary(), task.AgentName, onExceedText(action))
+
+	sm.wsHub.BroadcastToSession(sessionID, "budget_warning", gin.H{
+		"level":     BudgetLevelExceeded,
+		"status":    status,
+		"action":    action,
+		"taskId":    task.TaskID,
+		"agentName": task.AgentName,
+	})
+
+	if action == BudgetOnExceedQueue {
+		sm.appendSystemMessage(ctx, sessionID, fmt.Sprintf("💸 %s已用尽（%s），%s 的任务已排队，提高预算后继续", status.Describe(), status.usageSummary(), task.AgentName))
+		return
+	}
+
+	task.Status = TaskStatusFailed
+	task.FailReason = TaskFailBudget
+	task.Error = fmt.Sprintf("%s已用尽（%s）", status.Describe(), status.usageSummary())
+	sm.handleTaskFailure(ctx, &task)
+}
+
+// removeBudgetQueuedTask 从预算队列中移除任务，不在队列中时返回 nil
+// 调用方需持有 ctx.mu 写锁
+func (sm *SessionManager) removeBudgetQueuedTask(sessionID, taskID string) *TaskMessage {
+	queue, err := loadBudgetQueue(sm.ctx, sm.redisClient, sessionID)
+	if err != nil {
+		LogWarn("[Budget] 读取预算队列失败: %v", err)
+		return nil
+	}
+	for _, queued := range queue {
+		if queued.task.TaskID == taskID && takeBudgetQueuedTask(sm.ctx, sm.redisClient, sessionID, queued) {
+			task := queued.task
+			return &task
+		}
+	}
+	return nil
+}
+
+// resumeBudgetQueues 重新检查各会话排队的任务，未超出预算的发送给调度器
+func (sm *SessionManager) resumeBudgetQueues() int {
+	sm.mu.RLock()
+	sessions := make(map[string]*SessionContext, len(sm.sessions))
+	for sessionID, ctx := range sm.sessions {
+		sessions[sessionID] = ctx
+	}
+	sm.mu.RUnlock()
+
+	resumed := 0
+	for sessionID, ctx := range sessions {
+		ctx.mu.Lock()
+		queue, err := loadBudgetQueue(sm.ctx, sm.redisClient, sessionID)
+		if err != nil {
+			LogWarn("[Budget] 读取预算队列失败 - Session: %s, Error: %v", sessionID, err)
+		}
+		for _, queued := range queue {
+			task := queued.task
+			if status := sm.exceededBudget(sessionID, task.AgentName); status != nil {
+				continue
+			}
+			if !takeBudgetQueuedTask(sm.ctx, sm.redisClient, sessionID, queued) {
+				continue
+			}
+			sm.appendSystemMessage(ctx, sessionID, fmt.Sprintf("▶ 预算已调整，%s 的任务继续执行", task.AgentName))
+			sm.sendTask(ctx, task)
+			resumed++
+		}
+		ctx.mu.Unlock()
+	}
+	return resumed
+}
+
+// watchBudgetDay 启动时和日期变化后（按天计算的预算已重置）重新检查排队的任务
+func (sm *SessionManager) watchBudgetDay() {
+	ticker := time.NewTicker(budgetDayCheckInterval)
+	defer ticker.Stop()
+
+	date := usageDate(time.Now())
+	for {
+		if resumed := sm.resumeBudgetQueues(); resumed > 0 {
+			LogInfo("[Budget] 重新检查排队任务，%d 个继续执行", resumed)
+		}
+
+		for date == usageDate(time.Now()) {
+			select {
+			case <-sm.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+		date = usageDate(time.Now())
+	}
+}
+
+// checkBudgetWarnings 猫猫调用结束后检查相关预算，首次达到提醒阈值或用尽时通知会话
+// 调用方需持有 ctx.mu 写锁
+func (sm *SessionManager) checkBudgetWarnings(ctx *SessionContext, sessionID, catName string) {
+	statuses, err := sm.budgetStatuses(sessionID, catName)
+	if err != nil {
+		LogWarn("[Budget] 读取用量失败: %v", err)
+		return
+	}
+
+	date := usageDate(time.Now())
+	warnAt := sm.config.Budgets.warnAt()
+	for _, status := range statuses {
+		level := budgetLevel(status, warnAt)
+		if level == "" {
+			continue
+		}
+
+		key := budgetWarnedKey(budgetScopeKey(status.Scope, sessionID, status.CatName, date))
+		first, err := sm.redisClient.HSetNX(sm.ctx, key, level, time.Now().Unix()).Result()
+		if err != nil || !first {
+			continue
+		}
+		sm.redisClient.Expire(sm.ctx, key, usageDailyTTL)
+
+		content := fmt.Sprintf("⚠️ %s已使用 %.0f%%（%s）", status.Describe(), status.Ratio*100, status.usageSummary())
+		if level == BudgetLevelExceeded {
+			content = fmt.Sprintf("💸 %s已用尽（%s），后续调用将%s", status.Describe(), status.usageSummary(), onExceedText(sm.config.Budgets.onExceed()))
+		}
+		sm.appendSystemMessage(ctx, sessionID, content)
+		sm.wsHub.BroadcastToSession(sessionID, "budget_warning", gin.H{
+			"level":  level,
+			"status": status,
+		})
+	}
+}
+
+// BudgetOverview 会话相关的预算使用情况
+type BudgetOverview struct {
+	OnExceed string         `json:"onExceed"`
+	WarnAt   float64        `json:"warnAt"`
+	Session  BudgetStatus   `json:"session"`
+	Daily    BudgetStatus   `json:"daily"`
+	Cats     []BudgetStatus `json:"cats"`
+	Queued   []string       `json:"queued"` // 因预算排队的任务 ID
+}
+
+// GetBudgetOverview 获取会话的预算使用情况（包含每只猫猫当天的预算）
+func (sm *SessionManager) GetBudgetOverview(sessionID string) (*BudgetOverview, error) {
+	overview := &BudgetOverview{
+		OnExceed: sm.config.Budgets.onExceed(),
+		WarnAt:   sm.config.Budgets.warnAt(),
+		Cats:     []BudgetStatus{},
+		Queued:   []string{},
+	}
+	statuses, err := sm.budgetStatuses(sessionID, "")
+	if err != nil {
+		return nil, err
+	}
+	overview.Session, overview.Daily = statuses[0], statuses[2]
+	for _, name := range sm.cats.Names() {
+		statuses, err := sm.budgetStatuses(sessionID, name)
+		if err != nil {
+			return nil, err
+		}
+		overview.Cats = append(overview.Cats, statuses[1])
+	}
+
+	queue, err := loadBudgetQueue(sm.ctx, sm.redisClient, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	for _, queued := range queue {
+		overview.Queued = append(overview.Queued, queued.task.TaskID)
+	}
+	return overview, nil
+}
+
+// handleGetBudget 获取会话的预算使用情况
+func (sm *SessionManager) handleGetBudget(c *gin.Context) {
+	sessionID := c.Param("sessionId")
+
+	sm.mu.RLock()
+	_, exists := sm.sessions[sessionID]
+	sm.mu.RUnlock()
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "会话不存在"})
+		return
+	}
+
+	overview, err := sm.GetBudgetOverview(sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("读取预算失败: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, overview)
+}
+
+// UpdateBudgetRequest 调整预算上限的请求，未传的字段保持当前生效的上限
+type UpdateBudgetRequest struct {
+	Scope      string   `json:"scope" binding:"required"`
+	SessionID  string   `json:"sessionId"` // scope 为 session 时必填
+	CatName    string   `json:"catName"`   // scope 为 cat 时必填
+	MaxCostUSD *float64 `json:"maxCostUsd"`
+	MaxTokens  *int64   `json:"maxTokens"`
+}
+
+// apply 用请求中传入的字段覆盖当前上限
+func (r UpdateBudgetRequest) apply(current BudgetLimit) BudgetLimit {
+	limit := current
+	if r.MaxCostUSD != nil {
+		limit.MaxCostUSD = *r.MaxCostUSD
+	}
+	if r.MaxTokens != nil {
+		limit.MaxTokens = *r.MaxTokens
+	}
+	return limit
+}
+
+// handleUpdateBudget 调整预算上限（按天计算的范围只对当天生效），之后恢复排队的任务
+func (sm *SessionManager) handleUpdateBudget(c *gin.Context) {
+	var req UpdateBudgetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.MaxCostUSD == nil && req.MaxTokens == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "需要 maxCostUsd 或 maxTokens"})
+		return
+	}
+	if (req.MaxCostUSD != nil && *req.MaxCostUSD < 0) || (req.MaxTokens != nil && *req.MaxTokens < 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "maxCostUsd 和 maxTokens 不能为负数"})
+		return
+	}
+
+	switch req.Scope {
+	case BudgetScopeSession:
+		sm.mu.RLock()
+		_, exists := sm.sessions[req.SessionID]
+		sm.mu.RUnlock()
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "会话不存在"})
+			return
+		}
+	case BudgetScopeCat:
+		if _, found := sm.cats.Get(req.CatName); !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "猫猫不存在"})
+			return
+		}
+	case BudgetScopeDaily:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("未知的预算范围: %s", req.Scope)})
+		return
+	}
+
+	date := usageDate(time.Now())
+	scopeKey := budgetScopeKey(req.Scope, req.SessionID, req.CatName, date)
+	limitKey := budgetLimitKey(scopeKey)
+	limit := req.apply(sm.budgetLimit(req.Scope, scopeKey))
+	if limit.Unlimited() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "调整后 maxCostUsd 或 maxTokens 至少需要一个正数"})
+		return
+	}
+
+	pipe := sm.redisClient.TxPipeline()
+	pipe.HSet(sm.ctx, limitKey, map[string]interface{}{
+		"max_cost_usd": limit.MaxCostUSD,
+		"max_tokens":   limit.MaxTokens,
+	})
+	if req.Scope != BudgetScopeSession {
+		pipe.Expire(sm.ctx, limitKey, usageDailyTTL)
+	}
+	// 重新计算提醒
+	pipe.Del(sm.ctx, budgetWarnedKey(scopeKey))
+	if _, err := pipe.Exec(sm.ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("保存预算失败: %v", err)})
+		return
+	}
+	LogInfo("[Budget] 预算已调整 - %s: $%.2f / %d tokens", scopeKey, limit.MaxCostUSD, limit.MaxTokens)
+
+	resumed := sm.resumeBudgetQueues()
+	c.JSON(http.StatusOK, gin.H{
+		"scope":   req.Scope,
+		"limit":   limit,
+		"resumed": resumed,
+	})
+}
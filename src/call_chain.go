@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CallChain 调用因果链
+// 记录一次猫猫调用是由哪条用户消息引发、经过了哪些猫猫，用于防止猫猫之间无限互相 @
+type CallChain struct {
+	// RootMsgID 引发整条调用链的用户消息 ID
+	RootMsgID string `json:"root_msg_id"`
+
+	// Hop 当前调用的跳数（用户直接 @ 的猫猫为 1）
+	Hop int `json:"hop"`
+
+	// Path 调用路径（按调用顺序排列的猫猫名称，最后一个是当前被调用的猫猫）
+	Path []string `json:"path,omitempty"`
+}
+
+// NewRootChain 以用户消息为起点创建调用链
+func NewRootChain(rootMsgID string) *CallChain {
+	return &CallChain{RootMsgID: rootMsgID}
+}
+
+// Extend 派生下一跳调用链（不修改原链）
+func (c *CallChain) Extend(agentName string) *CallChain {
+	if c == nil {
+		return &CallChain{Hop: 1, Path: []string{agentName}}
+	}
+	path := make([]string, len(c.Path), len(c.Path)+1)
+	copy(path, c.Path)
+	return &CallChain{
+		RootMsgID: c.RootMsgID,
+		Hop:       c.Hop + 1,
+		Path:      append(path, agentName),
+	}
+}
+
+// Current 返回链上最后一只猫猫（根链返回空字符串）
+func (c *CallChain) Current() string {
+	if c == nil || len(c.Path) == 0 {
+		return ""
+	}
+	return c.Path[len(c.Path)-1]
+}
+
+// String 以 "花花 → 薇薇 → 小乔" 的形式输出调用路径
+func (c *CallChain) String() string {
+	if c == nil {
+		return ""
+	}
+	return strings.Join(c.Path, " → ")
+}
+
+// LoopLimits 调用链限制，0 表示不限制
+type LoopLimits struct {
+	// MaxHops 单条调用链的最大跳数
+	MaxHops int `json:"max_hops"`
+
+	// MaxInvocations 单条用户消息最多引发的猫猫调用次数
+	MaxInvocations int `json:"max_invocations"`
+
+	// MaxPairRepeats 同一对猫猫之间（不分方向）最多互相调用的次数
+	MaxPairRepeats int `json:"max_pair_repeats"`
+}
+
+// DefaultLoopLimits 未声明限制的模式使用的默认值
+// 流程类模式自身有轮次上限，这里只兜底防止失控
+var DefaultLoopLimits = LoopLimits{
+	MaxHops:        30,
+	MaxInvocations: 60,
+}
+
+// LoopLimitedMode 可选接口：模式声明自己的默认调用链限制
+// 会话的模式配置（max_hops、max_invocations、max_pair_repeats）可以再覆盖这些默认值
+type LoopLimitedMode interface {
+	DefaultLoopLimits() LoopLimits
+}
+
+// resolveLoopLimits 合并模式默认限制与模式配置中的覆盖值
+func resolveLoopLimits(mode CollaborationMode, config *ModeConfig) LoopLimits {
+	limits := DefaultLoopLimits
+	if limited, ok := mode.(LoopLimitedMode); ok {
+		limits = limited.DefaultLoopLimits()
+	}
+	if config == nil || config.Config == nil {
+		return limits
+	}
+	if v, ok := config.Config["max_hops"].(float64); ok && v >= 0 {
+		limits.MaxHops = int(v)
+	}
+	if v, ok := config.Config["max_invocations"].(float64); ok && v >= 0 {
+		limits.MaxInvocations = int(v)
+	}
+	if v, ok := config.Config["max_pair_repeats"].(float64); ok && v >= 0 {
+		limits.MaxPairRepeats = int(v)
+	}
+	return limits
+}
+
+// loopTrackerTTL 调用链计数的保留时间，超过后清理
+const loopTrackerTTL = time.Hour
+
+// loopCounter 一条用户消息引发的调用计数
+type loopCounter struct {
+	Invocations int
+	Pairs       map[string]int
+	LastSeen    time.Time
+}
+
+// pairKey 不分方向的猫猫对标识
+func pairKey(a, b string) string {
+	if a > b {
+		a, b = b, a
+	}
+	return a + "↔" + b
+}
+
+// check 检查派生出的调用是否超出限制，超出时返回原因
+func (c *loopCounter) check(limits LoopLimits, chain *CallChain, caller string) string {
+	if limits.MaxHops > 0 && chain.Hop > limits.MaxHops {
+		return fmt.Sprintf("调用深度超过上限 %d", limits.MaxHops)
+	}
+	if limits.MaxInvocations > 0 && c.Invocations >= limits.MaxInvocations {
+		return fmt.Sprintf("单条消息引发的调用次数超过上限 %d", limits.MaxInvocations)
+	}
+	if limits.MaxPairRepeats > 0 && caller != "" &&
+		c.Pairs[pairKey(caller, chain.Current())] >= limits.MaxPairRepeats {
+		return fmt.Sprintf("%s 与 %s 之间互相调用超过上限 %d 次", caller, chain.Current(), limits.MaxPairRepeats)
+	}
+	return ""
+}
+
+// record 记录一次放行的调用
+func (c *loopCounter) record(chain *CallChain, caller string) {
+	c.Invocations++
+	if caller != "" {
+		c.Pairs[pairKey(caller, chain.Current())]++
+	}
+	c.LastSeen = time.Now()
+}
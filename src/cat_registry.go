@@ -0,0 +1,670 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"gopkg.in/yaml.v3"
+)
+
+// catRegistryKey 猫猫注册表在 Redis 中的副本（JSON 数组），Agent 工作进程据此查找其他猫猫的管道
+const catRegistryKey = "config:agents"
+
+// defaultCatColors 未配置 color 时依次分配的颜色（前三个与最初的三只猫猫一致）
+var defaultCatColors = []string{"#ff9966", "#d9bf99", "#cccccc", "#99ccff", "#ffcc66", "#cc99ff", "#99cc99", "#ff99aa"}
+
+var (
+	catIDPattern       = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	defaultCatIDNumber = regexp.MustCompile(`^cat_(\d+)$`)
+)
+
+var (
+	// ErrCatNotFound 注册表中没有该猫猫
+	ErrCatNotFound = errors.New("猫猫不存在")
+	// ErrCatConflict 名字、ID 或管道与已有的猫猫重复
+	ErrCatConflict = errors.New("猫猫已存在")
+)
+
+// CatRegistry 猫猫注册表：API 服务器中所有按名字或 ID 查找猫猫的地方都从这里读取
+// 修改会写回配置文件（agents 段）并同步到 Redis，新注册的猫猫可以直接启动工作进程
+type CatRegistry struct {
+	mu         sync.RWMutex
+	agents     []AgentConfig // 按配置顺序
+	configPath string
+	ctx        context.Context
+	rdb        *redis.Client
+	listeners  []func([]AgentConfig)
+}
+
+// NewCatRegistry 由配置文件中的 Agent 创建注册表，补全缺省的 ID、颜色和管道并同步到 Redis
+func NewCatRegistry(ctx context.Context, rdb *redis.Client, configPath string, agents []AgentConfig) (*CatRegistry, error) {
+	r := &CatRegistry{
+		agents:     append([]AgentConfig(nil), agents...),
+		configPath: configPath,
+		ctx:        ctx,
+		rdb:        rdb,
+	}
+	for i := range r.agents {
+		fillCatDefaults(&r.agents[i], r.agents)
+		if err := checkCatConflicts(r.agents[i], r.agents[:i]); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.publish(r.agents); err != nil {
+		LogWarn("[Registry] 同步猫猫注册表到 Redis 失败: %v", err)
+	}
+	return r, nil
+}
+
+// OnChange 注册表变化后的回调（参数为变化后的全部猫猫）
+// 回调在持有注册表写锁时调用，不能再访问注册表
+func (r *CatRegistry) OnChange(fn func([]AgentConfig)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.listeners = append(r.listeners, fn)
+}
+
+// List 按配置顺序返回所有猫猫（副本）
+func (r *CatRegistry) List() []AgentConfig {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]AgentConfig(nil), r.agents...)
+}
+
+// Names 按配置顺序返回所有猫猫的名字
+func (r *CatRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, len(r.agents))
+	for i := range r.agents {
+		names[i] = r.agents[i].Name
+	}
+	return names
+}
+
+// Get 按名字查找猫猫
+func (r *CatRegistry) Get(name string) (AgentConfig, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, agent := range r.agents {
+		if agent.Name == name {
+			return agent, true
+		}
+	}
+	return AgentConfig{}, false
+}
+
+// GetByID 按 ID 查找猫猫
+func (r *CatRegistry) GetByID(id string) (AgentConfig, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, agent := range r.agents {
+		if agent.ID == id {
+			return agent, true
+		}
+	}
+	return AgentConfig{}, false
+}
+
+// NameByID 猫猫 ID 对应的名字，不存在时返回空字符串
+func (r *CatRegistry) NameByID(id string) string {
+	agent, _ := r.GetByID(id)
+	return agent.Name
+}
+
+// IDByName 猫猫名字对应的 ID，不存在时返回 cat_unknown
+func (r *CatRegistry) IDByName(name string) string {
+	if agent, ok := r.Get(name); ok {
+		return agent.ID
+	}
+	return "cat_unknown"
+}
+
+// Add 注册新猫猫，未指定的 ID、颜色和管道自动分配
+func (r *CatRegistry) Add(agent AgentConfig) (AgentConfig, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fillCatDefaults(&agent, r.agents)
+	if err := checkCatConflicts(agent, r.agents); err != nil {
+		return AgentConfig{}, err
+	}
+	if err := restrictAPICatConfig(&agent, nil); err != nil {
+		return AgentConfig{}, err
+	}
+	if err := validateCat(&agent); err != nil {
+		return AgentConfig{}, err
+	}
+	agents := append(append([]AgentConfig(nil), r.agents...), agent)
+	if err := r.commitLocked(agents); err != nil {
+		return AgentConfig{}, err
+	}
+	LogInfo("[Registry] 已注册猫猫: %s (%s, 管道: %s)", agent.Name, agent.ID, agent.Pipe)
+	return agent, nil
+}
+
+// Update 替换猫猫的配置；名字和管道关联着历史消息和任务队列，不能修改
+func (r *CatRegistry) Update(id string, agent AgentConfig) (AgentConfig, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	index := r.indexLocked(id)
+	if index < 0 {
+		return AgentConfig{}, fmt.Errorf("%w: %s", ErrCatNotFound, id)
+	}
+	current := r.agents[index]
+	if agent.Name == "" {
+		agent.Name = current.Name
+	}
+	if agent.Pipe == "" {
+		agent.Pipe = current.Pipe
+	}
+	if agent.Name != current.Name {
+		return AgentConfig{}, fmt.Errorf("不能修改猫猫的名字（%s），请删除后重新注册", current.Name)
+	}
+	if agent.Pipe != current.Pipe {
+		return AgentConfig{}, fmt.Errorf("不能修改猫猫的管道（%s），请删除后重新注册", current.Pipe)
+	}
+	if agent.ID != "" && agent.ID != id {
+		return AgentConfig{}, fmt.Errorf("不能修改猫猫的 ID（%s）", id)
+	}
+	agent.ID = id
+	if agent.Color == "" {
+		agent.Color = current.Color
+	}
+	if err := restrictAPICatConfig(&agent, &current); err != nil {
+		return AgentConfig{}, err
+	}
+	if err := validateCat(&agent); err != nil {
+		return AgentConfig{}, err
+	}
+
+	agents := append([]AgentConfig(nil), r.agents...)
+	agents[index] = agent
+	if err := r.commitLocked(agents); err != nil {
+		return AgentConfig{}, err
+	}
+	LogInfo("[Registry] 已更新猫猫: %s (%s)", agent.Name, agent.ID)
+	return agent, nil
+}
+
+// Remove 删除猫猫（已在运行的工作进程不受影响，但不会再收到任务）
+func (r *CatRegistry) Remove(id string) (AgentConfig, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	index := r.indexLocked(id)
+	if index < 0 {
+		return AgentConfig{}, fmt.Errorf("%w: %s", ErrCatNotFound, id)
+	}
+	removed := r.agents[index]
+	agents := append(append([]AgentConfig(nil), r.agents[:index]...), r.agents[index+1:]...)
+	if err := r.commitLocked(agents); err != nil {
+		return AgentConfig{}, err
+	}
+	LogInfo("[Registry] 已删除猫猫: %s (%s)", removed.Name, removed.ID)
+	return removed, nil
+}
+
+func (r *CatRegistry) indexLocked(id string) int {
+	for i := range r.agents {
+		if r.agents[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// commitLocked 先写配置文件（失败时不生效），再同步 Redis 并通知订阅者
+// 调用方需持有 r.mu 写锁
+func (r *CatRegistry) commitLocked(agents []AgentConfig) error {
+	if err := saveAgentsToConfig(r.configPath, agents); err != nil {
+		return fmt.Errorf("写入配置文件失败: %w", err)
+	}
+	r.agents = agents
+	if err := r.publish(agents); err != nil {
+		LogWarn("[Registry] 同步猫猫注册表到 Redis 失败: %v", err)
+	}
+	for _, fn := range r.listeners {
+		fn(append([]AgentConfig(nil), agents...))
+	}
+	return nil
+}
+
+// publish 将注册表写入 Redis
+func (r *CatRegistry) publish(agents []AgentConfig) error {
+	data, err := json.Marshal(agents)
+	if err != nil {
+		return err
+	}
+	return r.rdb.Set(r.ctx, catRegistryKey, data, 0).Err()
+}
+
+// loadRegisteredAgents 读取 API 服务器同步到 Redis 的猫猫注册表
+func loadRegisteredAgents(ctx context.Context, rdb *redis.Client) ([]AgentConfig, error) {
+	data, err := rdb.Get(ctx, catRegistryKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	var agents []AgentConfig
+	if err := json.Unmarshal([]byte(data), &agents); err != nil {
+		return nil, err
+	}
+	return agents, nil
+}
+
+// fillCatDefaults 补全 ID（cat_NNN，取已有编号的最大值加一）、颜色（第一个未使用的默认颜色）和管道（pipe_<ID>）
+func fillCatDefaults(agent *AgentConfig, existing []AgentConfig) {
+	if agent.ID == "" {
+		next := 1
+		for _, other := range existing {
+			if m := defaultCatIDNumber.FindStringSubmatch(other.ID); m != nil {
+				if n, _ := strconv.Atoi(m[1]); n >= next {
+					next = n + 1
+				}
+			}
+		}
+		agent.ID = fmt.Sprintf("cat_%03d", next)
+	}
+	if agent.Color == "" {
+		used := make(map[string]bool, len(existing))
+		for _, other := range existing {
+			used[other.Color] = true
+		}
+		agent.Color = defaultCatColors[len(existing)%len(defaultCatColors)]
+		for _, color := range defaultCatColors {
+			if !used[color] {
+				agent.Color = color
+				break
+			}
+		}
+	}
+	if agent.Pipe == "" {
+		agent.Pipe = "pipe_" + agent.ID
+	}
+}
+
+// checkCatConflicts 名字、ID 和管道在注册表中必须唯一
+func checkCatConflicts(agent AgentConfig, existing []AgentConfig) error {
+	for _, other := range existing {
+		switch {
+		case other.Name == agent.Name:
+			return fmt.Errorf("%w: 名字 %s 已被使用", ErrCatConflict, agent.Name)
+		case other.ID == agent.ID:
+			return fmt.Errorf("%w: ID %s 已被 %s 使用", ErrCatConflict, agent.ID, other.Name)
+		case other.Pipe == agent.Pipe:
+			return fmt.Errorf("%w: 管道 %s 已被 %s 使用", ErrCatConflict, agent.Pipe, other.Name)
+		}
+	}
+	return nil
+}
+
+// validateCat 校验通过 API 注册或修改的猫猫：必填项、调用选项和提示词文件
+func validateCat(agent *AgentConfig) error {
+	if agent.Name == "" {
+		return fmt.Errorf("name 不能为空")
+	}
+	if !catIDPattern.MatchString(agent.ID) {
+		return fmt.Errorf("id 只能包含字母、数字、下划线和连字符: %q", agent.ID)
+	}
+	if agent.CLIType == "" {
+		return fmt.Errorf("cli_type 不能为空")
+	}
+	if agent.SystemPromptPath == "" {
+		return fmt.Errorf("system_prompt_path 不能为空")
+	}
+	if err := validateAgentConfigs([]AgentConfig{*agent}); err != nil {
+		return err
+	}
+	if _, err := NewPromptComposer(agent); err != nil {
+		return fmt.Errorf("加载提示词失败: %w", err)
+	}
+	return nil
+}
+
+// apiPromptDir 通过 API 注册或修改猫猫时，提示词文件必须位于该目录下
+const apiPromptDir = "prompts"
+
+// restrictAPICatConfig 限制通过 API 提交的猫猫配置：
+// env、extra_args、http.base_url 和 http.api_key_env 只能在配置文件中设置（请求中出现时返回错误），
+// 修改已有猫猫（current 非 nil）时保留配置文件中的原值（备用后端按位置和 cli_type 对应）；
+// 提示词文件必须是 prompts/ 下的相对路径，配置文件中原有的路径除外
+func restrictAPICatConfig(agent *AgentConfig, current *AgentConfig) error {
+	if err := checkAPIBackend(agent.AgentBackend, ""); err != nil {
+		return err
+	}
+	for i, backend := range agent.Fallbacks {
+		if err := checkAPIBackend(backend, fmt.Sprintf("fallbacks[%d].", i)); err != nil {
+			return err
+		}
+	}
+
+	allowed := make(map[string]bool)
+	if current != nil {
+		keepConfigFileFields(&agent.AgentBackend, current.AgentBackend)
+		for i := range agent.Fallbacks {
+			if i < len(current.Fallbacks) {
+				keepConfigFileFields(&agent.Fallbacks[i], current.Fallbacks[i])
+			}
+		}
+		for _, path := range catPromptPaths(current) {
+			allowed[path] = true
+		}
+	}
+	for _, path := range catPromptPaths(agent) {
+		if !allowed[path] && !isAPIPromptPath(path) {
+			return fmt.Errorf("提示词文件必须位于 %s/ 目录下: %s", apiPromptDir, path)
+		}
+	}
+	return nil
+}
+
+// isAPIPromptPath 路径是 prompts/ 下的相对路径（清理 .. 之后）
+func isAPIPromptPath(path string) bool {
+	return !filepath.IsAbs(path) && strings.HasPrefix(filepath.Clean(path), apiPromptDir+string(filepath.Separator))
+}
+
+// checkAPIBackend 请求中的后端设置了只能在配置文件中设置的字段时返回错误
+func checkAPIBackend(backend AgentBackend, prefix string) error {
+	var fields []string
+	if len(backend.Env) > 0 {
+		fields = append(fields, prefix+"env")
+	}
+	if len(backend.ExtraArgs) > 0 {
+		fields = append(fields, prefix+"extra_args")
+	}
+	if backend.HTTP != nil && backend.HTTP.BaseURL != "" {
+		fields = append(fields, prefix+"http.base_url")
+	}
+	if backend.HTTP != nil && backend.HTTP.APIKeyEnv != "" {
+		fields = append(fields, prefix+"http.api_key_env")
+	}
+	if len(fields) > 0 {
+		return fmt.Errorf("%s 只能在配置文件中设置", strings.Join(fields, "、"))
+	}
+	return nil
+}
+
+// keepConfigFileFields cli_type 未变时保留配置文件中只能在配置文件里设置的字段
+func keepConfigFileFields(backend *AgentBackend, current AgentBackend) {
+	if backend.CLIType != current.CLIType {
+		return
+	}
+	backend.Env = current.Env
+	backend.ExtraArgs = current.ExtraArgs
+	if current.HTTP != nil {
+		if backend.HTTP == nil {
+			backend.HTTP = &HTTPBackendConfig{}
+		}
+		backend.HTTP.BaseURL = current.HTTP.BaseURL
+		backend.HTTP.APIKeyEnv = current.HTTP.APIKeyEnv
+	}
+}
+
+// catPromptPaths 猫猫配置中引用的所有提示词文件
+func catPromptPaths(agent *AgentConfig) []string {
+	var paths []string
+	for _, path := range []string{agent.SystemPromptPath, agent.DevPromptPath, agent.PromptTemplatePath} {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	paths = append(paths, agent.PromptPaths...)
+	for _, files := range agent.ModePrompts {
+		paths = append(paths, files...)
+	}
+	return paths
+}
+
+// saveAgentsToConfig 替换配置文件中的 agents 段，其余内容和注释保持不变
+func saveAgentsToConfig(path string, agents []AgentConfig) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("配置文件格式无效: %s", path)
+	}
+
+	var agentsNode yaml.Node
+	if err := agentsNode.Encode(agents); err != nil {
+		return err
+	}
+	root := doc.Content[0]
+	replaced := false
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "agents" {
+			root.Content[i+1] = &agentsNode
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		root.Content = append([]*yaml.Node{{Kind: yaml.ScalarNode, Value: "agents"}, &agentsNode}, root.Content...)
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+
+	// 先写临时文件再重命名，避免写到一半时其他进程读到不完整的配置
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".config-*.yaml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if info, err := os.Stat(path); err == nil {
+		os.Chmod(tmp.Name(), info.Mode())
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// bindAgentConfig 解析请求体中的猫猫配置，字段名与配置文件 agents 条目相同（snake_case），未知字段视为错误
+func bindAgentConfig(c *gin.Context) (AgentConfig, error) {
+	var raw interface{}
+	if err := c.ShouldBindJSON(&raw); err != nil {
+		return AgentConfig{}, fmt.Errorf("请求格式错误: %w", err)
+	}
+	data, err := yaml.Marshal(raw)
+	if err != nil {
+		return AgentConfig{}, err
+	}
+	var agent AgentConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&agent); err != nil {
+		return AgentConfig{}, fmt.Errorf("猫猫配置无效: %w", err)
+	}
+	return agent, nil
+}
+
+// catRegistryStatus 注册表错误对应的 HTTP 状态码
+func catRegistryStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrCatNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrCatConflict):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// catDetail 按 ID 查找猫猫详情（包含在线状态、调用选项和熔断状态）
+func (sm *SessionManager) catDetail(catID string) (CatDetail, bool) {
+	for _, cat := range sm.GetCats() {
+		if cat.ID == catID {
+			return CatDetail{Cat: cat, Options: sm.catOptions(cat.Name), Backends: sm.catBackends(cat.Name)}, true
+		}
+	}
+	return CatDetail{}, false
+}
+
+// broadcastCats 注册表变化后向前端推送完整的猫猫列表（cats 事件）
+func (sm *SessionManager) broadcastCats() {
+	sm.wsHub.BroadcastToAll("cats", sm.GetCats())
+}
+
+// handleCreateCat 注册新猫猫
+func (sm *SessionManager) handleCreateCat(c *gin.Context) {
+	agent, err := bindAgentConfig(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	agent, err = sm.cats.Add(agent)
+	if err != nil {
+		c.JSON(catRegistryStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	sm.broadcastCats()
+
+	detail, _ := sm.catDetail(agent.ID)
+	c.JSON(http.StatusCreated, detail)
+}
+
+// handleUpdateCat 替换猫猫的配置（正在运行的工作进程需要重启才会使用新配置）
+func (sm *SessionManager) handleUpdateCat(c *gin.Context) {
+	catID := c.Param("catId")
+	agent, err := bindAgentConfig(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	agent, err = sm.cats.Update(catID, agent)
+	if err != nil {
+		c.JSON(catRegistryStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	sm.broadcastCats()
+
+	detail, _ := sm.catDetail(agent.ID)
+	c.JSON(http.StatusOK, detail)
+}
+
+// handleDeleteCat 删除猫猫，并停止通过 API 为它启动的工作进程
+func (sm *SessionManager) handleDeleteCat(c *gin.Context) {
+	agent, err := sm.cats.Remove(c.Param("catId"))
+	if err != nil {
+		c.JSON(catRegistryStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	sm.stopSpawnedWorkers(agent.Name)
+	sm.broadcastCats()
+	c.Status(http.StatusNoContent)
+}
+
+// handleSpawnCatWorker 为猫猫启动一个 Agent 工作进程（与 start.sh 中的启动方式相同）
+func (sm *SessionManager) handleSpawnCatWorker(c *gin.Context) {
+	agent, ok := sm.cats.GetByID(c.Param("catId"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "猫猫不存在"})
+		return
+	}
+	pid, logPath, err := sm.spawnWorker(agent)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"catId": agent.ID, "name": agent.Name, "pid": pid, "log": logPath})
+}
+
+// spawnWorker 启动 `cat-cafe --mode agent`，输出写入 logs/agent_<ID>.log
+// 工作进程从配置文件读取自己的配置，因此注册后无需重启 API 服务器
+func (sm *SessionManager) spawnWorker(agent AgentConfig) (int, string, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return 0, "", fmt.Errorf("获取可执行文件路径失败: %w", err)
+	}
+	configPath, err := filepath.Abs(sm.configPath)
+	if err != nil {
+		return 0, "", err
+	}
+	if err := os.MkdirAll("logs", 0755); err != nil {
+		return 0, "", fmt.Errorf("创建日志目录失败: %w", err)
+	}
+	logPath := filepath.Join("logs", fmt.Sprintf("agent_%s.log", agent.ID))
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, "", fmt.Errorf("打开日志文件失败: %w", err)
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(executable, "--mode", "agent", "--agent", agent.Name, "--config", configPath)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	// 取消 CLAUDECODE 环境变量，避免嵌套会话冲突
+	for _, env := range os.Environ() {
+		if !strings.HasPrefix(env, "CLAUDECODE=") {
+			cmd.Env = append(cmd.Env, env)
+		}
+	}
+	if err := cmd.Start(); err != nil {
+		return 0, "", fmt.Errorf("启动工作进程失败: %w", err)
+	}
+
+	sm.spawnMu.Lock()
+	sm.spawned[agent.Name] = append(sm.spawned[agent.Name], cmd.Process)
+	sm.spawnMu.Unlock()
+	LogInfo("[Registry] 已为 %s 启动工作进程 (PID: %d, 日志: %s)", agent.Name, cmd.Process.Pid, logPath)
+
+	go func() {
+		err := cmd.Wait()
+		LogInfo("[Registry] %s 的工作进程已退出 (PID: %d): %v", agent.Name, cmd.Process.Pid, err)
+		sm.spawnMu.Lock()
+		defer sm.spawnMu.Unlock()
+		processes := sm.spawned[agent.Name]
+		for i, process := range processes {
+			if process == cmd.Process {
+				sm.spawned[agent.Name] = append(processes[:i:i], processes[i+1:]...)
+				break
+			}
+		}
+		if len(sm.spawned[agent.Name]) == 0 {
+			delete(sm.spawned, agent.Name)
+		}
+	}()
+	return cmd.Process.Pid, logPath, nil
+}
+
+// stopSpawnedWorkers 通知通过 API 启动的工作进程退出（SIGTERM，工作进程会等正在执行的任务结束）
+func (sm *SessionManager) stopSpawnedWorkers(name string) {
+	sm.spawnMu.Lock()
+	defer sm.spawnMu.Unlock()
+	for _, process := range sm.spawned[name] {
+		if err := process.Signal(syscall.SIGTERM); err != nil {
+			LogWarn("[Registry] 停止 %s 的工作进程失败 (PID: %d): %v", name, process.Pid, err)
+		}
+	}
+}
@@ -1,54 +1,38 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+
+	"cat-cafe/src/agentcli"
 )
 
 // InvokeAgent 调用指定类型的 AI Agent
-// cliType: "claude" / "codex" / "gemini"
+// cliType: 已注册的 CLI 类型，如 "claude" / "codex" / "gemini" / "opencode" / "http"
 // prompt: 完整的 prompt 内容
 // aiSessionID: 可选的 AI session ID（用于 --resume）
 // workDir: 可选的工作目录
+// ctx 取消时终止 CLI 进程组
 // 返回: response, newSessionID, error
-func InvokeAgent(cliType, prompt, aiSessionID, workDir string) (string, string, error) {
-	options := getDefaultOptions(cliType)
-	options.SessionID = aiSessionID
-	options.WorkDir = workDir
-	return InvokeCLI(cliType, prompt, options)
+func InvokeAgent(ctx context.Context, cliType, prompt, aiSessionID, workDir string) (string, string, error) {
+	result, err := InvokeAgentWithOptions(ctx, cliType, prompt, AgentOptions{SessionID: aiSessionID, WorkDir: workDir})
+	return result.Response, result.SessionID, err
 }
 
 // InvokeAgentWithMCP 调用 AI Agent 并注入 MCP 配置
-func InvokeAgentWithMCP(cliType, prompt, aiSessionID, workDir, mcpConfigPath string) (string, string, error) {
-	options := getDefaultOptions(cliType)
-	options.SessionID = aiSessionID
-	options.WorkDir = workDir
-	options.MCPConfigPath = mcpConfigPath
-	return InvokeCLI(cliType, prompt, options)
+func InvokeAgentWithMCP(ctx context.Context, cliType, prompt, aiSessionID, workDir, mcpConfigPath string) (string, string, error) {
+	result, err := InvokeAgentWithOptions(ctx, cliType, prompt, AgentOptions{SessionID: aiSessionID, WorkDir: workDir, MCPConfigPath: mcpConfigPath})
+	return result.Response, result.SessionID, err
 }
 
-// getDefaultOptions 返回指定 CLI 类型的默认选项
-// 注意: claude 使用 bypassPermissions 是因为 agent 在受控的本地开发环境中运行，
-// 且已通过 AllowedTools 白名单限制了可用工具范围
-func getDefaultOptions(cliType string) AgentOptions {
-	switch cliType {
-	case "claude":
-		return AgentOptions{
-			PermissionMode: "bypassPermissions",
-			AllowedTools:   "mcp__hindsight__*,mcp__session-chain__*,mcp__github__*,mcp__figma__*,mcp__ide__*",
-		}
-	case "codex":
-		return AgentOptions{} // 已在 invoke.go 中硬编码 --full-auto
-	case "gemini":
-		return AgentOptions{
-			ApprovalMode: "yolo",
-			AllowedTools: "mcp__hindsight__*,mcp__session-chain__*,mcp__TalkToFigma__*",
-		}
-	default:
-		return AgentOptions{}
-	}
+// InvokeAgentWithOptions 调用 AI Agent：以 cliType 的默认选项为基础，覆盖 overrides 中的非空字段
+// 运行过程中的文本增量和工具调用通过 overrides.OnEvent 回调；返回值始终非 nil
+func InvokeAgentWithOptions(ctx context.Context, cliType, prompt string, overrides AgentOptions) (*CLIResult, error) {
+	options := agentcli.MergeOptions(agentcli.DefaultOptions(cliType), overrides)
+	return InvokeCLIDetailed(ctx, cliType, prompt, options)
 }
 
 // GenerateMCPConfig 生成 MCP 配置文件，返回临时文件路径
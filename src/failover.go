@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"cat-cafe/src/agentcli"
+	"github.com/go-redis/redis/v8"
+)
+
+// 后端调用失败的分类（见 agentcli.ClassifyError）
+const (
+	FailureTransient = agentcli.FailureTransient // 非零退出、限流、网络错误等，稍后重试可能恢复
+	FailureFatal     = agentcli.FailureFatal     // CLI 未安装、额度用尽、认证失败等，重试无意义，直接熔断
+)
+
+// 熔断器状态
+const (
+	BreakerClosed   = "closed"    // 正常调用
+	BreakerOpen     = "open"      // 熔断中，冷却结束前跳过该后端
+	BreakerHalfOpen = "half_open" // 冷却结束，允许一次试探调用
+)
+
+const (
+	defaultBreakerThreshold = 3
+	defaultBreakerCooldown  = 60 * time.Second
+)
+
+// ErrBackendUnavailable 所有后端都因致命错误失败或处于熔断中，任务不再重试
+var ErrBackendUnavailable = errors.New("所有后端均不可用")
+
+// CircuitBreakerConfig 后端熔断设置（只在配置了 fallbacks 时生效）
+type CircuitBreakerConfig struct {
+	FailureThreshold int `yaml:"failure_threshold,omitempty"` // 连续失败多少次后熔断，默认 3
+	Cooldown         int `yaml:"cooldown,omitempty"`          // 熔断后多久（秒）允许试探，默认 60
+}
+
+// threshold 连续失败阈值（未配置时使用默认值）
+func (c *CircuitBreakerConfig) threshold() int {
+	if c == nil || c.FailureThreshold <= 0 {
+		return defaultBreakerThreshold
+	}
+	return c.FailureThreshold
+}
+
+// cooldown 熔断冷却时间（未配置时使用默认值）
+func (c *CircuitBreakerConfig) cooldown() time.Duration {
+	if c == nil || c.Cooldown <= 0 {
+		return defaultBreakerCooldown
+	}
+	return time.Duration(c.Cooldown) * time.Second
+}
+
+// Name 后端名称：cli_type，配置了模型时附上模型名
+func (c *AgentBackend) Name() string {
+	if model := c.invokeOptions().Model; model != "" {
+		return c.CLIType + "/" + model
+	}
+	return c.CLIType
+}
+
+// backends 按尝试顺序返回主后端和备用后端
+func (c *AgentConfig) backends() []*AgentBackend {
+	backends := []*AgentBackend{&c.AgentBackend}
+	for i := range c.Fallbacks {
+		backends = append(backends, &c.Fallbacks[i])
+	}
+	return backends
+}
+
+// BackendAttempt 一次未成功的后端尝试（调用失败或因熔断跳过）
+type BackendAttempt struct {
+	Backend string `json:"backend"`
+	Class   string `json:"class,omitempty"` // 因熔断跳过时为空
+	Reason  string `json:"reason"`
+}
+
+// describeAttempts 将尝试记录格式化为「claude（额度已用尽）、gemini（熔断中）」
+func describeAttempts(attempts []BackendAttempt) string {
+	parts := make([]string, 0, len(attempts))
+	for _, attempt := range attempts {
+		parts = append(parts, fmt.Sprintf("%s（%s）", attempt.Backend, attempt.Reason))
+	}
+	return strings.Join(parts, "、")
+}
+
+// classifyBackendError 判断后端调用失败是临时的还是致命的，并给出简短原因
+// 只按后端自己报告的错误分类（HTTP 状态、CLI 的结果/错误事件），不看 stderr
+func classifyBackendError(err error) (string, string) {
+	return agentcli.ClassifyError(err)
+}
+
+// BreakerState 一个后端的熔断状态，保存在 Redis 中供同一只猫猫的所有工作进程和 API 共享
+type BreakerState struct {
+	Backend   string    `json:"backend"`
+	State     string    `json:"state"`
+	Failures  int       `json:"failures"` // 连续失败次数
+	OpenedAt  time.Time `json:"openedAt"` // 最近一次熔断的时间
+	LastError string    `json:"lastError,omitempty"`
+}
+
+// allow 是否允许调用：熔断中的后端在冷却结束后进入半开状态，允许一次试探
+func (s *BreakerState) allow(now time.Time, cooldown time.Duration) bool {
+	if s.State != BreakerOpen {
+		return true
+	}
+	if now.Sub(s.OpenedAt) < cooldown {
+		return false
+	}
+	s.State = BreakerHalfOpen
+	return true
+}
+
+// recordFailure 记录一次失败：致命错误、半开试探失败或连续失败达到阈值时熔断
+func (s *BreakerState) recordFailure(class, lastError string, now time.Time, threshold int) {
+	s.Failures++
+	s.LastError = lastError
+	if class == FailureFatal || s.State == BreakerHalfOpen || s.Failures >= threshold {
+		s.State = BreakerOpen
+		s.OpenedAt = now
+	}
+}
+
+// recordSuccess 调用成功，恢复正常
+func (s *BreakerState) recordSuccess() {
+	s.State = BreakerClosed
+	s.Failures = 0
+	s.LastError = ""
+}
+
+// breakerErrorText 熔断状态中保存的错误摘要：第一行，最多 200 个字符
+func breakerErrorText(err error) string {
+	line, _, _ := strings.Cut(err.Error(), "\n")
+	if runes := []rune(line); len(runes) > 200 {
+		return string(runes[:200]) + "..."
+	}
+	return line
+}
+
+// backendBreakerKey 猫猫各后端熔断状态的 Redis Hash（字段为后端名称）
+func backendBreakerKey(agentName string) string {
+	return fmt.Sprintf("backend_breaker:%s", agentName)
+}
+
+// loadBreakerStates 读取猫猫各后端的熔断状态，没有记录的后端视为正常
+func loadBreakerStates(ctx context.Context, rdb *redis.Client, agent *AgentConfig) ([]BreakerState, error) {
+	backends := agent.backends()
+	names := make([]string, len(backends))
+	for i, backend := range backends {
+		names[i] = backend.Name()
+	}
+	values, err := rdb.HMGet(ctx, backendBreakerKey(agent.Name), names...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]BreakerState, len(names))
+	for i, name := range names {
+		states[i] = BreakerState{Backend: name, State: BreakerClosed}
+		if data, ok := values[i].(string); ok {
+			json.Unmarshal([]byte(data), &states[i])
+		}
+	}
+	return states, nil
+}
+
+// saveBreakerState 保存一个后端的熔断状态
+func saveBreakerState(ctx context.Context, rdb *redis.Client, agentName string, state BreakerState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return rdb.HSet(ctx, backendBreakerKey(agentName), state.Backend, string(data)).Err()
+}
+
+// backendInvocation 一次成功的后端调用
+type backendInvocation struct {
+	backend *AgentBackend
+	primary bool   // 由主后端回答（AI 会话和 Cursor 只属于主后端）
+	prompt  string // 实际发送的 prompt（备用后端不能续接会话时为完整 prompt）
+	result  *CLIResult
+	usage   InvocationUsage
+}
+
+// invokeBackends 按顺序调用主后端和备用后端，直到有一个成功
+// 配置了 fallbacks 时跳过熔断中的后端并更新熔断状态；取消和超时不切换后端。
+// 成功时 task.Backend / task.Failover 记录回答的后端和之前失败的后端；
+// 全部失败且没有可重试的临时错误时返回包装了 ErrBackendUnavailable 的错误
+func (w *AgentWorker) invokeBackends(ctx context.Context, task *TaskMessage, prompt string, base AgentOptions, data PromptData) (*backendInvocation, error) {
+	backends := w.config.backends()
+	failover := len(backends) > 1
+	cooldown := w.config.CircuitBreaker.cooldown()
+
+	var states []BreakerState
+	if failover {
+		var err error
+		if states, err = loadBreakerStates(w.ctx, w.redisClient, w.config); err != nil {
+			LogWarn("[Agent-%s] 读取熔断状态失败: %v（按正常状态处理）", w.config.Name, err)
+			states = make([]BreakerState, len(backends))
+			for i, backend := range backends {
+				states[i] = BreakerState{Backend: backend.Name(), State: BreakerClosed}
+			}
+		}
+	}
+
+	var attempts []BackendAttempt
+	var lastErr error
+	retryable := false
+	for i, backend := range backends {
+		name := backend.Name()
+		if failover && !states[i].allow(time.Now(), cooldown) {
+			LogInfo("[Agent-%s] 后端 %s 熔断中，跳过", w.config.Name, name)
+			attempts = append(attempts, BackendAttempt{Backend: name, Reason: "熔断中"})
+			continue
+		}
+
+		options := agentcli.MergeOptions(backend.invokeOptions(), base)
+		attemptPrompt := prompt
+		if i > 0 {
+			// AI 会话属于主后端，备用后端重新开始；增量 prompt 缺少上下文，改用完整历史
+			options.SessionID = ""
+			if base.SessionID != "" {
+				attemptPrompt = w.buildOrchestratedPrompt(task, data)
+			}
+			LogInfo("[Agent-%s] 🔀 切换到备用后端: %s", w.config.Name, name)
+		}
+
+		startedAt := time.Now()
+		result, err := InvokeAgentWithOptions(ctx, backend.CLIType, attemptPrompt, options)
+		usage := resolveInvocationUsage(result, attemptPrompt, options.Model, backend.CLIType, w.pricing, time.Since(startedAt))
+		if err == nil {
+			w.recordUsage(task, usage)
+			if failover {
+				states[i].recordSuccess()
+				w.saveBreakerState(states[i])
+				task.Backend = name
+				task.Failover = attempts
+			}
+			return &backendInvocation{backend: backend, primary: i == 0, prompt: attemptPrompt, result: result, usage: usage}, nil
+		}
+
+		// 失败的调用只在 CLI 报告了用量时计入（已实际消耗）
+		if result.Usage != nil {
+			w.recordUsage(task, usage)
+		}
+		LogError("[Agent-%s] 调用 %s 失败: %v", w.config.Name, name, err)
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("调用 %s CLI 失败: %w", backend.CLIType, err)
+		}
+
+		class, reason := classifyBackendError(err)
+		attempts = append(attempts, BackendAttempt{Backend: name, Class: class, Reason: reason})
+		retryable = retryable || class == FailureTransient
+		lastErr = err
+		if failover {
+			states[i].recordFailure(class, breakerErrorText(err), time.Now(), w.config.CircuitBreaker.threshold())
+			w.saveBreakerState(states[i])
+			if states[i].State == BreakerOpen {
+				LogWarn("[Agent-%s] ⚡ 后端 %s 已熔断（%s）", w.config.Name, name, reason)
+			}
+			// 已推送的草稿作废，由下一个后端重新输出
+			if base.OnEvent != nil {
+				base.OnEvent(StreamEvent{Type: StreamEventDiscard})
+			}
+		}
+	}
+
+	if !failover {
+		err := fmt.Errorf("调用 %s CLI 失败: %w", w.config.CLIType, lastErr)
+		if !retryable {
+			return nil, fmt.Errorf("%w: %w", ErrBackendUnavailable, err)
+		}
+		return nil, err
+	}
+	if !retryable {
+		return nil, fmt.Errorf("%w: %s", ErrBackendUnavailable, describeAttempts(attempts))
+	}
+	return nil, fmt.Errorf("所有后端调用失败: %s: %w", describeAttempts(attempts), lastErr)
+}
+
+// saveBreakerState 保存熔断状态（失败只记录日志，不影响任务）
+func (w *AgentWorker) saveBreakerState(state BreakerState) {
+	if err := saveBreakerState(w.ctx, w.redisClient, w.config.Name, state); err != nil {
+		LogWarn("[Agent-%s] 保存熔断状态失败: %v", w.config.Name, err)
+	}
+}
+
+// catBackends 按猫猫名字查询各后端的熔断状态（未配置 fallbacks 或读取失败时返回 nil）
+func (sm *SessionManager) catBackends(name string) []BreakerState {
+	agent, ok := sm.cats.Get(name)
+	if !ok || len(agent.Fallbacks) == 0 {
+		return nil
+	}
+	states, err := loadBreakerStates(sm.ctx, sm.redisClient, &agent)
+	if err != nil {
+		LogWarn("[API] 读取 %s 的熔断状态失败: %v", name, err)
+		return nil
+	}
+	return states
+}
+
+// failoverNotice 由备用后端回答时的系统消息
+func failoverNotice(task *TaskMessage) string {
+	return fmt.Sprintf("🔀 %s 的 %s 不可用，本次由 %s 回答", task.AgentName, describeAttempts(task.Failover), task.Backend)
+}
@@ -0,0 +1,286 @@
+// Package ipdflow IPD 研发流程的状态机与评审结论解析
+// 独立成包以便 test 包直接测试真实实现（src 为 main 包，无法导入）；
+// 发给猫猫的提示词和状态持久化由 mode_ipd.go 负责
+package ipdflow
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Phase IPD 评审阶段
+type Phase string
+
+// SubPhase IPD 子阶段
+type SubPhase string
+
+const (
+	PhaseTR3  Phase = "tr3"
+	PhaseTR5  Phase = "tr5"
+	PhaseDone Phase = "done"
+
+	SubPhaseCoding        SubPhase = "coding"
+	SubPhaseReview        SubPhase = "review"
+	SubPhaseDebate        SubPhase = "debate"
+	SubPhaseFinalApproval SubPhase = "final_approval"
+)
+
+// IPD 动作名称
+const (
+	ActionSubmitCode   = "submit_code"
+	ActionApprove      = "approve"
+	ActionReject       = "reject"
+	ActionStartDebate  = "start_debate"
+	ActionFinalApprove = "final_approve"
+	ActionAdvancePhase = "advance_phase"
+)
+
+// MaxVerdictRetries 评审回复中没有结论标记时最多追问的次数，超过后等待铲屎官通过动作决定
+const MaxVerdictRetries = 2
+
+// PRInfo 提交评审的代码信息
+type PRInfo struct {
+	URL      string   `json:"url"`
+	Author   string   `json:"author"`
+	Comments []string `json:"comments"`
+}
+
+// State IPD 流程状态（保存在 ModeState.CustomState 中）
+type State struct {
+	Phase          Phase           `json:"phase"`
+	SubPhase       SubPhase        `json:"sub_phase"`
+	Participants   []string        `json:"participants"`
+	Approvals      map[string]bool `json:"approvals"`
+	PRInfo         *PRInfo         `json:"pr_info,omitempty"`
+	ReviewRound    int             `json:"review_round"`
+	DebateRebutted bool            `json:"debate_rebutted"`
+	VerdictRetries int             `json:"verdict_retries,omitempty"` // 当前子阶段已追问结论的次数
+	StartTime      time.Time       `json:"start_time"`
+}
+
+// StepName 步骤名称，如 tr3:review
+func (s *State) StepName() string {
+	if s.Phase == PhaseDone {
+		return string(PhaseDone)
+	}
+	return fmt.Sprintf("%s:%s", s.Phase, s.SubPhase)
+}
+
+// Next 状态变化后需要发起的猫猫调用
+type Next int
+
+const (
+	NextNone          Next = iota
+	NextReview             // 请 reviewer 审查代码
+	NextDebate             // 请 architect 陈述技术观点
+	NextRebuttal           // 请 reviewer 反驳 architect 的观点
+	NextFinalApproval      // 请 architect 做出最终决策
+	NextAskVerdict         // 回复中没有结论标记，请同一只猫猫补充结论
+)
+
+// Flow IPD 流程的角色分工：审查由 Reviewer 负责，辩论和最终批准由 Architect 负责
+type Flow struct {
+	Architect string
+	Reviewer  string
+}
+
+// NewState 创建从 TR3 编码阶段开始的流程状态
+func (f Flow) NewState(now time.Time) *State {
+	return &State{
+		Phase:        PhaseTR3,
+		SubPhase:     SubPhaseCoding,
+		Participants: []string{f.Architect, f.Reviewer},
+		Approvals:    make(map[string]bool),
+		StartTime:    now,
+	}
+}
+
+// HandleAction 执行用户显式触发的动作，prURL 只用于 submit_code，reason 只用于 reject
+func (f Flow) HandleAction(s *State, action, prURL, reason string) (Next, error) {
+	if s.Phase == PhaseDone {
+		if action == ActionAdvancePhase {
+			return NextNone, fmt.Errorf("IPD 流程已完成，无法继续推进")
+		}
+		return NextNone, fmt.Errorf("IPD 流程已完成")
+	}
+
+	switch action {
+	case ActionSubmitCode:
+		if s.SubPhase != SubPhaseCoding {
+			return NextNone, fmt.Errorf("submit_code 只能在 coding 阶段执行，当前阶段: %s", s.SubPhase)
+		}
+		s.submitCode(prURL)
+		return NextReview, nil
+
+	case ActionApprove:
+		if s.SubPhase != SubPhaseReview {
+			return NextNone, fmt.Errorf("approve 只能在 review 阶段执行，当前阶段: %s", s.SubPhase)
+		}
+		s.Approvals[f.Reviewer] = true
+		s.startDebate()
+		return NextDebate, nil
+
+	case ActionReject:
+		if s.SubPhase != SubPhaseReview {
+			return NextNone, fmt.Errorf("reject 只能在 review 阶段执行，当前阶段: %s", s.SubPhase)
+		}
+		s.reject(reason)
+		return NextNone, nil
+
+	case ActionStartDebate:
+		if s.SubPhase != SubPhaseReview {
+			return NextNone, fmt.Errorf("start_debate 只能在 review 阶段执行，当前阶段: %s", s.SubPhase)
+		}
+		s.startDebate()
+		return NextDebate, nil
+
+	case ActionFinalApprove:
+		if s.SubPhase != SubPhaseDebate && s.SubPhase != SubPhaseFinalApproval {
+			return NextNone, fmt.Errorf("final_approve 只能在 debate 阶段之后执行，当前阶段: %s", s.SubPhase)
+		}
+		s.Approvals[f.Architect] = true
+		s.advancePhase()
+		return NextNone, nil
+
+	case ActionAdvancePhase:
+		s.advancePhase()
+		return NextNone, nil
+	}
+	return NextNone, fmt.Errorf("未知的 IPD 动作: %s", action)
+}
+
+// OnResponse 根据猫猫回复推进状态：审查和最终批准阶段按「结论：APPROVE/REJECT」标记决定去向，
+// 没有标记时追问同一只猫猫（最多 MaxVerdictRetries 次），辩论阶段由两只猫猫轮流发言
+func (f Flow) OnResponse(s *State, agentName, response string) Next {
+	switch s.SubPhase {
+	case SubPhaseReview:
+		if agentName != f.Reviewer {
+			return NextNone
+		}
+		switch ParseVerdict(response) {
+		case VerdictApprove:
+			s.Approvals[f.Reviewer] = true
+			s.startDebate()
+			return NextDebate
+		case VerdictReject:
+			s.reject(response)
+			return NextNone
+		}
+		return s.askVerdict()
+
+	case SubPhaseDebate:
+		if agentName == f.Architect && !s.DebateRebutted {
+			s.DebateRebutted = true
+			return NextRebuttal
+		}
+		if agentName == f.Reviewer && s.DebateRebutted {
+			s.enter(SubPhaseFinalApproval)
+			return NextFinalApproval
+		}
+
+	case SubPhaseFinalApproval:
+		if agentName != f.Architect {
+			return NextNone
+		}
+		switch ParseVerdict(response) {
+		case VerdictApprove:
+			s.Approvals[f.Architect] = true
+			s.advancePhase()
+			return NextNone
+		case VerdictReject:
+			s.reject(response)
+			return NextNone
+		}
+		return s.askVerdict()
+	}
+	return NextNone
+}
+
+// enter 进入子阶段并清零追问次数
+func (s *State) enter(subPhase SubPhase) {
+	s.SubPhase = subPhase
+	s.VerdictRetries = 0
+}
+
+// askVerdict 回复中没有结论时追问，超过次数后停止，留在当前子阶段等待铲屎官的动作
+func (s *State) askVerdict() Next {
+	if s.VerdictRetries >= MaxVerdictRetries {
+		return NextNone
+	}
+	s.VerdictRetries++
+	return NextAskVerdict
+}
+
+// submitCode 提交代码，进入新一轮审查
+func (s *State) submitCode(prURL string) {
+	if s.PRInfo == nil {
+		s.PRInfo = &PRInfo{Author: "用户", Comments: []string{}}
+	}
+	if prURL != "" {
+		s.PRInfo.URL = prURL
+	}
+	s.ReviewRound++
+	s.Approvals = make(map[string]bool)
+	s.enter(SubPhaseReview)
+}
+
+// startDebate 进入技术辩论阶段，由 architect 先陈述观点
+func (s *State) startDebate() {
+	s.enter(SubPhaseDebate)
+	s.DebateRebutted = false
+}
+
+// reject 审查或最终批准被拒绝，记录意见并回退到编码阶段
+func (s *State) reject(reason string) {
+	if s.PRInfo == nil {
+		s.PRInfo = &PRInfo{Author: "用户", Comments: []string{}}
+	}
+	if reason = strings.TrimSpace(reason); reason != "" {
+		s.PRInfo.Comments = append(s.PRInfo.Comments, reason)
+	}
+	s.Approvals = make(map[string]bool)
+	s.enter(SubPhaseCoding)
+}
+
+// advancePhase 推进到下一个评审点：TR3 → TR5 → 完成
+func (s *State) advancePhase() {
+	switch s.Phase {
+	case PhaseTR3:
+		s.Phase = PhaseTR5
+		s.enter(SubPhaseCoding)
+		s.PRInfo = nil
+		s.ReviewRound = 0
+	default:
+		s.Phase = PhaseDone
+		s.enter("")
+	}
+	s.Approvals = make(map[string]bool)
+	s.DebateRebutted = false
+}
+
+// Verdict 猫猫回复中的评审结论
+type Verdict int
+
+const (
+	VerdictNone Verdict = iota
+	VerdictApprove
+	VerdictReject
+)
+
+// verdictMarker 「结论：APPROVE/REJECT」标记（APPROVED 等不算）
+var verdictMarker = regexp.MustCompile(`(?i)结论\s*[:：]\s*(APPROVE|REJECT)\b`)
+
+// ParseVerdict 解析评审结论，只识别「结论：APPROVE/REJECT」标记（多个时以最后一个为准）
+// 正文中的 APPROVE、通过、批准等词不作为结论：「审查未通过」「暂不批准」「修复后我会 APPROVE」都会被误判
+func ParseVerdict(response string) Verdict {
+	matches := verdictMarker.FindAllStringSubmatch(response, -1)
+	if len(matches) == 0 {
+		return VerdictNone
+	}
+	if strings.EqualFold(matches[len(matches)-1][1], "REJECT") {
+		return VerdictReject
+	}
+	return VerdictApprove
+}
@@ -19,6 +19,7 @@ func main() {
 		targetAgent = flag.String("to", "", "目标 Agent 名称")
 		taskContent = flag.String("task", "", "任务内容")
 		port        = flag.String("port", "8080", "API 服务器端口")
+		route       = flag.String("route", "", "独立任务的后续 @ 调用路由策略 (send/ui 模式): orchestrator(默认，不自动派发), worker(由 Agent 工作进程派发)")
 	)
 
 	flag.Parse()
@@ -116,6 +117,12 @@ func main() {
 			os.Exit(1)
 		}
 
+		routing, err := ParseRoutingPolicy(*route)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+
 		scheduler, err := NewScheduler(*configPath)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "初始化调度器失败: %v\n", err)
@@ -123,7 +130,7 @@ func main() {
 		}
 		defer scheduler.Close()
 
-		taskID, err := scheduler.SendTask(*targetAgent, *taskContent, "")
+		taskID, err := scheduler.SendTaskWithRouting(*targetAgent, *taskContent, routing)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "发送任务失败: %v\n", err)
 			os.Exit(1)
@@ -179,29 +186,32 @@ func main() {
 			}
 		}
 
-		// 获取系统提示词
-		systemPrompt, err := scheduler.GetSystemPrompt(*agentName)
+		// 获取提示词组合器
+		prompts, err := scheduler.GetPromptComposer(*agentName)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "获取系统提示词失败: %v\n", err)
+			fmt.Fprintf(os.Stderr, "获取提示词失败: %v\n", err)
 			os.Exit(1)
 		}
 
 		// 创建 Agent 工作进程
 		worker, err := NewAgentWorker(
 			agentConfig,
-			systemPrompt,
+			prompts,
 			scheduler.config.Redis.Addr,
 			scheduler.config.Redis.Password,
 			scheduler.config.Redis.DB,
 			workspaceManager,
 			chainManager,
 			scheduler.config.Hindsight,
+			scheduler.config.Pricing,
 		)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "创建 Agent 工作进程失败: %v\n", err)
 			os.Exit(1)
 		}
 
+		worker.SetPeers(scheduler.config.Agents)
+		worker.SetBudgets(scheduler.config.Budgets)
 		scheduler.Close()
 
 		// 启动 Agent
@@ -215,6 +225,12 @@ func main() {
 
 	// 交互式 UI 模式
 	if *mode == "ui" {
+		routing, err := ParseRoutingPolicy(*route)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+
 		scheduler, err := NewScheduler(*configPath)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "初始化调度器失败: %v\n", err)
@@ -232,6 +248,7 @@ func main() {
 			os.Exit(1)
 		}
 		defer ui.Stop()
+		ui.SetRouting(routing)
 
 		if err := ui.Start(); err != nil {
 			fmt.Fprintf(os.Stderr, "用户界面运行失败: %v\n", err)
@@ -249,6 +266,7 @@ func main() {
 	fmt.Println("  交互界面:      ./cat-cafe --mode ui")
 	fmt.Println("  列出 Agent:    ./cat-cafe --list")
 	fmt.Println("  发送任务:      ./cat-cafe --send --to 花花 --task \"实现HTTP服务器\"")
+	fmt.Println("  接力发送任务:  ./cat-cafe --send --route worker --to 花花 --task \"实现HTTP服务器\"")
 	fmt.Println("  启动 Agent:    ./cat-cafe --mode agent --agent 花花")
 	fmt.Println()
 	flag.PrintDefaults()
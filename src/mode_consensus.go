@@ -0,0 +1,556 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 共识模式状态
+const (
+	ConsensusStatusIdle      = "idle"
+	ConsensusStatusProposing = "proposing"
+	ConsensusStatusVoting    = "voting"
+	ConsensusStatusDone      = "done"
+)
+
+// 共识模式默认超时（秒）
+const (
+	defaultConsensusProposalTimeout = 300
+	defaultConsensusVoteTimeout     = 180
+)
+
+// ConsensusBallot 一张选票：按偏好从高到低排列的方案（以提出方案的猫猫命名）
+type ConsensusBallot struct {
+	Voter   string   `json:"voter"`
+	Ranking []string `json:"ranking"`
+}
+
+// ConsensusTally 计票结果
+type ConsensusTally struct {
+	Scores     map[string]int `json:"scores"`
+	Winner     string         `json:"winner,omitempty"`
+	Tie        []string       `json:"tie,omitempty"`
+	QuorumMet  bool           `json:"quorum_met"`
+	ValidVotes int            `json:"valid_votes"`
+}
+
+// ConsensusState 共识模式状态（保存在 ModeState.CustomState 中）
+type ConsensusState struct {
+	Status       string                     `json:"status"`
+	Question     string                     `json:"question"`
+	Round        int                        `json:"round"`
+	GroupID      string                     `json:"group_id,omitempty"`
+	Participants []string                   `json:"participants"`
+	Proposals    map[string]string          `json:"proposals"`
+	Ballots      map[string]ConsensusBallot `json:"ballots"`
+	Result       *ConsensusTally            `json:"result,omitempty"`
+	StartTime    time.Time                  `json:"start_time"`
+}
+
+// ConsensusMode 共识/投票模式
+// 第一轮所有猫猫并行回答同一个问题，第二轮每只猫猫对其他猫猫的方案排序投票，
+// 按 Borda 计分统计后以系统消息公布结果
+type ConsensusMode struct {
+	name            string
+	description     string
+	participants    []string // 配置中指定的参与者，为空时使用全部猫猫
+	roster          []string
+	quorum          int
+	proposalTimeout int
+	voteTimeout     int
+	notifier        ModeNotifier
+
+	mu     sync.Mutex
+	states map[string]*ModeState
+}
+
+// NewConsensusMode 创建共识模式
+// 支持的配置：participants（默认全部猫猫）、quorum（默认过半）、
+// proposal_timeout / vote_timeout（秒，默认 300 / 180）
+func NewConsensusMode(config *ModeConfig) (CollaborationMode, error) {
+	mode := &ConsensusMode{
+		name:            "consensus",
+		description:     "共识模式 - 所有猫猫并行回答并互相投票，统计后公布结果",
+		proposalTimeout: defaultConsensusProposalTimeout,
+		voteTimeout:     defaultConsensusVoteTimeout,
+		states:          make(map[string]*ModeState),
+	}
+
+	if config != nil && config.Config != nil {
+		if v, ok := config.Config["participants"].([]interface{}); ok {
+			for _, p := range v {
+				if name, ok := p.(string); ok && name != "" {
+					mode.participants = append(mode.participants, name)
+				}
+			}
+		}
+		if v, ok := config.Config["quorum"].(float64); ok {
+			mode.quorum = int(v)
+		}
+		if v, ok := config.Config["proposal_timeout"].(float64); ok && v > 0 {
+			mode.proposalTimeout = int(v)
+		}
+		if v, ok := config.Config["vote_timeout"].(float64); ok && v > 0 {
+			mode.voteTimeout = int(v)
+		}
+	}
+
+	return mode, nil
+}
+
+// GetName 返回模式名称
+func (m *ConsensusMode) GetName() string {
+	return m.name
+}
+
+// GetDescription 返回模式描述
+func (m *ConsensusMode) GetDescription() string {
+	return m.description
+}
+
+// Validate 验证模式配置
+func (m *ConsensusMode) Validate() error {
+	if m.quorum < 0 {
+		return fmt.Errorf("consensus 的 quorum 不能为负数: %d", m.quorum)
+	}
+	if len(m.participants) > 0 && m.quorum > len(m.participants) {
+		return fmt.Errorf("consensus 的 quorum (%d) 超过参与者数量 (%d)", m.quorum, len(m.participants))
+	}
+	return nil
+}
+
+// SetRoster 设置全部猫猫名单
+func (m *ConsensusMode) SetRoster(agentNames []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.roster = agentNames
+}
+
+// SetNotifier 设置通知回调
+func (m *ConsensusMode) SetNotifier(notifier ModeNotifier) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.notifier = notifier
+}
+
+// BindState 绑定会话状态
+func (m *ConsensusMode) BindState(sessionID string, state *ModeState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.states[sessionID] = state
+}
+
+// UnbindState 解绑会话状态
+func (m *ConsensusMode) UnbindState(sessionID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.states, sessionID)
+}
+
+// Initialize 初始化模式
+func (m *ConsensusMode) Initialize(sessionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	modeState, cs, err := m.loadLocked(sessionID)
+	if err != nil {
+		return err
+	}
+	if cs.Status != "" {
+		return nil
+	}
+	cs.Status = ConsensusStatusIdle
+	return m.saveLocked(modeState, cs)
+}
+
+// OnUserMessage 处理用户消息
+// 空闲时把消息作为议题发给所有参与者；投票进行中时按 @ 提及转发
+func (m *ConsensusMode) OnUserMessage(sessionID string, content string, mentionedCats []string) ([]AgentCall, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	modeState, cs, err := m.loadLocked(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if cs.Status == ConsensusStatusProposing || cs.Status == ConsensusStatusVoting {
+		calls := make([]AgentCall, 0, len(mentionedCats))
+		for _, catName := range mentionedCats {
+			calls = append(calls, AgentCall{
+				AgentName:  catName,
+				Prompt:     content,
+				SessionID:  sessionID,
+				CallerName: "用户",
+			})
+		}
+		return calls, nil
+	}
+
+	participants := m.participantsLocked()
+	if len(participants) == 0 {
+		return nil, fmt.Errorf("consensus 模式没有可用的参与者")
+	}
+
+	cs.Status = ConsensusStatusProposing
+	cs.Question = content
+	cs.Round++
+	cs.GroupID = fmt.Sprintf("consensus_%d_propose_%d", cs.Round, time.Now().UnixNano())
+	cs.Participants = participants
+	cs.Proposals = make(map[string]string)
+	cs.Ballots = make(map[string]ConsensusBallot)
+	cs.Result = nil
+	cs.StartTime = time.Now()
+
+	calls := make([]AgentCall, 0, len(participants))
+	for _, name := range participants {
+		calls = append(calls, AgentCall{
+			AgentName:  name,
+			Prompt:     m.buildProposalPrompt(content, participants),
+			SessionID:  sessionID,
+			CallerName: "用户",
+			Metadata: map[string]interface{}{
+				"source":         "consensus_proposal",
+				MetaGroupID:      cs.GroupID,
+				MetaGroupTimeout: m.proposalTimeout,
+			},
+		})
+	}
+
+	if err := m.saveLocked(modeState, cs); err != nil {
+		return nil, err
+	}
+	m.broadcastProgressLocked(sessionID, cs, false)
+	return calls, nil
+}
+
+// OnAgentResponse 共识模式的回复都通过子任务组汇总，这里不处理
+func (m *ConsensusMode) OnAgentResponse(sessionID string, agentName string, response string) ([]AgentCall, error) {
+	return nil, nil
+}
+
+// OnSubtaskCompleted 逐条记录方案和选票，并推送投票进度
+func (m *ConsensusMode) OnSubtaskCompleted(sessionID string, group *SubtaskGroup, subtask *Subtask) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	modeState, cs, err := m.loadLocked(sessionID)
+	if err != nil || group.ID != cs.GroupID || subtask.Status != SubtaskCompleted {
+		return
+	}
+
+	switch cs.Status {
+	case ConsensusStatusProposing:
+		cs.Proposals[subtask.AgentName] = subtask.Result
+	case ConsensusStatusVoting:
+		candidates := m.candidatesFor(cs, subtask.AgentName)
+		ranking := parseConsensusRanking(subtask.Result, candidates)
+		if len(ranking) == 0 {
+			LogWarn("[Consensus] 无法解析 %s 的选票", subtask.AgentName)
+			return
+		}
+		cs.Ballots[subtask.AgentName] = ConsensusBallot{Voter: subtask.AgentName, Ranking: ranking}
+	default:
+		return
+	}
+
+	if err := m.saveLocked(modeState, cs); err != nil {
+		LogError("[Consensus] 保存状态失败: %v", err)
+		return
+	}
+	m.broadcastProgressLocked(sessionID, cs, false)
+}
+
+// OnGroupCompleted 方案轮结束后进入投票轮，投票轮结束后计票并公布结果
+func (m *ConsensusMode) OnGroupCompleted(sessionID string, group *SubtaskGroup) ([]AgentCall, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	modeState, cs, err := m.loadLocked(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if group.ID != cs.GroupID {
+		LogWarn("[Consensus] 忽略过期的子任务组 - Session: %s, Group: %s", sessionID, group.ID)
+		return nil, nil
+	}
+
+	var calls []AgentCall
+	quorum := m.quorumFor(len(cs.Participants))
+
+	switch cs.Status {
+	case ConsensusStatusProposing:
+		if len(cs.Proposals) < quorum {
+			m.finishLocked(sessionID, cs, fmt.Sprintf("只收到 %d 份方案，未达到法定人数 %d，本轮投票取消。", len(cs.Proposals), quorum))
+			break
+		}
+		if len(cs.Proposals) == 1 {
+			for name := range cs.Proposals {
+				cs.Result = &ConsensusTally{Scores: map[string]int{name: 0}, Winner: name, QuorumMet: true}
+			}
+			m.finishLocked(sessionID, cs, m.formatResult(cs))
+			break
+		}
+
+		cs.Status = ConsensusStatusVoting
+		cs.GroupID = fmt.Sprintf("consensus_%d_vote_%d", cs.Round, time.Now().UnixNano())
+		for _, voter := range cs.Participants {
+			candidates := m.candidatesFor(cs, voter)
+			if len(candidates) == 0 {
+				continue
+			}
+			calls = append(calls, AgentCall{
+				AgentName:  voter,
+				Prompt:     m.buildVotePrompt(cs, candidates),
+				SessionID:  sessionID,
+				CallerName: "共识模式",
+				Metadata: map[string]interface{}{
+					"source":         "consensus_vote",
+					MetaGroupID:      cs.GroupID,
+					MetaGroupTimeout: m.voteTimeout,
+				},
+			})
+		}
+
+	case ConsensusStatusVoting:
+		cs.Result = tallyConsensusBallots(cs.Ballots, cs.Proposals)
+		cs.Result.QuorumMet = cs.Result.ValidVotes >= quorum
+		m.finishLocked(sessionID, cs, m.formatResult(cs))
+	}
+
+	if err := m.saveLocked(modeState, cs); err != nil {
+		return nil, err
+	}
+	m.broadcastProgressLocked(sessionID, cs, cs.Status == ConsensusStatusDone)
+	return calls, nil
+}
+
+// finishLocked 结束本轮并公布结果
+func (m *ConsensusMode) finishLocked(sessionID string, cs *ConsensusState, message string) {
+	cs.Status = ConsensusStatusDone
+	cs.GroupID = ""
+	if m.notifier != nil {
+		m.notifier.PostSystemMessage(sessionID, message)
+	}
+}
+
+// participantsLocked 返回本轮参与者
+func (m *ConsensusMode) participantsLocked() []string {
+	if len(m.participants) > 0 {
+		return append([]string(nil), m.participants...)
+	}
+	return append([]string(nil), m.roster...)
+}
+
+// quorumFor 计算法定人数，未配置时为过半
+func (m *ConsensusMode) quorumFor(total int) int {
+	if m.quorum > 0 {
+		return m.quorum
+	}
+	return total/2 + 1
+}
+
+// candidatesFor 返回投票者可以投的方案（不能投自己）
+func (m *ConsensusMode) candidatesFor(cs *ConsensusState, voter string) []string {
+	candidates := make([]string, 0, len(cs.Proposals))
+	for _, name := range cs.Participants {
+		if _, ok := cs.Proposals[name]; ok && name != voter {
+			candidates = append(candidates, name)
+		}
+	}
+	return candidates
+}
+
+// broadcastProgressLocked 推送投票进度
+func (m *ConsensusMode) broadcastProgressLocked(sessionID string, cs *ConsensusState, final bool) {
+	if m.notifier == nil {
+		return
+	}
+
+	received := len(cs.Proposals)
+	if cs.Status == ConsensusStatusVoting || final {
+		received = len(cs.Ballots)
+	}
+
+	m.notifier.BroadcastModeEvent(sessionID, "vote_progress", map[string]interface{}{
+		"sessionId": sessionID,
+		"round":     cs.Round,
+		"phase":     cs.Status,
+		"received":  received,
+		"total":     len(cs.Participants),
+		"quorum":    m.quorumFor(len(cs.Participants)),
+		"tally":     tallyConsensusBallots(cs.Ballots, cs.Proposals).Scores,
+		"result":    cs.Result,
+		"final":     final,
+	})
+}
+
+// buildProposalPrompt 构造方案轮提示词
+func (m *ConsensusMode) buildProposalPrompt(question string, participants []string) string {
+	return fmt.Sprintf("【共识模式 第一轮：提出方案】%s 会同时回答同一个问题，之后互相投票。\n\n问题：%s\n\n请独立给出你的方案和理由，不要 @ 其他猫猫。",
+		strings.Join(participants, "、"), question)
+}
+
+// buildVotePrompt 构造投票轮提示词
+func (m *ConsensusMode) buildVotePrompt(cs *ConsensusState, candidates []string) string {
+	var sb strings.Builder
+	sb.WriteString("【共识模式 第二轮：投票】请阅读其他猫猫的方案并按你的偏好排序。\n\n")
+	sb.WriteString(fmt.Sprintf("问题：%s\n", cs.Question))
+	for _, name := range candidates {
+		sb.WriteString(fmt.Sprintf("\n### %s 的方案\n%s\n", name, cs.Proposals[name]))
+	}
+	sb.WriteString(fmt.Sprintf("\n请简要说明理由，并在回复最后一行按偏好从高到低写出排名，例如：\n排名：%s\n", strings.Join(candidates, " > ")))
+	return sb.String()
+}
+
+// formatResult 格式化计票结果
+func (m *ConsensusMode) formatResult(cs *ConsensusState) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("🗳️ 共识投票结果（第 %d 轮）\n议题：%s\n", cs.Round, cs.Question))
+
+	result := cs.Result
+	if result == nil {
+		return sb.String()
+	}
+
+	names := make([]string, 0, len(result.Scores))
+	for name := range result.Scores {
+		names = append(names, name)
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		if result.Scores[names[i]] != result.Scores[names[j]] {
+			return result.Scores[names[i]] > result.Scores[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	for _, name := range names {
+		sb.WriteString(fmt.Sprintf("- %s 的方案：%d 分\n", name, result.Scores[name]))
+	}
+	sb.WriteString(fmt.Sprintf("有效票数：%d/%d\n", result.ValidVotes, len(cs.Participants)))
+
+	switch {
+	case !result.QuorumMet:
+		sb.WriteString(fmt.Sprintf("未达到法定人数 %d，结果仅供参考。", m.quorumFor(len(cs.Participants))))
+	case len(result.Tie) > 1:
+		sb.WriteString(fmt.Sprintf("平票：%s，需要铲屎官裁决。", strings.Join(result.Tie, "、")))
+	default:
+		sb.WriteString(fmt.Sprintf("胜出：%s 的方案", result.Winner))
+	}
+	return sb.String()
+}
+
+// loadLocked 读取会话的共识状态（调用方需持有 m.mu）
+func (m *ConsensusMode) loadLocked(sessionID string) (*ModeState, *ConsensusState, error) {
+	modeState, ok := m.states[sessionID]
+	if !ok || modeState == nil {
+		return nil, nil, fmt.Errorf("会话 %s 未绑定 consensus 状态", sessionID)
+	}
+
+	cs := &ConsensusState{}
+	if err := modeState.DecodeCustomState(cs); err != nil {
+		return nil, nil, err
+	}
+	if cs.Proposals == nil {
+		cs.Proposals = make(map[string]string)
+	}
+	if cs.Ballots == nil {
+		cs.Ballots = make(map[string]ConsensusBallot)
+	}
+	return modeState, cs, nil
+}
+
+// saveLocked 写回共识状态（调用方需持有 m.mu）
+func (m *ConsensusMode) saveLocked(modeState *ModeState, cs *ConsensusState) error {
+	if err := modeState.EncodeCustomState(cs); err != nil {
+		return err
+	}
+	modeState.EnterStep(cs.Status)
+	return nil
+}
+
+// parseConsensusRanking 从投票回复中解析排名
+// 优先读取最后一个包含「排名」「投票」「ranking」「vote」的行，按候选名出现顺序排列
+func parseConsensusRanking(response string, candidates []string) []string {
+	lines := strings.Split(response, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		lower := strings.ToLower(lines[i])
+		if !strings.Contains(lower, "排名") && !strings.Contains(lower, "投票") &&
+			!strings.Contains(lower, "ranking") && !strings.Contains(lower, "vote") {
+			continue
+		}
+		if ranking := orderByAppearance(lines[i], candidates); len(ranking) > 0 {
+			return ranking
+		}
+	}
+	return nil
+}
+
+// orderByAppearance 按候选名在文本中首次出现的位置排序
+func orderByAppearance(text string, candidates []string) []string {
+	type pos struct {
+		name  string
+		index int
+	}
+	found := make([]pos, 0, len(candidates))
+	for _, name := range candidates {
+		if idx := strings.Index(text, name); idx >= 0 {
+			found = append(found, pos{name: name, index: idx})
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].index < found[j].index })
+
+	ranking := make([]string, 0, len(found))
+	for _, p := range found {
+		ranking = append(ranking, p.name)
+	}
+	return ranking
+}
+
+// tallyConsensusBallots 按 Borda 计分统计选票：n 个候选中排第 k 位得 n-k+1 分
+func tallyConsensusBallots(ballots map[string]ConsensusBallot, proposals map[string]string) *ConsensusTally {
+	tally := &ConsensusTally{Scores: make(map[string]int)}
+	for name := range proposals {
+		tally.Scores[name] = 0
+	}
+
+	for _, ballot := range ballots {
+		if len(ballot.Ranking) == 0 {
+			continue
+		}
+		tally.ValidVotes++
+		n := len(ballot.Ranking)
+		for i, name := range ballot.Ranking {
+			if _, ok := tally.Scores[name]; ok {
+				tally.Scores[name] += n - i
+			}
+		}
+	}
+
+	best := -1
+	for name, score := range tally.Scores {
+		switch {
+		case score > best:
+			best = score
+			tally.Tie = []string{name}
+		case score == best:
+			tally.Tie = append(tally.Tie, name)
+		}
+	}
+	sort.Strings(tally.Tie)
+	if len(tally.Tie) == 1 {
+		tally.Winner = tally.Tie[0]
+		tally.Tie = nil
+	}
+	return tally
+}
+
+// init 注册共识模式到全局注册表
+func init() {
+	err := RegisterMode("consensus", NewConsensusMode)
+	if err != nil {
+		fmt.Printf("Failed to register consensus mode: %v\n", err)
+	}
+}
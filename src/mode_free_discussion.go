@@ -3,21 +3,41 @@ package main
 import (
 	"fmt"
 	"strings"
+	"time"
 )
 
+// defaultJoinTimeout 用户同时 @ 多只猫猫时等待全部回复的默认超时（秒）
+const defaultJoinTimeout = 600
+
 // FreeDiscussionMode 自由讨论模式
 // 猫猫可以随意互相 @ 调用，没有流程约束
 type FreeDiscussionMode struct {
-	name        string
-	description string
+	name         string
+	description  string
+	joinMentions bool // 用户同时 @ 多只猫猫时，等全部回复后再统一处理后续调用（需显式开启）
+	joinTimeout  int
 }
 
 // NewFreeDiscussionMode 创建自由讨论模式
+// 支持的配置：join_mentions（默认 false，开启后后续调用最多等待 join_timeout）、join_timeout（秒，默认 600）
 func NewFreeDiscussionMode(config *ModeConfig) (CollaborationMode, error) {
-	return &FreeDiscussionMode{
-		name:        "free_discussion",
-		description: "自由讨论模式 - 猫猫可以随意互相调用，适合开放式协作",
-	}, nil
+	mode := &FreeDiscussionMode{
+		name:         "free_discussion",
+		description:  "自由讨论模式 - 猫猫可以随意互相调用，适合开放式协作",
+		joinMentions: false,
+		joinTimeout:  defaultJoinTimeout,
+	}
+
+	if config != nil && config.Config != nil {
+		if v, ok := config.Config["join_mentions"].(bool); ok {
+			mode.joinMentions = v
+		}
+		if v, ok := config.Config["join_timeout"].(float64); ok && v > 0 {
+			mode.joinTimeout = int(v)
+		}
+	}
+
+	return mode, nil
 }
 
 // GetName 返回模式名称
@@ -34,22 +54,77 @@ func (m *FreeDiscussionMode) GetDescription() string {
 func (m *FreeDiscussionMode) OnUserMessage(sessionID string, content string, mentionedCats []string) ([]AgentCall, error) {
 	calls := []AgentCall{}
 
+	// 同时 @ 多只猫猫时编为一组，等全部回复后再统一处理后续调用
+	groupID := ""
+	if m.joinMentions && len(mentionedCats) > 1 {
+		groupID = fmt.Sprintf("join_%d", time.Now().UnixNano())
+	}
+
 	// 为每个被提及的猫猫创建调用
 	for _, catName := range mentionedCats {
+		metadata := map[string]interface{}{
+			"source": "user_message",
+		}
+		if groupID != "" {
+			metadata[MetaGroupID] = groupID
+			metadata[MetaGroupTimeout] = m.joinTimeout
+		}
 		calls = append(calls, AgentCall{
 			AgentName:  catName,
 			Prompt:     content,
 			SessionID:  sessionID,
 			CallerName: "用户",
-			Metadata: map[string]interface{}{
-				"source": "user_message",
-			},
+			Metadata:   metadata,
 		})
 	}
 
 	return calls, nil
 }
 
+// DefaultLoopLimits 自由讨论没有流程约束，使用较严格的调用链限制防止猫猫互相 @ 停不下来
+func (m *FreeDiscussionMode) DefaultLoopLimits() LoopLimits {
+	return LoopLimits{
+		MaxHops:        8,
+		MaxInvocations: 20,
+		MaxPairRepeats: 4,
+	}
+}
+
+// OnGroupCompleted 一组猫猫全部回复后，按派发顺序汇总各自回复中的 @ 调用
+// 多只猫猫 @ 同一只猫猫时合并为一次调用，避免后续调用交错
+func (m *FreeDiscussionMode) OnGroupCompleted(sessionID string, group *SubtaskGroup) ([]AgentCall, error) {
+	merged := []AgentCall{}
+	index := make(map[string]int)
+	callers := make(map[string][]string)
+
+	for _, subtask := range group.Results() {
+		if subtask.Status != SubtaskCompleted {
+			continue
+		}
+		for _, call := range m.parseAtMentions(subtask.Result, sessionID, subtask.AgentName) {
+			i, exists := index[call.AgentName]
+			if !exists {
+				index[call.AgentName] = len(merged)
+				callers[call.AgentName] = []string{subtask.AgentName}
+				merged = append(merged, call)
+				continue
+			}
+
+			// 合并来自不同猫猫的调用，每段标注发起者
+			existing := &merged[i]
+			if len(callers[call.AgentName]) == 1 {
+				existing.Prompt = fmt.Sprintf("【%s】%s", existing.CallerName, existing.Prompt)
+			}
+			existing.Prompt = fmt.Sprintf("%s\n\n【%s】%s", existing.Prompt, subtask.AgentName, call.Prompt)
+			callers[call.AgentName] = append(callers[call.AgentName], subtask.AgentName)
+			existing.CallerName = strings.Join(callers[call.AgentName], "、")
+			existing.Metadata["caller_agent"] = existing.CallerName
+		}
+	}
+
+	return merged, nil
+}
+
 // OnAgentResponse 处理猫猫回复
 func (m *FreeDiscussionMode) OnAgentResponse(sessionID string, agentName string, response string) ([]AgentCall, error) {
 	// 解析回复中的 @ 调用
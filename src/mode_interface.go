@@ -1,7 +1,11 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"time"
+
+	"cat-cafe/src/modeaction"
 )
 
 // CollaborationMode 协作模式接口
@@ -51,6 +55,9 @@ type AgentCall struct {
 
 	// Metadata 额外的元数据
 	Metadata map[string]interface{}
+
+	// Chain 调用因果链（由编排器在派发前填写）
+	Chain *CallChain
 }
 
 // ModeConfig 模式配置
@@ -77,9 +84,258 @@ type ModeState struct {
 	// CustomState 自定义状态数据
 	CustomState map[string]interface{} `json:"custom_state,omitempty"`
 
+	// Groups 未完成的子任务组，由编排器维护（随会话持久化，重启后可继续汇总）
+	Groups map[string]*SubtaskGroup `json:"groups,omitempty"`
+
+	// OwnerRequests 等待铲屎官回复的提问，不为空时会话处于等待铲屎官状态
+	OwnerRequests []*OwnerRequest `json:"owner_requests,omitempty"`
+
 	// LastUpdateTime 最后更新时间
 	LastUpdateTime time.Time `json:"last_update_time"`
 }
 
 // ModeFactory 模式工厂函数
 type ModeFactory func(config *ModeConfig) (CollaborationMode, error)
+
+// StatefulMode 有状态的协作模式（可选接口）
+// 模式实例按名称在注册表中共享，会话级的流程进度必须保存在 ModeState 中。
+// 编排器在会话创建、切换模式、从 Redis 恢复时通过 BindState 注入该会话的状态，
+// 在会话删除或切出该模式时调用 UnbindState。
+type StatefulMode interface {
+	BindState(sessionID string, state *ModeState)
+	UnbindState(sessionID string)
+}
+
+// EnterStep 进入新步骤，记录步骤历史
+func (s *ModeState) EnterStep(step string) {
+	if s.CurrentStep == step {
+		return
+	}
+	s.CurrentStep = step
+	s.StepHistory = append(s.StepHistory, step)
+	s.LastUpdateTime = time.Now()
+}
+
+// DecodeCustomState 将 CustomState 解码为模式自定义的结构体
+// CustomState 经过 Redis JSON 往返后类型会变成 map/float64，统一通过 JSON 转换
+func (s *ModeState) DecodeCustomState(v interface{}) error {
+	if len(s.CustomState) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(s.CustomState)
+	if err != nil {
+		return fmt.Errorf("序列化模式状态失败: %w", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("解析模式状态失败: %w", err)
+	}
+	return nil
+}
+
+// EncodeCustomState 将模式自定义的结构体写回 CustomState
+func (s *ModeState) EncodeCustomState(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("序列化模式状态失败: %w", err)
+	}
+	custom := make(map[string]interface{})
+	if err := json.Unmarshal(data, &custom); err != nil {
+		return fmt.Errorf("解析模式状态失败: %w", err)
+	}
+	s.CustomState = custom
+	s.LastUpdateTime = time.Now()
+	return nil
+}
+
+// ActionableMode 支持用户显式动作的协作模式（可选接口）
+// 需要用户决策的流程模式（批准、拒绝、跳过步骤、重新开始等）实现该接口，
+// 通过 POST /api/sessions/:sessionId/mode/action 触发
+type ActionableMode interface {
+	// GetActions 返回会话当前步骤可执行的动作列表
+	GetActions(sessionID string) []ModeAction
+
+	// HandleAction 执行动作，返回需要调用的猫猫列表
+	HandleAction(sessionID string, action string, params map[string]interface{}) ([]AgentCall, error)
+}
+
+// ModeAction 模式动作声明（定义在 modeaction 包中）
+type ModeAction = modeaction.Action
+
+// ModeActionParam 动作参数定义
+type ModeActionParam = modeaction.Param
+
+// 子任务相关的 AgentCall.Metadata 键
+const (
+	// MetaGroupID 子任务组 ID，模式在返回的调用中设置该键即可让编排器跟踪并汇总结果
+	MetaGroupID = "group_id"
+
+	// MetaSubtaskID 子任务 ID，由编排器分配，随任务发送并在结果中带回
+	MetaSubtaskID = "subtask_id"
+
+	// MetaGroupTimeout 子任务组超时时间（秒），超时后未返回的子任务记为 timeout 并直接汇总
+	MetaGroupTimeout = "group_timeout"
+
+	// MetaTaskTimeout 单个任务的 CLI 调用超时（秒），覆盖 Agent 配置的 timeout
+	MetaTaskTimeout = "task_timeout"
+)
+
+// 编排器派发任务时附加的 Metadata 键，Agent 据此选择 mode_prompts 中的提示词
+const (
+	// MetaMode 会话当前的协作模式名称
+	MetaMode = "mode"
+
+	// MetaModeStep 模式当前所处的步骤（ModeState.CurrentStep）
+	MetaModeStep = "mode_step"
+)
+
+// 子任务状态
+const (
+	SubtaskPending   = "pending"
+	SubtaskCompleted = "completed"
+	SubtaskFailed    = "failed"
+	SubtaskTimeout   = "timeout"
+)
+
+// SubtaskGroup 一组并行派发的子任务
+type SubtaskGroup struct {
+	ID        string              `json:"id"`
+	Subtasks  map[string]*Subtask `json:"subtasks"`
+	Order     []string            `json:"order"`
+	CreatedAt time.Time           `json:"created_at"`
+	Deadline  time.Time           `json:"deadline,omitempty"`
+}
+
+// Subtask 子任务
+type Subtask struct {
+	ID          string     `json:"id"`
+	AgentName   string     `json:"agent_name"`
+	Prompt      string     `json:"prompt"`
+	Status      string     `json:"status"`
+	Result      string     `json:"result,omitempty"`
+	CompletedAt time.Time  `json:"completed_at,omitempty"`
+	Chain       *CallChain `json:"chain,omitempty"`
+}
+
+// parentChain 返回组内最深的调用链，作为汇总后续调用的上游
+func (g *SubtaskGroup) parentChain() *CallChain {
+	var parent *CallChain
+	for _, st := range g.Subtasks {
+		if st.Chain != nil && (parent == nil || st.Chain.Hop > parent.Hop) {
+			parent = st.Chain
+		}
+	}
+	return parent
+}
+
+// Done 判断子任务组是否全部结束
+func (g *SubtaskGroup) Done() bool {
+	for _, st := range g.Subtasks {
+		if st.Status == SubtaskPending {
+			return false
+		}
+	}
+	return true
+}
+
+// Results 按派发顺序返回子任务
+func (g *SubtaskGroup) Results() []*Subtask {
+	results := make([]*Subtask, 0, len(g.Order))
+	for _, id := range g.Order {
+		if st, ok := g.Subtasks[id]; ok {
+			results = append(results, st)
+		}
+	}
+	return results
+}
+
+// 子任务组状态
+const (
+	GroupWaiting   = "waiting"
+	GroupCompleted = "completed"
+	GroupTimeout   = "timeout"
+)
+
+// SubtaskGroupStatus 子任务组状态快照（用于 WebSocket 推送和查询接口）
+type SubtaskGroupStatus struct {
+	SessionID string          `json:"sessionId"`
+	GroupID   string          `json:"groupId"`
+	Status    string          `json:"status"`
+	Finished  int             `json:"finished"`
+	Total     int             `json:"total"`
+	Deadline  *time.Time      `json:"deadline,omitempty"`
+	Subtasks  []SubtaskStatus `json:"subtasks"`
+}
+
+// SubtaskStatus 子任务状态快照
+type SubtaskStatus struct {
+	ID        string `json:"id"`
+	AgentName string `json:"agentName"`
+	Status    string `json:"status"`
+}
+
+// Snapshot 生成子任务组状态快照
+func (g *SubtaskGroup) Snapshot(sessionID string, status string) SubtaskGroupStatus {
+	snapshot := SubtaskGroupStatus{
+		SessionID: sessionID,
+		GroupID:   g.ID,
+		Status:    status,
+		Total:     len(g.Order),
+		Subtasks:  make([]SubtaskStatus, 0, len(g.Order)),
+	}
+	if !g.Deadline.IsZero() {
+		deadline := g.Deadline
+		snapshot.Deadline = &deadline
+	}
+	for _, st := range g.Results() {
+		if st.Status != SubtaskPending {
+			snapshot.Finished++
+		}
+		snapshot.Subtasks = append(snapshot.Subtasks, SubtaskStatus{
+			ID:        st.ID,
+			AgentName: st.AgentName,
+			Status:    st.Status,
+		})
+	}
+	return snapshot
+}
+
+// AggregatingMode 需要汇总子任务结果的协作模式（可选接口）
+// 模式在 AgentCall.Metadata 中设置 MetaGroupID 后，组内子任务的回复不再逐条进入 OnAgentResponse，
+// 而是在全部结束（或超时）后一次性交给 OnGroupCompleted。
+// 未实现该接口的模式会在整组结束后按派发顺序依次收到 OnAgentResponse
+type AggregatingMode interface {
+	OnGroupCompleted(sessionID string, group *SubtaskGroup) ([]AgentCall, error)
+}
+
+// SubtaskObserver 需要逐条观察子任务结果的协作模式（可选接口）
+// 每个子任务结束时调用（早于 OnGroupCompleted），用于推送进度等
+type SubtaskObserver interface {
+	OnSubtaskCompleted(sessionID string, group *SubtaskGroup, subtask *Subtask)
+}
+
+// ModeNotifier 模式向会话推送通知的回调，由 SessionManager 实现
+// 模式回调通常在持有会话锁时执行，实现方必须保证这些方法不会因此阻塞
+type ModeNotifier interface {
+	// PostSystemMessage 发布系统消息（写入 Session Chain 并推送给前端）
+	PostSystemMessage(sessionID string, content string)
+
+	// BroadcastModeEvent 通过 WebSocket 推送模式事件
+	BroadcastModeEvent(sessionID string, eventType string, data interface{})
+
+	// DispatchModeCalls 异步派发模式产生的猫猫调用（如超时触发的后续步骤）
+	DispatchModeCalls(sessionID string, calls []AgentCall)
+
+	// RunModeTimer 在会话锁内执行定时器触发的模式逻辑（与结果处理、会话持久化互斥），
+	// 并派发 fn 返回的调用；只能在不持有会话锁的 goroutine 中调用
+	RunModeTimer(sessionID string, fn func() []AgentCall)
+}
+
+// NotifiableMode 需要主动推送通知的协作模式（可选接口）
+type NotifiableMode interface {
+	SetNotifier(notifier ModeNotifier)
+}
+
+// RosterAwareMode 需要知道所有已配置猫猫的协作模式（可选接口）
+type RosterAwareMode interface {
+	SetRoster(agentNames []string)
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"cat-cafe/src/ipdflow"
+)
+
+// IPD 流程的状态和转换规则见 ipdflow 包，这里负责生成发给猫猫的提示词和保存状态
+
+// IPDPhase IPD 评审阶段
+type IPDPhase = ipdflow.Phase
+
+// IPDSubPhase IPD 子阶段
+type IPDSubPhase = ipdflow.SubPhase
+
+const (
+	IPDPhaseTR3  = ipdflow.PhaseTR3
+	IPDPhaseTR5  = ipdflow.PhaseTR5
+	IPDPhaseDone = ipdflow.PhaseDone
+
+	IPDSubPhaseCoding        = ipdflow.SubPhaseCoding
+	IPDSubPhaseReview        = ipdflow.SubPhaseReview
+	IPDSubPhaseDebate        = ipdflow.SubPhaseDebate
+	IPDSubPhaseFinalApproval = ipdflow.SubPhaseFinalApproval
+)
+
+// IPD 动作名称
+const (
+	IPDActionSubmitCode   = ipdflow.ActionSubmitCode
+	IPDActionApprove      = ipdflow.ActionApprove
+	IPDActionReject       = ipdflow.ActionReject
+	IPDActionStartDebate  = ipdflow.ActionStartDebate
+	IPDActionFinalApprove = ipdflow.ActionFinalApprove
+	IPDActionAdvancePhase = ipdflow.ActionAdvancePhase
+)
+
+// IPDPRInfo 提交评审的代码信息
+type IPDPRInfo = ipdflow.PRInfo
+
+// IPDState IPD 流程状态（保存在 ModeState.CustomState 中）
+type IPDState = ipdflow.State
+
+// IPDMode IPD 研发流程模式
+// 每个评审点（TR3、TR5）依次经过 编码 → 代码审查 → 技术辩论 → 最终批准，
+// 审查由 reviewer 负责，辩论和最终批准由 architect 负责
+type IPDMode struct {
+	name        string
+	description string
+	architect   string
+	reviewer    string
+
+	mu     sync.Mutex
+	states map[string]*ModeState
+}
+
+// NewIPDMode 创建 IPD 模式
+// 支持的配置：architect（默认 花花）、reviewer（默认 薇薇）
+func NewIPDMode(config *ModeConfig) (CollaborationMode, error) {
+	mode := &IPDMode{
+		name:        "ipd_dev",
+		description: "IPD 研发流程模式，支持 TR3/TR5 评审",
+		architect:   "花花",
+		reviewer:    "薇薇",
+		states:      make(map[string]*ModeState),
+	}
+
+	if config != nil && config.Config != nil {
+		if v, ok := config.Config["architect"].(string); ok && v != "" {
+			mode.architect = v
+		}
+		if v, ok := config.Config["reviewer"].(string); ok && v != "" {
+			mode.reviewer = v
+		}
+	}
+
+	return mode, nil
+}
+
+// GetName 返回模式名称
+func (m *IPDMode) GetName() string {
+	return m.name
+}
+
+// GetDescription 返回模式描述
+func (m *IPDMode) GetDescription() string {
+	return m.description
+}
+
+// Validate 验证模式配置
+func (m *IPDMode) Validate() error {
+	if m.architect == "" || m.reviewer == "" {
+		return fmt.Errorf("ipd_dev 需要配置 architect 和 reviewer")
+	}
+	if m.architect == m.reviewer {
+		return fmt.Errorf("ipd_dev 的 architect 和 reviewer 不能是同一只猫猫: %s", m.architect)
+	}
+	return nil
+}
+
+// BindState 绑定会话状态
+func (m *IPDMode) BindState(sessionID string, state *ModeState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.states[sessionID] = state
+}
+
+// UnbindState 解绑会话状态
+func (m *IPDMode) UnbindState(sessionID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.states, sessionID)
+}
+
+// Initialize 初始化模式：新会话从 TR3 编码阶段开始，已有进度的会话保持不变
+func (m *IPDMode) Initialize(sessionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	modeState, ipd, err := m.loadLocked(sessionID)
+	if err != nil {
+		return err
+	}
+	if ipd.Phase != "" {
+		return nil
+	}
+
+	return m.saveLocked(modeState, m.flow().NewState(time.Now()))
+}
+
+// OnUserMessage 处理用户消息：按当前子阶段路由到对应角色的猫猫
+func (m *IPDMode) OnUserMessage(sessionID string, content string, mentionedCats []string) ([]AgentCall, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ipd, err := m.loadLocked(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []string
+	switch ipd.SubPhase {
+	case IPDSubPhaseReview:
+		targets = []string{m.reviewer}
+	case IPDSubPhaseDebate, IPDSubPhaseFinalApproval:
+		targets = []string{m.architect}
+	default:
+		// 编码阶段或流程结束后，按用户 @ 的猫猫自由协作
+		targets = mentionedCats
+	}
+
+	calls := make([]AgentCall, 0, len(targets))
+	for _, catName := range targets {
+		calls = append(calls, m.newCall(sessionID, catName, content, "用户", ipd, "user_message"))
+	}
+	return calls, nil
+}
+
+// OnAgentResponse 处理猫猫回复，根据评审结论推进状态机
+func (m *IPDMode) OnAgentResponse(sessionID string, agentName string, response string) ([]AgentCall, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	modeState, ipd, err := m.loadLocked(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	phase := strings.ToUpper(string(ipd.Phase))
+	var calls []AgentCall
+
+	switch m.flow().OnResponse(ipd, agentName, response) {
+	case ipdflow.NextDebate:
+		calls = m.debateCalls(sessionID, ipd, response)
+	case ipdflow.NextRebuttal:
+		// 架构师陈述完观点后，由审查者进行反驳
+		calls = append(calls, m.newCall(sessionID, m.reviewer,
+			fmt.Sprintf("【IPD %s 技术辩论】%s 的观点如下，请针对其中的技术风险给出你的反驳或补充：\n\n%s",
+				phase, m.architect, response),
+			m.architect, ipd, "ipd_debate"))
+	case ipdflow.NextFinalApproval:
+		calls = append(calls, m.newCall(sessionID, m.architect,
+			fmt.Sprintf("【IPD %s 最终批准】%s 的反驳意见如下：\n\n%s\n\n请综合审查和辩论结果做出最终决策，并在回复末尾注明「结论：APPROVE」或「结论：REJECT」。",
+				phase, m.reviewer, response),
+			m.reviewer, ipd, "ipd_final_approval"))
+	case ipdflow.NextAskVerdict:
+		// 回复中没有结论标记，不猜测结论，请同一只猫猫补充（追问的调用方与原请求一致）
+		caller := "用户"
+		if agentName == m.architect {
+			caller = m.reviewer
+		}
+		calls = append(calls, m.newCall(sessionID, agentName,
+			fmt.Sprintf("【IPD %s】你的回复中没有找到评审结论。请在回复末尾注明「结论：APPROVE」或「结论：REJECT」。", phase),
+			caller, ipd, "ipd_verdict"))
+	}
+
+	if err := m.saveLocked(modeState, ipd); err != nil {
+		return nil, err
+	}
+	return calls, nil
+}
+
+// GetActions 返回当前子阶段可执行的 IPD 动作
+func (m *IPDMode) GetActions(sessionID string) []ModeAction {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ipd, err := m.loadLocked(sessionID)
+	if err != nil || ipd.Phase == IPDPhaseDone {
+		return []ModeAction{}
+	}
+
+	advance := ModeAction{Name: IPDActionAdvancePhase, Description: "跳过剩余步骤，直接推进到下一个评审点"}
+
+	switch ipd.SubPhase {
+	case IPDSubPhaseCoding:
+		return []ModeAction{
+			{
+				Name:        IPDActionSubmitCode,
+				Description: "提交代码，进入代码审查",
+				Params: []ModeActionParam{
+					{Name: "pr_url", Type: "string", Description: "PR 链接"},
+					{Name: "description", Type: "string", Description: "提交说明"},
+				},
+			},
+			advance,
+		}
+	case IPDSubPhaseReview:
+		return []ModeAction{
+			{Name: IPDActionApprove, Description: "批准代码审查，进入技术辩论"},
+			{
+				Name:        IPDActionReject,
+				Description: "拒绝代码，退回编码阶段",
+				Params: []ModeActionParam{
+					{Name: "reason", Type: "string", Description: "拒绝原因"},
+				},
+			},
+			{Name: IPDActionStartDebate, Description: "跳过审查，直接开始技术辩论"},
+			advance,
+		}
+	case IPDSubPhaseDebate, IPDSubPhaseFinalApproval:
+		return []ModeAction{
+			{Name: IPDActionFinalApprove, Description: "最终批准，推进到下一个评审点"},
+			advance,
+		}
+	}
+	return []ModeAction{advance}
+}
+
+// HandleAction 处理用户显式触发的 IPD 动作
+func (m *IPDMode) HandleAction(sessionID string, action string, params map[string]interface{}) ([]AgentCall, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	modeState, ipd, err := m.loadLocked(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	next, err := m.flow().HandleAction(ipd, action, paramString(params, "pr_url"), paramString(params, "reason"))
+	if err != nil {
+		return nil, err
+	}
+
+	var calls []AgentCall
+	switch next {
+	case ipdflow.NextReview:
+		calls = m.reviewCalls(sessionID, ipd, paramString(params, "description"))
+	case ipdflow.NextDebate:
+		summary := "铲屎官已批准代码审查"
+		if action == IPDActionStartDebate {
+			summary = "铲屎官跳过审查，直接开始技术辩论"
+		}
+		calls = m.debateCalls(sessionID, ipd, summary)
+	}
+
+	if err := m.saveLocked(modeState, ipd); err != nil {
+		return nil, err
+	}
+	return calls, nil
+}
+
+// reviewCalls 提交代码后通知 reviewer 审查
+func (m *IPDMode) reviewCalls(sessionID string, ipd *IPDState, description string) []AgentCall {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("【IPD %s 代码审查 第 %d 轮】铲屎官提交了代码，请进行审查。\n",
+		strings.ToUpper(string(ipd.Phase)), ipd.ReviewRound))
+	if ipd.PRInfo.URL != "" {
+		sb.WriteString(fmt.Sprintf("PR 链接：%s\n", ipd.PRInfo.URL))
+	}
+	if description != "" {
+		sb.WriteString(fmt.Sprintf("提交说明：%s\n", description))
+	}
+	if len(ipd.PRInfo.Comments) > 0 {
+		sb.WriteString("\n上一轮审查意见：\n")
+		for _, comment := range ipd.PRInfo.Comments {
+			sb.WriteString(fmt.Sprintf("- %s\n", comment))
+		}
+	}
+	sb.WriteString("\n审查完成后请在回复末尾注明「结论：APPROVE」或「结论：REJECT」。")
+
+	return []AgentCall{m.newCall(sessionID, m.reviewer, sb.String(), "用户", ipd, "ipd_review")}
+}
+
+// debateCalls 进入技术辩论阶段后请 architect 先陈述观点
+func (m *IPDMode) debateCalls(sessionID string, ipd *IPDState, reviewSummary string) []AgentCall {
+	prompt := fmt.Sprintf("【IPD %s 技术辩论】代码审查已通过，审查结论如下：\n\n%s\n\n请从架构角度陈述你对本次改动的技术观点和潜在风险，随后 %s 会进行反驳。",
+		strings.ToUpper(string(ipd.Phase)), reviewSummary, m.reviewer)
+	return []AgentCall{m.newCall(sessionID, m.architect, prompt, m.reviewer, ipd, "ipd_debate")}
+}
+
+// flow IPD 流程的角色分工
+func (m *IPDMode) flow() ipdflow.Flow {
+	return ipdflow.Flow{Architect: m.architect, Reviewer: m.reviewer}
+}
+
+// newCall 构造带 IPD 元数据的猫猫调用
+func (m *IPDMode) newCall(sessionID, agentName, prompt, callerName string, ipd *IPDState, source string) AgentCall {
+	return AgentCall{
+		AgentName:  agentName,
+		Prompt:     prompt,
+		SessionID:  sessionID,
+		CallerName: callerName,
+		Metadata: map[string]interface{}{
+			"source":        source,
+			"ipd_phase":     string(ipd.Phase),
+			"ipd_sub_phase": string(ipd.SubPhase),
+		},
+	}
+}
+
+// loadLocked 读取会话的 IPD 状态（调用方需持有 m.mu）
+func (m *IPDMode) loadLocked(sessionID string) (*ModeState, *IPDState, error) {
+	modeState, ok := m.states[sessionID]
+	if !ok || modeState == nil {
+		return nil, nil, fmt.Errorf("会话 %s 未绑定 ipd_dev 状态", sessionID)
+	}
+
+	ipd := &IPDState{}
+	if err := modeState.DecodeCustomState(ipd); err != nil {
+		return nil, nil, err
+	}
+	if ipd.Approvals == nil {
+		ipd.Approvals = make(map[string]bool)
+	}
+	return modeState, ipd, nil
+}
+
+// saveLocked 写回 IPD 状态并同步 CurrentStep/StepHistory（调用方需持有 m.mu）
+func (m *IPDMode) saveLocked(modeState *ModeState, ipd *IPDState) error {
+	if err := modeState.EncodeCustomState(ipd); err != nil {
+		return err
+	}
+	modeState.EnterStep(ipd.StepName())
+	return nil
+}
+
+// paramString 读取动作参数中的字符串
+func paramString(params map[string]interface{}, key string) string {
+	if params == nil {
+		return ""
+	}
+	if v, ok := params[key].(string); ok {
+		return v
+	}
+	return ""
+}
+
+// init 注册 IPD 模式到全局注册表
+func init() {
+	err := RegisterMode("ipd_dev", NewIPDMode)
+	if err != nil {
+		fmt.Printf("Failed to register ipd_dev mode: %v\n", err)
+	}
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 规划模式状态
+const (
+	PlannerStatusIdle        = "idle"
+	PlannerStatusPlanning    = "planning"
+	PlannerStatusExecuting   = "executing"
+	PlannerStatusSummarizing = "summarizing"
+	PlannerStatusDone        = "done"
+)
+
+// defaultPlannerMaxSubtasks 单次规划最多派发的子任务数
+const defaultPlannerMaxSubtasks = 5
+
+// defaultPlannerSubtaskTimeout 子任务组超时（秒），超时后以已返回的结果汇总
+// 略长于 Agent 默认的 CLI 超时，正常情况下子任务会先以 timeout 失败结束
+const defaultPlannerSubtaskTimeout = 3600
+
+// PlannerSubtask 规划出的子任务
+type PlannerSubtask struct {
+	Agent string `json:"agent"`
+	Task  string `json:"task"`
+}
+
+// PlannerState 规划模式状态（保存在 ModeState.CustomState 中）
+type PlannerState struct {
+	Status    string           `json:"status"`
+	Request   string           `json:"request"`
+	Round     int              `json:"round"`
+	GroupID   string           `json:"group_id,omitempty"`
+	Subtasks  []PlannerSubtask `json:"subtasks,omitempty"`
+	StartTime time.Time        `json:"start_time"`
+}
+
+// PlannerMode 规划/监督模式
+// 指定的规划猫猫把用户需求拆成子任务，子任务并行派发给执行猫猫，
+// 全部结果返回后再交给规划猫猫汇总出最终答复
+type PlannerMode struct {
+	name        string
+	description string
+	planner     string
+	workers     []string
+	maxSubtasks int
+	timeout     int
+
+	mu     sync.Mutex
+	states map[string]*ModeState
+}
+
+// NewPlannerMode 创建规划模式
+// 支持的配置：planner（默认 花花）、workers（默认 薇薇、小乔）、max_subtasks（默认 5）、
+// subtask_timeout（秒，默认 3600）
+func NewPlannerMode(config *ModeConfig) (CollaborationMode, error) {
+	mode := &PlannerMode{
+		name:        "planner",
+		description: "规划模式 - 规划猫猫拆分任务，执行猫猫并行完成后汇总",
+		planner:     "花花",
+		workers:     []string{"薇薇", "小乔"},
+		maxSubtasks: defaultPlannerMaxSubtasks,
+		timeout:     defaultPlannerSubtaskTimeout,
+		states:      make(map[string]*ModeState),
+	}
+
+	if config != nil && config.Config != nil {
+		if v, ok := config.Config["planner"].(string); ok && v != "" {
+			mode.planner = v
+		}
+		if v, ok := config.Config["workers"].([]interface{}); ok && len(v) > 0 {
+			workers := make([]string, 0, len(v))
+			for _, w := range v {
+				if name, ok := w.(string); ok && name != "" {
+					workers = append(workers, name)
+				}
+			}
+			mode.workers = workers
+		}
+		if v, ok := config.Config["max_subtasks"].(float64); ok && v > 0 {
+			mode.maxSubtasks = int(v)
+		}
+		if v, ok := config.Config["subtask_timeout"].(float64); ok && v > 0 {
+			mode.timeout = int(v)
+		}
+	}
+
+	return mode, nil
+}
+
+// GetName 返回模式名称
+func (m *PlannerMode) GetName() string {
+	return m.name
+}
+
+// GetDescription 返回模式描述
+func (m *PlannerMode) GetDescription() string {
+	return m.description
+}
+
+// Validate 验证模式配置
+func (m *PlannerMode) Validate() error {
+	if m.planner == "" {
+		return fmt.Errorf("planner 模式需要配置 planner")
+	}
+	if len(m.workers) == 0 {
+		return fmt.Errorf("planner 模式至少需要一只执行猫猫")
+	}
+	return nil
+}
+
+// BindState 绑定会话状态
+func (m *PlannerMode) BindState(sessionID string, state *ModeState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.states[sessionID] = state
+}
+
+// UnbindState 解绑会话状态
+func (m *PlannerMode) UnbindState(sessionID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.states, sessionID)
+}
+
+// Initialize 初始化模式
+func (m *PlannerMode) Initialize(sessionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	modeState, ps, err := m.loadLocked(sessionID)
+	if err != nil {
+		return err
+	}
+	if ps.Status != "" {
+		return nil
+	}
+	ps.Status = PlannerStatusIdle
+	return m.saveLocked(modeState, ps)
+}
+
+// OnUserMessage 处理用户消息
+// 空闲时把消息交给规划猫猫拆分任务；执行中时按 @ 提及转发，不影响当前规划
+func (m *PlannerMode) OnUserMessage(sessionID string, content string, mentionedCats []string) ([]AgentCall, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	modeState, ps, err := m.loadLocked(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if ps.Status != PlannerStatusIdle && ps.Status != PlannerStatusDone {
+		calls := make([]AgentCall, 0, len(mentionedCats))
+		for _, catName := range mentionedCats {
+			calls = append(calls, AgentCall{
+				AgentName:  catName,
+				Prompt:     content,
+				SessionID:  sessionID,
+				CallerName: "用户",
+			})
+		}
+		return calls, nil
+	}
+
+	ps.Status = PlannerStatusPlanning
+	ps.Request = content
+	ps.Round++
+	ps.GroupID = ""
+	ps.Subtasks = nil
+	ps.StartTime = time.Now()
+
+	if err := m.saveLocked(modeState, ps); err != nil {
+		return nil, err
+	}
+	return []AgentCall{{
+		AgentName:  m.planner,
+		Prompt:     m.buildPlanPrompt(content),
+		SessionID:  sessionID,
+		CallerName: "用户",
+		Metadata:   map[string]interface{}{"source": "planner_plan"},
+	}}, nil
+}
+
+// OnAgentResponse 处理规划猫猫的回复：规划阶段拆分并派发子任务，汇总阶段结束本轮
+func (m *PlannerMode) OnAgentResponse(sessionID string, agentName string, response string) ([]AgentCall, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if agentName != m.planner {
+		return nil, nil
+	}
+
+	modeState, ps, err := m.loadLocked(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var calls []AgentCall
+
+	switch ps.Status {
+	case PlannerStatusPlanning:
+		subtasks := m.normalizeSubtasks(parsePlannerSubtasks(response, m.workers))
+		if len(subtasks) == 0 {
+			// 规划猫猫直接给出了答复，无需拆分
+			LogInfo("[Planner] 未解析到子任务，本轮直接结束 - Session: %s", sessionID)
+			ps.Status = PlannerStatusDone
+			break
+		}
+
+		ps.Status = PlannerStatusExecuting
+		ps.GroupID = fmt.Sprintf("plan_%d_%d", ps.Round, time.Now().UnixNano())
+		ps.Subtasks = subtasks
+		for _, st := range subtasks {
+			calls = append(calls, AgentCall{
+				AgentName:  st.Agent,
+				Prompt:     m.buildSubtaskPrompt(ps.Request, st),
+				SessionID:  sessionID,
+				CallerName: m.planner,
+				Metadata: map[string]interface{}{
+					"source":         "planner_subtask",
+					MetaGroupID:      ps.GroupID,
+					MetaGroupTimeout: m.timeout,
+				},
+			})
+		}
+		LogInfo("[Planner] 已拆分 %d 个子任务 - Session: %s, Group: %s", len(calls), sessionID, ps.GroupID)
+
+	case PlannerStatusSummarizing:
+		ps.Status = PlannerStatusDone
+	}
+
+	if err := m.saveLocked(modeState, ps); err != nil {
+		return nil, err
+	}
+	return calls, nil
+}
+
+// OnGroupCompleted 所有子任务结束后，把结果交给规划猫猫汇总
+func (m *PlannerMode) OnGroupCompleted(sessionID string, group *SubtaskGroup) ([]AgentCall, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	modeState, ps, err := m.loadLocked(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if ps.Status != PlannerStatusExecuting || group.ID != ps.GroupID {
+		LogWarn("[Planner] 忽略过期的子任务组 - Session: %s, Group: %s", sessionID, group.ID)
+		return nil, nil
+	}
+
+	ps.Status = PlannerStatusSummarizing
+	if err := m.saveLocked(modeState, ps); err != nil {
+		return nil, err
+	}
+
+	return []AgentCall{{
+		AgentName:  m.planner,
+		Prompt:     m.buildSummaryPrompt(ps.Request, group.Results()),
+		SessionID:  sessionID,
+		CallerName: "规划模式",
+		Metadata:   map[string]interface{}{"source": "planner_summary"},
+	}}, nil
+}
+
+// normalizeSubtasks 限制子任务数量，并把未知的猫猫轮流分配给执行猫猫
+func (m *PlannerMode) normalizeSubtasks(subtasks []PlannerSubtask) []PlannerSubtask {
+	if len(subtasks) > m.maxSubtasks {
+		subtasks = subtasks[:m.maxSubtasks]
+	}
+	for i := range subtasks {
+		if !containsString(m.workers, subtasks[i].Agent) {
+			subtasks[i].Agent = m.workers[i%len(m.workers)]
+		}
+	}
+	return subtasks
+}
+
+// buildPlanPrompt 构造规划提示词
+func (m *PlannerMode) buildPlanPrompt(request string) string {
+	var sb strings.Builder
+	sb.WriteString("【规划模式】你是本次任务的规划者，请把下面的需求拆分为可以并行完成的子任务。\n\n")
+	sb.WriteString(fmt.Sprintf("需求：%s\n\n", request))
+	sb.WriteString(fmt.Sprintf("可分配的猫猫：%s（最多 %d 个子任务）\n\n", strings.Join(m.workers, "、"), m.maxSubtasks))
+	sb.WriteString("请在回复中用如下 JSON 代码块给出子任务列表：\n")
+	sb.WriteString("```json\n[{\"agent\": \"猫猫名称\", \"task\": \"子任务描述\"}]\n```\n")
+	sb.WriteString("所有子任务完成后，你会收到汇总结果并给出最终答复。如果需求足够简单，可以不输出子任务直接回答。")
+	return sb.String()
+}
+
+// buildSubtaskPrompt 构造子任务提示词
+func (m *PlannerMode) buildSubtaskPrompt(request string, st PlannerSubtask) string {
+	return fmt.Sprintf("【规划模式 子任务】%s 将总体需求拆分后分配给你以下子任务：\n\n%s\n\n总体需求（仅供参考）：%s\n\n请专注完成你的子任务，直接给出结果。",
+		m.planner, st.Task, request)
+}
+
+// buildSummaryPrompt 构造汇总提示词
+func (m *PlannerMode) buildSummaryPrompt(request string, results []*Subtask) string {
+	var sb strings.Builder
+	sb.WriteString("【规划模式 汇总】所有子任务已结束，请综合以下结果给出最终答复。\n\n")
+	sb.WriteString(fmt.Sprintf("需求：%s\n", request))
+	for i, st := range results {
+		sb.WriteString(fmt.Sprintf("\n### 子任务 %d（%s，%s）\n", i+1, st.AgentName, st.Status))
+		if st.Result != "" {
+			sb.WriteString(st.Result)
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+// loadLocked 读取会话的规划状态（调用方需持有 m.mu）
+func (m *PlannerMode) loadLocked(sessionID string) (*ModeState, *PlannerState, error) {
+	modeState, ok := m.states[sessionID]
+	if !ok || modeState == nil {
+		return nil, nil, fmt.Errorf("会话 %s 未绑定 planner 状态", sessionID)
+	}
+
+	ps := &PlannerState{}
+	if err := modeState.DecodeCustomState(ps); err != nil {
+		return nil, nil, err
+	}
+	return modeState, ps, nil
+}
+
+// saveLocked 写回规划状态（调用方需持有 m.mu）
+func (m *PlannerMode) saveLocked(modeState *ModeState, ps *PlannerState) error {
+	if err := modeState.EncodeCustomState(ps); err != nil {
+		return err
+	}
+	modeState.EnterStep(ps.Status)
+	return nil
+}
+
+var (
+	plannerJSONBlockRe = regexp.MustCompile("(?s)```(?:json)?\\s*(\\[.*?\\])\\s*```")
+	plannerListItemRe  = regexp.MustCompile(`^\s*(?:[-*]|\d+[.)、])\s*@?([^\s:：]+)\s*[:：]\s*(.+)$`)
+)
+
+// parsePlannerSubtasks 从规划猫猫的回复中解析子任务
+// 优先解析 JSON 代码块，其次解析「- @猫猫: 任务」形式的列表
+func parsePlannerSubtasks(response string, workers []string) []PlannerSubtask {
+	candidates := []string{}
+	if match := plannerJSONBlockRe.FindStringSubmatch(response); match != nil {
+		candidates = append(candidates, match[1])
+	}
+	if start, end := strings.Index(response, "["), strings.LastIndex(response, "]"); start >= 0 && end > start {
+		candidates = append(candidates, response[start:end+1])
+	}
+
+	for _, candidate := range candidates {
+		var raw []map[string]interface{}
+		if err := json.Unmarshal([]byte(candidate), &raw); err != nil {
+			continue
+		}
+		subtasks := make([]PlannerSubtask, 0, len(raw))
+		for _, item := range raw {
+			agent, _ := item["agent"].(string)
+			task, _ := item["task"].(string)
+			if task == "" {
+				task, _ = item["description"].(string)
+			}
+			if task = strings.TrimSpace(task); task != "" {
+				subtasks = append(subtasks, PlannerSubtask{Agent: strings.TrimPrefix(strings.TrimSpace(agent), "@"), Task: task})
+			}
+		}
+		if len(subtasks) > 0 {
+			return subtasks
+		}
+	}
+
+	var subtasks []PlannerSubtask
+	for _, line := range strings.Split(response, "\n") {
+		match := plannerListItemRe.FindStringSubmatch(line)
+		if match == nil || !containsString(workers, match[1]) {
+			continue
+		}
+		subtasks = append(subtasks, PlannerSubtask{Agent: match[1], Task: strings.TrimSpace(match[2])})
+	}
+	return subtasks
+}
+
+// init 注册规划模式到全局注册表
+func init() {
+	err := RegisterMode("planner", NewPlannerMode)
+	if err != nil {
+		fmt.Printf("Failed to register planner mode: %v\n", err)
+	}
+}
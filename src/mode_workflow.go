@@ -0,0 +1,725 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// WorkflowEnd 表示流程结束的特殊步骤名
+const WorkflowEnd = "end"
+
+// defaultWorkflowMaxVisits 单个步骤默认最多执行的次数（防止条件回环导致死循环）
+const defaultWorkflowMaxVisits = 5
+
+// WorkflowDefinition 声明式工作流定义
+// 可以写在 config.yaml 的 workflows 下，或作为独立文件放在 workflows/ 目录中
+type WorkflowDefinition struct {
+	Name        string         `yaml:"name" json:"name"`
+	Description string         `yaml:"description" json:"description"`
+	Start       string         `yaml:"start" json:"start"`
+	MaxVisits   int            `yaml:"max_visits,omitempty" json:"max_visits,omitempty"`
+	Steps       []WorkflowStep `yaml:"steps" json:"steps"`
+
+	// knownAgents 已配置的猫猫名称，用于校验步骤中的 agent（加载时注入）
+	knownAgents map[string]bool
+}
+
+// WorkflowStep 工作流步骤
+type WorkflowStep struct {
+	Name        string               `yaml:"name" json:"name"`
+	Agent       string               `yaml:"agent" json:"agent"`
+	Prompt      string               `yaml:"prompt,omitempty" json:"prompt,omitempty"`
+	PromptPath  string               `yaml:"prompt_path,omitempty" json:"prompt_path,omitempty"`
+	DependsOn   []string             `yaml:"depends_on,omitempty" json:"depends_on,omitempty"`
+	Transitions []WorkflowTransition `yaml:"transitions,omitempty" json:"transitions,omitempty"`
+	Next        []string             `yaml:"next,omitempty" json:"next,omitempty"`
+}
+
+// WorkflowTransition 条件转移，按顺序匹配，第一个满足条件的生效
+type WorkflowTransition struct {
+	When WorkflowCondition `yaml:"when" json:"when"`
+	Next []string          `yaml:"next" json:"next"`
+}
+
+// WorkflowCondition 转移条件，所有非空字段都满足时成立
+type WorkflowCondition struct {
+	Contains    string `yaml:"contains,omitempty" json:"contains,omitempty"`
+	NotContains string `yaml:"not_contains,omitempty" json:"not_contains,omitempty"`
+	Regex       string `yaml:"regex,omitempty" json:"regex,omitempty"`
+}
+
+// WorkflowState 工作流运行状态（保存在 ModeState.CustomState 中）
+type WorkflowState struct {
+	Status    string            `json:"status"` // idle, running, completed, stopped
+	Input     string            `json:"input"`
+	Active    []string          `json:"active"`
+	Completed map[string]bool   `json:"completed"`
+	Outputs   map[string]string `json:"outputs"`
+	Visits    map[string]int    `json:"visits"`
+	StartTime time.Time         `json:"start_time"`
+}
+
+// 工作流状态
+const (
+	WorkflowStatusIdle      = "idle"
+	WorkflowStatusRunning   = "running"
+	WorkflowStatusCompleted = "completed"
+	WorkflowStatusStopped   = "stopped"
+)
+
+// 工作流动作
+const (
+	WorkflowActionRestart  = "restart"
+	WorkflowActionSkipStep = "skip_step"
+	WorkflowActionStop     = "stop"
+)
+
+// WorkflowPromptData 步骤提示词模板可用的变量
+type WorkflowPromptData struct {
+	Input    string            // 触发工作流的用户消息
+	Previous string            // 触发本步骤的上一步输出
+	Outputs  map[string]string // 各步骤的最新输出，按步骤名索引
+	Step     string            // 当前步骤名
+	Agent    string            // 当前步骤的猫猫
+}
+
+// WorkflowMode 声明式工作流模式
+type WorkflowMode struct {
+	def       *WorkflowDefinition
+	steps     map[string]*WorkflowStep
+	templates map[string]*template.Template
+	regexes   map[string]*regexp.Regexp
+
+	mu     sync.Mutex
+	states map[string]*ModeState
+}
+
+// NewWorkflowModeFactory 为工作流定义创建模式工厂
+func NewWorkflowModeFactory(def *WorkflowDefinition) ModeFactory {
+	return func(config *ModeConfig) (CollaborationMode, error) {
+		return NewWorkflowMode(def)
+	}
+}
+
+// NewWorkflowMode 创建工作流模式
+func NewWorkflowMode(def *WorkflowDefinition) (*WorkflowMode, error) {
+	if def == nil {
+		return nil, fmt.Errorf("workflow definition is nil")
+	}
+
+	mode := &WorkflowMode{
+		def:       def,
+		steps:     make(map[string]*WorkflowStep),
+		templates: make(map[string]*template.Template),
+		regexes:   make(map[string]*regexp.Regexp),
+		states:    make(map[string]*ModeState),
+	}
+	for i := range def.Steps {
+		step := &def.Steps[i]
+		mode.steps[step.Name] = step
+	}
+	return mode, nil
+}
+
+// GetName 返回模式名称
+func (m *WorkflowMode) GetName() string {
+	return m.def.Name
+}
+
+// GetDescription 返回模式描述
+func (m *WorkflowMode) GetDescription() string {
+	if m.def.Description != "" {
+		return m.def.Description
+	}
+	return fmt.Sprintf("工作流模式 - %d 个步骤", len(m.def.Steps))
+}
+
+// Validate 验证工作流定义：步骤名唯一、引用的步骤存在、模板和正则可解析
+func (m *WorkflowMode) Validate() error {
+	def := m.def
+	if def.Name == "" {
+		return fmt.Errorf("workflow name is required")
+	}
+	if len(def.Steps) == 0 {
+		return fmt.Errorf("workflow %s has no steps", def.Name)
+	}
+	if len(m.steps) != len(def.Steps) {
+		return fmt.Errorf("workflow %s has duplicate step names", def.Name)
+	}
+	if _, ok := m.steps[def.Start]; !ok {
+		return fmt.Errorf("workflow %s start step %q not found", def.Name, def.Start)
+	}
+
+	checkRef := func(from, to string) error {
+		if to == WorkflowEnd {
+			return nil
+		}
+		if _, ok := m.steps[to]; !ok {
+			return fmt.Errorf("workflow %s step %s references unknown step %q", def.Name, from, to)
+		}
+		return nil
+	}
+
+	for i := range def.Steps {
+		step := &def.Steps[i]
+		if step.Name == "" || step.Name == WorkflowEnd {
+			return fmt.Errorf("workflow %s has invalid step name %q", def.Name, step.Name)
+		}
+		if step.Agent == "" {
+			return fmt.Errorf("workflow %s step %s has no agent", def.Name, step.Name)
+		}
+		if def.knownAgents != nil && !def.knownAgents[step.Agent] {
+			return fmt.Errorf("workflow %s step %s uses unknown agent %q", def.Name, step.Name, step.Agent)
+		}
+
+		for _, dep := range step.DependsOn {
+			if dep == WorkflowEnd {
+				return fmt.Errorf("workflow %s step %s cannot depend on %q", def.Name, step.Name, WorkflowEnd)
+			}
+			if err := checkRef(step.Name, dep); err != nil {
+				return err
+			}
+		}
+		for _, next := range step.Next {
+			if err := checkRef(step.Name, next); err != nil {
+				return err
+			}
+		}
+		for j, tr := range step.Transitions {
+			if len(tr.Next) == 0 {
+				return fmt.Errorf("workflow %s step %s transition %d has no next", def.Name, step.Name, j)
+			}
+			for _, next := range tr.Next {
+				if err := checkRef(step.Name, next); err != nil {
+					return err
+				}
+			}
+			if tr.When.Regex != "" {
+				re, err := regexp.Compile(tr.When.Regex)
+				if err != nil {
+					return fmt.Errorf("workflow %s step %s transition %d regex invalid: %w", def.Name, step.Name, j, err)
+				}
+				m.regexes[tr.When.Regex] = re
+			}
+		}
+
+		promptText := step.Prompt
+		if promptText == "" && step.PromptPath != "" {
+			data, err := os.ReadFile(step.PromptPath)
+			if err != nil {
+				return fmt.Errorf("workflow %s step %s read prompt failed: %w", def.Name, step.Name, err)
+			}
+			promptText = string(data)
+		}
+		if promptText == "" {
+			promptText = "{{.Previous}}"
+		}
+		tmpl, err := template.New(step.Name).Option("missingkey=zero").Parse(promptText)
+		if err != nil {
+			return fmt.Errorf("workflow %s step %s prompt template invalid: %w", def.Name, step.Name, err)
+		}
+		m.templates[step.Name] = tmpl
+	}
+
+	return nil
+}
+
+// BindState 绑定会话状态
+func (m *WorkflowMode) BindState(sessionID string, state *ModeState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.states[sessionID] = state
+}
+
+// UnbindState 解绑会话状态
+func (m *WorkflowMode) UnbindState(sessionID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.states, sessionID)
+}
+
+// Initialize 初始化模式：新会话处于空闲状态，已有进度的会话保持不变
+func (m *WorkflowMode) Initialize(sessionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	modeState, wf, err := m.loadLocked(sessionID)
+	if err != nil {
+		return err
+	}
+	if wf.Status != "" {
+		return nil
+	}
+	wf.Status = WorkflowStatusIdle
+	return m.saveLocked(modeState, wf)
+}
+
+// OnUserMessage 处理用户消息
+// 工作流未运行时，用户消息作为输入启动流程；运行中时按 @ 提及转发，不影响流程进度
+func (m *WorkflowMode) OnUserMessage(sessionID string, content string, mentionedCats []string) ([]AgentCall, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	modeState, wf, err := m.loadLocked(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if wf.Status == WorkflowStatusRunning {
+		calls := make([]AgentCall, 0, len(mentionedCats))
+		for _, catName := range mentionedCats {
+			calls = append(calls, AgentCall{
+				AgentName:  catName,
+				Prompt:     content,
+				SessionID:  sessionID,
+				CallerName: "用户",
+			})
+		}
+		return calls, nil
+	}
+
+	calls, err := m.startLocked(sessionID, wf, content)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.saveLocked(modeState, wf); err != nil {
+		return nil, err
+	}
+	return calls, nil
+}
+
+// OnAgentResponse 处理猫猫回复：完成对应步骤并按转移条件激活后续步骤
+func (m *WorkflowMode) OnAgentResponse(sessionID string, agentName string, response string) ([]AgentCall, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	modeState, wf, err := m.loadLocked(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if wf.Status != WorkflowStatusRunning {
+		return nil, nil
+	}
+
+	// 找到该猫猫负责的活动步骤（按激活顺序）
+	stepName := ""
+	for _, name := range wf.Active {
+		if m.steps[name].Agent == agentName {
+			stepName = name
+			break
+		}
+	}
+	if stepName == "" {
+		return nil, nil
+	}
+
+	calls, err := m.completeStepLocked(sessionID, wf, stepName, response, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.saveLocked(modeState, wf); err != nil {
+		return nil, err
+	}
+	return calls, nil
+}
+
+// GetActions 返回当前可执行的工作流动作
+func (m *WorkflowMode) GetActions(sessionID string) []ModeAction {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, wf, err := m.loadLocked(sessionID)
+	if err != nil {
+		return []ModeAction{}
+	}
+
+	restart := ModeAction{
+		Name:        WorkflowActionRestart,
+		Description: "从起始步骤重新运行工作流",
+		Params: []ModeActionParam{
+			{Name: "input", Type: "string", Description: "新的输入，默认沿用上次输入"},
+		},
+	}
+	if wf.Status != WorkflowStatusRunning {
+		return []ModeAction{restart}
+	}
+
+	return []ModeAction{
+		{
+			Name:        WorkflowActionSkipStep,
+			Description: "跳过当前步骤，按默认转移进入后续步骤",
+			Params: []ModeActionParam{
+				{Name: "step", Type: "string", Description: "要跳过的步骤，默认为第一个活动步骤"},
+			},
+		},
+		{Name: WorkflowActionStop, Description: "停止工作流"},
+		restart,
+	}
+}
+
+// HandleAction 执行工作流动作
+func (m *WorkflowMode) HandleAction(sessionID string, action string, params map[string]interface{}) ([]AgentCall, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	modeState, wf, err := m.loadLocked(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var calls []AgentCall
+
+	switch action {
+	case WorkflowActionRestart:
+		input := paramString(params, "input")
+		if input == "" {
+			input = wf.Input
+		}
+		calls, err = m.startLocked(sessionID, wf, input)
+
+	case WorkflowActionSkipStep:
+		if wf.Status != WorkflowStatusRunning || len(wf.Active) == 0 {
+			return nil, fmt.Errorf("工作流未在运行")
+		}
+		stepName := paramString(params, "step")
+		if stepName == "" {
+			stepName = wf.Active[0]
+		}
+		if !containsString(wf.Active, stepName) {
+			return nil, fmt.Errorf("步骤 %s 不在活动状态", stepName)
+		}
+		calls, err = m.completeStepLocked(sessionID, wf, stepName, "", true)
+
+	case WorkflowActionStop:
+		if wf.Status != WorkflowStatusRunning {
+			return nil, fmt.Errorf("工作流未在运行")
+		}
+		wf.Status = WorkflowStatusStopped
+		wf.Active = []string{}
+
+	default:
+		return nil, fmt.Errorf("未知的工作流动作: %s", action)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.saveLocked(modeState, wf); err != nil {
+		return nil, err
+	}
+	return calls, nil
+}
+
+// startLocked 以 input 为输入从起始步骤启动工作流
+func (m *WorkflowMode) startLocked(sessionID string, wf *WorkflowState, input string) ([]AgentCall, error) {
+	wf.Status = WorkflowStatusRunning
+	wf.Input = input
+	wf.Active = []string{}
+	wf.Completed = make(map[string]bool)
+	wf.Outputs = make(map[string]string)
+	wf.Visits = make(map[string]int)
+	wf.StartTime = time.Now()
+
+	call, err := m.activateLocked(sessionID, wf, m.def.Start, input)
+	if err != nil {
+		return nil, err
+	}
+	return []AgentCall{call}, nil
+}
+
+// completeStepLocked 记录步骤输出并激活后续步骤，skipped 为 true 时忽略条件直接走默认 next
+func (m *WorkflowMode) completeStepLocked(sessionID string, wf *WorkflowState, stepName string, output string, skipped bool) ([]AgentCall, error) {
+	step := m.steps[stepName]
+	wf.Active = removeString(wf.Active, stepName)
+	wf.Completed[stepName] = true
+	wf.Outputs[stepName] = output
+
+	nextSteps := step.Next
+	if !skipped {
+		nextSteps = m.resolveNext(step, output)
+	}
+
+	var calls []AgentCall
+	for _, next := range nextSteps {
+		if next == WorkflowEnd {
+			continue
+		}
+		if containsString(wf.Active, next) || !m.depsSatisfied(wf, next) {
+			continue
+		}
+		if wf.Visits[next] >= m.maxVisits() {
+			// 条件回环超过上限，停止工作流等待用户介入
+			LogWarn("[Workflow] 工作流 %s 步骤 %s 已执行 %d 次，停止工作流", m.def.Name, next, wf.Visits[next])
+			wf.Status = WorkflowStatusStopped
+			wf.Active = []string{}
+			return nil, nil
+		}
+		// 回环到已完成的步骤时，清除它及其下游步骤的完成标记，避免汇合点用上一轮的结果提前触发
+		if wf.Completed[next] {
+			m.clearDownstreamLocked(wf, next)
+		}
+		call, err := m.activateLocked(sessionID, wf, next, output)
+		if err != nil {
+			return nil, err
+		}
+		calls = append(calls, call)
+	}
+
+	if len(wf.Active) == 0 {
+		wf.Status = WorkflowStatusCompleted
+	}
+	return calls, nil
+}
+
+// clearDownstreamLocked 清除 start 及所有可从它到达的步骤（next、转移条件的 next、依赖它的汇合点）的完成标记
+// Outputs 保留为各步骤的最新输出，汇合点要等所有依赖在本轮重新完成后才会触发
+func (m *WorkflowMode) clearDownstreamLocked(wf *WorkflowState, start string) {
+	visited := map[string]bool{start: true}
+	queue := []string{start}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		delete(wf.Completed, name)
+
+		step := m.steps[name]
+		successors := append([]string{}, step.Next...)
+		for _, tr := range step.Transitions {
+			successors = append(successors, tr.Next...)
+		}
+		for _, other := range m.def.Steps {
+			if containsString(other.DependsOn, name) {
+				successors = append(successors, other.Name)
+			}
+		}
+		for _, next := range successors {
+			if next == WorkflowEnd || visited[next] {
+				continue
+			}
+			visited[next] = true
+			queue = append(queue, next)
+		}
+	}
+}
+
+// resolveNext 按转移条件计算后续步骤，没有匹配条件时使用默认 next
+func (m *WorkflowMode) resolveNext(step *WorkflowStep, output string) []string {
+	for _, tr := range step.Transitions {
+		if m.matches(tr.When, output) {
+			return tr.Next
+		}
+	}
+	return step.Next
+}
+
+// matches 判断输出是否满足条件
+func (m *WorkflowMode) matches(cond WorkflowCondition, output string) bool {
+	if cond.Contains != "" && !strings.Contains(output, cond.Contains) {
+		return false
+	}
+	if cond.NotContains != "" && strings.Contains(output, cond.NotContains) {
+		return false
+	}
+	if cond.Regex != "" {
+		re, ok := m.regexes[cond.Regex]
+		if !ok || !re.MatchString(output) {
+			return false
+		}
+	}
+	return true
+}
+
+// maxVisits 单个步骤最多执行的次数
+func (m *WorkflowMode) maxVisits() int {
+	if m.def.MaxVisits > 0 {
+		return m.def.MaxVisits
+	}
+	return defaultWorkflowMaxVisits
+}
+
+// depsSatisfied 判断步骤的依赖是否都已完成（DAG 汇合点）
+func (m *WorkflowMode) depsSatisfied(wf *WorkflowState, stepName string) bool {
+	for _, dep := range m.steps[stepName].DependsOn {
+		if !wf.Completed[dep] {
+			return false
+		}
+	}
+	return true
+}
+
+// activateLocked 激活步骤并渲染提示词
+func (m *WorkflowMode) activateLocked(sessionID string, wf *WorkflowState, stepName string, previous string) (AgentCall, error) {
+	step := m.steps[stepName]
+
+	wf.Visits[stepName]++
+	wf.Active = append(wf.Active, stepName)
+
+	prompt, err := m.renderPrompt(step, WorkflowPromptData{
+		Input:    wf.Input,
+		Previous: previous,
+		Outputs:  wf.Outputs,
+		Step:     step.Name,
+		Agent:    step.Agent,
+	})
+	if err != nil {
+		return AgentCall{}, err
+	}
+
+	return AgentCall{
+		AgentName:  step.Agent,
+		Prompt:     prompt,
+		SessionID:  sessionID,
+		CallerName: "工作流",
+		Metadata: map[string]interface{}{
+			"source":        "workflow",
+			"workflow":      m.def.Name,
+			"workflow_step": step.Name,
+		},
+	}, nil
+}
+
+// renderPrompt 渲染步骤提示词模板
+func (m *WorkflowMode) renderPrompt(step *WorkflowStep, data WorkflowPromptData) (string, error) {
+	tmpl, ok := m.templates[step.Name]
+	if !ok {
+		return "", fmt.Errorf("workflow %s step %s template not compiled", m.def.Name, step.Name)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("workflow %s step %s render prompt failed: %w", m.def.Name, step.Name, err)
+	}
+	return buf.String(), nil
+}
+
+// loadLocked 读取会话的工作流状态（调用方需持有 m.mu）
+func (m *WorkflowMode) loadLocked(sessionID string) (*ModeState, *WorkflowState, error) {
+	modeState, ok := m.states[sessionID]
+	if !ok || modeState == nil {
+		return nil, nil, fmt.Errorf("会话 %s 未绑定 %s 状态", sessionID, m.def.Name)
+	}
+
+	wf := &WorkflowState{}
+	if err := modeState.DecodeCustomState(wf); err != nil {
+		return nil, nil, err
+	}
+	if wf.Completed == nil {
+		wf.Completed = make(map[string]bool)
+	}
+	if wf.Outputs == nil {
+		wf.Outputs = make(map[string]string)
+	}
+	if wf.Visits == nil {
+		wf.Visits = make(map[string]int)
+	}
+	return modeState, wf, nil
+}
+
+// saveLocked 写回工作流状态并同步 CurrentStep/StepHistory（调用方需持有 m.mu）
+func (m *WorkflowMode) saveLocked(modeState *ModeState, wf *WorkflowState) error {
+	if err := modeState.EncodeCustomState(wf); err != nil {
+		return err
+	}
+	step := wf.Status
+	if wf.Status == WorkflowStatusRunning {
+		step = strings.Join(wf.Active, ",")
+	}
+	modeState.EnterStep(step)
+	return nil
+}
+
+// containsString 判断切片是否包含字符串
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// removeString 从切片中移除第一个匹配的字符串
+func removeString(list []string, s string) []string {
+	for i, item := range list {
+		if item == s {
+			return append(list[:i:i], list[i+1:]...)
+		}
+	}
+	return list
+}
+
+// LoadWorkflowDefinitions 加载 config.yaml 中的工作流和 workflows 目录下的工作流文件
+func LoadWorkflowDefinitions(config *Config) ([]*WorkflowDefinition, error) {
+	defs := make([]*WorkflowDefinition, 0, len(config.Workflows))
+	for i := range config.Workflows {
+		defs = append(defs, &config.Workflows[i])
+	}
+
+	dir := config.WorkflowsDir
+	if dir == "" {
+		dir = "workflows"
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("扫描工作流目录失败: %w", err)
+	}
+	ymlFiles, _ := filepath.Glob(filepath.Join(dir, "*.yml"))
+	files = append(files, ymlFiles...)
+	sort.Strings(files)
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("读取工作流文件 %s 失败: %w", file, err)
+		}
+		def := &WorkflowDefinition{}
+		if err := yaml.Unmarshal(data, def); err != nil {
+			return nil, fmt.Errorf("解析工作流文件 %s 失败: %w", file, err)
+		}
+		if def.Name == "" {
+			def.Name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		}
+		defs = append(defs, def)
+	}
+
+	knownAgents := make(map[string]bool)
+	for _, agent := range config.Agents {
+		knownAgents[agent.Name] = true
+	}
+	for _, def := range defs {
+		def.knownAgents = knownAgents
+	}
+
+	return defs, nil
+}
+
+// RegisterWorkflowModes 将工作流注册为命名模式，定义无效的工作流会被跳过并记录错误
+func RegisterWorkflowModes(registry *ModeRegistry, defs []*WorkflowDefinition) int {
+	registered := 0
+	for _, def := range defs {
+		// 注册前先校验，避免无效定义出现在模式列表中
+		mode, err := NewWorkflowMode(def)
+		if err == nil {
+			err = mode.Validate()
+		}
+		if err != nil {
+			LogError("[Workflow] 工作流 %s 无效: %v", def.Name, err)
+			continue
+		}
+		if err := registry.Register(def.Name, NewWorkflowModeFactory(def)); err != nil {
+			LogError("[Workflow] 注册工作流 %s 失败: %v", def.Name, err)
+			continue
+		}
+		LogInfo("[Workflow] 已注册工作流模式: %s（%d 个步骤）", def.Name, len(def.Steps))
+		registered++
+	}
+	return registered
+}
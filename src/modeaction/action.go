@@ -0,0 +1,67 @@
+// Package modeaction 协作模式的用户动作声明与参数校验
+// 独立成包以便 test 包直接测试真实实现（src 为 main 包，无法导入）
+package modeaction
+
+import "fmt"
+
+// Action 模式动作声明
+type Action struct {
+	// Name 动作名称
+	Name string `json:"name"`
+
+	// Description 动作描述
+	Description string `json:"description"`
+
+	// Params 参数定义
+	Params []Param `json:"params,omitempty"`
+}
+
+// Param 动作参数定义
+type Param struct {
+	// Name 参数名称
+	Name string `json:"name"`
+
+	// Type 参数类型：string、number、boolean、object、array
+	Type string `json:"type"`
+
+	// Required 是否必填
+	Required bool `json:"required"`
+
+	// Description 参数描述
+	Description string `json:"description,omitempty"`
+}
+
+// ValidateParams 按参数定义校验动作参数
+func (a Action) ValidateParams(params map[string]interface{}) error {
+	for _, p := range a.Params {
+		v, ok := params[p.Name]
+		if !ok || v == nil {
+			if p.Required {
+				return fmt.Errorf("动作 %s 缺少必填参数: %s", a.Name, p.Name)
+			}
+			continue
+		}
+
+		valid := true
+		switch p.Type {
+		case "string":
+			_, valid = v.(string)
+		case "number":
+			switch v.(type) {
+			case float64, float32, int, int64:
+			default:
+				valid = false
+			}
+		case "boolean":
+			_, valid = v.(bool)
+		case "object":
+			_, valid = v.(map[string]interface{})
+		case "array":
+			_, valid = v.([]interface{})
+		}
+		if !valid {
+			return fmt.Errorf("动作 %s 的参数 %s 类型应为 %s", a.Name, p.Name, p.Type)
+		}
+	}
+	return nil
+}
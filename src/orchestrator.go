@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -15,6 +17,9 @@ type Orchestrator struct {
 	defaultMode   string
 	sessions      map[string]*OrchestratorSession
 	agentConfigs  map[string]*AgentConfig // 猫猫配置映射
+	agentNames    []string                // 猫猫名称（按配置顺序）
+	notifier      ModeNotifier
+	groupTimers   map[string]*time.Timer // 子任务组超时定时器，key 为 sessionID/groupID
 }
 
 // OrchestratorSession 编排器会话
@@ -25,6 +30,8 @@ type OrchestratorSession struct {
 	ModeState  *ModeState
 	CreatedAt  time.Time
 	UpdatedAt  time.Time
+
+	loops map[string]*loopCounter // 调用链计数，key 为根用户消息 ID
 }
 
 // NewOrchestrator 创建新的编排器
@@ -35,16 +42,28 @@ func NewOrchestrator(scheduler *Scheduler, defaultMode string) *Orchestrator {
 		defaultMode:  defaultMode,
 		sessions:     make(map[string]*OrchestratorSession),
 		agentConfigs: make(map[string]*AgentConfig),
+		groupTimers:  make(map[string]*time.Timer),
 	}
 }
 
+// SetNotifier 设置模式通知回调
+func (o *Orchestrator) SetNotifier(notifier ModeNotifier) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.notifier = notifier
+}
+
 // SetAgentConfigs 设置猫猫配置
 func (o *Orchestrator) SetAgentConfigs(configs []AgentConfig) {
 	o.mu.Lock()
 	defer o.mu.Unlock()
 
+	// 猫猫注册表变化时整体替换，已删除的猫猫不再保留
+	o.agentConfigs = make(map[string]*AgentConfig, len(configs))
+	o.agentNames = make([]string, 0, len(configs))
 	for i := range configs {
 		o.agentConfigs[configs[i].Name] = &configs[i]
+		o.agentNames = append(o.agentNames, configs[i].Name)
 	}
 }
 
@@ -92,8 +111,12 @@ func (o *Orchestrator) CreateSession(sessionID string, modeName string, modeConf
 
 	o.sessions[sessionID] = session
 
+	// 有状态模式需要先绑定会话状态再初始化
+	o.bindModeLocked(mode, sessionID, session.ModeState)
+
 	// 初始化模式
 	if err := mode.Initialize(sessionID); err != nil {
+		unbindModeState(mode, sessionID)
 		delete(o.sessions, sessionID)
 		return fmt.Errorf("failed to initialize mode: %w", err)
 	}
@@ -119,10 +142,13 @@ func (o *Orchestrator) DeleteSession(sessionID string) error {
 	o.mu.Lock()
 	defer o.mu.Unlock()
 
-	if _, exists := o.sessions[sessionID]; !exists {
+	session, exists := o.sessions[sessionID]
+	if !exists {
 		return fmt.Errorf("session %s not found", sessionID)
 	}
 
+	unbindModeState(session.Mode, sessionID)
+	o.stopSessionTimersLocked(sessionID)
 	delete(o.sessions, sessionID)
 	return nil
 }
@@ -152,15 +178,19 @@ func (o *Orchestrator) SwitchMode(sessionID string, modeName string, modeConfig
 	}
 
 	// 更新会话
+	unbindModeState(session.Mode, sessionID)
+	o.stopSessionTimersLocked(sessionID)
 	session.Mode = mode
 	session.ModeConfig = modeConfig
 	session.ModeState = &ModeState{
 		CustomState:    make(map[string]interface{}),
+		OwnerRequests:  session.ModeState.OwnerRequests, // 等待铲屎官的提问与模式无关，切换后保留
 		LastUpdateTime: time.Now(),
 	}
 	session.UpdatedAt = time.Now()
 
 	// 初始化新模式
+	o.bindModeLocked(mode, sessionID, session.ModeState)
 	if err := mode.Initialize(sessionID); err != nil {
 		return fmt.Errorf("failed to initialize mode: %w", err)
 	}
@@ -168,8 +198,70 @@ func (o *Orchestrator) SwitchMode(sessionID string, modeName string, modeConfig
 	return nil
 }
 
+// RestoreModeState 用持久化的模式状态替换会话当前状态（从 Redis 恢复会话时使用）
+func (o *Orchestrator) RestoreModeState(sessionID string, state *ModeState) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	session, exists := o.sessions[sessionID]
+	if !exists {
+		return fmt.Errorf("session %s not found", sessionID)
+	}
+	if state == nil {
+		return nil
+	}
+	if state.CustomState == nil {
+		state.CustomState = make(map[string]interface{})
+	}
+
+	session.ModeState = state
+	o.bindModeLocked(session.Mode, sessionID, state)
+
+	// 恢复未完成子任务组的超时定时器
+	for groupID, group := range state.Groups {
+		if !group.Deadline.IsZero() {
+			o.scheduleGroupTimeoutLocked(sessionID, groupID, time.Until(group.Deadline))
+		}
+	}
+	return nil
+}
+
+// GetModeState 获取会话的模式状态
+func (o *Orchestrator) GetModeState(sessionID string) (*ModeState, error) {
+	session, err := o.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return session.ModeState, nil
+}
+
+// bindModeLocked 为模式注入会话状态、通知回调和猫猫名单（调用方需持有 o.mu）
+func (o *Orchestrator) bindModeLocked(mode CollaborationMode, sessionID string, state *ModeState) {
+	if notifiable, ok := mode.(NotifiableMode); ok && o.notifier != nil {
+		notifiable.SetNotifier(o.notifier)
+	}
+	if rosterAware, ok := mode.(RosterAwareMode); ok {
+		rosterAware.SetRoster(append([]string(nil), o.agentNames...))
+	}
+	if stateful, ok := mode.(StatefulMode); ok {
+		stateful.BindState(sessionID, state)
+	}
+}
+
+// unbindModeState 解绑有状态模式的会话状态
+func unbindModeState(mode CollaborationMode, sessionID string) {
+	if stateful, ok := mode.(StatefulMode); ok {
+		stateful.UnbindState(sessionID)
+	}
+}
+
 // HandleUserMessage 处理用户消息
 func (o *Orchestrator) HandleUserMessage(sessionID string, content string, mentionedCats []string) ([]AgentCall, error) {
+	return o.HandleUserMessageWithID(sessionID, fmt.Sprintf("msg_%d", time.Now().UnixNano()), content, mentionedCats)
+}
+
+// HandleUserMessageWithID 处理用户消息，以该消息 ID 作为调用链的起点
+func (o *Orchestrator) HandleUserMessageWithID(sessionID string, msgID string, content string, mentionedCats []string) ([]AgentCall, error) {
 	session, err := o.GetSession(sessionID)
 	if err != nil {
 		return nil, err
@@ -185,6 +277,8 @@ func (o *Orchestrator) HandleUserMessage(sessionID string, content string, menti
 	o.mu.Lock()
 	session.ModeState.LastUpdateTime = time.Now()
 	session.UpdatedAt = time.Now()
+	calls = o.guardCallsLocked(session, NewRootChain(msgID), calls)
+	o.trackSubtasksLocked(session, calls)
 	o.mu.Unlock()
 
 	return calls, nil
@@ -192,6 +286,11 @@ func (o *Orchestrator) HandleUserMessage(sessionID string, content string, menti
 
 // HandleAgentResponse 处理猫猫回复
 func (o *Orchestrator) HandleAgentResponse(sessionID string, agentName string, response string) ([]AgentCall, error) {
+	return o.HandleAgentResponseWithChain(sessionID, agentName, response, nil)
+}
+
+// HandleAgentResponseWithChain 处理猫猫回复，后续调用沿 chain 继续计数
+func (o *Orchestrator) HandleAgentResponseWithChain(sessionID string, agentName string, response string, chain *CallChain) ([]AgentCall, error) {
 	session, err := o.GetSession(sessionID)
 	if err != nil {
 		return nil, err
@@ -207,6 +306,403 @@ func (o *Orchestrator) HandleAgentResponse(sessionID string, agentName string, r
 	o.mu.Lock()
 	session.ModeState.LastUpdateTime = time.Now()
 	session.UpdatedAt = time.Now()
+	calls = o.guardCallsLocked(session, chain, calls)
+	o.trackSubtasksLocked(session, calls)
+	o.mu.Unlock()
+
+	return calls, nil
+}
+
+// HandleAgentResult 处理猫猫任务结果（带任务元数据）
+// 属于子任务组的结果先记录在 ModeState.Groups 中，整组结束后交给模式的 OnGroupCompleted 汇总；
+// 其他结果按普通回复交给 OnAgentResponse
+func (o *Orchestrator) HandleAgentResult(sessionID string, agentName string, response string, metadata map[string]interface{}, chain *CallChain) ([]AgentCall, error) {
+	groupID, _ := metadata[MetaGroupID].(string)
+	subtaskID, _ := metadata[MetaSubtaskID].(string)
+	if groupID == "" || subtaskID == "" {
+		return o.HandleAgentResponseWithChain(sessionID, agentName, response, chain)
+	}
+
+	session, err := o.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	o.mu.Lock()
+	group, done := o.completeSubtaskLocked(session, groupID, subtaskID, SubtaskCompleted, response)
+	o.mu.Unlock()
+
+	if group == nil {
+		return nil, nil
+	}
+	if observer, ok := session.Mode.(SubtaskObserver); ok {
+		observer.OnSubtaskCompleted(sessionID, group, group.Subtasks[subtaskID])
+	}
+	if !done {
+		return nil, nil
+	}
+	return o.finishGroup(session, group)
+}
+
+// HandleAgentFailure 处理没有产生回复的猫猫任务（取消、超时、执行失败）
+// 属于子任务组的任务以 status 结束对应子任务，整组结束后照常汇总；其他任务不影响模式状态
+func (o *Orchestrator) HandleAgentFailure(sessionID string, agentName string, metadata map[string]interface{}, status string) ([]AgentCall, error) {
+	groupID, _ := metadata[MetaGroupID].(string)
+	subtaskID, _ := metadata[MetaSubtaskID].(string)
+	if groupID == "" || subtaskID == "" {
+		return nil, nil
+	}
+
+	session, err := o.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	o.mu.Lock()
+	group, done := o.completeSubtaskLocked(session, groupID, subtaskID, status, "")
+	o.mu.Unlock()
+
+	if group == nil || !done {
+		return nil, nil
+	}
+	LogInfo("[Orchestrator] %s 的子任务以 %s 结束，子任务组汇总 - Session: %s, Group: %s", agentName, status, sessionID, groupID)
+	return o.finishGroup(session, group)
+}
+
+// GetSubtaskGroups 获取会话未完成的子任务组状态
+func (o *Orchestrator) GetSubtaskGroups(sessionID string) ([]SubtaskGroupStatus, error) {
+	session, err := o.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	groups := make([]SubtaskGroupStatus, 0, len(session.ModeState.Groups))
+	for _, group := range session.ModeState.Groups {
+		groups = append(groups, group.Snapshot(sessionID, GroupWaiting))
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].GroupID < groups[j].GroupID })
+	return groups, nil
+}
+
+// finishGroup 子任务组全部结束后交给模式汇总
+// 未实现 AggregatingMode 的模式按派发顺序逐条回放已完成的回复
+func (o *Orchestrator) finishGroup(session *OrchestratorSession, group *SubtaskGroup) ([]AgentCall, error) {
+	var calls []AgentCall
+	if aggregating, ok := session.Mode.(AggregatingMode); ok {
+		groupCalls, err := aggregating.OnGroupCompleted(session.SessionID, group)
+		if err != nil {
+			return nil, fmt.Errorf("mode failed to handle group completion: %w", err)
+		}
+		calls = groupCalls
+	} else {
+		for _, subtask := range group.Results() {
+			if subtask.Status != SubtaskCompleted {
+				continue
+			}
+			subtaskCalls, err := session.Mode.OnAgentResponse(session.SessionID, subtask.AgentName, subtask.Result)
+			if err != nil {
+				return nil, fmt.Errorf("mode failed to handle agent response: %w", err)
+			}
+			calls = append(calls, subtaskCalls...)
+		}
+	}
+
+	o.mu.Lock()
+	session.ModeState.LastUpdateTime = time.Now()
+	session.UpdatedAt = time.Now()
+	calls = o.guardCallsLocked(session, group.parentChain(), calls)
+	o.trackSubtasksLocked(session, calls)
+	o.mu.Unlock()
+
+	return calls, nil
+}
+
+// guardCallsLocked 为调用填写因果链，并截断超出模式限制的调用（调用方需持有 o.mu）
+// parent 为 nil 时视为新的调用链起点；被截断的调用会以系统消息写入 Session Chain
+func (o *Orchestrator) guardCallsLocked(session *OrchestratorSession, parent *CallChain, calls []AgentCall) []AgentCall {
+	if len(calls) == 0 {
+		return calls
+	}
+	if parent == nil {
+		parent = NewRootChain(fmt.Sprintf("mode_%d", time.Now().UnixNano()))
+	}
+
+	counter := o.loopCounterLocked(session, parent.RootMsgID)
+	limits := resolveLoopLimits(session.Mode, session.ModeConfig)
+	caller := parent.Current()
+
+	allowed := make([]AgentCall, 0, len(calls))
+	for _, call := range calls {
+		chain := parent.Extend(call.AgentName)
+		if reason := counter.check(limits, chain, caller); reason != "" {
+			LogWarn("[Orchestrator] 调用链已截断 - Session: %s, Root: %s, Path: %s, 原因: %s",
+				session.SessionID, chain.RootMsgID, chain, reason)
+			if o.notifier != nil {
+				o.notifier.PostSystemMessage(session.SessionID,
+					fmt.Sprintf("⛔ 调用链已截断（%s）：%s。如需继续，请直接 @ 对应的猫猫。", reason, chain))
+			}
+			continue
+		}
+		counter.record(chain, caller)
+		call.Chain = chain
+		allowed = append(allowed, call)
+	}
+	return allowed
+}
+
+// loopCounterLocked 获取调用链计数，并顺带清理过期的计数（调用方需持有 o.mu）
+func (o *Orchestrator) loopCounterLocked(session *OrchestratorSession, rootMsgID string) *loopCounter {
+	if session.loops == nil {
+		session.loops = make(map[string]*loopCounter)
+	}
+	counter, exists := session.loops[rootMsgID]
+	if exists {
+		return counter
+	}
+
+	for id, c := range session.loops {
+		if time.Since(c.LastSeen) > loopTrackerTTL {
+			delete(session.loops, id)
+		}
+	}
+	counter = &loopCounter{Pairs: make(map[string]int), LastSeen: time.Now()}
+	session.loops[rootMsgID] = counter
+	return counter
+}
+
+// trackSubtasksLocked 登记带 group_id 的调用为子任务，并为其分配 subtask_id（调用方需持有 o.mu）
+func (o *Orchestrator) trackSubtasksLocked(session *OrchestratorSession, calls []AgentCall) {
+	touched := make(map[string]*SubtaskGroup)
+	defer func() {
+		for _, group := range touched {
+			o.broadcastGroupStatusLocked(session.SessionID, group, GroupWaiting)
+		}
+	}()
+
+	for i := range calls {
+		groupID, _ := calls[i].Metadata[MetaGroupID].(string)
+		if groupID == "" {
+			continue
+		}
+
+		if session.ModeState.Groups == nil {
+			session.ModeState.Groups = make(map[string]*SubtaskGroup)
+		}
+		group, exists := session.ModeState.Groups[groupID]
+		if !exists {
+			group = &SubtaskGroup{
+				ID:        groupID,
+				Subtasks:  make(map[string]*Subtask),
+				CreatedAt: time.Now(),
+			}
+			session.ModeState.Groups[groupID] = group
+
+			if timeout := metadataSeconds(calls[i].Metadata[MetaGroupTimeout]); timeout > 0 {
+				group.Deadline = group.CreatedAt.Add(timeout)
+				o.scheduleGroupTimeoutLocked(session.SessionID, groupID, timeout)
+			}
+		}
+
+		subtaskID := fmt.Sprintf("%s_%d", groupID, len(group.Order)+1)
+		calls[i].Metadata[MetaSubtaskID] = subtaskID
+		group.Subtasks[subtaskID] = &Subtask{
+			ID:        subtaskID,
+			AgentName: calls[i].AgentName,
+			Prompt:    calls[i].Prompt,
+			Status:    SubtaskPending,
+			Chain:     calls[i].Chain,
+		}
+		group.Order = append(group.Order, subtaskID)
+		touched[groupID] = group
+	}
+}
+
+// broadcastGroupStatusLocked 通过 WebSocket 推送子任务组状态（调用方需持有 o.mu）
+func (o *Orchestrator) broadcastGroupStatusLocked(sessionID string, group *SubtaskGroup, status string) {
+	if o.notifier == nil {
+		return
+	}
+	o.notifier.BroadcastModeEvent(sessionID, "group_status", group.Snapshot(sessionID, status))
+}
+
+// completeSubtaskLocked 记录子任务结果，返回所属组以及该组是否已全部结束（调用方需持有 o.mu）
+// 全部结束的组会从 ModeState.Groups 中移除
+func (o *Orchestrator) completeSubtaskLocked(session *OrchestratorSession, groupID, subtaskID, status, result string) (*SubtaskGroup, bool) {
+	group, exists := session.ModeState.Groups[groupID]
+	if !exists {
+		LogWarn("[Orchestrator] 子任务组不存在或已结束 - Session: %s, Group: %s", session.SessionID, groupID)
+		return nil, false
+	}
+	subtask, exists := group.Subtasks[subtaskID]
+	if !exists || subtask.Status != SubtaskPending {
+		LogWarn("[Orchestrator] 子任务不存在或已结束 - Session: %s, Subtask: %s", session.SessionID, subtaskID)
+		return nil, false
+	}
+
+	subtask.Status = status
+	subtask.Result = result
+	subtask.CompletedAt = time.Now()
+	session.ModeState.LastUpdateTime = time.Now()
+
+	if !group.Done() {
+		o.broadcastGroupStatusLocked(session.SessionID, group, GroupWaiting)
+		return group, false
+	}
+	delete(session.ModeState.Groups, groupID)
+	o.stopGroupTimerLocked(session.SessionID, groupID)
+	o.broadcastGroupStatusLocked(session.SessionID, group, GroupCompleted)
+	return group, true
+}
+
+// scheduleGroupTimeoutLocked 启动子任务组超时定时器（调用方需持有 o.mu）
+func (o *Orchestrator) scheduleGroupTimeoutLocked(sessionID, groupID string, timeout time.Duration) {
+	key := sessionID + "/" + groupID
+	if timer, exists := o.groupTimers[key]; exists {
+		timer.Stop()
+	}
+	if timeout < 0 {
+		timeout = 0
+	}
+	o.groupTimers[key] = time.AfterFunc(timeout, func() {
+		o.mu.Lock()
+		notifier := o.notifier
+		o.mu.Unlock()
+		if notifier == nil {
+			o.expireGroup(sessionID, groupID)
+			return
+		}
+		// 在会话锁内修改 ModeState，与结果处理和会话持久化互斥
+		notifier.RunModeTimer(sessionID, func() []AgentCall {
+			return o.expireGroup(sessionID, groupID)
+		})
+	})
+}
+
+// stopGroupTimerLocked 停止子任务组超时定时器（调用方需持有 o.mu）
+func (o *Orchestrator) stopGroupTimerLocked(sessionID, groupID string) {
+	key := sessionID + "/" + groupID
+	if timer, exists := o.groupTimers[key]; exists {
+		timer.Stop()
+		delete(o.groupTimers, key)
+	}
+}
+
+// stopSessionTimersLocked 停止会话的所有子任务组定时器（调用方需持有 o.mu）
+func (o *Orchestrator) stopSessionTimersLocked(sessionID string) {
+	prefix := sessionID + "/"
+	for key, timer := range o.groupTimers {
+		if strings.HasPrefix(key, prefix) {
+			timer.Stop()
+			delete(o.groupTimers, key)
+		}
+	}
+}
+
+// expireGroup 子任务组超时：未返回的子任务记为 timeout，整组交给模式汇总，返回需要派发的后续调用
+// 由定时器通过 ModeNotifier.RunModeTimer 在会话锁内调用
+func (o *Orchestrator) expireGroup(sessionID, groupID string) []AgentCall {
+	session, err := o.GetSession(sessionID)
+	if err != nil {
+		return nil
+	}
+
+	o.mu.Lock()
+	delete(o.groupTimers, sessionID+"/"+groupID)
+	group, exists := session.ModeState.Groups[groupID]
+	if !exists {
+		o.mu.Unlock()
+		return nil
+	}
+	expired := 0
+	for _, subtask := range group.Subtasks {
+		if subtask.Status == SubtaskPending {
+			subtask.Status = SubtaskTimeout
+			subtask.CompletedAt = time.Now()
+			expired++
+		}
+	}
+	delete(session.ModeState.Groups, groupID)
+	o.broadcastGroupStatusLocked(sessionID, group, GroupTimeout)
+	o.mu.Unlock()
+
+	LogWarn("[Orchestrator] 子任务组超时 - Session: %s, Group: %s, 未返回: %d", sessionID, groupID, expired)
+
+	calls, err := o.finishGroup(session, group)
+	if err != nil {
+		LogError("[Orchestrator] 汇总超时子任务组失败: %v", err)
+		return nil
+	}
+	return calls
+}
+
+// metadataSeconds 读取元数据中的秒数（兼容 JSON 反序列化后的 float64）
+func metadataSeconds(v interface{}) time.Duration {
+	switch n := v.(type) {
+	case int:
+		return time.Duration(n) * time.Second
+	case int64:
+		return time.Duration(n) * time.Second
+	case float64:
+		return time.Duration(n * float64(time.Second))
+	}
+	return 0
+}
+
+// GetModeActions 获取会话当前步骤可执行的模式动作
+func (o *Orchestrator) GetModeActions(sessionID string) ([]ModeAction, error) {
+	session, err := o.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	actionable, ok := session.Mode.(ActionableMode)
+	if !ok {
+		return []ModeAction{}, nil
+	}
+	return actionable.GetActions(sessionID), nil
+}
+
+// HandleModeAction 执行模式动作
+func (o *Orchestrator) HandleModeAction(sessionID string, action string, params map[string]interface{}) ([]AgentCall, error) {
+	session, err := o.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	actionable, ok := session.Mode.(ActionableMode)
+	if !ok {
+		return nil, fmt.Errorf("mode %s does not support actions", session.Mode.GetName())
+	}
+
+	// 只允许执行当前步骤声明的动作
+	var declared *ModeAction
+	for _, a := range actionable.GetActions(sessionID) {
+		if a.Name == action {
+			declared = &a
+			break
+		}
+	}
+	if declared == nil {
+		return nil, fmt.Errorf("action %s is not available in current step", action)
+	}
+	if err := declared.ValidateParams(params); err != nil {
+		return nil, err
+	}
+
+	calls, err := actionable.HandleAction(sessionID, action, params)
+	if err != nil {
+		return nil, fmt.Errorf("mode failed to handle action: %w", err)
+	}
+
+	// 更新会话状态（模式动作由用户发起，作为新的调用链起点）
+	o.mu.Lock()
+	session.ModeState.LastUpdateTime = time.Now()
+	session.UpdatedAt = time.Now()
+	calls = o.guardCallsLocked(session, nil, calls)
+	o.trackSubtasksLocked(session, calls)
 	o.mu.Unlock()
 
 	return calls, nil
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ownerTokenEnv 铲屎官令牌的环境变量，设置后受保护的接口必须携带 Authorization: Bearer <令牌>
+const ownerTokenEnv = "CAT_CAFE_ADMIN_TOKEN"
+
+// requireOwner 保护只有铲屎官才能调用的接口：注册、修改、删除猫猫和启动工作进程（会写配置文件并启动进程），
+// 以及调整预算上限（会放行因预算排队的任务）。
+// 设置了 CAT_CAFE_ADMIN_TOKEN 时校验令牌，否则只接受本机直接发起的请求，
+// 经反向代理转发的请求和其他网站页面发起的请求（Origin 不是本机）都会被拒绝
+func requireOwner(c *gin.Context) {
+	if token := os.Getenv(ownerTokenEnv); token != "" {
+		auth := c.GetHeader("Authorization")
+		if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "缺少或错误的铲屎官令牌"})
+			return
+		}
+		c.Next()
+		return
+	}
+	if !isLocalRequest(c.Request) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "只允许在本机调用，远程调用请设置 " + ownerTokenEnv})
+		return
+	}
+	c.Next()
+}
+
+// isLocalRequest 请求来自本机的回环地址，没有经过代理转发，Host 和 Origin（如果有）也都指向本机
+// （检查 Host 是为了防止 DNS 重绑定：恶意域名解析到 127.0.0.1 时 Origin 和 Host 都是该域名）
+func isLocalRequest(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil || !isLocalHost(host) {
+		return false
+	}
+	if r.Header.Get("X-Forwarded-For") != "" || r.Header.Get("X-Real-IP") != "" {
+		return false
+	}
+	if !isLocalHost(hostWithoutPort(r.Host)) {
+		return false
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || !isLocalHost(u.Hostname()) {
+			return false
+		}
+	}
+	return true
+}
+
+// hostWithoutPort 去掉 host:port 中的端口
+func hostWithoutPort(hostport string) string {
+	if host, _, err := net.SplitHostPort(hostport); err == nil {
+		return host
+	}
+	return strings.Trim(hostport, "[]")
+}
+
+// isLocalHost localhost 或回环 IP
+func isLocalHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// OwnerName 用户（铲屎官）在对话中的称呼，猫猫通过 @铲屎官 向用户提问
+const OwnerName = "铲屎官"
+
+// OwnerRequest 猫猫向铲屎官发起的提问
+// 会话存在未回复的提问时处于"等待铲屎官"状态，铲屎官的下一条消息会自动交给提问的猫猫
+type OwnerRequest struct {
+	ID        string     `json:"id"`
+	AgentName string     `json:"agentName"`
+	Question  string     `json:"question"`
+	Chain     *CallChain `json:"chain,omitempty"`
+	AskedAt   time.Time  `json:"askedAt"`
+}
+
+// parseOwnerQuestion 解析回复中 @铲屎官 的提问内容
+// 提问内容为 @铲屎官 同一行之后的文字以及后续行，直到下一个 @ 提及；只写了 @铲屎官 时使用整段回复
+func parseOwnerQuestion(response string) (string, bool) {
+	lines := strings.Split(response, "\n")
+	found := false
+	var question strings.Builder
+
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+
+		if strings.HasPrefix(line, "@") {
+			parts := strings.SplitN(line[1:], " ", 2)
+			if strings.TrimSpace(parts[0]) != OwnerName {
+				if found {
+					break
+				}
+				continue
+			}
+			found = true
+			if len(parts) > 1 {
+				question.WriteString(strings.TrimSpace(parts[1]))
+			}
+			continue
+		}
+
+		if found && line != "" {
+			if question.Len() > 0 {
+				question.WriteString("\n")
+			}
+			question.WriteString(line)
+		}
+	}
+
+	if !found {
+		return "", false
+	}
+	if question.Len() == 0 {
+		return strings.TrimSpace(response), true
+	}
+	return question.String(), true
+}
+
+// formatOwnerRequest 提问在消息列表中的展示文本
+func formatOwnerRequest(agentName, question string) string {
+	return fmt.Sprintf("🙋 %s 在等铲屎官回复：%s", agentName, question)
+}
+
+// buildOwnerResumePrompt 把铲屎官的回复连同原问题交给提问的猫猫
+func buildOwnerResumePrompt(req *OwnerRequest, reply string) string {
+	return fmt.Sprintf("铲屎官回复了你之前的提问。\n\n你的提问：\n%s\n\n铲屎官的回复：\n%s\n\n请结合回复继续之前的工作。", req.Question, reply)
+}
+
+// RequestOwnerInput 检查猫猫回复中是否 @铲屎官，是则登记提问并让会话进入等待铲屎官状态
+// 同一只猫猫重复提问时只保留最新的问题；没有提问时返回 nil
+func (o *Orchestrator) RequestOwnerInput(sessionID string, agentName string, response string, chain *CallChain) *OwnerRequest {
+	question, ok := parseOwnerQuestion(response)
+	if !ok {
+		return nil
+	}
+
+	session, err := o.GetSession(sessionID)
+	if err != nil {
+		return nil
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	req := &OwnerRequest{
+		ID:        fmt.Sprintf("owner_%d", time.Now().UnixNano()),
+		AgentName: agentName,
+		Question:  question,
+		Chain:     chain,
+		AskedAt:   time.Now(),
+	}
+
+	pending := make([]*OwnerRequest, 0, len(session.ModeState.OwnerRequests)+1)
+	for _, existing := range session.ModeState.OwnerRequests {
+		if existing.AgentName != agentName {
+			pending = append(pending, existing)
+		}
+	}
+	session.ModeState.OwnerRequests = append(pending, req)
+	session.ModeState.LastUpdateTime = time.Now()
+
+	LogInfo("[Orchestrator] 🙋 %s 向铲屎官提问，会话进入等待状态 - Session: %s", agentName, sessionID)
+	return req
+}
+
+// GetOwnerRequests 获取会话中等待铲屎官回复的提问
+func (o *Orchestrator) GetOwnerRequests(sessionID string) ([]OwnerRequest, error) {
+	session, err := o.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	requests := make([]OwnerRequest, 0, len(session.ModeState.OwnerRequests))
+	for _, req := range session.ModeState.OwnerRequests {
+		requests = append(requests, *req)
+	}
+	return requests, nil
+}
+
+// ResumeFromOwner 铲屎官回复后恢复所有等待中的猫猫，回复内容与原问题一起作为上下文
+// 返回需要派发的调用和被回复的提问；没有等待中的提问时都为空
+func (o *Orchestrator) ResumeFromOwner(sessionID string, msgID string, reply string) ([]AgentCall, []*OwnerRequest, error) {
+	session, err := o.GetSession(sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	resolved := session.ModeState.OwnerRequests
+	if len(resolved) == 0 {
+		return nil, nil, nil
+	}
+	session.ModeState.OwnerRequests = nil
+	session.ModeState.LastUpdateTime = time.Now()
+	session.UpdatedAt = time.Now()
+
+	calls := make([]AgentCall, 0, len(resolved))
+	for _, req := range resolved {
+		calls = append(calls, AgentCall{
+			AgentName:  req.AgentName,
+			Prompt:     buildOwnerResumePrompt(req, reply),
+			SessionID:  sessionID,
+			CallerName: OwnerName,
+			Metadata: map[string]interface{}{
+				"source":           "owner_reply",
+				"owner_request_id": req.ID,
+			},
+		})
+	}
+
+	// 铲屎官的回复是新的调用链起点
+	calls = o.guardCallsLocked(session, NewRootChain(msgID), calls)
+	o.trackSubtasksLocked(session, calls)
+	return calls, resolved, nil
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 猫猫在线状态（Cat.Status / AgentState.Status）
+const (
+	CatStatusIdle    = "idle"    // 在线且有空闲的工作进程，可以立即回答
+	CatStatusBusy    = "busy"    // 在线，但所有工作进程都在执行任务（新任务排队）
+	CatStatusOffline = "offline" // 没有存活的工作进程
+)
+
+const (
+	// presenceHeartbeatInterval 工作进程发布心跳的间隔
+	presenceHeartbeatInterval = 5 * time.Second
+	// presenceTTL 心跳过期时间：连续错过约 3 次心跳视为离线
+	presenceTTL = 15 * time.Second
+	// presenceChannel 工作进程状态变化（开始/结束任务、上线/下线）时发布的频道，载荷为猫猫名字
+	presenceChannel = "cat_presence"
+)
+
+// WorkerPresence 一个工作进程的心跳，保存在 Redis 中并带有 TTL
+type WorkerPresence struct {
+	AgentName     string     `json:"agentName"`
+	Worker        string     `json:"worker"`           // 消费者名称
+	Status        string     `json:"status"`           // idle, busy（同时执行的任务数达到上限）
+	Running       int        `json:"running"`          // 正在执行的任务数
+	Capacity      int        `json:"capacity"`         // 同时执行的任务数上限（concurrency）
+	TaskID        string     `json:"taskId,omitempty"` // 最早开始的正在执行的任务
+	SessionID     string     `json:"sessionId,omitempty"`
+	TaskStartedAt *time.Time `json:"taskStartedAt,omitempty"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+}
+
+// presenceKey 工作进程心跳的 Redis Key
+func presenceKey(agentName, worker string) string {
+	return fmt.Sprintf("presence:%s:%s", agentName, worker)
+}
+
+// savePresence 写入心跳并刷新 TTL；notify 为 true 时通知 API 服务器状态已变化
+func savePresence(ctx context.Context, rdb *redis.Client, presence WorkerPresence, notify bool) error {
+	data, err := json.Marshal(presence)
+	if err != nil {
+		return err
+	}
+	if err := rdb.Set(ctx, presenceKey(presence.AgentName, presence.Worker), data, presenceTTL).Err(); err != nil {
+		return err
+	}
+	if notify {
+		return rdb.Publish(ctx, presenceChannel, presence.AgentName).Err()
+	}
+	return nil
+}
+
+// removePresence 工作进程退出时删除心跳，不必等 TTL 过期
+func removePresence(ctx context.Context, rdb *redis.Client, agentName, worker string) error {
+	if err := rdb.Del(ctx, presenceKey(agentName, worker)).Err(); err != nil {
+		return err
+	}
+	return rdb.Publish(ctx, presenceChannel, agentName).Err()
+}
+
+// loadPresence 读取所有存活工作进程的心跳，按猫猫名字分组
+func loadPresence(ctx context.Context, rdb *redis.Client) (map[string][]WorkerPresence, error) {
+	var keys []string
+	iter := rdb.Scan(ctx, 0, "presence:*", 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	presence := make(map[string][]WorkerPresence)
+	if len(keys) == 0 {
+		return presence, nil
+	}
+	values, err := rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue // 读取前已过期
+		}
+		var worker WorkerPresence
+		if err := json.Unmarshal([]byte(data), &worker); err != nil {
+			continue
+		}
+		presence[worker.AgentName] = append(presence[worker.AgentName], worker)
+	}
+	return presence, nil
+}
+
+// CatPresence 由工作进程心跳汇总的猫猫在线状态
+type CatPresence struct {
+	Status      string     // idle, busy, offline
+	Workers     int        // 存活的工作进程数
+	Running     int        // 所有工作进程正在执行的任务数
+	Capacity    int        // 所有工作进程同时执行的任务数上限
+	CurrentTask string     // 忙碌时正在执行的任务（多个时取最早开始的）
+	LastSeen    *time.Time // 最近一次心跳
+}
+
+// summarizePresence 汇总猫猫所有工作进程的心跳：有空闲进程即可回答，全部忙碌为 busy，没有进程为 offline
+func summarizePresence(workers []WorkerPresence) CatPresence {
+	summary := CatPresence{Status: CatStatusOffline, Workers: len(workers)}
+	var earliest *time.Time
+	for i := range workers {
+		worker := &workers[i]
+		summary.Running += worker.Running
+		summary.Capacity += worker.Capacity
+		if summary.LastSeen == nil || worker.UpdatedAt.After(*summary.LastSeen) {
+			summary.LastSeen = &worker.UpdatedAt
+		}
+		if worker.Status != CatStatusBusy {
+			summary.Status = CatStatusIdle
+			continue
+		}
+		if summary.Status == CatStatusOffline {
+			summary.Status = CatStatusBusy
+		}
+		if worker.TaskStartedAt != nil && (earliest == nil || worker.TaskStartedAt.Before(*earliest)) {
+			earliest = worker.TaskStartedAt
+			summary.CurrentTask = worker.TaskID
+		}
+	}
+	if summary.Status != CatStatusBusy {
+		summary.CurrentTask = ""
+	}
+	return summary
+}
+
+// heartbeat 定期发布工作进程心跳，直到工作进程退出
+func (w *AgentWorker) heartbeat() {
+	ticker := time.NewTicker(presenceHeartbeatInterval)
+	defer ticker.Stop()
+
+	w.publishPresence(true)
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+			w.publishPresence(false)
+		}
+	}
+}
+
+// presenceTask 工作进程正在执行的任务
+type presenceTask struct {
+	sessionID string
+	startedAt time.Time
+}
+
+// startPresence 开始执行任务，更新心跳并立即通知
+func (w *AgentWorker) startPresence(task *TaskMessage) {
+	w.presenceMu.Lock()
+	w.presenceTasks[task.TaskID] = presenceTask{sessionID: task.SessionID, startedAt: time.Now()}
+	w.refreshPresenceLocked()
+	w.presenceMu.Unlock()
+	w.publishPresence(true)
+}
+
+// finishPresence 任务结束，更新心跳并立即通知
+func (w *AgentWorker) finishPresence(taskID string) {
+	w.presenceMu.Lock()
+	delete(w.presenceTasks, taskID)
+	w.refreshPresenceLocked()
+	w.presenceMu.Unlock()
+	w.publishPresence(true)
+}
+
+// refreshPresenceLocked 由正在执行的任务计算心跳内容：槽位用完为 busy，并报告最早开始的任务
+// 调用方需持有 presenceMu
+func (w *AgentWorker) refreshPresenceLocked() {
+	w.presence.Running = len(w.presenceTasks)
+	w.presence.Status = CatStatusIdle
+	if w.presence.Running >= w.presence.Capacity {
+		w.presence.Status = CatStatusBusy
+	}
+	w.presence.TaskID, w.presence.SessionID, w.presence.TaskStartedAt = "", "", nil
+	for taskID, task := range w.presenceTasks {
+		if w.presence.TaskStartedAt == nil || task.startedAt.Before(*w.presence.TaskStartedAt) {
+			startedAt := task.startedAt
+			w.presence.TaskID, w.presence.SessionID, w.presence.TaskStartedAt = taskID, task.sessionID, &startedAt
+		}
+	}
+}
+
+// publishPresence 写入当前心跳（失败只记录日志，下一次心跳会重试）
+func (w *AgentWorker) publishPresence(notify bool) {
+	w.presenceMu.Lock()
+	presence := w.presence
+	w.presenceMu.Unlock()
+
+	presence.UpdatedAt = time.Now()
+	if err := savePresence(w.ctx, w.redisClient, presence, notify); err != nil && w.ctx.Err() == nil {
+		LogWarn("[Agent-%s] 发布心跳失败: %v", w.config.Name, err)
+	}
+}
+
+// clearPresence 工作进程退出时下线（w.ctx 已取消，使用独立的超时）
+func (w *AgentWorker) clearPresence() {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := removePresence(ctx, w.redisClient, w.config.Name, w.consumerName); err != nil {
+		LogWarn("[Agent-%s] 删除心跳失败: %v", w.config.Name, err)
+	}
+}
+
+// applyPresence 用心跳汇总的状态填充猫猫信息
+func (c *Cat) applyPresence(workers []WorkerPresence) {
+	summary := summarizePresence(workers)
+	c.Status = summary.Status
+	c.Workers = summary.Workers
+	c.Running = summary.Running
+	c.Capacity = summary.Capacity
+	c.CurrentTask = summary.CurrentTask
+	c.LastSeen = summary.LastSeen
+}
+
+// presenceChanged 猫猫在线状态是否有需要推送的变化（只有心跳时间变化不推送）
+func presenceChanged(before, after Cat) bool {
+	return before.Status != after.Status || before.Workers != after.Workers || before.Running != after.Running ||
+		before.Capacity != after.Capacity || before.CurrentTask != after.CurrentTask
+}
+
+// watchPresence 向前端推送猫猫在线状态变化（cat_presence 事件）
+// 工作进程开始/结束任务、上下线时收到通知立即推送；心跳过期导致的离线在下一次轮询时推送
+func (sm *SessionManager) watchPresence() {
+	sub := sm.redisClient.Subscribe(sm.ctx, presenceChannel)
+	defer sub.Close()
+	changes := sub.Channel()
+
+	ticker := time.NewTicker(presenceHeartbeatInterval)
+	defer ticker.Stop()
+
+	last := make(map[string]Cat)
+	for {
+		for _, cat := range sm.GetCats() {
+			if before, ok := last[cat.Name]; ok && presenceChanged(before, cat) {
+				LogInfo("[API] 猫猫状态变化: %s %s -> %s", cat.Name, before.Status, cat.Status)
+				sm.wsHub.BroadcastToAll("cat_presence", cat)
+			}
+			last[cat.Name] = cat
+		}
+
+		select {
+		case <-sm.ctx.Done():
+			return
+		case _, ok := <-changes:
+			if !ok {
+				return
+			}
+		case <-ticker.C:
+		}
+	}
+}
+
+// presenceAgentState 由心跳汇总 Agent 状态
+func presenceAgentState(agentName string, workers []WorkerPresence) *AgentState {
+	summary := summarizePresence(workers)
+	state := &AgentState{Name: agentName, Status: summary.Status, LastTaskID: summary.CurrentTask}
+	if summary.LastSeen != nil {
+		state.UpdatedAt = *summary.LastSeen
+	}
+	return state
+}
@@ -0,0 +1,200 @@
+// Package prompt 组合猫猫的提示词文件并套用骨架模板生成最终 prompt
+// 独立成包以便 test 包直接测试真实实现（src 为 main 包，无法导入）
+package prompt
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// 提示词骨架模板名称，与 context_mode 对应
+const (
+	LayoutOrchestrated = "orchestrated" // 策略 A：完整历史
+	LayoutCLIManaged   = "cli_managed"  // 策略 B：首次完整、之后只传增量
+	LayoutLegacy       = "legacy"       // 未配置 context_mode
+)
+
+// defaultPromptLayouts 内置的提示词骨架
+// Config.LayoutPath（prompt_template_path）指定的文件可以用 {{define "orchestrated"}}...{{end}} 等重新定义其中任意一个
+const defaultPromptLayouts = `{{define "separator"}}
+========================================
+
+{{end}}
+
+{{- define "section"}}【{{.Title}}】
+{{.Body}}{{template "separator"}}{{end}}
+
+{{- define "reply"}}🎯 你是{{.CatName}}，请回应以下消息：
+{{.Message}}{{end}}
+
+{{- define "orchestrated"}}{{.System}}
+{{template "separator"}}
+{{- if .Summaries}}{{template "section" section "历史摘要" .Summaries}}{{end}}
+{{- if .History}}{{template "section" section "对话历史" .History}}{{end}}
+{{- template "reply" .}}
+
+请结合上面的对话历史来完成任务。{{end}}
+
+{{- define "cli_managed"}}
+{{- if .Compressed}}{{.System}}
+{{template "separator"}}
+{{- template "section" section "历史摘要（已压缩）" .Summaries}}
+{{- if .History}}{{template "section" section "最近对话" .History}}{{end}}
+{{- else}}
+{{- if not .Resumed}}{{.System}}
+{{template "separator"}}{{end}}
+{{- if .History}}{{template "section" section (or (and .Resumed "新消息") "对话历史") .History}}{{end}}
+{{- end}}
+{{- template "reply" .}}{{end}}
+
+{{- define "legacy"}}{{.System}}
+{{template "separator"}}
+{{- if .History}}{{template "section" section "对话历史" .History}}{{template "reply" .}}
+
+请结合上面的对话历史来完成任务。
+{{- else}}用户需求：
+{{.Message}}{{end}}{{end}}`
+
+// promptFuncs 骨架模板可用的函数
+var promptFuncs = template.FuncMap{
+	// section 构造一个带标题的段落
+	"section": func(title, body string) map[string]string {
+		return map[string]string{"Title": title, "Body": body}
+	},
+}
+
+// Data 渲染提示词文件和骨架模板时可用的变量
+type Data struct {
+	CatName       string
+	SessionID     string
+	TaskID        string
+	WorkspacePath string
+	Mode          string // 会话当前的协作模式
+	ModeStep      string // 模式当前所处的步骤（流程类模式）
+	Message       string // 本次需要回应的消息
+	Summaries     string // 已 seal 的 Session 摘要
+	History       string // 对话历史（续接 CLI 会话时只有新消息）
+	Resumed       bool   // 续接 CLI 会话，只传增量内容
+	Compressed    bool   // 历史已压缩，CLI 会话重新开始
+	System        string // 组合后的提示词文件内容，只在骨架模板中可用
+}
+
+// Config 组合器使用的提示词文件
+type Config struct {
+	Files      []string            // system_prompt_path、dev_prompt_path、prompt_paths，按顺序拼接
+	ModeFiles  map[string][]string // mode_prompts，键为模式名或 "模式名:步骤"
+	LayoutPath string              // prompt_template_path，覆盖内置骨架中重新定义的部分（可选）
+}
+
+// Composer 组合多个提示词文件，并套用骨架模板生成最终 prompt
+type Composer struct {
+	files   []*template.Template
+	modes   map[string][]*template.Template
+	layouts *template.Template
+}
+
+// New 读取并解析所有提示词文件
+// 文件缺失、模板语法错误或引用了不存在的变量都在这里返回错误，避免运行时才发现
+func New(cfg Config) (*Composer, error) {
+	c := &Composer{modes: make(map[string][]*template.Template)}
+
+	files, err := parsePromptFiles(cfg.Files)
+	if err != nil {
+		return nil, err
+	}
+	c.files = files
+
+	for key, modePaths := range cfg.ModeFiles {
+		files, err := parsePromptFiles(modePaths)
+		if err != nil {
+			return nil, fmt.Errorf("模式 %s 的提示词: %w", key, err)
+		}
+		c.modes[key] = files
+	}
+
+	layouts, err := template.New("layouts").Funcs(promptFuncs).Parse(defaultPromptLayouts)
+	if err != nil {
+		return nil, fmt.Errorf("解析内置提示词骨架失败: %w", err)
+	}
+	if cfg.LayoutPath != "" {
+		data, err := os.ReadFile(cfg.LayoutPath)
+		if err != nil {
+			return nil, fmt.Errorf("读取提示词骨架失败: %w", err)
+		}
+		if layouts, err = layouts.Parse(string(data)); err != nil {
+			return nil, fmt.Errorf("解析提示词骨架 %s 失败: %w", cfg.LayoutPath, err)
+		}
+	}
+	c.layouts = layouts
+
+	// 用空数据试渲染一次，提前发现引用了不存在的变量
+	for _, name := range []string{LayoutOrchestrated, LayoutCLIManaged, LayoutLegacy} {
+		if _, err := c.Render(name, Data{}); err != nil {
+			return nil, err
+		}
+	}
+	for key := range c.modes {
+		if _, err := c.composeSystem(Data{Mode: key}); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// parsePromptFiles 按顺序读取并解析提示词文件，每个文件都是一个 text/template
+func parsePromptFiles(paths []string) ([]*template.Template, error) {
+	files := make([]*template.Template, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("读取提示词文件失败: %w", err)
+		}
+		tmpl, err := template.New(path).Parse(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("解析提示词文件 %s 失败: %w", path, err)
+		}
+		files = append(files, tmpl)
+	}
+	return files, nil
+}
+
+// Render 组合提示词文件并套用 layout 骨架
+func (c *Composer) Render(layout string, data Data) (string, error) {
+	system, err := c.composeSystem(data)
+	if err != nil {
+		return "", err
+	}
+	data.System = system
+
+	var buf bytes.Buffer
+	if err := c.layouts.ExecuteTemplate(&buf, layout, data); err != nil {
+		return "", fmt.Errorf("渲染提示词骨架 %s 失败: %w", layout, err)
+	}
+	return buf.String(), nil
+}
+
+// composeSystem 渲染并拼接提示词文件：通用文件在前，当前模式、当前步骤的文件依次在后
+func (c *Composer) composeSystem(data Data) (string, error) {
+	files := c.files
+	if data.Mode != "" {
+		files = append(append([]*template.Template{}, files...), c.modes[data.Mode]...)
+		if data.ModeStep != "" {
+			files = append(files, c.modes[data.Mode+":"+data.ModeStep]...)
+		}
+	}
+
+	parts := make([]string, 0, len(files))
+	for _, tmpl := range files {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return "", fmt.Errorf("渲染提示词文件 %s 失败: %w", tmpl.Name(), err)
+		}
+		if part := strings.TrimRight(buf.String(), "\n"); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
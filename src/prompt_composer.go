@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+
+	"cat-cafe/src/prompt"
+)
+
+// 提示词骨架模板名称，与 context_mode 对应
+const (
+	PromptLayoutOrchestrated = prompt.LayoutOrchestrated
+	PromptLayoutCLIManaged   = prompt.LayoutCLIManaged
+	PromptLayoutLegacy       = prompt.LayoutLegacy
+)
+
+// PromptData 渲染提示词文件和骨架模板时可用的变量
+type PromptData = prompt.Data
+
+// PromptComposer 按 Agent 配置组合多个提示词文件，并套用骨架模板生成最终 prompt
+type PromptComposer struct {
+	agentName string
+	composer  *prompt.Composer
+}
+
+// NewPromptComposer 读取并解析 Agent 配置的所有提示词文件（见 prompt.New）
+func NewPromptComposer(agent *AgentConfig) (*PromptComposer, error) {
+	files := []string{agent.SystemPromptPath}
+	if agent.DevPromptPath != "" {
+		files = append(files, agent.DevPromptPath)
+	}
+	files = append(files, agent.PromptPaths...)
+
+	composer, err := prompt.New(prompt.Config{
+		Files:      files,
+		ModeFiles:  agent.ModePrompts,
+		LayoutPath: agent.PromptTemplatePath,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &PromptComposer{agentName: agent.Name, composer: composer}, nil
+}
+
+// Render 组合提示词文件并套用 layout 骨架
+func (pc *PromptComposer) Render(layout string, data PromptData) string {
+	rendered, err := pc.composer.Render(layout, data)
+	if err != nil {
+		// 启动时已试渲染过，这里出错说明数据异常，不中断任务
+		LogWarn("[Agent-%s] 渲染提示词失败: %v", pc.agentName, err)
+		return fmt.Sprintf("%s\n\n%s", data.History, data.Message)
+	}
+	return rendered
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -14,14 +15,77 @@ import (
 // AgentConfig Agent 配置结构
 type AgentConfig struct {
 	Name             string                  `yaml:"name"`
+	ID               string                  `yaml:"id,omitempty"`    // 前端使用的猫猫 ID，未配置时按顺序分配 cat_NNN
+	Color            string                  `yaml:"color,omitempty"` // 前端显示的颜色，未配置时从默认颜色中分配
 	Pipe             string                  `yaml:"pipe"`
-	CLIType          string                  `yaml:"cli_type"`
-	ExecCmd          string                  `yaml:"exec_cmd"`
+	ExecCmd          string                  `yaml:"exec_cmd,omitempty"`
 	SystemPromptPath string                  `yaml:"system_prompt_path"`
 	Avatar           string                  `yaml:"avatar"`
-	ContextMode      string                  `yaml:"context_mode,omitempty"`       // "cli_managed" | "orchestrated"
+	ContextMode      string                  `yaml:"context_mode,omitempty"` // "cli_managed" | "orchestrated"
 	MemoryCompressor *MemoryCompressorConfig `yaml:"memory_compressor,omitempty"`
 	SessionChainCfg  *SessionChainConfig     `yaml:"session_chain,omitempty"`
+	Timeout          int                     `yaml:"timeout,omitempty"`     // 单次 CLI 调用超时（秒），0 使用默认值
+	Concurrency      int                     `yaml:"concurrency,omitempty"` // 每个工作进程同时执行的任务数，0 使用默认值
+
+	// 主后端：cli_type 及其调用选项
+	AgentBackend `yaml:",inline"`
+
+	// 主后端调用失败时按顺序尝试的备用后端，以及各后端的熔断设置（见 failover.go）
+	Fallbacks      []AgentBackend        `yaml:"fallbacks,omitempty"`
+	CircuitBreaker *CircuitBreakerConfig `yaml:"circuit_breaker,omitempty"`
+
+	// 提示词组合（见 prompt_composer.go），文件内容按 text/template 渲染
+	DevPromptPath      string              `yaml:"dev_prompt_path,omitempty"`      // 开发规范，拼接在系统提示词之后
+	PromptPaths        []string            `yaml:"prompt_paths,omitempty"`         // 其余提示词文件，按顺序拼接
+	ModePrompts        map[string][]string `yaml:"mode_prompts,omitempty"`         // 键为模式名或 "模式名:步骤"，处于该模式/步骤时追加
+	PromptTemplatePath string              `yaml:"prompt_template_path,omitempty"` // 覆盖内置骨架模板
+}
+
+// AgentBackend 一个可调用的 Agent 后端（CLI 或模型接口）
+// 未配置的调用选项使用 CLI 适配器的默认值（见 agent_options.go 中的校验规则）
+type AgentBackend struct {
+	CLIType string             `yaml:"cli_type"`
+	HTTP    *HTTPBackendConfig `yaml:"http,omitempty"` // cli_type 为 http 时的模型接口配置
+
+	Model          string            `yaml:"model,omitempty"`
+	PermissionMode string            `yaml:"permission_mode,omitempty"` // claude: --permission-mode
+	ApprovalMode   string            `yaml:"approval_mode,omitempty"`   // gemini: --approval-mode
+	AllowedTools   []string          `yaml:"allowed_tools,omitempty"`   // 覆盖默认的工具白名单
+	DeniedTools    []string          `yaml:"denied_tools,omitempty"`    // claude: --disallowedTools
+	ExtraArgs      []string          `yaml:"extra_args,omitempty"`      // 追加到 CLI 的选项之后（位置参数之前）
+	Env            map[string]string `yaml:"env,omitempty"`             // CLI 进程的额外环境变量
+}
+
+// HTTPBackendConfig 直接调用模型 HTTP 接口的配置（cli_type: http）
+type HTTPBackendConfig struct {
+	Model     string `yaml:"model"`
+	BaseURL   string `yaml:"base_url,omitempty"`    // 为空时使用官方地址
+	APIKeyEnv string `yaml:"api_key_env,omitempty"` // 保存 API Key 的环境变量名
+	APIFormat string `yaml:"api_format,omitempty"`  // "openai"（默认）| "anthropic"
+	MaxTokens int    `yaml:"max_tokens,omitempty"`
+}
+
+// invokeOptions 后端配置中的调用参数（会话、工作目录等由调用方补充）
+func (c *AgentBackend) invokeOptions() AgentOptions {
+	options := AgentOptions{
+		Model:           c.Model,
+		PermissionMode:  c.PermissionMode,
+		ApprovalMode:    c.ApprovalMode,
+		AllowedTools:    strings.Join(c.AllowedTools, ","),
+		DisallowedTools: strings.Join(c.DeniedTools, ","),
+		ExtraArgs:       c.ExtraArgs,
+		Env:             c.Env,
+	}
+	if c.HTTP != nil {
+		if c.HTTP.Model != "" {
+			options.Model = c.HTTP.Model
+		}
+		options.BaseURL = c.HTTP.BaseURL
+		options.APIKeyEnv = c.HTTP.APIKeyEnv
+		options.APIFormat = c.HTTP.APIFormat
+		options.MaxTokens = c.HTTP.MaxTokens
+	}
+	return options
 }
 
 // Config 系统配置
@@ -30,6 +94,16 @@ type Config struct {
 	Redis     RedisConfig      `yaml:"redis"`
 	User      UserConfig       `yaml:"user"`
 	Hindsight *HindsightConfig `yaml:"hindsight,omitempty"`
+
+	// Workflows 声明式工作流，每个工作流注册为一个同名协作模式
+	Workflows []WorkflowDefinition `yaml:"workflows,omitempty"`
+	// WorkflowsDir 工作流定义目录（默认 workflows），目录下每个 yaml 文件一个工作流
+	WorkflowsDir string `yaml:"workflows_dir,omitempty"`
+
+	// Pricing 模型价格表（键为模型名或模型名前缀，也可以是 cli_type），用于 CLI 未报告费用时计算成本
+	Pricing map[string]ModelPrice `yaml:"pricing,omitempty"`
+	// Budgets 用量预算（会话、每只猫猫每天、全部猫猫每天）
+	Budgets *BudgetConfig `yaml:"budgets,omitempty"`
 }
 
 // UserConfig 用户配置
@@ -58,12 +132,37 @@ type TaskMessage struct {
 	Status      string                 `json:"status"` // pending, processing, completed, failed
 	Timestamp   time.Time              `json:"timestamp"`
 	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	Chain       *CallChain             `json:"chain,omitempty"`   // 调用因果链（根消息 ID、跳数、调用路径）
+	Routing     string                 `json:"routing,omitempty"` // 后续调用的路由策略，为空时由编排器统一派发
+	Timeout     int                    `json:"timeout,omitempty"` // 任务级超时（秒），覆盖 Agent 配置
+	Error       string                 `json:"error,omitempty"`   // 任务失败原因（status 为 failed 时）
+	FailReason  string                 `json:"fail_reason,omitempty"`
+	Backend     string                 `json:"backend,omitempty"`  // 配置了 fallbacks 时实际回答的后端
+	Failover    []BackendAttempt       `json:"failover,omitempty"` // 回答前失败或被跳过的后端
+	Worktree    *Worktree              `json:"worktree,omitempty"` // 工作区开启隔离时任务所在的分支及其 diff
+}
+
+// 任务路由策略：Agent 回复中的 @ 提及由谁负责派发
+const (
+	RoutingOrchestrator = "orchestrator" // 默认：由 API 服务器的编排器按协作模式统一派发
+	RoutingWorker       = "worker"       // 独立使用（--send / ui）时由 Agent 工作进程自行派发
+)
+
+// ParseRoutingPolicy 校验路由策略参数，空字符串视为由编排器派发
+func ParseRoutingPolicy(policy string) (string, error) {
+	switch policy {
+	case "", RoutingOrchestrator:
+		return RoutingOrchestrator, nil
+	case RoutingWorker:
+		return RoutingWorker, nil
+	}
+	return "", fmt.Errorf("未知的路由策略: %s（可选: %s, %s）", policy, RoutingOrchestrator, RoutingWorker)
 }
 
 // AgentState Agent 状态
 type AgentState struct {
 	Name       string
-	Status     string // idle, busy
+	Status     string // idle, busy, offline
 	LastTaskID string
 	UpdatedAt  time.Time
 }
@@ -83,8 +182,9 @@ type Scheduler struct {
 	ctx           context.Context
 	agents        map[string]*AgentConfig
 	agentStates   map[string]*AgentState
-	systemPrompts map[string]string
+	prompts       map[string]*PromptComposer
 	chatLogFile   string
+	registry      *CatRegistry // API 服务器中的猫猫注册表（可选）
 }
 
 // NewScheduler 创建新的调度器
@@ -99,6 +199,9 @@ func NewScheduler(configPath string) (*Scheduler, error) {
 	if err := yaml.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("解析配置文件失败: %w", err)
 	}
+	if err := validateAgentConfigs(config.Agents); err != nil {
+		return nil, err
+	}
 
 	// 创建 Redis 客户端
 	rdb := redis.NewClient(&redis.Options{
@@ -120,7 +223,7 @@ func NewScheduler(configPath string) (*Scheduler, error) {
 		ctx:           ctx,
 		agents:        make(map[string]*AgentConfig),
 		agentStates:   make(map[string]*AgentState),
-		systemPrompts: make(map[string]string),
+		prompts:       make(map[string]*PromptComposer),
 		chatLogFile:   "chat_history.jsonl",
 	}
 
@@ -137,14 +240,14 @@ func (s *Scheduler) registerAgents() error {
 	for i := range s.config.Agents {
 		agent := &s.config.Agents[i]
 
-		// 读取系统提示词
-		promptData, err := os.ReadFile(agent.SystemPromptPath)
+		// 读取并解析提示词文件
+		prompts, err := NewPromptComposer(agent)
 		if err != nil {
-			return fmt.Errorf("读取 Agent %s 的系统提示词失败: %w", agent.Name, err)
+			return fmt.Errorf("加载 Agent %s 的提示词失败: %w", agent.Name, err)
 		}
 
 		s.agents[agent.Name] = agent
-		s.systemPrompts[agent.Name] = string(promptData)
+		s.prompts[agent.Name] = prompts
 		s.agentStates[agent.Name] = &AgentState{
 			Name:      agent.Name,
 			Status:    "idle",
@@ -157,17 +260,64 @@ func (s *Scheduler) registerAgents() error {
 	return nil
 }
 
+// UseRegistry 改为从猫猫注册表查找 Agent，运行时注册的猫猫无需重建调度器即可接收任务
+func (s *Scheduler) UseRegistry(registry *CatRegistry) {
+	s.registry = registry
+}
+
+// lookupAgent 查找 Agent：使用注册表时以注册表为准，否则使用配置文件中的 Agent
+func (s *Scheduler) lookupAgent(name string) (*AgentConfig, bool) {
+	if s.registry != nil {
+		agent, ok := s.registry.Get(name)
+		return &agent, ok
+	}
+	agent, ok := s.agents[name]
+	return agent, ok
+}
+
 // SendTask 发送任务到指定 Agent
 func (s *Scheduler) SendTask(agentName, content, sessionID string) (string, error) {
 	return s.SendTaskWithWorkspace("铲屎官", agentName, content, sessionID, "")
 }
 
+// SendTaskWithMetadata 发送任务到指定 Agent，并附带元数据（结果返回时原样带回）
+func (s *Scheduler) SendTaskWithMetadata(agentName, content, sessionID string, metadata map[string]interface{}) (string, error) {
+	return s.sendTask("铲屎官", TaskMessage{AgentName: agentName, Content: content, SessionID: sessionID, Metadata: metadata})
+}
+
+// SendTaskMessage 发送预先构造的任务（可预先指定 TaskID，便于调用方在发送前登记任务）
+func (s *Scheduler) SendTaskMessage(task TaskMessage) (string, error) {
+	return s.sendTask("铲屎官", task)
+}
+
+// NewTaskID 生成任务 ID
+func NewTaskID(agentName string) string {
+	return fmt.Sprintf("task_%s_%d", agentName, time.Now().UnixNano())
+}
+
+// CancelTask 取消任务：仍在队列中的从 Redis Stream 删除，正在执行的通知 Agent 终止 CLI 进程组
+func (s *Scheduler) CancelTask(taskID string) (*CancelResult, error) {
+	return cancelTask(s.ctx, s.redisClient, taskID)
+}
+
+// SendTaskWithRouting 发送独立任务（不属于任何会话），并指定后续 @ 调用的路由策略
+func (s *Scheduler) SendTaskWithRouting(agentName, content, routing string) (string, error) {
+	return s.sendTask("铲屎官", TaskMessage{AgentName: agentName, Content: content, Routing: routing})
+}
+
 // SendTaskWithWorkspace 发送任务到指定 Agent（带工作区 ID）
 func (s *Scheduler) SendTaskWithWorkspace(from, agentName, content, sessionID, workspaceID string) (string, error) {
+	return s.sendTask(from, TaskMessage{AgentName: agentName, Content: content, SessionID: sessionID, WorkspaceID: workspaceID})
+}
+
+// sendTask 构造任务消息并发送到 Agent 的 Redis Stream
+// task 中只需填写 AgentName、Content 以及需要的会话/工作区/元数据字段，其余字段在这里补全
+func (s *Scheduler) sendTask(from string, task TaskMessage) (string, error) {
+	agentName, content := task.AgentName, task.Content
 	LogDebug("[Scheduler] 准备发送任务 - From: %s, To: %s, Content: %s, SessionID: %s, WorkspaceID: %s",
-		from, agentName, content, sessionID, workspaceID)
+		from, agentName, content, task.SessionID, task.WorkspaceID)
 
-	agent, exists := s.agents[agentName]
+	agent, exists := s.lookupAgent(agentName)
 	if !exists {
 		LogError("[Scheduler] Agent 不存在: %s, 可用的 Agents: %v", agentName, s.getAgentNames())
 		return "", fmt.Errorf("Agent %s 不存在", agentName)
@@ -178,22 +328,18 @@ func (s *Scheduler) SendTaskWithWorkspace(from, agentName, content, sessionID, w
 	// 记录聊天
 	s.logChat(from, agentName, content)
 
-	// 生成任务 ID
-	taskID := fmt.Sprintf("task_%s_%d", agentName, time.Now().UnixNano())
-	LogDebug("[Scheduler] 生成任务 ID: %s", taskID)
-
-	// 创建任务消息
-	task := TaskMessage{
-		TaskID:      taskID,
-		AgentName:   agentName,
-		Content:     content,
-		SessionID:   sessionID,
-		WorkspaceID: workspaceID, // 新增：传递工作区 ID
-		RetryCount:  0,
-		MaxRetries:  3,
-		CreatedAt:   time.Now(),
-		Status:      "pending",
+	// 生成任务 ID（调用方未指定时）
+	if task.TaskID == "" {
+		task.TaskID = NewTaskID(agentName)
 	}
+	taskID := task.TaskID
+	LogDebug("[Scheduler] 任务 ID: %s", taskID)
+
+	// 补全任务消息
+	task.RetryCount = 0
+	task.MaxRetries = 3
+	task.CreatedAt = time.Now()
+	task.Status = TaskStatusPending
 
 	// 序列化任务
 	taskData, err := json.Marshal(task)
@@ -205,7 +351,7 @@ func (s *Scheduler) SendTaskWithWorkspace(from, agentName, content, sessionID, w
 	// 发送到 Redis Stream
 	streamKey := fmt.Sprintf("pipe:%s", agent.Pipe)
 	LogInfo("[Scheduler] 发送任务到 Redis Stream: %s", streamKey)
-	_, err = s.redisClient.XAdd(s.ctx, &redis.XAddArgs{
+	messageID, err := s.redisClient.XAdd(s.ctx, &redis.XAddArgs{
 		Stream: streamKey,
 		Values: map[string]interface{}{
 			"task": string(taskData),
@@ -217,12 +363,20 @@ func (s *Scheduler) SendTaskWithWorkspace(from, agentName, content, sessionID, w
 		return "", fmt.Errorf("发送任务到 Redis Stream 失败: %w", err)
 	}
 
+	// 记录任务在 Stream 中的位置，取消时用于删除
+	if err := recordTaskQueued(s.ctx, s.redisClient, &task, streamKey, messageID); err != nil {
+		LogWarn("[Scheduler] 记录任务状态失败: %v", err)
+	}
+
 	LogInfo("[Scheduler] ✓ 任务已发送: %s -> %s (管道: %s)", taskID, agentName, agent.Pipe)
 	return taskID, nil
 }
 
 // getAgentNames 获取所有 Agent 名称（用于调试）
 func (s *Scheduler) getAgentNames() []string {
+	if s.registry != nil {
+		return s.registry.Names()
+	}
 	names := make([]string, 0, len(s.agents))
 	for name := range s.agents {
 		names = append(names, name)
@@ -230,13 +384,18 @@ func (s *Scheduler) getAgentNames() []string {
 	return names
 }
 
-// GetAgentState 获取 Agent 状态
+// GetAgentState 获取 Agent 状态（由工作进程心跳得出，读取失败时返回本地记录的状态）
 func (s *Scheduler) GetAgentState(agentName string) (*AgentState, error) {
 	state, exists := s.agentStates[agentName]
 	if !exists {
 		return nil, fmt.Errorf("Agent %s 不存在", agentName)
 	}
-	return state, nil
+	presence, err := loadPresence(s.ctx, s.redisClient)
+	if err != nil {
+		LogWarn("[Scheduler] 读取 Agent 心跳失败: %v", err)
+		return state, nil
+	}
+	return presenceAgentState(agentName, presence[agentName]), nil
 }
 
 // UpdateAgentState 更新 Agent 状态
@@ -262,13 +421,13 @@ func (s *Scheduler) ListAgents() []*AgentConfig {
 	return agents
 }
 
-// GetSystemPrompt 获取 Agent 的系统提示词
-func (s *Scheduler) GetSystemPrompt(agentName string) (string, error) {
-	prompt, exists := s.systemPrompts[agentName]
+// GetPromptComposer 获取 Agent 的提示词组合器
+func (s *Scheduler) GetPromptComposer(agentName string) (*PromptComposer, error) {
+	prompts, exists := s.prompts[agentName]
 	if !exists {
-		return "", fmt.Errorf("Agent %s 不存在", agentName)
+		return nil, fmt.Errorf("Agent %s 不存在", agentName)
 	}
-	return prompt, nil
+	return prompts, nil
 }
 
 // Close 关闭调度器
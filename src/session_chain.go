@@ -21,6 +21,9 @@ const (
 	SCEventCat        SessionChainEventType = "cat"
 	SCEventSystem     SessionChainEventType = "system"
 	SCEventInvocation SessionChainEventType = "invocation"
+
+	// SCEventOwnerRequest 猫猫 @铲屎官 的提问（Sender 为提问的猫猫，Content 为问题）
+	SCEventOwnerRequest SessionChainEventType = "owner_request"
 )
 
 // --- 类型定义 ---
@@ -68,19 +71,24 @@ type SessionEvent struct {
 
 // InvocationRecord 一次 Agent 调用的完整记录
 type InvocationRecord struct {
-	ID           string    `json:"id"`
-	SessionID    string    `json:"sessionId"`
-	ThreadID     string    `json:"threadId"`
-	AgentName    string    `json:"agentName"`
-	Prompt       string    `json:"prompt"`
-	Response     string    `json:"response"`
-	AISessionID  string    `json:"aiSessionId"`
-	TokensIn     int       `json:"tokensIn"`
-	TokensOut    int       `json:"tokensOut"`
-	Duration     int64     `json:"duration"`
-	StartEventNo int       `json:"startEventNo"`
-	EndEventNo   int       `json:"endEventNo"`
-	Timestamp    time.Time `json:"timestamp"`
+	ID              string     `json:"id"`
+	SessionID       string     `json:"sessionId"`
+	ThreadID        string     `json:"threadId"`
+	AgentName       string     `json:"agentName"`
+	Prompt          string     `json:"prompt"`
+	Response        string     `json:"response"`
+	AISessionID     string     `json:"aiSessionId"`
+	Model           string     `json:"model,omitempty"`
+	TokensIn        int        `json:"tokensIn"`
+	TokensOut       int        `json:"tokensOut"`
+	CacheReadTokens int        `json:"cacheReadTokens,omitempty"`
+	CostUSD         float64    `json:"costUsd"`
+	UsageEstimated  bool       `json:"usageEstimated,omitempty"` // CLI 未报告用量，token 数为估算值
+	Duration        int64      `json:"duration"`                 // 毫秒
+	StartEventNo    int        `json:"startEventNo"`
+	EndEventNo      int        `json:"endEventNo"`
+	Timestamp       time.Time  `json:"timestamp"`
+	ToolCalls       []ToolCall `json:"toolCalls,omitempty"` // 本次调用中 CLI 执行的工具
 }
 
 // AgentCursor Agent 的读取位置指针
@@ -332,9 +340,17 @@ func (m *SessionChainManager) RecordInvocation(threadID string, inv InvocationRe
 
 // GetInvocation 获取 Invocation 详情
 func (m *SessionChainManager) GetInvocation(threadID, invocationID string) (*InvocationRecord, error) {
+	if !isValidInvocationID(invocationID) {
+		return nil, fmt.Errorf("无效的 Invocation ID: %s", invocationID)
+	}
 	return m.readInvocationFromDisk(threadID, invocationID)
 }
 
+// isValidInvocationID Invocation ID 用作文件名，不允许包含路径
+func isValidInvocationID(invocationID string) bool {
+	return invocationID != "" && filepath.Base(invocationID) == invocationID && !strings.HasPrefix(invocationID, ".")
+}
+
 // --- Event 读取 ---
 
 // GetEvents 获取指定 Session 的 Event（支持分页）
@@ -655,6 +671,8 @@ func (m *SessionChainManager) CompressSession(threadID, sessionID string, config
 			eventsText.WriteString(fmt.Sprintf("[%s] %s\n", e.Sender, e.Content))
 		case SCEventSystem:
 			eventsText.WriteString(fmt.Sprintf("[系统] %s\n", e.Content))
+		case SCEventOwnerRequest:
+			eventsText.WriteString(fmt.Sprintf("[%s→铲屎官] %s\n", e.Sender, e.Content))
 		}
 	}
 
@@ -804,6 +822,10 @@ func (m *SessionChainManager) MCPReadSessionEvents(sessionID string, cursor, lim
 
 // MCPReadInvocationDetail MCP: read_invocation_detail
 func (m *SessionChainManager) MCPReadInvocationDetail(invocationID string) (*InvocationRecord, error) {
+	if !isValidInvocationID(invocationID) {
+		return nil, fmt.Errorf("无效的 Invocation ID: %s", invocationID)
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -5,12 +5,26 @@ import (
 	"strings"
 )
 
+// promptData 任务对应的提示词变量（历史和摘要由各策略补充）
+func (w *AgentWorker) promptData(task *TaskMessage, workDir string) PromptData {
+	data := PromptData{
+		CatName:       w.config.Name,
+		SessionID:     task.SessionID,
+		TaskID:        task.TaskID,
+		WorkspacePath: workDir,
+		Message:       task.Content,
+	}
+	data.Mode, _ = task.Metadata[MetaMode].(string)
+	data.ModeStep, _ = task.Metadata[MetaModeStep].(string)
+	return data
+}
+
 // buildOrchestratedPrompt 策略 A：调度系统管理
 // 每次调用传入活跃 Session 的全部 Event，不使用 --resume
-func (w *AgentWorker) buildOrchestratedPrompt(task *TaskMessage) string {
+func (w *AgentWorker) buildOrchestratedPrompt(task *TaskMessage, data PromptData) string {
 	threadID := task.SessionID
 	if threadID == "" || w.chainManager == nil {
-		return w.buildLegacyPrompt(w.getSessionHistory(task.SessionID), task)
+		return w.buildLegacyPrompt(w.getSessionHistory(task.SessionID), data)
 	}
 
 	// 从磁盘重新加载最新数据（跨进程同步）
@@ -22,58 +36,37 @@ func (w *AgentWorker) buildOrchestratedPrompt(task *TaskMessage) string {
 	_, err := w.chainManager.GetOrCreateChain(threadID)
 	if err != nil {
 		LogWarn("[Agent-%s] 获取 Session Chain 失败: %v，回退到旧逻辑", w.config.Name, err)
-		return w.buildLegacyPrompt(w.getSessionHistory(task.SessionID), task)
+		return w.buildLegacyPrompt(w.getSessionHistory(task.SessionID), data)
 	}
 
 	// 读取活跃 Session 的所有 Event
 	activeSession, err := w.chainManager.GetActiveSession(threadID)
 	if err != nil {
 		LogWarn("[Agent-%s] 获取活跃 Session 失败: %v", w.config.Name, err)
-		return w.buildLegacyPrompt("", task)
+		return w.buildLegacyPrompt("", data)
 	}
 
 	events, _, err := w.chainManager.GetEvents(threadID, activeSession.ID, 0, 10000)
 	if err != nil {
 		LogWarn("[Agent-%s] 读取 Event 失败: %v", w.config.Name, err)
-		return w.buildLegacyPrompt("", task)
+		return w.buildLegacyPrompt("", data)
 	}
 
 	// 收集已 seal 的 Session 的 Summary
-	summaries := w.collectSealedSummaries(threadID)
-
-	// 格式化
-	history := formatEventsAsHistory(events)
-
-	var sb strings.Builder
-	sb.WriteString(w.systemPrompt)
-	sb.WriteString("\n\n========================================\n\n")
-
-	if summaries != "" {
-		sb.WriteString("【历史摘要】\n")
-		sb.WriteString(summaries)
-		sb.WriteString("\n========================================\n\n")
-	}
-
-	if history != "" {
-		sb.WriteString("【对话历史】\n")
-		sb.WriteString(history)
-		sb.WriteString("\n========================================\n\n")
-	}
-
-	sb.WriteString(fmt.Sprintf("🎯 你是%s，请回应以下消息：\n%s\n\n请结合上面的对话历史来完成任务。",
-		w.config.Name, task.Content))
+	data.Summaries = w.collectSealedSummaries(threadID)
+	data.History = formatEventsAsHistory(events)
 
-	return sb.String()
+	return w.prompts.Render(PromptLayoutOrchestrated, data)
 }
 
 // buildCLIManagedPrompt 策略 B：CLI 自动管理
 // 使用 --resume + AI session ID，只传增量 Event
 // 返回: (prompt, aiSessionID)
-func (w *AgentWorker) buildCLIManagedPrompt(task *TaskMessage) (string, string) {
+func (w *AgentWorker) buildCLIManagedPrompt(task *TaskMessage, data PromptData) (string, string) {
 	threadID := task.SessionID
 	if threadID == "" || w.chainManager == nil {
 		chatHistory := w.getSessionHistory(task.SessionID)
-		return w.buildLegacyPrompt(chatHistory, task), ""
+		return w.buildLegacyPrompt(chatHistory, data), ""
 	}
 
 	// 从磁盘重新加载最新数据（跨进程同步）
@@ -84,7 +77,7 @@ func (w *AgentWorker) buildCLIManagedPrompt(task *TaskMessage) (string, string)
 	_, err := w.chainManager.GetOrCreateChain(threadID)
 	if err != nil {
 		LogWarn("[Agent-%s] 获取 Session Chain 失败: %v，回退到旧逻辑", w.config.Name, err)
-		return w.buildLegacyPrompt("", task), ""
+		return w.buildLegacyPrompt("", data), ""
 	}
 
 	cursor := w.chainManager.GetCursor(w.config.Name, threadID)
@@ -111,23 +104,11 @@ func (w *AgentWorker) buildCLIManagedPrompt(task *TaskMessage) (string, string)
 
 			// 如果有 summary，需要重置 AI session（上下文已断裂）
 			if summaries != "" {
-				aiSessionID = "" // 强制新建 session
-				// 构建包含 summary 的 prompt
-				history := formatEventsAsHistory(incrementalEvents)
-				var sb strings.Builder
-				sb.WriteString(w.systemPrompt)
-				sb.WriteString("\n\n========================================\n\n")
-				sb.WriteString("【历史摘要（已压缩）】\n")
-				sb.WriteString(summaries)
-				sb.WriteString("\n========================================\n\n")
-				if history != "" {
-					sb.WriteString("【最近对话】\n")
-					sb.WriteString(history)
-					sb.WriteString("\n========================================\n\n")
-				}
-				sb.WriteString(fmt.Sprintf("🎯 你是%s，请回应以下消息：\n%s",
-					w.config.Name, task.Content))
-				return sb.String(), aiSessionID
+				// 构建包含 summary 的 prompt，强制新建 session
+				data.Compressed = true
+				data.Summaries = summaries
+				data.History = formatEventsAsHistory(incrementalEvents)
+				return w.prompts.Render(PromptLayoutCLIManaged, data), ""
 			}
 		} else {
 			// 正常增量读取
@@ -135,41 +116,17 @@ func (w *AgentWorker) buildCLIManagedPrompt(task *TaskMessage) (string, string)
 		}
 	}
 
-	// 构建增量 prompt
-	history := formatEventsAsHistory(incrementalEvents)
+	// 构建增量 prompt：首次调用需要完整 prompt，有 AI session 时只传增量内容
+	data.Resumed = aiSessionID != ""
+	data.History = formatEventsAsHistory(incrementalEvents)
 
-	var sb strings.Builder
-	if aiSessionID == "" {
-		// 首次调用，需要完整 prompt
-		sb.WriteString(w.systemPrompt)
-		sb.WriteString("\n\n========================================\n\n")
-	}
-
-	if history != "" {
-		if aiSessionID != "" {
-			// 有 AI session，只传增量内容
-			sb.WriteString("【新消息】\n")
-		} else {
-			sb.WriteString("【对话历史】\n")
-		}
-		sb.WriteString(history)
-		sb.WriteString("\n========================================\n\n")
-	}
-
-	sb.WriteString(fmt.Sprintf("🎯 你是%s，请回应以下消息：\n%s",
-		w.config.Name, task.Content))
-
-	return sb.String(), aiSessionID
+	return w.prompts.Render(PromptLayoutCLIManaged, data), aiSessionID
 }
 
 // buildLegacyPrompt 旧逻辑兼容：无 context_mode 配置时使用
-func (w *AgentWorker) buildLegacyPrompt(chatHistory string, task *TaskMessage) string {
-	if chatHistory != "" {
-		return fmt.Sprintf("%s\n\n========================================\n\n【对话历史】\n%s\n========================================\n\n🎯 你是%s，请回应以下消息：\n%s\n\n请结合上面的对话历史来完成任务。",
-			w.systemPrompt, chatHistory, w.config.Name, task.Content)
-	}
-	return fmt.Sprintf("%s\n\n========================================\n\n用户需求：\n%s",
-		w.systemPrompt, task.Content)
+func (w *AgentWorker) buildLegacyPrompt(chatHistory string, data PromptData) string {
+	data.History = chatHistory
+	return w.prompts.Render(PromptLayoutLegacy, data)
 }
 
 // collectSealedSummaries 收集所有已 seal 的 Session 的 Summary
@@ -239,6 +196,8 @@ func formatEventsAsHistory(events []SessionEvent) string {
 			sb.WriteString(fmt.Sprintf("[%s] %s\n", e.Sender, content))
 		case SCEventSystem:
 			sb.WriteString(fmt.Sprintf("[系统] %s\n", content))
+		case SCEventOwnerRequest:
+			sb.WriteString(fmt.Sprintf("[%s→铲屎官] %s\n", e.Sender, content))
 		case SCEventInvocation:
 			// 简化 invocation 信息
 			if len(content) > maxContentLen {
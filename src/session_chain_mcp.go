@@ -167,7 +167,7 @@ func (s *SessionChainMCPServer) handleToolsList(req *jsonRPCRequest) *jsonRPCRes
 		},
 		{
 			Name:        "read_invocation_detail",
-			Description: "查看某一次猫猫调用的完整输入/输出",
+			Description: "查看某一次猫猫调用的完整输入/输出，以及调用中执行的工具（名称、参数、结果、耗时）",
 			InputSchema: mcpToolInputSchema{
 				Type: "object",
 				Properties: map[string]mcpPropertySchema{
@@ -178,6 +178,8 @@ func (m *SessionChainManager) writeSessionMarkdownToDisk(threadID string, sessio
 		case SCEventInvocation:
 			sb.WriteString(fmt.Sprintf("### #%d [%s] **[调用:%s]** invocation_id=%s%s\n\n%s\n\n",
 				e.EventNo, ts, e.Sender, e.InvocationID, msgIDComment, e.Content))
+		case SCEventOwnerRequest:
+			sb.WriteString(fmt.Sprintf("### #%d [%s] **[询问铲屎官:%s]**%s\n\n%s\n\n", e.EventNo, ts, e.Sender, msgIDComment, e.Content))
 		}
 	}
 
@@ -294,6 +296,13 @@ func parseEventsFromMarkdown(body string, baseDate time.Time) []SessionEvent {
 			} else if strings.Contains(rest, "**[系统]**") {
 				e.Type = SCEventSystem
 				e.Sender = "系统"
+			} else if strings.Contains(rest, "**[询问铲屎官:") {
+				e.Type = SCEventOwnerRequest
+				start := strings.Index(rest, "**[询问铲屎官:") + len("**[询问铲屎官:")
+				end := strings.Index(rest[start:], "]**")
+				if end > 0 {
+					e.Sender = rest[start : start+end]
+				}
 			} else if strings.Contains(rest, "**[调用:") {
 				e.Type = SCEventInvocation
 				start := strings.Index(rest, "**[调用:") + len("**[调用:")
@@ -102,6 +102,7 @@ func (sm *SessionManager) LoadSession(sessionID string) error {
 	if err != nil {
 		return fmt.Errorf("创建调度器失败: %w", err)
 	}
+	scheduler.UseRegistry(sm.cats)
 
 	mode, err := sm.orchestrator.registry.GetOrCreate(data.ModeName, data.ModeConfig)
 	if err != nil {
@@ -133,6 +134,16 @@ func (sm *SessionManager) LoadSession(sessionID string) error {
 		return fmt.Errorf("在编排器中注册会话失败: %w", err)
 	}
 
+	// 恢复模式状态（流程类模式可从中断的步骤继续）
+	if err := sm.orchestrator.RestoreModeState(sessionID, data.ModeState); err != nil {
+		return fmt.Errorf("恢复模式状态失败: %w", err)
+	}
+	if modeState, err := sm.orchestrator.GetModeState(sessionID); err == nil {
+		ctx.mu.Lock()
+		ctx.ModeState = modeState
+		ctx.mu.Unlock()
+	}
+
 	LogInfo("[Persistence] 会话已加载: %s", sessionID)
 	return nil
 }
@@ -226,7 +237,7 @@ func (sm *SessionManager) rebuildSummariesFromChain() {
 func (sm *SessionManager) DeleteSessionFromRedis(sessionID string) error {
 	key := sessionKeyPrefix + sessionID
 
-	if err := sm.redisClient.Del(sm.ctx, key).Err(); err != nil {
+	if err := sm.redisClient.Del(sm.ctx, key, usageStatsKey(sessionID), budgetLimitKey(budgetScopeKey(BudgetScopeSession, sessionID, "", "")), budgetWarnedKey(budgetScopeKey(BudgetScopeSession, sessionID, "", "")), budgetQueueKey(sessionID)).Err(); err != nil {
 		return fmt.Errorf("删除会话数据失败: %w", err)
 	}
 
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// agentStreamChannel Agent 增量输出的 Redis Pub/Sub 频道
+// 增量输出只用于实时展示，丢失不影响最终结果（最终回复仍走 results:stream）
+const agentStreamChannel = "agent_stream"
+
+// StreamEventDiscard 丢弃草稿：任务被取消或执行失败时通知前端移除已展示的增量内容
+const StreamEventDiscard = "discard"
+
+// TaskDelta 一条增量输出
+type TaskDelta struct {
+	TaskID    string `json:"taskId"`
+	SessionID string `json:"sessionId"`
+	AgentName string `json:"agentName"`
+	Seq       int    `json:"seq"` // 同一任务内递增，前端据此丢弃乱序的旧事件
+	StreamEvent
+}
+
+// MessageDelta 推送给前端的 message_delta 载荷
+type MessageDelta struct {
+	TaskDelta
+	Sender *Sender `json:"sender,omitempty"`
+}
+
+// deltaPublisher 将一个任务的增量输出发布到 Redis
+type deltaPublisher struct {
+	ctx  context.Context
+	rdb  *redis.Client
+	task *TaskMessage
+	mu   sync.Mutex
+	seq  int
+}
+
+// newDeltaPublisher 创建任务的增量输出发布器
+func newDeltaPublisher(ctx context.Context, rdb *redis.Client, task *TaskMessage) *deltaPublisher {
+	return &deltaPublisher{ctx: ctx, rdb: rdb, task: task}
+}
+
+// Publish 发布一条增量事件（实现 StreamHandler）
+func (p *deltaPublisher) Publish(event StreamEvent) {
+	p.mu.Lock()
+	p.seq++
+	delta := TaskDelta{
+		TaskID:      p.task.TaskID,
+		SessionID:   p.task.SessionID,
+		AgentName:   p.task.AgentName,
+		Seq:         p.seq,
+		StreamEvent: event,
+	}
+	p.mu.Unlock()
+
+	data, err := json.Marshal(delta)
+	if err != nil {
+		return
+	}
+	if err := p.rdb.Publish(p.ctx, agentStreamChannel, string(data)).Err(); err != nil {
+		LogDebug("[Stream] 发布增量输出失败: %v", err)
+	}
+}
+
+// listenForDeltas 订阅 Agent 增量输出并通过 WebSocket 推送 message_delta
+func (sm *SessionManager) listenForDeltas() {
+	sub := sm.redisClient.Subscribe(sm.ctx, agentStreamChannel)
+	defer sub.Close()
+
+	LogInfo("[API] 开始监听增量输出: %s", agentStreamChannel)
+
+	ch := sub.Channel()
+	for {
+		select {
+		case <-sm.ctx.Done():
+			LogInfo("[API] 增量输出监听器已停止")
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			var delta TaskDelta
+			if err := json.Unmarshal([]byte(msg.Payload), &delta); err != nil {
+				LogDebug("[API] 解析增量输出失败: %v", err)
+				continue
+			}
+
+			sm.mu.RLock()
+			_, exists := sm.sessions[delta.SessionID]
+			sm.mu.RUnlock()
+			if !exists {
+				continue
+			}
+
+			sm.wsHub.BroadcastToSession(delta.SessionID, "message_delta", MessageDelta{
+				TaskDelta: delta,
+				Sender:    sm.getCatInfoByName(delta.AgentName),
+			})
+		}
+	}
+}
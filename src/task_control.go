@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 任务状态
+const (
+	TaskStatusPending   = "pending"
+	TaskStatusRunning   = "running"
+	TaskStatusCompleted = "completed"
+	TaskStatusFailed    = "failed"
+	TaskStatusCancelled = "cancelled"
+)
+
+const (
+	// taskCancelChannel 取消信号的 Redis Pub/Sub 频道，消息内容为任务 ID
+	taskCancelChannel = "task_cancel"
+
+	// taskStateTTL 任务状态和取消标记的保留时间
+	taskStateTTL = 24 * time.Hour
+
+	// DefaultAgentTimeout Agent 未配置 timeout 时单次 CLI 调用的超时时间
+	DefaultAgentTimeout = 30 * time.Minute
+
+	// DefaultAgentConcurrency Agent 未配置 concurrency 时每个工作进程同时执行的任务数
+	DefaultAgentConcurrency = 1
+)
+
+// 任务失败原因（TaskMessage.FailReason）
+const (
+	TaskFailTimeout   = "timeout"
+	TaskFailError     = "error"                 // 执行失败且重试次数已用尽
+	TaskFailBudget    = "budget_exceeded"       // 预算已用尽，任务未执行
+	TaskFailBackend   = "backend_unavailable"   // 所有后端致命失败或熔断中，任务不重试
+	TaskFailWorkspace = "workspace_unavailable" // 隔离模式下无法创建 worktree（不是 git 仓库等），任务不重试
+)
+
+// resolveTaskTimeout 任务超时时间：任务指定 > Agent 配置 > 默认值
+func resolveTaskTimeout(agent AgentConfig, task *TaskMessage) time.Duration {
+	if task != nil && task.Timeout > 0 {
+		return time.Duration(task.Timeout) * time.Second
+	}
+	if agent.Timeout > 0 {
+		return time.Duration(agent.Timeout) * time.Second
+	}
+	return DefaultAgentTimeout
+}
+
+// resolveConcurrency 工作进程同时执行的任务数：Agent 配置 > 默认值
+func resolveConcurrency(agent AgentConfig) int {
+	if agent.Concurrency > 0 {
+		return agent.Concurrency
+	}
+	return DefaultAgentConcurrency
+}
+
+// ErrTaskFinished 任务已经结束，无法取消
+var ErrTaskFinished = errors.New("任务已结束")
+
+// ErrTaskNotFound 任务不存在（或状态已过期）
+var ErrTaskNotFound = errors.New("任务不存在或已过期")
+
+// taskStateKey 任务状态（所在 Stream、消息 ID、状态）的 Redis Hash
+func taskStateKey(taskID string) string {
+	return fmt.Sprintf("task_state:%s", taskID)
+}
+
+// taskCancelledKey 任务取消标记，Agent 取到任务后先检查该标记
+func taskCancelledKey(taskID string) string {
+	return fmt.Sprintf("task_cancelled:%s", taskID)
+}
+
+// CancelResult 取消任务的结果
+type CancelResult struct {
+	TaskID    string `json:"taskId"`
+	AgentName string `json:"agentName"`
+	// Removed 任务还在队列中，已从 Stream 删除（不会再产生结果）
+	Removed bool `json:"removed"`
+	// Signalled 已通知 Agent 工作进程终止正在执行的 CLI
+	Signalled bool `json:"signalled"`
+	// Task 从队列中删除的任务（Removed 为 true 时有效）
+	Task *TaskMessage `json:"-"`
+}
+
+// recordTaskQueued 记录任务入队位置，用于之后从 Stream 中删除
+func recordTaskQueued(ctx context.Context, rdb *redis.Client, task *TaskMessage, stream, messageID string) error {
+	key := taskStateKey(task.TaskID)
+	pipe := rdb.TxPipeline()
+	pipe.HSet(ctx, key, map[string]interface{}{
+		"agent_name": task.AgentName,
+		"session_id": task.SessionID,
+		"stream":     stream,
+		"message_id": messageID,
+		"status":     TaskStatusPending,
+	})
+	pipe.Expire(ctx, key, taskStateTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// setTaskStatus 更新任务状态（任务状态不存在时忽略）
+func setTaskStatus(ctx context.Context, rdb *redis.Client, taskID, status string) error {
+	key := taskStateKey(taskID)
+	exists, err := rdb.Exists(ctx, key).Result()
+	if err != nil || exists == 0 {
+		return err
+	}
+	return rdb.HSet(ctx, key, "status", status).Err()
+}
+
+// isTaskCancelled 检查任务是否已被取消
+func isTaskCancelled(ctx context.Context, rdb *redis.Client, taskID string) bool {
+	n, err := rdb.Exists(ctx, taskCancelledKey(taskID)).Result()
+	return err == nil && n > 0
+}
+
+// cancelTask 取消任务：打上取消标记，仍在队列中的从 Stream 删除，正在执行的通知 Agent 终止
+func cancelTask(ctx context.Context, rdb *redis.Client, taskID string) (*CancelResult, error) {
+	state, err := rdb.HGetAll(ctx, taskStateKey(taskID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("读取任务状态失败: %w", err)
+	}
+	if len(state) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrTaskNotFound, taskID)
+	}
+
+	switch state["status"] {
+	case TaskStatusCompleted, TaskStatusFailed, TaskStatusCancelled:
+		return nil, fmt.Errorf("%w: %s (%s)", ErrTaskFinished, taskID, state["status"])
+	}
+
+	result := &CancelResult{TaskID: taskID, AgentName: state["agent_name"]}
+
+	// 先打标记，避免 Agent 在删除前已取走任务
+	if err := rdb.Set(ctx, taskCancelledKey(taskID), "1", taskStateTTL).Err(); err != nil {
+		return nil, fmt.Errorf("写入取消标记失败: %w", err)
+	}
+
+	// 仍在队列中的任务直接从 Stream 删除
+	if state["status"] == TaskStatusPending && state["stream"] != "" && state["message_id"] != "" {
+		messages, err := rdb.XRange(ctx, state["stream"], state["message_id"], state["message_id"]).Result()
+		if err == nil && len(messages) > 0 {
+			if n, err := rdb.XDel(ctx, state["stream"], state["message_id"]).Result(); err == nil && n > 0 {
+				result.Removed = true
+				if data, ok := messages[0].Values["task"].(string); ok {
+					var task TaskMessage
+					if json.Unmarshal([]byte(data), &task) == nil {
+						result.Task = &task
+					}
+				}
+			}
+		}
+	}
+
+	// 正在执行（或刚被取走）的任务通知 Agent 终止
+	if !result.Removed {
+		if err := rdb.Publish(ctx, taskCancelChannel, taskID).Err(); err != nil {
+			return nil, fmt.Errorf("发送取消信号失败: %w", err)
+		}
+		result.Signalled = true
+	}
+
+	rdb.HSet(ctx, taskStateKey(taskID), "status", TaskStatusCancelled)
+	return result, nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ModelPrice 模型价格（美元 / 百万 token）
+type ModelPrice struct {
+	Input     float64 `yaml:"input" json:"input"`
+	Output    float64 `yaml:"output" json:"output"`
+	CacheRead float64 `yaml:"cache_read,omitempty" json:"cacheRead,omitempty"` // 未配置时按 Input 计价
+}
+
+// InvocationUsage 一次调用的用量、费用和耗时
+type InvocationUsage struct {
+	Model           string
+	TokensIn        int
+	TokensOut       int
+	CacheReadTokens int
+	CostUSD         float64
+	DurationMs      int64
+	Estimated       bool // CLI 未报告用量，token 数由 EstimateTokens 估算
+}
+
+// lookupModelPrice 查找模型价格：精确匹配 > 最长前缀匹配（如 claude-sonnet-4-5 匹配 claude-sonnet-4-5-20250929）
+func lookupModelPrice(pricing map[string]ModelPrice, model string) (ModelPrice, bool) {
+	if model == "" {
+		return ModelPrice{}, false
+	}
+	if price, ok := pricing[model]; ok {
+		return price, true
+	}
+	bestKey := ""
+	for key := range pricing {
+		if strings.HasPrefix(model, key) && len(key) > len(bestKey) {
+			bestKey = key
+		}
+	}
+	if bestKey == "" {
+		return ModelPrice{}, false
+	}
+	return pricing[bestKey], true
+}
+
+// resolveInvocationUsage 汇总一次调用的用量：优先使用 CLI 报告的用量和费用，
+// 未报告用量时估算 token 数，未报告费用时按价格表计算（依次按实际模型、配置模型、cli_type 查价）
+func resolveInvocationUsage(result *CLIResult, prompt string, configuredModel, cliType string, pricing map[string]ModelPrice, duration time.Duration) InvocationUsage {
+	usage := InvocationUsage{
+		Model:      result.Model,
+		DurationMs: duration.Milliseconds(),
+	}
+	if usage.Model == "" {
+		usage.Model = configuredModel
+	}
+
+	if result.Usage != nil {
+		usage.TokensIn = result.Usage.InputTokens
+		usage.TokensOut = result.Usage.OutputTokens
+		usage.CacheReadTokens = result.Usage.CacheReadTokens
+		usage.CostUSD = result.Usage.CostUSD
+	} else {
+		usage.TokensIn = EstimateTokens(prompt)
+		usage.TokensOut = EstimateTokens(result.Response)
+		usage.Estimated = true
+	}
+
+	if usage.CostUSD == 0 {
+		price, ok := lookupModelPrice(pricing, usage.Model)
+		if !ok {
+			price, ok = lookupModelPrice(pricing, cliType)
+		}
+		if ok {
+			cacheRead := price.CacheRead
+			if cacheRead == 0 {
+				cacheRead = price.Input
+			}
+			usage.CostUSD = (float64(usage.TokensIn)*price.Input +
+				float64(usage.TokensOut)*price.Output +
+				float64(usage.CacheReadTokens)*cacheRead) / 1e6
+		}
+	}
+	return usage
+}
+
+// UsageTotals 累计用量
+type UsageTotals struct {
+	Invocations     int64   `json:"invocations"`
+	TokensIn        int64   `json:"tokensIn"`
+	TokensOut       int64   `json:"tokensOut"`
+	CacheReadTokens int64   `json:"cacheReadTokens"`
+	CostUSD         float64 `json:"costUsd"`
+	DurationMs      int64   `json:"durationMs"`
+	Estimated       int64   `json:"estimated"` // 其中用量为估算值的调用次数
+}
+
+// add 累加一条用量
+func (t *UsageTotals) add(other UsageTotals) {
+	t.Invocations += other.Invocations
+	t.TokensIn += other.TokensIn
+	t.TokensOut += other.TokensOut
+	t.CacheReadTokens += other.CacheReadTokens
+	t.CostUSD += other.CostUSD
+	t.DurationMs += other.DurationMs
+	t.Estimated += other.Estimated
+}
+
+// UsageStats 会话的用量统计
+type UsageStats struct {
+	Total UsageTotals            `json:"total"`
+	ByCat map[string]UsageTotals `json:"byCat"`
+}
+
+// usageStatsKey 会话用量的 Redis Hash，字段为 "<猫猫名>|<指标>"
+func usageStatsKey(sessionID string) string {
+	return fmt.Sprintf("usage_stats:%s", sessionID)
+}
+
+// usageDailyKey 全部会话当天用量的 Redis Hash（字段格式同 usageStatsKey），用于每日预算
+func usageDailyKey(date string) string {
+	return fmt.Sprintf("usage_daily:%s", date)
+}
+
+// usageDailyTTL 每日用量的保留时间
+const usageDailyTTL = 8 * 24 * time.Hour
+
+// usageDate 用量按本地日期归档
+func usageDate(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+// recordUsage 将一次调用的用量累加到会话统计和当天统计
+func recordUsage(ctx context.Context, rdb *redis.Client, sessionID, agentName string, usage InvocationUsage) error {
+	field := func(metric string) string { return agentName + "|" + metric }
+	dailyKey := usageDailyKey(usageDate(time.Now()))
+
+	pipe := rdb.TxPipeline()
+	for _, key := range []string{usageStatsKey(sessionID), dailyKey} {
+		pipe.HIncrBy(ctx, key, field("invocations"), 1)
+		pipe.HIncrBy(ctx, key, field("tokens_in"), int64(usage.TokensIn))
+		pipe.HIncrBy(ctx, key, field("tokens_out"), int64(usage.TokensOut))
+		pipe.HIncrBy(ctx, key, field("cache_read_tokens"), int64(usage.CacheReadTokens))
+		pipe.HIncrByFloat(ctx, key, field("cost_usd"), usage.CostUSD)
+		pipe.HIncrBy(ctx, key, field("duration_ms"), usage.DurationMs)
+		if usage.Estimated {
+			pipe.HIncrBy(ctx, key, field("estimated"), 1)
+		}
+	}
+	pipe.Expire(ctx, dailyKey, usageDailyTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// loadUsageStats 读取会话的用量统计（没有记录时返回空统计）
+func loadUsageStats(ctx context.Context, rdb *redis.Client, sessionID string) (*UsageStats, error) {
+	return loadUsageHash(ctx, rdb, usageStatsKey(sessionID))
+}
+
+// loadDailyUsage 读取某一天全部会话的用量统计
+func loadDailyUsage(ctx context.Context, rdb *redis.Client, date string) (*UsageStats, error) {
+	return loadUsageHash(ctx, rdb, usageDailyKey(date))
+}
+
+func loadUsageHash(ctx context.Context, rdb *redis.Client, key string) (*UsageStats, error) {
+	values, err := rdb.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	return parseUsageStats(values), nil
+}
+
+// parseUsageStats 将 Redis Hash 解析为按猫猫汇总的统计
+func parseUsageStats(values map[string]string) *UsageStats {
+	stats := &UsageStats{ByCat: make(map[string]UsageTotals)}
+	for field, value := range values {
+		sep := strings.LastIndex(field, "|")
+		if sep < 0 {
+			continue
+		}
+		cat, metric := field[:sep], field[sep+1:]
+		totals := stats.ByCat[cat]
+
+		n, _ := strconv.ParseInt(value, 10, 64)
+		switch metric {
+		case "invocations":
+			totals.Invocations = n
+		case "tokens_in":
+			totals.TokensIn = n
+		case "tokens_out":
+			totals.TokensOut = n
+		case "cache_read_tokens":
+			totals.CacheReadTokens = n
+		case "cost_usd":
+			totals.CostUSD, _ = strconv.ParseFloat(value, 64)
+		case "duration_ms":
+			totals.DurationMs = n
+		case "estimated":
+			totals.Estimated = n
+		}
+		stats.ByCat[cat] = totals
+	}
+	for _, totals := range stats.ByCat {
+		stats.Total.add(totals)
+	}
+	return stats
+}
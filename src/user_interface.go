@@ -29,6 +29,7 @@ type UserInterface struct {
 	redisClient *redis.Client
 	ctx         context.Context
 	cancel      context.CancelFunc
+	routing     string // 发出任务的后续 @ 调用路由策略
 }
 
 // NewUserInterface 创建用户界面
@@ -52,9 +53,15 @@ func NewUserInterface(scheduler *Scheduler, redisAddr, redisPassword string, red
 		redisClient: rdb,
 		ctx:         ctx,
 		cancel:      cancel,
+		routing:     RoutingOrchestrator,
 	}, nil
 }
 
+// SetRouting 设置发出任务的路由策略（worker 表示由 Agent 工作进程接力派发 @ 调用）
+func (ui *UserInterface) SetRouting(routing string) {
+	ui.routing = routing
+}
+
 // Start 启动用户界面
 func (ui *UserInterface) Start() error {
 	fmt.Println("🐱 猫猫咖啡屋 - 交互式界面")
@@ -172,6 +179,7 @@ func (ui *UserInterface) handleAgentTask(input string) error {
 		CreatedAt:  time.Now(),
 		RetryCount: 0,
 		MaxRetries: 3,
+		Routing:    ui.routing,
 	}
 
 	// 发送到 Redis
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 工作进程内的并发执行：
+//   - 每个正在执行的任务占用一个槽位，最多 concurrency 个
+//   - 等待同会话前序任务的消息不占用槽位，但占用一个排队名额（同样最多 concurrency 个），开始执行时换成槽位
+//   - 槽位或排队名额用完时不再读取，消息留在 Stream 中，可以被同一只猫猫的其他工作进程读取
+//   - 同一会话的任务按读取顺序串行执行，不同会话的任务并行执行
+
+// processMessages 占到排队名额和空闲槽位后读取一条消息并交给对应会话执行
+func (w *AgentWorker) processMessages() error {
+	select {
+	case w.waiting <- struct{}{}:
+	case <-w.ctx.Done():
+		return nil
+	}
+	select {
+	case w.slots <- struct{}{}:
+	case <-w.ctx.Done():
+		<-w.waiting
+		return nil
+	}
+
+	// 从消费者组读取消息
+	streams, err := w.redisClient.XReadGroup(w.ctx, &redis.XReadGroupArgs{
+		Group:    w.consumerGroup,
+		Consumer: w.consumerName,
+		Streams:  []string{w.streamKey, ">"},
+		Count:    1,
+		Block:    1 * time.Second,
+	}).Result()
+
+	if err != nil {
+		<-w.slots
+		<-w.waiting
+		if err == redis.Nil {
+			return nil // 没有新消息
+		}
+		return err
+	}
+
+	if len(streams) == 0 || len(streams[0].Messages) == 0 {
+		<-w.slots
+		<-w.waiting
+		return nil
+	}
+	w.dispatch(streams[0].Messages[0])
+	return nil
+}
+
+// dispatch 会话没有正在执行的任务时立即开始执行（归还排队名额），
+// 否则排在该会话之后（归还槽位，保留排队名额）
+func (w *AgentWorker) dispatch(message redis.XMessage) {
+	lane := messageLane(message)
+
+	w.lanesMu.Lock()
+	if queue, running := w.lanes[lane]; running {
+		w.lanes[lane] = append(queue, message)
+		w.lanesMu.Unlock()
+		<-w.slots
+		LogInfo("[Agent-%s] 会话 %s 有任务正在执行，消息 %s 排队（前面 %d 条）", w.config.Name, lane, message.ID, len(queue)+1)
+		return
+	}
+	w.lanes[lane] = nil
+	w.lanesMu.Unlock()
+	<-w.waiting
+
+	w.tasks.Add(1)
+	go w.runLane(lane, message)
+}
+
+// runLane 依次执行一个会话的消息，每条结束后释放其槽位，下一条开始前重新占用槽位，队列为空时退出
+func (w *AgentWorker) runLane(lane string, message redis.XMessage) {
+	defer w.tasks.Done()
+	for {
+		w.processMessage(message)
+		<-w.slots
+
+		w.lanesMu.Lock()
+		queue := w.lanes[lane]
+		if len(queue) == 0 || w.ctx.Err() != nil {
+			// 工作进程退出时未执行的消息不确认，留在消费者组的待处理列表中
+			delete(w.lanes, lane)
+			w.lanesMu.Unlock()
+			return
+		}
+		message, w.lanes[lane] = queue[0], queue[1:]
+		w.lanesMu.Unlock()
+
+		select {
+		case w.slots <- struct{}{}:
+			<-w.waiting
+		case <-w.ctx.Done():
+			// 工作进程退出，消息同样留在待处理列表中
+			w.lanesMu.Lock()
+			delete(w.lanes, lane)
+			w.lanesMu.Unlock()
+			return
+		}
+	}
+}
+
+// processMessage 执行一条消息：成功时确认，失败时在原位重试（同一会话的后续消息等待重试结束）
+func (w *AgentWorker) processMessage(message redis.XMessage) {
+	for {
+		err := w.handleMessage(message)
+		if err == nil {
+			w.redisClient.XAck(w.ctx, w.streamKey, w.consumerGroup, message.ID)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "处理消息 %s 失败: %v\n", message.ID, err)
+
+		// 工作进程退出时不再重试，消息留在消费者组的待处理列表中
+		if w.ctx.Err() != nil {
+			return
+		}
+		var retry bool
+		if message, retry = w.retryMessage(message, err); !retry {
+			return
+		}
+	}
+}
+
+// messageLane 消息的串行执行键：会话任务按会话 ID 串行，无会话或无法解析的消息各自独立
+func messageLane(message redis.XMessage) string {
+	if data, ok := message.Values["task"].(string); ok {
+		var task struct {
+			SessionID string `json:"session_id"`
+		}
+		if json.Unmarshal([]byte(data), &task) == nil && task.SessionID != "" {
+			return task.SessionID
+		}
+	}
+	return "message:" + message.ID
+}
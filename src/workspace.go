@@ -41,6 +41,7 @@ type Workspace struct {
 	TestCmd     string        `json:"test_cmd"`
 	StartCmd    string        `json:"start_cmd"`
 	HealthCheck string        `json:"health_check"`
+	Isolation   string        `json:"isolation,omitempty"` // 隔离模式（见 worktree.go），为空时猫猫直接修改工作区
 	State       string        `json:"state"`
 	CreatedAt   time.Time     `json:"created_at"`
 	UpdatedAt   time.Time     `json:"updated_at"`
@@ -159,6 +160,24 @@ func (wm *WorkspaceManager) GetWorkspace(workspaceID string) (*Workspace, error)
 	return workspace, nil
 }
 
+// ReloadWorkspace 从 Redis 重新读取工作区
+// Agent 工作进程只在启动时加载工作区，执行任务前据此获取 API 服务器之后创建或修改的配置
+func (wm *WorkspaceManager) ReloadWorkspace(workspaceID string) (*Workspace, error) {
+	data, err := wm.redisClient.Get(wm.ctx, fmt.Sprintf("workspace:%s", workspaceID)).Result()
+	if err != nil {
+		return wm.GetWorkspace(workspaceID)
+	}
+	var workspace Workspace
+	if err := json.Unmarshal([]byte(data), &workspace); err != nil {
+		return wm.GetWorkspace(workspaceID)
+	}
+
+	wm.mu.Lock()
+	wm.workspaces[workspace.ID] = &workspace
+	wm.mu.Unlock()
+	return &workspace, nil
+}
+
 // ListWorkspaces 列出所有工作区
 func (wm *WorkspaceManager) ListWorkspaces() []*Workspace {
 	wm.mu.RLock()
@@ -182,6 +201,14 @@ func (wm *WorkspaceManager) UpdateWorkspace(workspaceID string, updates map[stri
 		return nil, fmt.Errorf("工作区不存在: %s", workspaceID)
 	}
 
+	// 先校验，避免只更新了一部分字段
+	isolation, hasIsolation := updates["isolation"].(string)
+	if hasIsolation {
+		if err := validateIsolation(isolation); err != nil {
+			return nil, err
+		}
+	}
+
 	// 更新字段
 	if buildCmd, ok := updates["build_cmd"].(string); ok {
 		workspace.BuildCmd = buildCmd
@@ -195,6 +222,9 @@ func (wm *WorkspaceManager) UpdateWorkspace(workspaceID string, updates map[stri
 	if healthCheck, ok := updates["health_check"].(string); ok {
 		workspace.HealthCheck = healthCheck
 	}
+	if hasIsolation {
+		workspace.Isolation = isolation
+	}
 
 	workspace.UpdatedAt = time.Now()
 
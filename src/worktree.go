@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 工作区隔离模式（Workspace.Isolation）
+const (
+	WorkspaceIsolationShared  = ""        // 默认：所有猫猫直接修改工作区目录
+	WorkspaceIsolationTask    = "task"    // 每个任务一个 git worktree 和分支
+	WorkspaceIsolationSession = "session" // 每只猫猫在每个会话中一个 worktree，同一会话的后续任务继续在上面修改
+)
+
+// 隔离分支状态
+const (
+	WorktreeStatusRunning = "running" // 猫猫正在分支上执行任务
+	WorktreeStatusReady   = "ready"   // 任务已结束，等待合并或丢弃
+)
+
+// worktreeDiffLimit 结果中附带的 diff 最大字节数（完整 diff 可在 worktree 中查看）
+const worktreeDiffLimit = 64 * 1024
+
+var (
+	// ErrWorktreeUnavailable 隔离模式下无法准备 worktree（不是 git 仓库等），任务不重试
+	ErrWorktreeUnavailable = errors.New("无法创建隔离工作目录")
+	// ErrWorktreeNotFound 隔离分支不存在（已合并或丢弃）
+	ErrWorktreeNotFound = errors.New("隔离分支不存在")
+	// ErrWorktreeBusy 猫猫正在隔离分支上执行任务
+	ErrWorktreeBusy = errors.New("猫猫正在该分支上执行任务")
+	// ErrWorktreeConflict 合并到工作区时发生冲突（已中止合并，工作区保持不变）
+	ErrWorktreeConflict = errors.New("合并冲突")
+)
+
+// Worktree 隔离模式下猫猫执行任务的 git worktree 和分支，保存在 Redis 中直到合并或丢弃
+type Worktree struct {
+	ID            string    `json:"id"`
+	WorkspaceID   string    `json:"workspaceId"`
+	AgentName     string    `json:"agentName"`
+	SessionID     string    `json:"sessionId,omitempty"`
+	TaskID        string    `json:"taskId"` // 最近一次在分支上执行的任务
+	Branch        string    `json:"branch"`
+	Path          string    `json:"path"`
+	Base          string    `json:"base"`             // 创建分支时工作区的 HEAD
+	Commit        string    `json:"commit,omitempty"` // 分支最新提交
+	Status        string    `json:"status"`
+	Changed       bool      `json:"changed"`            // 相对 base 是否有修改
+	DiffStat      string    `json:"diffStat,omitempty"` // git diff --stat
+	Diff          string    `json:"diff,omitempty"`
+	DiffTruncated bool      `json:"diffTruncated,omitempty"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// validateIsolation 校验工作区隔离模式
+func validateIsolation(isolation string) error {
+	switch isolation {
+	case WorkspaceIsolationShared, WorkspaceIsolationTask, WorkspaceIsolationSession:
+		return nil
+	}
+	return fmt.Errorf("未知的隔离模式: %s（可选: %s, %s，留空表示不隔离）", isolation, WorkspaceIsolationTask, WorkspaceIsolationSession)
+}
+
+// worktreeID 隔离分支的 ID：task 模式为任务 ID，session 模式为会话 ID + 猫猫名字（无会话的任务按任务隔离）
+func worktreeID(isolation string, task *TaskMessage) string {
+	if isolation == WorkspaceIsolationSession && task.SessionID != "" {
+		return fmt.Sprintf("session_%s_%s", task.SessionID, task.AgentName)
+	}
+	return task.TaskID
+}
+
+// worktreeBranch 隔离分支名
+func worktreeBranch(id string) string {
+	return "cat-cafe/" + id
+}
+
+// worktreeKey 工作区的隔离分支记录（Redis Hash，字段为分支 ID）
+func worktreeKey(workspaceID string) string {
+	return fmt.Sprintf("worktrees:%s", workspaceID)
+}
+
+// runGit 在 dir 中执行 git 命令，返回去掉首尾空白的标准输出；失败时错误中带上标准错误输出
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// gitIdentity 提交时使用的身份（不依赖机器上的 git 全局配置）
+func gitIdentity(name string) []string {
+	return []string{"-c", "user.name=" + name, "-c", "user.email=cat-cafe@localhost"}
+}
+
+// worktreeRoot 存放隔离 worktree 的目录：位于仓库的 .git 目录下，不会出现在工作区的未跟踪文件中
+func worktreeRoot(repo string) (string, error) {
+	gitDir, err := runGit(repo, "rev-parse", "--git-common-dir")
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(repo, gitDir)
+	}
+	return filepath.Join(gitDir, "cat-cafe-worktrees"), nil
+}
+
+// PrepareWorktree 为任务准备隔离的 worktree；工作区未开启隔离时返回 nil
+// session 模式下同一会话中同一只猫猫的任务复用已有的 worktree
+func (wm *WorkspaceManager) PrepareWorktree(workspace *Workspace, task *TaskMessage) (*Worktree, error) {
+	if workspace.Isolation == WorkspaceIsolationShared {
+		return nil, nil
+	}
+
+	id := worktreeID(workspace.Isolation, task)
+	wt, err := wm.loadWorktree(workspace.ID, id)
+	if err != nil && !errors.Is(err, ErrWorktreeNotFound) {
+		return nil, err
+	}
+	if wt != nil {
+		if _, statErr := os.Stat(wt.Path); statErr != nil {
+			wt = nil // worktree 目录已被手动删除，重新创建
+		}
+	}
+
+	if wt == nil {
+		base, err := runGit(workspace.Path, "rev-parse", "HEAD")
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrWorktreeUnavailable, err)
+		}
+		root, err := worktreeRoot(workspace.Path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrWorktreeUnavailable, err)
+		}
+		wt = &Worktree{
+			ID:          id,
+			WorkspaceID: workspace.ID,
+			AgentName:   task.AgentName,
+			SessionID:   task.SessionID,
+			Branch:      worktreeBranch(id),
+			Path:        filepath.Join(root, id),
+			Base:        base,
+		}
+
+		// 分支已存在（worktree 目录被删除）时检出原分支，保留之前的修改
+		args := []string{"worktree", "add", "-b", wt.Branch, wt.Path, base}
+		if _, err := runGit(workspace.Path, "rev-parse", "--verify", "--quiet", "refs/heads/"+wt.Branch); err == nil {
+			args = []string{"worktree", "add", wt.Path, wt.Branch}
+		}
+		if _, err := runGit(workspace.Path, args...); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrWorktreeUnavailable, err)
+		}
+		LogInfo("[Workspace] 已创建隔离分支: %s (%s)", wt.Branch, wt.Path)
+	}
+
+	wt.TaskID = task.TaskID
+	wt.Status = WorktreeStatusRunning
+	wt.UpdatedAt = time.Now()
+	if err := wm.saveWorktree(wt); err != nil {
+		LogWarn("[Workspace] 保存隔离分支记录失败: %v", err)
+	}
+	return wt, nil
+}
+
+// FinishWorktree 任务结束后提交猫猫在 worktree 中的修改，并计算相对 base 的 diff
+// 失败只记录日志：修改仍在 worktree 中，可以手动处理
+func (wm *WorkspaceManager) FinishWorktree(wt *Worktree) {
+	if _, err := runGit(wt.Path, "add", "-A"); err != nil {
+		LogWarn("[Workspace] 暂存 %s 的修改失败: %v", wt.Branch, err)
+	} else if _, err := runGit(wt.Path, "diff", "--cached", "--quiet"); err != nil {
+		// 有未提交的修改（CLI 自己提交过的不会再出现在这里）
+		message := fmt.Sprintf("%s: %s", wt.AgentName, wt.TaskID)
+		args := append(gitIdentity(wt.AgentName), "commit", "--quiet", "--no-verify", "-m", message)
+		if _, err := runGit(wt.Path, args...); err != nil {
+			LogWarn("[Workspace] 提交 %s 的修改失败: %v", wt.Branch, err)
+		}
+	}
+
+	if commit, err := runGit(wt.Path, "rev-parse", "HEAD"); err == nil {
+		wt.Commit = commit
+	}
+	wt.DiffStat, _ = runGit(wt.Path, "diff", "--stat", wt.Base, "HEAD")
+	wt.Changed = wt.DiffStat != ""
+	wt.Diff, wt.DiffTruncated = "", false
+	if wt.Changed {
+		if diff, err := runGit(wt.Path, "diff", wt.Base, "HEAD"); err == nil {
+			wt.Diff, wt.DiffTruncated = truncateDiff(diff, worktreeDiffLimit)
+		}
+	}
+
+	wt.Status = WorktreeStatusReady
+	wt.UpdatedAt = time.Now()
+	if err := wm.saveWorktree(wt); err != nil {
+		LogWarn("[Workspace] 保存隔离分支记录失败: %v", err)
+	}
+}
+
+// truncateDiff 截断过长的 diff（按行截断，避免截断在多字节字符中间）
+func truncateDiff(diff string, limit int) (string, bool) {
+	if len(diff) <= limit {
+		return diff, false
+	}
+	cut := strings.LastIndex(diff[:limit], "\n")
+	if cut < 0 {
+		cut = 0
+	}
+	return diff[:cut], true
+}
+
+// ListWorktrees 列出工作区中等待合并或丢弃的隔离分支
+func (wm *WorkspaceManager) ListWorktrees(workspaceID string) ([]*Worktree, error) {
+	values, err := wm.redisClient.HGetAll(wm.ctx, worktreeKey(workspaceID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	worktrees := make([]*Worktree, 0, len(values))
+	for _, data := range values {
+		var wt Worktree
+		if err := json.Unmarshal([]byte(data), &wt); err != nil {
+			continue
+		}
+		worktrees = append(worktrees, &wt)
+	}
+	sort.Slice(worktrees, func(i, j int) bool { return worktrees[i].UpdatedAt.Before(worktrees[j].UpdatedAt) })
+	return worktrees, nil
+}
+
+// MergeWorktree 将隔离分支合并到工作区当前分支（--no-ff），成功后删除 worktree 和分支
+// 发生冲突时中止合并，工作区保持不变
+func (wm *WorkspaceManager) MergeWorktree(workspaceID, id string) (*Worktree, error) {
+	workspace, wt, err := wm.readyWorktree(workspaceID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	message := fmt.Sprintf("合并 %s 的修改（%s）", wt.AgentName, wt.Branch)
+	args := append(gitIdentity("cat-cafe"), "merge", "--no-ff", "--no-edit", "-m", message, wt.Branch)
+	if _, err := runGit(workspace.Path, args...); err != nil {
+		conflicts, _ := runGit(workspace.Path, "diff", "--name-only", "--diff-filter=U")
+		if conflicts != "" {
+			if _, abortErr := runGit(workspace.Path, "merge", "--abort"); abortErr != nil {
+				LogWarn("[Workspace] 中止合并失败: %v", abortErr)
+			}
+			return nil, fmt.Errorf("%w: %s", ErrWorktreeConflict, strings.Join(strings.Fields(conflicts), ", "))
+		}
+		return nil, err
+	}
+	LogInfo("[Workspace] 已合并隔离分支: %s -> %s", wt.Branch, workspace.Path)
+
+	wm.removeWorktree(workspace, wt)
+	return wt, nil
+}
+
+// DiscardWorktree 丢弃隔离分支：删除 worktree 和分支，修改不会进入工作区
+func (wm *WorkspaceManager) DiscardWorktree(workspaceID, id string) (*Worktree, error) {
+	workspace, wt, err := wm.readyWorktree(workspaceID, id)
+	if err != nil {
+		return nil, err
+	}
+	wm.removeWorktree(workspace, wt)
+	LogInfo("[Workspace] 已丢弃隔离分支: %s", wt.Branch)
+	return wt, nil
+}
+
+// readyWorktree 查找等待合并或丢弃的隔离分支
+func (wm *WorkspaceManager) readyWorktree(workspaceID, id string) (*Workspace, *Worktree, error) {
+	workspace, err := wm.GetWorkspace(workspaceID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrWorktreeNotFound, err)
+	}
+	wt, err := wm.loadWorktree(workspaceID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if wt.Status == WorktreeStatusRunning {
+		return nil, nil, fmt.Errorf("%w: %s (%s)", ErrWorktreeBusy, wt.Branch, wt.TaskID)
+	}
+	return workspace, wt, nil
+}
+
+// removeWorktree 删除 worktree 目录、分支和记录（失败只记录日志）
+func (wm *WorkspaceManager) removeWorktree(workspace *Workspace, wt *Worktree) {
+	if _, err := runGit(workspace.Path, "worktree", "remove", "--force", wt.Path); err != nil {
+		LogWarn("[Workspace] 删除 worktree 失败: %v", err)
+	}
+	if _, err := runGit(workspace.Path, "branch", "-D", wt.Branch); err != nil {
+		LogWarn("[Workspace] 删除分支失败: %v", err)
+	}
+	if err := wm.redisClient.HDel(wm.ctx, worktreeKey(workspace.ID), wt.ID).Err(); err != nil {
+		LogWarn("[Workspace] 删除隔离分支记录失败: %v", err)
+	}
+}
+
+func (wm *WorkspaceManager) saveWorktree(wt *Worktree) error {
+	data, err := json.Marshal(wt)
+	if err != nil {
+		return err
+	}
+	return wm.redisClient.HSet(wm.ctx, worktreeKey(wt.WorkspaceID), wt.ID, data).Err()
+}
+
+func (wm *WorkspaceManager) loadWorktree(workspaceID, id string) (*Worktree, error) {
+	data, err := wm.redisClient.HGet(wm.ctx, worktreeKey(workspaceID), id).Result()
+	if err == redis.Nil {
+		return nil, fmt.Errorf("%w: %s", ErrWorktreeNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var wt Worktree
+	if err := json.Unmarshal([]byte(data), &wt); err != nil {
+		return nil, err
+	}
+	return &wt, nil
+}
+
+// worktreeNotice 猫猫在隔离分支上修改了文件时的系统消息
+func worktreeNotice(task *TaskMessage) string {
+	wt := task.Worktree
+	stat := wt.DiffStat
+	if lines := strings.Split(stat, "\n"); len(lines) > 0 {
+		stat = strings.TrimSpace(lines[len(lines)-1]) // 汇总行，如 "3 files changed, 10 insertions(+)"
+	}
+	return fmt.Sprintf("🌿 %s 的修改在分支 %s（%s），可以合并到工作区或丢弃", task.AgentName, wt.Branch, stat)
+}
@@ -0,0 +1,161 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Agent 调用选项简化版本用于测试（从 invoke.go / cli_adapter.go / agent_options.go 复制）
+
+type AgentOptions struct {
+	Model           string
+	AllowedTools    string
+	DisallowedTools string
+	PermissionMode  string
+	ApprovalMode    string
+	ExtraArgs       []string
+	Env             map[string]string
+}
+
+func mergeAgentOptions(base, overrides AgentOptions) AgentOptions {
+	merged := base
+	if overrides.Model != "" {
+		merged.Model = overrides.Model
+	}
+	if overrides.AllowedTools != "" {
+		merged.AllowedTools = overrides.AllowedTools
+	}
+	if overrides.DisallowedTools != "" {
+		merged.DisallowedTools = overrides.DisallowedTools
+	}
+	if overrides.PermissionMode != "" {
+		merged.PermissionMode = overrides.PermissionMode
+	}
+	if overrides.ApprovalMode != "" {
+		merged.ApprovalMode = overrides.ApprovalMode
+	}
+	if len(overrides.ExtraArgs) > 0 {
+		merged.ExtraArgs = overrides.ExtraArgs
+	}
+	if len(overrides.Env) > 0 {
+		env := make(map[string]string, len(base.Env)+len(overrides.Env))
+		for name, value := range base.Env {
+			env[name] = value
+		}
+		for name, value := range overrides.Env {
+			env[name] = value
+		}
+		merged.Env = env
+	}
+	return merged
+}
+
+func agentInvokeOptions(c AgentConfig) AgentOptions {
+	return AgentOptions{
+		Model:           c.Model,
+		PermissionMode:  c.PermissionMode,
+		ApprovalMode:    c.ApprovalMode,
+		AllowedTools:    strings.Join(c.AllowedTools, ","),
+		DisallowedTools: strings.Join(c.DeniedTools, ","),
+		ExtraArgs:       c.ExtraArgs,
+		Env:             c.Env,
+	}
+}
+
+var claudeDefaultOptions = AgentOptions{
+	AllowedTools: "mcp__hindsight__*,mcp__session-chain__*,mcp__github__*,mcp__figma__*,mcp__ide__*",
+}
+
+// claude 适配器生成的参数（agent_options.go 中由 reservedCLIFlags 从 BuildCommand 推导）
+var claudeReservedFlags = map[string]bool{
+	"-p": true, "--output-format": true, "--verbose": true, "--model": true, "--resume": true,
+	"--allowedTools": true, "--disallowedTools": true, "--permission-mode": true, "--mcp-config": true,
+}
+
+func validateClaudeOptions(c AgentConfig) error {
+	permissionModes := []string{"default", "acceptEdits", "plan", "bypassPermissions"}
+	if c.PermissionMode != "" {
+		valid := false
+		for _, mode := range permissionModes {
+			valid = valid || mode == c.PermissionMode
+		}
+		if !valid {
+			return fmt.Errorf("permission_mode 取值无效: %s", c.PermissionMode)
+		}
+	}
+	if c.ApprovalMode != "" {
+		return fmt.Errorf("cli_type claude 不支持 approval_mode")
+	}
+	for _, arg := range c.ExtraArgs {
+		flag, _, _ := strings.Cut(arg, "=")
+		if arg == "" || claudeReservedFlags[flag] {
+			return fmt.Errorf("extra_args 不能包含 %s", flag)
+		}
+	}
+	return nil
+}
+
+// TestAgentOptionsFromConfig 测试 config.yaml 中的选项覆盖默认值，未配置的项保留默认值
+func TestAgentOptionsFromConfig(t *testing.T) {
+	data := `
+name: "花花"
+cli_type: "claude"
+model: "claude-sonnet-4-5"
+denied_tools: ["Bash(rm:*)", "WebFetch"]
+extra_args: ["--max-turns", "20"]
+env:
+  ANTHROPIC_BASE_URL: "http://localhost:8080"
+`
+	var agent AgentConfig
+	if err := yaml.Unmarshal([]byte(data), &agent); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if err := validateClaudeOptions(agent); err != nil {
+		t.Fatalf("Expected valid options, got %v", err)
+	}
+
+	base := claudeDefaultOptions
+	base.Env = map[string]string{"KEEP": "1"}
+	options := mergeAgentOptions(base, agentInvokeOptions(agent))
+
+	if options.Model != "claude-sonnet-4-5" || options.DisallowedTools != "Bash(rm:*),WebFetch" {
+		t.Errorf("Configured options not applied: %+v", options)
+	}
+	if options.PermissionMode != "" || options.AllowedTools != claudeDefaultOptions.AllowedTools {
+		t.Errorf("Unconfigured options should keep defaults: %+v", options)
+	}
+	if len(options.ExtraArgs) != 2 || options.ExtraArgs[1] != "20" {
+		t.Errorf("Unexpected extra args: %v", options.ExtraArgs)
+	}
+	if options.Env["KEEP"] != "1" || options.Env["ANTHROPIC_BASE_URL"] != "http://localhost:8080" {
+		t.Errorf("Env should merge over defaults: %v", options.Env)
+	}
+}
+
+// TestAgentOptionsValidation 测试非法取值、不支持的选项和与适配器参数冲突的 extra_args 被拒绝
+func TestAgentOptionsValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		agent AgentConfig
+	}{
+		{"unknown permission mode", AgentConfig{PermissionMode: "yolo"}},
+		{"approval mode on claude", AgentConfig{ApprovalMode: "auto_edit"}},
+		{"reserved flag", AgentConfig{ExtraArgs: []string{"--output-format", "text"}}},
+		{"reserved flag with value", AgentConfig{ExtraArgs: []string{"--resume=abc"}}},
+		{"empty arg", AgentConfig{ExtraArgs: []string{""}}},
+	}
+	for _, tt := range tests {
+		tt.agent.CLIType = "claude"
+		if err := validateClaudeOptions(tt.agent); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+
+	ok := AgentConfig{CLIType: "claude", PermissionMode: "plan", ExtraArgs: []string{"--max-turns", "5"}}
+	if err := validateClaudeOptions(ok); err != nil {
+		t.Errorf("Expected valid options, got %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+package test
+
+import "testing"
+
+// 预算计算简化版本用于测试（从 budget.go 复制）
+
+const (
+	BudgetScopeSession = "session"
+	BudgetScopeCat     = "cat"
+	BudgetScopeDaily   = "daily"
+
+	BudgetLevelWarning  = "warning"
+	BudgetLevelExceeded = "exceeded"
+
+	defaultBudgetWarnAt = 0.8
+)
+
+type BudgetLimit struct {
+	MaxCostUSD float64
+	MaxTokens  int64
+}
+
+func (l BudgetLimit) Unlimited() bool {
+	return l.MaxCostUSD <= 0 && l.MaxTokens <= 0
+}
+
+type BudgetConfig struct {
+	Session BudgetLimit
+	PerCat  BudgetLimit
+	Daily   BudgetLimit
+	WarnAt  float64
+}
+
+func (c *BudgetConfig) warnAt() float64 {
+	if c == nil || c.WarnAt <= 0 || c.WarnAt >= 1 {
+		return defaultBudgetWarnAt
+	}
+	return c.WarnAt
+}
+
+type BudgetStatus struct {
+	Scope       string
+	CatName     string
+	Limit       BudgetLimit
+	UsedCostUSD float64
+	UsedTokens  int64
+	Ratio       float64
+}
+
+func (s BudgetStatus) Exceeded() bool {
+	return s.Ratio >= 1
+}
+
+func newBudgetStatus(scope, catName string, limit BudgetLimit, used UsageTotals) BudgetStatus {
+	status := BudgetStatus{
+		Scope:       scope,
+		CatName:     catName,
+		Limit:       limit,
+		UsedCostUSD: used.CostUSD,
+		UsedTokens:  used.TokensIn + used.TokensOut,
+	}
+	if limit.MaxCostUSD > 0 {
+		status.Ratio = status.UsedCostUSD / limit.MaxCostUSD
+	}
+	if limit.MaxTokens > 0 {
+		if ratio := float64(status.UsedTokens) / float64(limit.MaxTokens); ratio > status.Ratio {
+			status.Ratio = ratio
+		}
+	}
+	return status
+}
+
+func budgetLevel(status BudgetStatus, warnAt float64) string {
+	switch {
+	case status.Limit.Unlimited():
+		return ""
+	case status.Exceeded():
+		return BudgetLevelExceeded
+	case status.Ratio >= warnAt:
+		return BudgetLevelWarning
+	}
+	return ""
+}
+
+func budgetScopeKey(scope, sessionID, catName, date string) string {
+	switch scope {
+	case BudgetScopeSession:
+		return "session:" + sessionID
+	case BudgetScopeCat:
+		return "cat:" + catName + ":" + date
+	default:
+		return "daily:" + date
+	}
+}
+
+type UpdateBudgetRequest struct {
+	MaxCostUSD *float64
+	MaxTokens  *int64
+}
+
+func (r UpdateBudgetRequest) apply(current BudgetLimit) BudgetLimit {
+	limit := current
+	if r.MaxCostUSD != nil {
+		limit.MaxCostUSD = *r.MaxCostUSD
+	}
+	if r.MaxTokens != nil {
+		limit.MaxTokens = *r.MaxTokens
+	}
+	return limit
+}
+
+// TestBudgetStatusRatio 测试费用和 token 两项上限取较大的使用比例
+func TestBudgetStatusRatio(t *testing.T) {
+	used := UsageTotals{TokensIn: 7000, TokensOut: 1000, CostUSD: 1.0}
+
+	costOnly := newBudgetStatus(BudgetScopeSession, "", BudgetLimit{MaxCostUSD: 4}, used)
+	if !almostEqual(costOnly.Ratio, 0.25) || costOnly.UsedTokens != 8000 {
+		t.Errorf("Unexpected cost-only status: %+v", costOnly)
+	}
+
+	both := newBudgetStatus(BudgetScopeSession, "", BudgetLimit{MaxCostUSD: 4, MaxTokens: 10000}, used)
+	if !almostEqual(both.Ratio, 0.8) {
+		t.Errorf("Token ratio should dominate, got %v", both.Ratio)
+	}
+
+	unlimited := newBudgetStatus(BudgetScopeDaily, "", BudgetLimit{}, used)
+	if unlimited.Ratio != 0 || unlimited.Exceeded() {
+		t.Errorf("Unlimited budget should never be exceeded: %+v", unlimited)
+	}
+}
+
+// TestBudgetLevel 测试提醒级别：达到阈值提醒，用尽后为 exceeded，不限制时不提醒
+func TestBudgetLevel(t *testing.T) {
+	limit := BudgetLimit{MaxCostUSD: 10}
+	cases := []struct {
+		cost float64
+		want string
+	}{
+		{cost: 5, want: ""},
+		{cost: 8, want: BudgetLevelWarning},
+		{cost: 9.99, want: BudgetLevelWarning},
+		{cost: 10, want: BudgetLevelExceeded},
+		{cost: 12, want: BudgetLevelExceeded},
+	}
+	for _, tc := range cases {
+		status := newBudgetStatus(BudgetScopeSession, "", limit, UsageTotals{CostUSD: tc.cost})
+		if got := budgetLevel(status, defaultBudgetWarnAt); got != tc.want {
+			t.Errorf("cost %v: expected level %q, got %q", tc.cost, tc.want, got)
+		}
+	}
+
+	if got := budgetLevel(newBudgetStatus(BudgetScopeDaily, "", BudgetLimit{}, UsageTotals{CostUSD: 100}), 0.8); got != "" {
+		t.Errorf("Unlimited budget should not warn, got %q", got)
+	}
+}
+
+// TestBudgetWarnAtDefault 测试 warn_at 未配置或超出 (0, 1) 时使用默认值
+func TestBudgetWarnAtDefault(t *testing.T) {
+	var nilConfig *BudgetConfig
+	for _, cfg := range []*BudgetConfig{nilConfig, {}, {WarnAt: 1.5}} {
+		if got := cfg.warnAt(); got != defaultBudgetWarnAt {
+			t.Errorf("Expected default warn_at, got %v", got)
+		}
+	}
+	if got := (&BudgetConfig{WarnAt: 0.5}).warnAt(); got != 0.5 {
+		t.Errorf("Expected configured warn_at, got %v", got)
+	}
+}
+
+// TestBudgetScopeKey 测试按天计算的范围带日期，会话范围不带
+func TestBudgetScopeKey(t *testing.T) {
+	if got := budgetScopeKey(BudgetScopeSession, "sess_1", "花花", "2026-03-01"); got != "session:sess_1" {
+		t.Errorf("Unexpected session key: %s", got)
+	}
+	if got := budgetScopeKey(BudgetScopeCat, "sess_1", "花花", "2026-03-01"); got != "cat:花花:2026-03-01" {
+		t.Errorf("Unexpected cat key: %s", got)
+	}
+	if got := budgetScopeKey(BudgetScopeDaily, "sess_1", "花花", "2026-03-01"); got != "daily:2026-03-01" {
+		t.Errorf("Unexpected daily key: %s", got)
+	}
+}
+
+// TestUpdateBudgetRequestApply 测试只覆盖请求中传入的字段，其余保持当前上限
+func TestUpdateBudgetRequestApply(t *testing.T) {
+	current := BudgetLimit{MaxCostUSD: 5, MaxTokens: 100000}
+
+	cost := 10.0
+	if got := (UpdateBudgetRequest{MaxCostUSD: &cost}).apply(current); got != (BudgetLimit{MaxCostUSD: 10, MaxTokens: 100000}) {
+		t.Errorf("Token limit should be kept, got %+v", got)
+	}
+
+	var noTokenLimit int64
+	if got := (UpdateBudgetRequest{MaxTokens: &noTokenLimit}).apply(current); got != (BudgetLimit{MaxCostUSD: 5}) {
+		t.Errorf("Cost limit should be kept and tokens unlimited, got %+v", got)
+	}
+}
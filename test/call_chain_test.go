@@ -0,0 +1,148 @@
+package test
+
+import (
+	"strings"
+	"testing"
+)
+
+// 调用链限制简化版本用于测试（从 call_chain.go 复制）
+
+type CallChain struct {
+	RootMsgID string
+	Hop       int
+	Path      []string
+}
+
+func (c *CallChain) Extend(agentName string) *CallChain {
+	if c == nil {
+		return &CallChain{Hop: 1, Path: []string{agentName}}
+	}
+	path := make([]string, len(c.Path), len(c.Path)+1)
+	copy(path, c.Path)
+	return &CallChain{RootMsgID: c.RootMsgID, Hop: c.Hop + 1, Path: append(path, agentName)}
+}
+
+func (c *CallChain) Current() string {
+	if c == nil || len(c.Path) == 0 {
+		return ""
+	}
+	return c.Path[len(c.Path)-1]
+}
+
+type LoopLimits struct {
+	MaxHops        int
+	MaxInvocations int
+	MaxPairRepeats int
+}
+
+type loopCounter struct {
+	Invocations int
+	Pairs       map[string]int
+}
+
+func pairKey(a, b string) string {
+	if a > b {
+		a, b = b, a
+	}
+	return a + "↔" + b
+}
+
+func (c *loopCounter) check(limits LoopLimits, chain *CallChain, caller string) string {
+	if limits.MaxHops > 0 && chain.Hop > limits.MaxHops {
+		return "max_hops"
+	}
+	if limits.MaxInvocations > 0 && c.Invocations >= limits.MaxInvocations {
+		return "max_invocations"
+	}
+	if limits.MaxPairRepeats > 0 && caller != "" && c.Pairs[pairKey(caller, chain.Current())] >= limits.MaxPairRepeats {
+		return "max_pair_repeats"
+	}
+	return ""
+}
+
+func (c *loopCounter) record(chain *CallChain, caller string) {
+	c.Invocations++
+	if caller != "" {
+		c.Pairs[pairKey(caller, chain.Current())]++
+	}
+}
+
+// TestCallChainExtend 测试派生调用链不修改上游
+func TestCallChainExtend(t *testing.T) {
+	root := &CallChain{RootMsgID: "msg_1"}
+	first := root.Extend("花花")
+	second := first.Extend("薇薇")
+
+	if first.Hop != 1 || strings.Join(first.Path, ",") != "花花" {
+		t.Errorf("Unexpected first hop: %+v", first)
+	}
+	if second.Hop != 2 || strings.Join(second.Path, ",") != "花花,薇薇" || second.RootMsgID != "msg_1" {
+		t.Errorf("Unexpected second hop: %+v", second)
+	}
+	if second.Current() != "薇薇" || root.Current() != "" {
+		t.Errorf("Unexpected current: %s / %s", second.Current(), root.Current())
+	}
+}
+
+// TestLoopGuardPingPong 测试两只猫猫互相 @ 超过次数后被截断
+func TestLoopGuardPingPong(t *testing.T) {
+	limits := LoopLimits{MaxHops: 8, MaxInvocations: 20, MaxPairRepeats: 4}
+	counter := &loopCounter{Pairs: make(map[string]int)}
+
+	chain := (&CallChain{RootMsgID: "msg_1"}).Extend("花花")
+	counter.record(chain, "")
+
+	cats := []string{"薇薇", "花花"}
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		caller := chain.Current()
+		next := chain.Extend(cats[i%2])
+		if reason := counter.check(limits, next, caller); reason != "" {
+			if reason != "max_pair_repeats" {
+				t.Errorf("Expected pair limit, got %s", reason)
+			}
+			break
+		}
+		counter.record(next, caller)
+		chain = next
+		allowed++
+	}
+
+	if allowed != 4 {
+		t.Errorf("Expected 4 calls between the pair, got %d", allowed)
+	}
+}
+
+// TestLoopGuardMaxHops 测试链路深度超过上限后被截断
+func TestLoopGuardMaxHops(t *testing.T) {
+	limits := LoopLimits{MaxHops: 3}
+	counter := &loopCounter{Pairs: make(map[string]int)}
+
+	chain := &CallChain{RootMsgID: "msg_1"}
+	for _, cat := range []string{"花花", "薇薇", "小乔"} {
+		next := chain.Extend(cat)
+		if reason := counter.check(limits, next, chain.Current()); reason != "" {
+			t.Fatalf("Unexpected cut at %s: %s", cat, reason)
+		}
+		counter.record(next, chain.Current())
+		chain = next
+	}
+
+	if reason := counter.check(limits, chain.Extend("花花"), chain.Current()); reason != "max_hops" {
+		t.Errorf("Expected max_hops, got %q", reason)
+	}
+}
+
+// TestLoopGuardMaxInvocations 测试单条消息引发的调用总数限制
+func TestLoopGuardMaxInvocations(t *testing.T) {
+	limits := LoopLimits{MaxInvocations: 2}
+	counter := &loopCounter{Pairs: make(map[string]int)}
+	root := &CallChain{RootMsgID: "msg_1"}
+
+	counter.record(root.Extend("花花"), "")
+	counter.record(root.Extend("薇薇"), "")
+
+	if reason := counter.check(limits, root.Extend("小乔"), ""); reason != "max_invocations" {
+		t.Errorf("Expected max_invocations, got %q", reason)
+	}
+}
@@ -0,0 +1,249 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 猫猫注册表简化版本用于测试（从 cat_registry.go 复制，AgentConfig 只保留注册表用到的字段）
+
+type registryCat struct {
+	Name    string `yaml:"name"`
+	ID      string `yaml:"id,omitempty"`
+	Color   string `yaml:"color,omitempty"`
+	Pipe    string `yaml:"pipe"`
+	CLIType string `yaml:"cli_type"`
+}
+
+var defaultCatColors = []string{"#ff9966", "#d9bf99", "#cccccc", "#99ccff", "#ffcc66", "#cc99ff", "#99cc99", "#ff99aa"}
+
+var defaultCatIDNumber = regexp.MustCompile(`^cat_(\d+)$`)
+
+var errCatConflict = errors.New("猫猫已存在")
+
+func fillCatDefaults(agent *registryCat, existing []registryCat) {
+	if agent.ID == "" {
+		next := 1
+		for _, other := range existing {
+			if m := defaultCatIDNumber.FindStringSubmatch(other.ID); m != nil {
+				if n, _ := strconv.Atoi(m[1]); n >= next {
+					next = n + 1
+				}
+			}
+		}
+		agent.ID = fmt.Sprintf("cat_%03d", next)
+	}
+	if agent.Color == "" {
+		used := make(map[string]bool, len(existing))
+		for _, other := range existing {
+			used[other.Color] = true
+		}
+		agent.Color = defaultCatColors[len(existing)%len(defaultCatColors)]
+		for _, color := range defaultCatColors {
+			if !used[color] {
+				agent.Color = color
+				break
+			}
+		}
+	}
+	if agent.Pipe == "" {
+		agent.Pipe = "pipe_" + agent.ID
+	}
+}
+
+func checkCatConflicts(agent registryCat, existing []registryCat) error {
+	for _, other := range existing {
+		switch {
+		case other.Name == agent.Name:
+			return fmt.Errorf("%w: 名字 %s 已被使用", errCatConflict, agent.Name)
+		case other.ID == agent.ID:
+			return fmt.Errorf("%w: ID %s 已被 %s 使用", errCatConflict, agent.ID, other.Name)
+		case other.Pipe == agent.Pipe:
+			return fmt.Errorf("%w: 管道 %s 已被 %s 使用", errCatConflict, agent.Pipe, other.Name)
+		}
+	}
+	return nil
+}
+
+func saveAgentsToConfig(path string, agents []registryCat) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("配置文件格式无效: %s", path)
+	}
+
+	var agentsNode yaml.Node
+	if err := agentsNode.Encode(agents); err != nil {
+		return err
+	}
+	root := doc.Content[0]
+	replaced := false
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "agents" {
+			root.Content[i+1] = &agentsNode
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		root.Content = append([]*yaml.Node{{Kind: yaml.ScalarNode, Value: "agents"}, &agentsNode}, root.Content...)
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+func isAPIPromptPath(path string) bool {
+	return !filepath.IsAbs(path) && strings.HasPrefix(filepath.Clean(path), "prompts"+string(filepath.Separator))
+}
+
+// TestFillCatDefaults 测试注册新猫猫时自动分配 ID、颜色和管道
+func TestFillCatDefaults(t *testing.T) {
+	existing := []registryCat{
+		{Name: "花花", ID: "cat_001", Color: "#ff9966", Pipe: "pipe_huahua"},
+		{Name: "小乔", ID: "cat_003", Color: "#cccccc", Pipe: "pipe_xiaoqiao"},
+	}
+
+	cat := registryCat{Name: "咪咪"}
+	fillCatDefaults(&cat, existing)
+	if cat.ID != "cat_004" {
+		t.Errorf("Expected the next ID after the largest number, got %s", cat.ID)
+	}
+	if cat.Color != "#d9bf99" {
+		t.Errorf("Expected the first unused color, got %s", cat.Color)
+	}
+	if cat.Pipe != "pipe_cat_004" {
+		t.Errorf("Expected the pipe to follow the ID, got %s", cat.Pipe)
+	}
+
+	// 指定的字段保持不变
+	cat = registryCat{Name: "咪咪", ID: "mimi", Color: "#000000", Pipe: "pipe_mimi"}
+	fillCatDefaults(&cat, existing)
+	if cat.ID != "mimi" || cat.Color != "#000000" || cat.Pipe != "pipe_mimi" {
+		t.Errorf("Expected explicit fields to be kept, got %+v", cat)
+	}
+}
+
+// TestCheckCatConflicts 测试名字、ID 和管道必须唯一
+func TestCheckCatConflicts(t *testing.T) {
+	existing := []registryCat{{Name: "花花", ID: "cat_001", Pipe: "pipe_huahua"}}
+
+	tests := []struct {
+		cat     registryCat
+		wantErr string
+	}{
+		{registryCat{Name: "咪咪", ID: "cat_002", Pipe: "pipe_mimi"}, ""},
+		{registryCat{Name: "花花", ID: "cat_002", Pipe: "pipe_mimi"}, "名字"},
+		{registryCat{Name: "咪咪", ID: "cat_001", Pipe: "pipe_mimi"}, "ID"},
+		{registryCat{Name: "咪咪", ID: "cat_002", Pipe: "pipe_huahua"}, "管道"},
+	}
+	for _, tt := range tests {
+		err := checkCatConflicts(tt.cat, existing)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%+v: unexpected error %v", tt.cat, err)
+			}
+			continue
+		}
+		if !errors.Is(err, errCatConflict) || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%+v: expected a %s conflict, got %v", tt.cat, tt.wantErr, err)
+		}
+	}
+}
+
+// TestSaveAgentsToConfig 测试写回配置文件时只替换 agents 段，其余配置和注释保持不变
+func TestSaveAgentsToConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	original := `agents:
+  - name: "花花"
+    pipe: "pipe_huahua"
+    cli_type: "claude"
+
+redis:
+  addr: "localhost:6379"
+
+# 声明式工作流目录
+workflows_dir: "workflows"
+`
+	if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	agents := []registryCat{
+		{Name: "花花", ID: "cat_001", Color: "#ff9966", Pipe: "pipe_huahua", CLIType: "claude"},
+		{Name: "咪咪", ID: "cat_002", Color: "#d9bf99", Pipe: "pipe_cat_002", CLIType: "codex"},
+	}
+	if err := saveAgentsToConfig(path, agents); err != nil {
+		t.Fatalf("saveAgentsToConfig failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "# 声明式工作流目录") {
+		t.Errorf("Expected comments to be kept:\n%s", data)
+	}
+
+	var config struct {
+		Agents []registryCat `yaml:"agents"`
+		Redis  struct {
+			Addr string `yaml:"addr"`
+		} `yaml:"redis"`
+		WorkflowsDir string `yaml:"workflows_dir"`
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		t.Fatalf("Saved config is not valid YAML: %v", err)
+	}
+	if len(config.Agents) != 2 || config.Agents[1] != agents[1] {
+		t.Errorf("Expected the new agent to be saved, got %+v", config.Agents)
+	}
+	if config.Redis.Addr != "localhost:6379" || config.WorkflowsDir != "workflows" {
+		t.Errorf("Expected other settings to be kept, got %+v", config)
+	}
+}
+
+// TestIsAPIPromptPath 测试通过 API 只能引用 prompts/ 下的提示词文件
+func TestIsAPIPromptPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"prompts/mimi.md", true},
+		{"./prompts/modes/ipd.md", true},
+		{"prompts/../config.yaml", false},
+		{"prompts", false},
+		{"/etc/passwd", false},
+		{"/root/module/prompts/mimi.md", false},
+		{"../prompts/mimi.md", false},
+		{"config.yaml", false},
+	}
+	for _, tt := range tests {
+		if got := isAPIPromptPath(tt.path); got != tt.want {
+			t.Errorf("isAPIPromptPath(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package test
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cat-cafe/src/agentcli"
+)
+
+// 用 testdata/cli_output 下录制的真实输出回放 agentcli 中的各个适配器
+
+// 解析结果相关类型直接使用 agentcli 包（其余测试文件中的简化副本也使用这些名称）
+type (
+	StreamEvent = agentcli.StreamEvent
+	ParseState  = agentcli.ParseState
+	ParsedLine  = agentcli.ParsedLine
+	CLIUsage    = agentcli.Usage
+)
+
+const (
+	StreamEventText      = agentcli.StreamEventText
+	StreamEventToolStart = agentcli.StreamEventToolStart
+	StreamEventToolEnd   = agentcli.StreamEventToolEnd
+)
+
+type recordedRun struct {
+	Response  string
+	SessionID string
+	Model     string
+	Tools     []StreamEvent
+	Usage     *CLIUsage
+}
+
+// replayRecorded 与 agentcli.Invoke 的拼接逻辑一致：文本按顺序拼接，会话 ID 取最后一次，用量累加
+func replayRecorded(t *testing.T, file string, adapter agentcli.Adapter) recordedRun {
+	t.Helper()
+
+	f, err := os.Open(filepath.Join("testdata", "cli_output", file))
+	if err != nil {
+		t.Fatalf("Failed to open recorded output: %v", err)
+	}
+	defer f.Close()
+	return replayOutput(f, adapter)
+}
+
+// replayOutput 逐行解析 CLI 输出
+func replayOutput(r io.Reader, adapter agentcli.Adapter) recordedRun {
+	var run recordedRun
+	state := agentcli.NewParseState()
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 1024*1024), 1024*1024)
+	for scanner.Scan() {
+		parsed := adapter.ParseLine(scanner.Text(), state)
+		if parsed.SessionID != "" {
+			run.SessionID = parsed.SessionID
+		}
+		if parsed.Model != "" {
+			run.Model = parsed.Model
+		}
+		if parsed.Usage != nil {
+			run.Usage = run.Usage.Add(parsed.Usage)
+		}
+		for _, event := range parsed.Events {
+			if event.Type == StreamEventText {
+				run.Response += event.Text
+			} else {
+				run.Tools = append(run.Tools, event)
+			}
+		}
+	}
+	return run
+}
+
+// assertTools 检查工具事件序列
+func assertTools(t *testing.T, got []StreamEvent, want []StreamEvent) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d tool events, got %d: %+v", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Tool event %d: expected %+v, got %+v", i, want[i], got[i])
+		}
+	}
+}
+
+// TestClaudeParser 测试 Claude stream-json 解析
+func TestClaudeParser(t *testing.T) {
+	run := replayRecorded(t, "claude.jsonl", agentcli.ClaudeAdapter{})
+
+	if run.SessionID != "7f3c2a10-5b1e-4c8e-9d2f-0a1b2c3d4e5f" {
+		t.Errorf("Unexpected session ID: %s", run.SessionID)
+	}
+	if run.Model != "claude-sonnet-4-5" {
+		t.Errorf("Unexpected model: %s", run.Model)
+	}
+	if run.Response != "我先看一下目录结构。项目包含 README.md 和 src 目录。" {
+		t.Errorf("Unexpected response: %q", run.Response)
+	}
+	assertTools(t, run.Tools, []StreamEvent{
+		{Type: StreamEventToolStart, Tool: "Bash", ToolID: "toolu_01A", Input: `{"command":"ls"}`},
+		{Type: StreamEventToolEnd, Tool: "Bash", ToolID: "toolu_01A", Output: "README.md\nsrc"},
+		{Type: StreamEventToolStart, Tool: "Read", ToolID: "toolu_01B", Input: `{"file_path":"missing.go"}`},
+		{Type: StreamEventToolEnd, Tool: "Read", ToolID: "toolu_01B", IsError: true, Output: "File does not exist."},
+	})
+	if run.Usage == nil || *run.Usage != (CLIUsage{InputTokens: 1812, OutputTokens: 256, CacheReadTokens: 15234, CostUSD: 0.0421}) {
+		t.Errorf("Unexpected usage: %+v", run.Usage)
+	}
+}
+
+// TestGeminiParser 测试 Gemini stream-json 解析（增量消息拼接，用户消息不计入回复）
+func TestGeminiParser(t *testing.T) {
+	run := replayRecorded(t, "gemini.jsonl", agentcli.GeminiAdapter{})
+
+	if run.SessionID != "b2c4e6f8-1a3b-4c5d-8e9f-001122334455" {
+		t.Errorf("Unexpected session ID: %s", run.SessionID)
+	}
+	if run.Model != "gemini-2.5-pro" {
+		t.Errorf("Unexpected model: %s", run.Model)
+	}
+	if run.Response != "目录里有 README.md 和 src。" {
+		t.Errorf("Unexpected response: %q", run.Response)
+	}
+	assertTools(t, run.Tools, []StreamEvent{
+		{Type: StreamEventToolStart, Tool: "list_directory", ToolID: "list_directory-1", Input: `{"path":"."}`},
+		{Type: StreamEventToolEnd, Tool: "list_directory", ToolID: "list_directory-1", Output: "README.md\nsrc"},
+	})
+	if run.Usage == nil || *run.Usage != (CLIUsage{InputTokens: 5100, OutputTokens: 130, CacheReadTokens: 2048}) {
+		t.Errorf("Unexpected usage: %+v", run.Usage)
+	}
+}
+
+// TestCodexParser 测试 Codex exec --json 解析（推理内容不计入回复，命令和 MCP 调用视为工具）
+func TestCodexParser(t *testing.T) {
+	run := replayRecorded(t, "codex.jsonl", agentcli.CodexAdapter{})
+
+	if run.SessionID != "0199a1b2-c3d4-7e5f-8a9b-0c1d2e3f4a5b" {
+		t.Errorf("Unexpected session ID: %s", run.SessionID)
+	}
+	if run.Response != "目录里有 README.md 和 src。" {
+		t.Errorf("Unexpected response: %q", run.Response)
+	}
+	assertTools(t, run.Tools, []StreamEvent{
+		{Type: StreamEventToolStart, Tool: "bash -lc ls", ToolID: "item_1", Input: "bash -lc ls"},
+		{Type: StreamEventToolEnd, Tool: "bash -lc ls", ToolID: "item_1", Input: "bash -lc ls", Output: "README.md\nsrc\n"},
+		{Type: StreamEventToolStart, Tool: "session-chain.search_session", ToolID: "item_2"},
+		{Type: StreamEventToolEnd, Tool: "session-chain.search_session", ToolID: "item_2", IsError: true},
+	})
+	if run.Usage == nil || *run.Usage != (CLIUsage{InputTokens: 3000, OutputTokens: 320, CacheReadTokens: 6000}) {
+		t.Errorf("Unexpected usage: %+v", run.Usage)
+	}
+}
+
+// TestOpenCodeParser 测试 OpenCode run --format json 解析（只输出完成状态的工具补发开始事件，各步骤用量累加）
+func TestOpenCodeParser(t *testing.T) {
+	run := replayRecorded(t, "opencode.jsonl", agentcli.OpenCodeAdapter{})
+
+	if run.SessionID != "ses_5f1e2d3c4b5aXyZ" {
+		t.Errorf("Unexpected session ID: %s", run.SessionID)
+	}
+	if run.Response != "目录里有 README.md 和 src。" {
+		t.Errorf("Unexpected response: %q", run.Response)
+	}
+	assertTools(t, run.Tools, []StreamEvent{
+		{Type: StreamEventToolStart, Tool: "bash", ToolID: "call_abc", Input: `{"command":"ls"}`},
+		{Type: StreamEventToolEnd, Tool: "bash", ToolID: "call_abc", Input: `{"command":"ls"}`, Output: "README.md\nsrc\n"},
+	})
+	if run.Usage == nil || run.Usage.InputTokens != 6100 || run.Usage.OutputTokens != 65 || run.Usage.CacheReadTokens != 3900 {
+		t.Errorf("Unexpected usage: %+v", run.Usage)
+	}
+	if run.Usage.CostUSD < 0.00199 || run.Usage.CostUSD > 0.00201 {
+		t.Errorf("Unexpected cost: %v", run.Usage.CostUSD)
+	}
+}
+
+// TestParserIgnoresNonJSON 测试非 JSON 行（CLI 的提示信息等）被忽略
+func TestParserIgnoresNonJSON(t *testing.T) {
+	state := agentcli.NewParseState()
+	for _, adapter := range []agentcli.Adapter{agentcli.ClaudeAdapter{}, agentcli.GeminiAdapter{}, agentcli.CodexAdapter{}, agentcli.OpenCodeAdapter{}, agentcli.HTTPAdapter{}} {
+		parsed := adapter.ParseLine("Loaded cached credentials.", state)
+		if parsed.SessionID != "" || len(parsed.Events) > 0 || parsed.Usage != nil {
+			t.Errorf("Expected empty result for non-JSON line, got %+v", parsed)
+		}
+	}
+}
+
+// TestParserErrorEvents 测试各 CLI 的失败结果/错误事件被识别为后端错误，成功的结果和工具失败不算
+func TestParserErrorEvents(t *testing.T) {
+	tests := []struct {
+		adapter agentcli.Adapter
+		line    string
+		want    string
+	}{
+		{agentcli.ClaudeAdapter{}, `{"type":"result","subtype":"success","is_error":true,"result":"Credit balance is too low"}`, "Credit balance is too low"},
+		{agentcli.ClaudeAdapter{}, `{"type":"result","subtype":"error_during_execution","is_error":true}`, "error_during_execution"},
+		{agentcli.ClaudeAdapter{}, `{"type":"result","subtype":"success","is_error":false,"result":"完成"}`, ""},
+		{agentcli.ClaudeAdapter{}, `{"type":"user","message":{"content":[{"type":"tool_result","tool_use_id":"t1","content":"quota exceeded","is_error":true}]}}`, ""},
+		{agentcli.GeminiAdapter{}, `{"type":"result","status":"error","error":{"type":"FatalAuthenticationError","message":"authentication failed"}}`, "authentication failed"},
+		{agentcli.GeminiAdapter{}, `{"type":"result","status":"success","stats":{"input_tokens":1,"output_tokens":1}}`, ""},
+		{agentcli.CodexAdapter{}, `{"type":"turn.failed","error":{"message":"exceeded your current quota"}}`, "exceeded your current quota"},
+		{agentcli.CodexAdapter{}, `{"type":"error","message":"Reconnecting... 1/5"}`, ""},
+		{agentcli.OpenCodeAdapter{}, `{"type":"error","error":{"name":"APIError","data":{"message":"Invalid API key"}}}`, "Invalid API key"},
+	}
+	for _, tt := range tests {
+		if got := tt.adapter.ParseLine(tt.line, agentcli.NewParseState()).Error; got != tt.want {
+			t.Errorf("%T %s: got error %q, want %q", tt.adapter, tt.line, got, tt.want)
+		}
+	}
+}
+
+// TestAdapterDefaultsAreSafe 测试默认选项不跳过权限确认，bypassPermissions / yolo 需要在配置中显式开启
+func TestAdapterDefaultsAreSafe(t *testing.T) {
+	for _, cliType := range []string{"claude", "gemini"} {
+		options := agentcli.DefaultOptions(cliType)
+		if options.PermissionMode != "" || options.ApprovalMode != "" {
+			t.Errorf("%s: default options should not bypass permissions: %+v", cliType, options)
+		}
+		_, args := mustAdapter(t, cliType).BuildCommand("hi", options)
+		for _, arg := range args {
+			if arg == "--permission-mode" || arg == "--approval-mode" {
+				t.Errorf("%s: unexpected %s in default command: %v", cliType, arg, args)
+			}
+		}
+	}
+
+	options := agentcli.MergeOptions(agentcli.DefaultOptions("claude"), agentcli.Options{PermissionMode: "bypassPermissions"})
+	_, args := mustAdapter(t, "claude").BuildCommand("hi", options)
+	if !containsSequence(args, "--permission-mode", "bypassPermissions") {
+		t.Errorf("Configured permission mode not passed: %v", args)
+	}
+}
+
+func mustAdapter(t *testing.T, cliType string) agentcli.Adapter {
+	t.Helper()
+	adapter, err := agentcli.Get(cliType)
+	if err != nil {
+		t.Fatalf("Get %s failed: %v", cliType, err)
+	}
+	return adapter
+}
+
+// containsSequence args 中是否依次相邻地包含 seq
+func containsSequence(args []string, seq ...string) bool {
+	for i := 0; i+len(seq) <= len(args); i++ {
+		match := true
+		for j := range seq {
+			match = match && args[i+j] == seq[j]
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// TestAdapterExtraArgsBeforePositional 测试 extra_args 放在位置参数（prompt、stdin 的 -）之前
+func TestAdapterExtraArgsBeforePositional(t *testing.T) {
+	extra := []string{"--max-turns", "20"}
+	tests := []struct {
+		cliType   string
+		sessionID string
+		last      []string
+	}{
+		{"claude", "", extra},
+		{"gemini", "", extra},
+		{"codex", "", append(extra, "-")},
+		{"codex", "sess_1", append(extra, "sess_1", "-")},
+		{"opencode", "", append(extra, "PROMPT")},
+		{"opencode", "sess_1", append(extra, "PROMPT")},
+	}
+	for _, tt := range tests {
+		_, args := mustAdapter(t, tt.cliType).BuildCommand("PROMPT", agentcli.Options{SessionID: tt.sessionID, ExtraArgs: extra})
+		if len(args) < len(tt.last) || !containsSequence(args[len(args)-len(tt.last):], tt.last...) {
+			t.Errorf("%s (session %q): expected args to end with %v, got %v", tt.cliType, tt.sessionID, tt.last, args)
+		}
+	}
+}
@@ -0,0 +1,408 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 端到端测试：启动本地 Redis、API 服务器和三只猫猫的工作进程，CLI 由假 Agent（test/fakeagent）代替
+// 需要 redis-server，未安装时跳过；go test -short 也会跳过
+
+// e2eConfig 测试集群的配置：花花 claude、薇薇 codex、小乔 gemini（额度用尽时切换到 claude）
+const e2eConfig = `agents:
+  - name: "花花"
+    id: "cat_001"
+    pipe: "pipe_huahua"
+    cli_type: "claude"
+    env: {FAKEAGENT_AGENT: "花花"}
+    system_prompt_path: "prompts/huahua.md"
+    context_mode: "orchestrated"
+    timeout: 2
+
+  - name: "薇薇"
+    id: "cat_002"
+    pipe: "pipe_weiwei"
+    cli_type: "codex"
+    env: {FAKEAGENT_AGENT: "薇薇"}
+    system_prompt_path: "prompts/weiwei.md"
+    context_mode: "orchestrated"
+
+  - name: "小乔"
+    id: "cat_003"
+    pipe: "pipe_xiaoqiao"
+    cli_type: "gemini"
+    env: {FAKEAGENT_AGENT: "小乔"}
+    system_prompt_path: "prompts/xiaoqiao.md"
+    context_mode: "orchestrated"
+    fallbacks:
+      - cli_type: "claude"
+        env: {FAKEAGENT_AGENT: "小乔"}
+
+redis:
+  addr: "%s"
+
+hindsight:
+  enabled: false
+`
+
+// e2eCluster 运行中的测试集群
+type e2eCluster struct {
+	dir     string
+	baseURL string
+	callLog string // 假 Agent 的调用记录
+}
+
+// e2eMessage GET /api/sessions/:id/messages 返回的消息（只保留断言用到的字段）
+type e2eMessage struct {
+	Type    string `json:"type"`
+	Content string `json:"content"`
+	Sender  *struct {
+		Name string `json:"name"`
+	} `json:"sender,omitempty"`
+}
+
+func (m e2eMessage) from(name string) bool {
+	return m.Type == "cat" && m.Sender != nil && m.Sender.Name == name
+}
+
+// freePort 向系统申请一个空闲端口
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// startProcess 在集群目录中启动进程，输出写入 logs/<name>.log；测试结束时先 SIGTERM，超时后强制结束
+// 测试失败时打印日志末尾，便于定位
+func startProcess(t *testing.T, dir, name string, env []string, command string, args ...string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join(dir, "logs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	logPath := filepath.Join(dir, "logs", name+".log")
+	logFile, err := os.Create(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(command, args...)
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if err := cmd.Start(); err != nil {
+		logFile.Close()
+		t.Fatalf("Failed to start %s: %v", name, err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		logFile.Close()
+		close(exited)
+	}()
+
+	t.Cleanup(func() {
+		cmd.Process.Signal(syscall.SIGTERM)
+		select {
+		case <-exited:
+		case <-time.After(5 * time.Second):
+			cmd.Process.Kill()
+			<-exited
+		}
+		if t.Failed() {
+			data, _ := os.ReadFile(logPath)
+			if len(data) > 4096 {
+				data = data[len(data)-4096:]
+			}
+			t.Logf("==== %s ====\n%s", name, data)
+		}
+	})
+}
+
+// startRedis 启动不持久化的 redis-server，返回地址
+func startRedis(t *testing.T, dir string) string {
+	t.Helper()
+	server, err := exec.LookPath("redis-server")
+	if err != nil {
+		t.Skip("redis-server not installed")
+	}
+	addr := fmt.Sprintf("127.0.0.1:%d", freePort(t))
+	_, port, _ := net.SplitHostPort(addr)
+	startProcess(t, dir, "redis", os.Environ(), server, "--port", port, "--save", "", "--appendonly", "no")
+
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	defer client.Close()
+	waitFor(t, 10*time.Second, "redis-server to accept connections", func() bool {
+		return client.Ping(context.Background()).Err() == nil
+	})
+	return addr
+}
+
+// buildCatCafe 按 Makefile 中 bin/cat-cafe 的文件列表编译主程序
+func buildCatCafe(t *testing.T, dir string) string {
+	t.Helper()
+	makefile, err := os.ReadFile(filepath.Join("..", "Makefile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, line := range strings.Split(string(makefile), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 4 && fields[0] == "go" && fields[1] == "build" && fields[3] == "bin/cat-cafe" {
+			files = fields[4:]
+			break
+		}
+	}
+	if len(files) == 0 {
+		t.Fatal("bin/cat-cafe build line not found in Makefile")
+	}
+
+	binary := filepath.Join(dir, "cat-cafe")
+	cmd := exec.Command("go", append([]string{"build", "-o", binary}, files...)...)
+	cmd.Dir = ".."
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to build cat-cafe: %v\n%s", err, output)
+	}
+	return binary
+}
+
+// startCluster 启动 Redis、API 服务器和三只猫猫的工作进程，等待所有猫猫上线
+func startCluster(t *testing.T) *e2eCluster {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipping end-to-end test in short mode")
+	}
+	dir := t.TempDir()
+	redisAddr := startRedis(t, dir)
+	binary := buildCatCafe(t, t.TempDir())
+	fakeBin := buildFakeAgent(t)
+
+	scenario, err := filepath.Abs(filepath.Join("testdata", "fakeagent_scenario.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "prompts"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for file, name := range map[string]string{"huahua.md": "花花", "weiwei.md": "薇薇", "xiaoqiao.md": "小乔"} {
+		writeFile(t, filepath.Join(dir, "prompts", file), fmt.Sprintf("你是%s，一只在猫猫咖啡屋工作的猫猫。\n", name))
+	}
+	writeFile(t, filepath.Join(dir, "config.yaml"), fmt.Sprintf(e2eConfig, redisAddr))
+
+	cluster := &e2eCluster{dir: dir, callLog: filepath.Join(dir, "fakeagent_calls.jsonl")}
+	env := []string{
+		"PATH=" + fakeBin + string(os.PathListSeparator) + os.Getenv("PATH"),
+		"HOME=" + dir,
+		"FAKEAGENT_SCENARIO=" + scenario,
+		"FAKEAGENT_LOG=" + cluster.callLog,
+	}
+
+	port := freePort(t)
+	cluster.baseURL = fmt.Sprintf("http://127.0.0.1:%d/api", port)
+	startProcess(t, dir, "api", env, binary, "--mode", "api", "--config", "config.yaml", "--port", fmt.Sprint(port))
+	for _, name := range []string{"花花", "薇薇", "小乔"} {
+		startProcess(t, dir, "agent_"+name, env, binary, "--mode", "agent", "--agent", name, "--config", "config.yaml")
+	}
+
+	waitFor(t, 30*time.Second, "all cats to come online", func() bool {
+		var cats []struct {
+			Status string `json:"status"`
+		}
+		if err := cluster.get("/cats", &cats); err != nil || len(cats) != 3 {
+			return false
+		}
+		for _, cat := range cats {
+			if cat.Status == "offline" {
+				return false
+			}
+		}
+		return true
+	})
+	return cluster
+}
+
+func (c *e2eCluster) get(path string, out interface{}) error {
+	resp, err := http.Get(c.baseURL + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("GET %s: %s %s", path, resp.Status, body)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *e2eCluster) post(t *testing.T, path string, body, out interface{}) {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(c.baseURL+path, "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		t.Fatalf("POST %s: %s %s", path, resp.Status, respBody)
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// newSession 创建会话，返回会话 ID
+func (c *e2eCluster) newSession(t *testing.T, name string) string {
+	t.Helper()
+	var session struct {
+		ID string `json:"id"`
+	}
+	c.post(t, "/sessions", map[string]string{"name": name}, &session)
+	return session.ID
+}
+
+// send 以铲屎官身份发送消息，mentionedCats 为猫猫 ID
+func (c *e2eCluster) send(t *testing.T, sessionID, content string, mentionedCats ...string) {
+	t.Helper()
+	c.post(t, "/sessions/"+sessionID+"/messages", map[string]interface{}{"content": content, "mentionedCats": mentionedCats}, nil)
+}
+
+// waitForMessages 等待会话中的消息满足条件，返回此时的全部消息
+func (c *e2eCluster) waitForMessages(t *testing.T, sessionID, what string, done func([]e2eMessage) bool) []e2eMessage {
+	t.Helper()
+	var messages []e2eMessage
+	waitFor(t, 20*time.Second, what, func() bool {
+		messages = nil
+		return c.get("/sessions/"+sessionID+"/messages", &messages) == nil && done(messages)
+	})
+	return messages
+}
+
+// calls 读取假 Agent 的调用记录
+func (c *e2eCluster) calls(t *testing.T) []fakeAgentCall {
+	t.Helper()
+	return readFakeAgentCalls(t, c.callLog)
+}
+
+func waitFor(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func findMessage(messages []e2eMessage, match func(e2eMessage) bool) int {
+	for i, m := range messages {
+		if match(m) {
+			return i
+		}
+	}
+	return -1
+}
+
+// TestEndToEnd 通过 HTTP 接口驱动完整对话：用户 @ 猫猫 → 工作进程调用 CLI → 回复中的 @ 由编排器继续派发
+func TestEndToEnd(t *testing.T) {
+	cluster := startCluster(t)
+
+	t.Run("MentionChain", func(t *testing.T) {
+		sessionID := cluster.newSession(t, "写服务器")
+		cluster.send(t, sessionID, "@花花 帮我写一个 HTTP 服务器", "cat_001")
+
+		messages := cluster.waitForMessages(t, sessionID, "薇薇's review", func(messages []e2eMessage) bool {
+			return findMessage(messages, func(m e2eMessage) bool { return m.from("薇薇") }) >= 0
+		})
+		huahua := findMessage(messages, func(m e2eMessage) bool { return m.from("花花") })
+		weiwei := findMessage(messages, func(m e2eMessage) bool { return m.from("薇薇") })
+		if huahua < 0 || huahua > weiwei {
+			t.Fatalf("Expected 花花 to answer before 薇薇: %+v", messages)
+		}
+		if !strings.Contains(messages[huahua].Content, "@薇薇 请 review 一下 server.go") {
+			t.Errorf("Unexpected reply from 花花: %q", messages[huahua].Content)
+		}
+		if messages[weiwei].Content != "LGTM，代码没问题。" {
+			t.Errorf("Unexpected reply from 薇薇: %q", messages[weiwei].Content)
+		}
+
+		// 薇薇（codex）收到的 prompt 包含花花派发的任务和之前的对话
+		var reviewPrompt string
+		for _, call := range cluster.calls(t) {
+			if call.Agent == "薇薇" && call.CLI == "codex" && strings.Contains(call.Prompt, "请 review 一下 server.go") {
+				reviewPrompt = call.Prompt
+			}
+		}
+		if reviewPrompt == "" || !strings.Contains(reviewPrompt, "帮我写一个 HTTP 服务器") {
+			t.Errorf("Expected 薇薇's prompt to include the task and the conversation, got %q", reviewPrompt)
+		}
+
+		// 假 CLI 报告的用量计入会话统计
+		var stats struct {
+			ByCat map[string]struct {
+				TokensIn  int64 `json:"tokensIn"`
+				TokensOut int64 `json:"tokensOut"`
+			} `json:"byCat"`
+		}
+		waitFor(t, 5*time.Second, "usage stats", func() bool {
+			return cluster.get("/sessions/"+sessionID+"/stats", &stats) == nil && len(stats.ByCat) == 2
+		})
+		if usage := stats.ByCat["花花"]; usage.TokensIn != 1200 || usage.TokensOut != 300 {
+			t.Errorf("Unexpected usage for 花花: %+v", usage)
+		}
+	})
+
+	t.Run("Failover", func(t *testing.T) {
+		sessionID := cluster.newSession(t, "部署")
+		cluster.send(t, sessionID, "@小乔 部署到测试环境", "cat_003")
+
+		messages := cluster.waitForMessages(t, sessionID, "小乔's reply from the fallback backend", func(messages []e2eMessage) bool {
+			return findMessage(messages, func(m e2eMessage) bool { return m.from("小乔") }) >= 0
+		})
+		reply := findMessage(messages, func(m e2eMessage) bool { return m.from("小乔") })
+		if messages[reply].Content != "部署完成，测试环境已更新。" {
+			t.Errorf("Unexpected reply from 小乔: %q", messages[reply].Content)
+		}
+		notice := findMessage(messages, func(m e2eMessage) bool {
+			return m.Type == "system" && strings.HasPrefix(m.Content, "🔀 小乔") && strings.Contains(m.Content, "claude")
+		})
+		if notice < 0 || notice > reply {
+			t.Errorf("Expected a failover notice before the reply: %+v", messages)
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		sessionID := cluster.newSession(t, "超时")
+		cluster.send(t, sessionID, "@花花 慢慢想一想", "cat_001")
+
+		messages := cluster.waitForMessages(t, sessionID, "the timeout notice", func(messages []e2eMessage) bool {
+			return findMessage(messages, func(m e2eMessage) bool { return m.Type == "system" && strings.Contains(m.Content, "⏱ 花花") }) >= 0
+		})
+		if findMessage(messages, func(m e2eMessage) bool { return m.from("花花") }) >= 0 {
+			t.Errorf("Expected no reply after the CLI timed out: %+v", messages)
+		}
+	})
+}
@@ -0,0 +1,185 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"cat-cafe/src/agentcli"
+)
+
+// 故障转移简化版本用于测试（从 failover.go 复制；失败分类直接测试 agentcli.ClassifyError）
+
+const (
+	FailureTransient = agentcli.FailureTransient
+	FailureFatal     = agentcli.FailureFatal
+)
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+type BackendAttempt struct {
+	Backend string
+	Class   string
+	Reason  string
+}
+
+func describeAttempts(attempts []BackendAttempt) string {
+	parts := make([]string, 0, len(attempts))
+	for _, attempt := range attempts {
+		parts = append(parts, fmt.Sprintf("%s（%s）", attempt.Backend, attempt.Reason))
+	}
+	return strings.Join(parts, "、")
+}
+
+type BreakerState struct {
+	Backend  string
+	State    string
+	Failures int
+	OpenedAt time.Time
+}
+
+func (s *BreakerState) allow(now time.Time, cooldown time.Duration) bool {
+	if s.State != BreakerOpen {
+		return true
+	}
+	if now.Sub(s.OpenedAt) < cooldown {
+		return false
+	}
+	s.State = BreakerHalfOpen
+	return true
+}
+
+func (s *BreakerState) recordFailure(class string, now time.Time, threshold int) {
+	s.Failures++
+	if class == FailureFatal || s.State == BreakerHalfOpen || s.Failures >= threshold {
+		s.State = BreakerOpen
+		s.OpenedAt = now
+	}
+}
+
+func (s *BreakerState) recordSuccess() {
+	s.State = BreakerClosed
+	s.Failures = 0
+}
+
+// TestClassifyBackendError 测试后端报告的错误被分为临时或致命错误
+func TestClassifyBackendError(t *testing.T) {
+	cliErr := func(message string) error {
+		return &agentcli.BackendError{Source: "命令 claude 报告错误", Message: message}
+	}
+	httpErr := func(status int, body string) error {
+		return &agentcli.BackendError{Source: fmt.Sprintf("模型接口返回 %d", status), StatusCode: status, Message: body}
+	}
+	tests := []struct {
+		err    error
+		class  string
+		reason string
+	}{
+		{&exec.Error{Name: "gemini", Err: exec.ErrNotFound}, FailureFatal, "CLI 未安装"},
+		{fmt.Errorf("%w: 环境变量 OPENAI_API_KEY 未设置", agentcli.ErrConfig), FailureFatal, "配置错误"},
+		{httpErr(429, `{"error":{"type":"insufficient_quota","message":"You exceeded your current quota"}}`), FailureFatal, "额度已用尽"},
+		{httpErr(401, `{"error":{"message":"Incorrect API key provided"}}`), FailureFatal, "认证失败"},
+		{httpErr(403, "forbidden"), FailureFatal, "认证失败"},
+		{httpErr(429, "slow down"), FailureTransient, "请求受限"},
+		{httpErr(500, "internal error"), FailureTransient, "调用失败"},
+		{cliErr("Credit balance is too low"), FailureFatal, "额度已用尽"},
+		{cliErr("Invalid API key · Please run /login"), FailureFatal, "认证失败"},
+		{cliErr("API Error: 401 {\"type\":\"error\"}"), FailureFatal, "认证失败"},
+		{cliErr("API Error: 529 Overloaded"), FailureTransient, "请求受限"},
+		{cliErr("Rate limit exceeded, retry later"), FailureTransient, "请求受限"},
+		// 后端错误在第一行、stderr 附在后面时按后端错误分类
+		{fmt.Errorf("%w\n命令 claude 执行失败: exit status 1\nstderr: file.go:401: boom", cliErr("Credit balance is too low")), FailureFatal, "额度已用尽"},
+		{errors.New("命令 codex 执行失败: exit status 2"), FailureTransient, "调用失败"},
+	}
+	for _, tt := range tests {
+		class, reason := classifyBackendError(tt.err)
+		if class != tt.class || reason != tt.reason {
+			t.Errorf("%q: got (%s, %s), want (%s, %s)", tt.err, class, reason, tt.class, tt.reason)
+		}
+	}
+}
+
+// TestClassifyBackendErrorIgnoresStderr 测试 stderr 和与额度、认证无关的后端错误内容不会被判为致命错误
+func TestClassifyBackendErrorIgnoresStderr(t *testing.T) {
+	tests := []error{
+		errors.New("命令 claude 执行失败: exit status 1\nstderr: write /tmp/out: Disk quota exceeded"),
+		errors.New("命令 codex 执行失败: exit status 1\nstderr: editing src/billing/invoice.go"),
+		errors.New("命令 gemini 执行失败: exit status 1\nstderr: internal/auth/handler.go:401: authentication middleware panicked"),
+		errors.New("命令 claude 执行失败: exit status 1\nstderr: Error: 403 lines changed, Insufficient_quota fixture"),
+		&agentcli.BackendError{Source: "命令 claude 报告错误", Message: "Tool failed: disk quota exceeded while writing billing report"},
+		&agentcli.BackendError{Source: "命令 claude 报告错误", Message: "build failed at main.go:403"},
+	}
+	for _, err := range tests {
+		if class, reason := classifyBackendError(err); class != FailureTransient {
+			t.Errorf("%q: got (%s, %s), want transient", err, class, reason)
+		}
+	}
+}
+
+func classifyBackendError(err error) (string, string) {
+	return agentcli.ClassifyError(err)
+}
+
+// TestCircuitBreakerTransitions 测试熔断器在连续失败、致命错误、冷却和试探之间的状态切换
+func TestCircuitBreakerTransitions(t *testing.T) {
+	now := time.Now()
+	cooldown := time.Minute
+	state := BreakerState{Backend: "claude", State: BreakerClosed}
+
+	// 临时错误未达到阈值时保持关闭
+	state.recordFailure(FailureTransient, now, 3)
+	state.recordFailure(FailureTransient, now, 3)
+	if state.State != BreakerClosed || !state.allow(now, cooldown) {
+		t.Fatalf("Expected closed after 2 transient failures, got %s", state.State)
+	}
+	state.recordFailure(FailureTransient, now, 3)
+	if state.State != BreakerOpen {
+		t.Fatalf("Expected open after reaching threshold, got %s", state.State)
+	}
+
+	// 冷却期内跳过，冷却结束后半开试探
+	if state.allow(now.Add(30*time.Second), cooldown) {
+		t.Error("Expected backend to be skipped during cooldown")
+	}
+	if !state.allow(now.Add(cooldown), cooldown) || state.State != BreakerHalfOpen {
+		t.Fatalf("Expected half-open after cooldown, got %s", state.State)
+	}
+
+	// 试探失败立即重新熔断，即使是临时错误
+	later := now.Add(2 * cooldown)
+	state.recordFailure(FailureTransient, later, 3)
+	if state.State != BreakerOpen || !state.OpenedAt.Equal(later) {
+		t.Fatalf("Expected reopened after failed probe, got %s", state.State)
+	}
+
+	// 试探成功恢复正常
+	state.allow(later.Add(cooldown), cooldown)
+	state.recordSuccess()
+	if state.State != BreakerClosed || state.Failures != 0 {
+		t.Errorf("Expected closed after success, got %+v", state)
+	}
+
+	// 致命错误直接熔断
+	state.recordFailure(FailureFatal, now, 3)
+	if state.State != BreakerOpen {
+		t.Errorf("Expected open after fatal failure, got %s", state.State)
+	}
+}
+
+// TestDescribeAttempts 测试故障转移提示中失败后端的描述
+func TestDescribeAttempts(t *testing.T) {
+	got := describeAttempts([]BackendAttempt{
+		{Backend: "claude/claude-sonnet-4-5", Class: FailureFatal, Reason: "额度已用尽"},
+		{Backend: "gemini", Reason: "熔断中"},
+	})
+	if got != "claude/claude-sonnet-4-5（额度已用尽）、gemini（熔断中）" {
+		t.Errorf("Unexpected description: %s", got)
+	}
+}
@@ -0,0 +1,203 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cat-cafe/src/agentcli"
+)
+
+// 假 Agent CLI（test/fakeagent）的输出用 cli_adapter_test.go 中的解析函数回放，确保与真实 CLI 的格式一致
+
+var fakeAgentCLIs = []string{"claude", "codex", "gemini", "opencode"}
+
+// buildFakeAgent 编译假 Agent CLI，返回包含 claude/codex/gemini/opencode 符号链接的目录（放到 PATH 最前面即可替换真实 CLI）
+func buildFakeAgent(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "fakeagent")
+	cmd := exec.Command("go", "build", "-o", binary, "./fakeagent")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to build fakeagent: %v\n%s", err, output)
+	}
+	for _, cli := range fakeAgentCLIs {
+		if err := os.Symlink(binary, filepath.Join(dir, cli)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// fakeAgentCommand 与各 CLI 适配器的 BuildCommand 一致（codex 的 prompt 通过 stdin 传递）
+func fakeAgentCommand(cli, prompt, sessionID string) (args []string, stdin string) {
+	switch cli {
+	case "claude":
+		args = []string{"-p", prompt, "--output-format", "stream-json", "--verbose"}
+		if sessionID != "" {
+			args = append(args, "--resume", sessionID)
+		}
+	case "gemini":
+		args = []string{"-p", prompt, "--output-format", "stream-json"}
+		if sessionID != "" {
+			args = append(args, "--resume", sessionID)
+		}
+	case "codex":
+		args = []string{"exec", "--json", "--full-auto", "--skip-git-repo-check", "-"}
+		if sessionID != "" {
+			args = []string{"exec", "resume", "--json", "--skip-git-repo-check", sessionID, "-"}
+		}
+		stdin = prompt
+	case "opencode":
+		args = []string{"run", "--format", "json"}
+		if sessionID != "" {
+			args = append(args, "--session", sessionID)
+		}
+		args = append(args, prompt)
+	}
+	return args, stdin
+}
+
+// fakeAgentRun 一次假 CLI 调用的结果
+type fakeAgentRun struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// fakeAgentCall FAKEAGENT_LOG 中的一条调用记录
+type fakeAgentCall struct {
+	CLI    string `json:"cli"`
+	Agent  string `json:"agent"`
+	Prompt string `json:"prompt"`
+	Resume string `json:"resume"`
+	Rule   int    `json:"rule"`
+}
+
+func runFakeAgent(t *testing.T, binDir, cli, agent, prompt, sessionID string, env ...string) fakeAgentRun {
+	t.Helper()
+	args, stdin := fakeAgentCommand(cli, prompt, sessionID)
+	cmd := exec.Command(filepath.Join(binDir, cli), args...)
+	cmd.Env = append(os.Environ(),
+		"FAKEAGENT_SCENARIO="+filepath.Join("testdata", "fakeagent_scenario.yaml"),
+		"FAKEAGENT_AGENT="+agent,
+	)
+	cmd.Env = append(cmd.Env, env...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	run := fakeAgentRun{}
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			t.Fatalf("Failed to run fake %s: %v", cli, err)
+		}
+		run.ExitCode = exitErr.ExitCode()
+	}
+	run.Stdout, run.Stderr = stdout.String(), stderr.String()
+	return run
+}
+
+// TestFakeAgentDialects 测试四种 CLI 格式的回复、@ 调用、工具调用、会话 ID 和用量都能被适配器解析
+func TestFakeAgentDialects(t *testing.T) {
+	binDir := buildFakeAgent(t)
+	parsers := map[string]agentcli.Adapter{
+		"claude":   agentcli.ClaudeAdapter{},
+		"codex":    agentcli.CodexAdapter{},
+		"gemini":   agentcli.GeminiAdapter{},
+		"opencode": agentcli.OpenCodeAdapter{},
+	}
+
+	for _, cli := range fakeAgentCLIs {
+		t.Run(cli, func(t *testing.T) {
+			result := runFakeAgent(t, binDir, cli, "花花", "铲屎官：帮我写一个 HTTP 服务器", "")
+			if result.ExitCode != 0 {
+				t.Fatalf("Unexpected exit code %d: %s", result.ExitCode, result.Stderr)
+			}
+
+			run := replayOutput(strings.NewReader(result.Stdout), parsers[cli])
+			if run.Response != "好的，server.go 已经写好了，监听 8080 端口。\n@薇薇 请 review 一下 server.go" {
+				t.Errorf("Unexpected response: %q", run.Response)
+			}
+			if run.SessionID != "fake-huahua-001" {
+				t.Errorf("Unexpected session ID: %s", run.SessionID)
+			}
+			if len(run.Tools) != 2 || run.Tools[0].Type != StreamEventToolStart || run.Tools[0].Tool != "Write" ||
+				run.Tools[1].Type != StreamEventToolEnd || run.Tools[1].IsError {
+				t.Errorf("Unexpected tool events: %+v", run.Tools)
+			}
+			if run.Usage == nil || run.Usage.InputTokens != 1200 || run.Usage.OutputTokens != 300 {
+				t.Errorf("Unexpected usage: %+v", run.Usage)
+			}
+		})
+	}
+}
+
+// TestFakeAgentScenarioRules 测试恢复会话、调用失败、默认回复和调用记录
+func TestFakeAgentScenarioRules(t *testing.T) {
+	binDir := buildFakeAgent(t)
+	logPath := filepath.Join(t.TempDir(), "calls.jsonl")
+
+	// 恢复会话时沿用传入的会话 ID
+	result := runFakeAgent(t, binDir, "codex", "薇薇", "继续", "thread-42", "FAKEAGENT_LOG="+logPath)
+	run := replayOutput(strings.NewReader(result.Stdout), agentcli.CodexAdapter{})
+	if run.SessionID != "thread-42" || run.Response != "接着上次继续。" {
+		t.Errorf("Expected the resumed session to be kept, got %s %q", run.SessionID, run.Response)
+	}
+
+	// 主后端失败：非零退出码和 stderr 交给故障切换分类
+	result = runFakeAgent(t, binDir, "gemini", "小乔", "部署到测试环境", "", "FAKEAGENT_LOG="+logPath)
+	if result.ExitCode != 1 || !strings.Contains(result.Stderr, "quota exceeded") {
+		t.Errorf("Expected a quota failure, got exit code %d stderr %q", result.ExitCode, result.Stderr)
+	}
+
+	// 没有命中的规则时使用 default
+	result = runFakeAgent(t, binDir, "claude", "花花", "你好", "", "FAKEAGENT_LOG="+logPath)
+	if run := replayOutput(strings.NewReader(result.Stdout), agentcli.ClaudeAdapter{}); run.Response != "收到。" {
+		t.Errorf("Expected the default reply, got %q", run.Response)
+	}
+
+	calls := readFakeAgentCalls(t, logPath)
+	if len(calls) != 3 {
+		t.Fatalf("Expected 3 recorded calls, got %d", len(calls))
+	}
+	// codex 的 prompt 从 stdin 读取
+	if calls[0].CLI != "codex" || calls[0].Prompt != "继续" || calls[0].Resume != "thread-42" {
+		t.Errorf("Unexpected codex call: %+v", calls[0])
+	}
+	if calls[1].Agent != "小乔" || calls[1].Rule != 3 {
+		t.Errorf("Unexpected gemini call: %+v", calls[1])
+	}
+	if calls[2].Rule != -1 {
+		t.Errorf("Expected the default rule, got %+v", calls[2])
+	}
+}
+
+// readFakeAgentCalls 读取 FAKEAGENT_LOG 中的调用记录
+func readFakeAgentCalls(t *testing.T, path string) []fakeAgentCall {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var calls []fakeAgentCall
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 1024*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var call fakeAgentCall
+		if err := json.Unmarshal(scanner.Bytes(), &call); err != nil {
+			t.Fatal(err)
+		}
+		calls = append(calls, call)
+	}
+	return calls
+}
@@ -0,0 +1,392 @@
+// fakeagent 可编排的假 Agent CLI，用于端到端测试
+//
+// 同一个二进制按调用名（argv[0]，或环境变量 FAKEAGENT_CLI）模拟 claude、codex、gemini、opencode
+// 的命令行参数和 stream-json 输出，回复内容由场景文件决定：
+//
+//	FAKEAGENT_SCENARIO  场景文件路径（YAML，格式见 test/testdata/fakeagent_scenario.yaml）
+//	FAKEAGENT_AGENT     当前猫猫的名字，用于匹配规则中的 agent（在 config.yaml 的 env 中设置）
+//	FAKEAGENT_LOG       每次调用追加一行 JSON 记录（参数、prompt、命中的规则），测试据此断言
+//
+// 用法：编译后以 claude/codex/gemini/opencode 为名创建符号链接，放到 PATH 最前面
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Scenario 场景文件：按顺序匹配规则，第一条命中的规则决定回复；都不命中时使用 default
+type Scenario struct {
+	Rules   []Rule `yaml:"rules"`
+	Default *Rule  `yaml:"default,omitempty"`
+}
+
+// Rule 一条回复规则，匹配条件为空表示不限制
+type Rule struct {
+	// 匹配条件
+	Agent  string `yaml:"agent,omitempty"`  // FAKEAGENT_AGENT
+	CLI    string `yaml:"cli,omitempty"`    // claude / codex / gemini / opencode
+	Match  string `yaml:"match,omitempty"`  // prompt 包含的子串
+	Resume string `yaml:"resume,omitempty"` // 恢复的会话 ID（--resume / --session / codex exec resume），"*" 表示任意恢复的会话
+
+	// 回复
+	Reply     string        `yaml:"reply,omitempty"`
+	Mentions  []Mention     `yaml:"mentions,omitempty"`   // 追加在回复末尾的 @ 调用
+	Tools     []ToolCall    `yaml:"tools,omitempty"`      // 回复前的工具调用
+	Delay     time.Duration `yaml:"delay,omitempty"`      // 输出 init 事件后等待多久再回复（用于测试超时和并发）
+	SessionID string        `yaml:"session_id,omitempty"` // 新会话的 ID，未设置时自动生成；恢复会话时沿用原 ID
+	Model     string        `yaml:"model,omitempty"`
+	Usage     *Usage        `yaml:"usage,omitempty"`
+	Fail      *Failure      `yaml:"fail,omitempty"` // 调用失败：输出 stderr 并以非零状态码退出
+}
+
+// Mention 回复中的 @ 调用，输出为单独一行 "@猫猫名 任务"
+type Mention struct {
+	Cat  string `yaml:"cat"`
+	Task string `yaml:"task,omitempty"`
+}
+
+// ToolCall 模拟的工具调用（codex 中 name 作为执行的命令）
+type ToolCall struct {
+	Name   string                 `yaml:"name"`
+	Input  map[string]interface{} `yaml:"input,omitempty"`
+	Output string                 `yaml:"output,omitempty"`
+	Error  bool                   `yaml:"error,omitempty"`
+}
+
+// Usage 调用结束时报告的 token 用量
+type Usage struct {
+	InputTokens     int     `yaml:"input_tokens"`
+	OutputTokens    int     `yaml:"output_tokens"`
+	CacheReadTokens int     `yaml:"cache_read_tokens,omitempty"`
+	CostUSD         float64 `yaml:"cost_usd,omitempty"`
+}
+
+// Failure 调用失败时的退出码和标准错误输出（如 "rate limit exceeded" 触发备用后端切换）
+type Failure struct {
+	ExitCode int    `yaml:"exit_code,omitempty"` // 默认 1
+	Stderr   string `yaml:"stderr,omitempty"`
+}
+
+// Invocation 调用记录（FAKEAGENT_LOG 中的一行）
+type Invocation struct {
+	CLI       string   `json:"cli"`
+	Agent     string   `json:"agent,omitempty"`
+	Args      []string `json:"args"`
+	Prompt    string   `json:"prompt"`
+	Model     string   `json:"model,omitempty"`
+	Resume    string   `json:"resume,omitempty"`
+	SessionID string   `json:"session_id"`
+	Rule      int      `json:"rule"` // 命中的规则下标，-1 表示 default
+}
+
+func main() {
+	cli := os.Getenv("FAKEAGENT_CLI")
+	if cli == "" {
+		cli = filepath.Base(os.Args[0])
+	}
+	args := os.Args[1:]
+
+	call, err := parseArgs(cli, args)
+	if err != nil {
+		fail(2, err.Error())
+	}
+	call.Agent = os.Getenv("FAKEAGENT_AGENT")
+
+	scenario, err := loadScenario(os.Getenv("FAKEAGENT_SCENARIO"))
+	if err != nil {
+		fail(2, fmt.Sprintf("加载场景文件失败: %v", err))
+	}
+	rule, index := scenario.match(call)
+	if rule == nil {
+		fail(2, fmt.Sprintf("没有匹配的场景规则 (cli: %s, agent: %s)", cli, call.Agent))
+	}
+	call.Rule = index
+
+	call.SessionID = call.Resume
+	if call.SessionID == "" {
+		call.SessionID = rule.SessionID
+	}
+	if call.SessionID == "" {
+		call.SessionID = fmt.Sprintf("fake-%s-%d", cli, time.Now().UnixNano())
+	}
+	if rule.Model != "" {
+		call.Model = rule.Model
+	}
+	if call.Model == "" {
+		call.Model = "fake-" + cli
+	}
+
+	if err := appendLog(os.Getenv("FAKEAGENT_LOG"), call); err != nil {
+		fail(2, fmt.Sprintf("写入调用记录失败: %v", err))
+	}
+
+	out := newEmitter(cli)
+	out.init(call)
+	if rule.Delay > 0 {
+		time.Sleep(rule.Delay)
+	}
+	if rule.Fail != nil {
+		code := rule.Fail.ExitCode
+		if code == 0 {
+			code = 1
+		}
+		fail(code, rule.Fail.Stderr)
+	}
+	for i, tool := range rule.Tools {
+		out.tool(fmt.Sprintf("tool_%d", i+1), tool)
+	}
+	out.text(rule.text())
+	out.finish(rule.Usage)
+}
+
+// parseArgs 按各 CLI 适配器的 BuildCommand 解析 prompt、模型和恢复的会话 ID
+func parseArgs(cli string, args []string) (*Invocation, error) {
+	call := &Invocation{CLI: cli, Args: args}
+	switch cli {
+	case "claude", "gemini":
+		call.Prompt = flagValue(args, "-p")
+		call.Model = flagValue(args, "--model")
+		call.Resume = flagValue(args, "--resume")
+	case "codex":
+		// codex exec [resume] --json ... [SESSION_ID] -，prompt 从 stdin 读取
+		if len(args) < 2 || args[0] != "exec" || args[len(args)-1] != "-" {
+			return nil, fmt.Errorf("不支持的 codex 参数: %v", args)
+		}
+		if args[1] == "resume" {
+			call.Resume = args[len(args)-2]
+		}
+		call.Model = flagValue(args, "--model")
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		call.Prompt = string(data)
+	case "opencode":
+		// opencode run --format json [--model M] [--session ID] PROMPT
+		if len(args) < 2 || args[0] != "run" {
+			return nil, fmt.Errorf("不支持的 opencode 参数: %v", args)
+		}
+		call.Model = flagValue(args, "--model")
+		call.Resume = flagValue(args, "--session")
+		call.Prompt = args[len(args)-1]
+	default:
+		return nil, fmt.Errorf("未知的 CLI: %s（可通过 FAKEAGENT_CLI 指定）", cli)
+	}
+	return call, nil
+}
+
+func flagValue(args []string, name string) string {
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == name {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+func loadScenario(path string) (*Scenario, error) {
+	if path == "" {
+		return nil, fmt.Errorf("未设置 FAKEAGENT_SCENARIO")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var scenario Scenario
+	if err := yaml.Unmarshal(data, &scenario); err != nil {
+		return nil, err
+	}
+	return &scenario, nil
+}
+
+// match 返回第一条命中的规则及其下标，都不命中时返回 default（下标 -1）
+func (s *Scenario) match(call *Invocation) (*Rule, int) {
+	for i := range s.Rules {
+		if s.Rules[i].matches(call) {
+			return &s.Rules[i], i
+		}
+	}
+	return s.Default, -1
+}
+
+func (r *Rule) matches(call *Invocation) bool {
+	if r.Agent != "" && r.Agent != call.Agent {
+		return false
+	}
+	if r.CLI != "" && r.CLI != call.CLI {
+		return false
+	}
+	if r.Match != "" && !strings.Contains(call.Prompt, r.Match) {
+		return false
+	}
+	switch r.Resume {
+	case "":
+	case "*":
+		return call.Resume != ""
+	default:
+		return r.Resume == call.Resume
+	}
+	return true
+}
+
+// text 回复正文，@ 调用各占一行追加在末尾
+func (r *Rule) text() string {
+	var b strings.Builder
+	b.WriteString(strings.TrimRight(r.Reply, "\n"))
+	for _, m := range r.Mentions {
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString("@" + m.Cat)
+		if m.Task != "" {
+			b.WriteString(" " + m.Task)
+		}
+	}
+	return b.String()
+}
+
+func appendLog(path string, call *Invocation) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.Marshal(call)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+func fail(code int, stderr string) {
+	if stderr != "" {
+		fmt.Fprintln(os.Stderr, stderr)
+	}
+	os.Exit(code)
+}
+
+// emitter 按 CLI 的 stream-json 格式逐行输出事件
+type emitter struct {
+	cli       string
+	w         *bufio.Writer
+	sessionID string
+}
+
+func newEmitter(cli string) *emitter {
+	return &emitter{cli: cli, w: bufio.NewWriter(os.Stdout)}
+}
+
+// line 输出一行 JSON 并立即刷新，保证调用方能收到增量事件
+func (e *emitter) line(event map[string]interface{}) {
+	data, _ := json.Marshal(event)
+	e.w.Write(append(data, '\n'))
+	e.w.Flush()
+}
+
+func (e *emitter) init(call *Invocation) {
+	e.sessionID = call.SessionID
+	switch e.cli {
+	case "claude":
+		e.line(map[string]interface{}{"type": "system", "subtype": "init", "session_id": call.SessionID, "model": call.Model})
+	case "codex":
+		e.line(map[string]interface{}{"type": "thread.started", "thread_id": call.SessionID})
+		e.line(map[string]interface{}{"type": "turn.started"})
+	case "gemini":
+		e.line(map[string]interface{}{"type": "init", "session_id": call.SessionID, "model": call.Model})
+	case "opencode":
+		e.line(map[string]interface{}{"type": "step_start", "sessionID": call.SessionID, "part": map[string]interface{}{}})
+	}
+}
+
+func (e *emitter) tool(id string, tool ToolCall) {
+	input := tool.Input
+	if input == nil {
+		input = map[string]interface{}{}
+	}
+	switch e.cli {
+	case "claude":
+		e.line(map[string]interface{}{"type": "assistant", "message": map[string]interface{}{"content": []interface{}{
+			map[string]interface{}{"type": "tool_use", "id": id, "name": tool.Name, "input": input},
+		}}})
+		e.line(map[string]interface{}{"type": "user", "message": map[string]interface{}{"content": []interface{}{
+			map[string]interface{}{"type": "tool_result", "tool_use_id": id, "content": tool.Output, "is_error": tool.Error},
+		}}})
+	case "codex":
+		status := "completed"
+		if tool.Error {
+			status = "failed"
+		}
+		e.line(map[string]interface{}{"type": "item.started", "item": map[string]interface{}{"id": id, "type": "command_execution", "command": tool.Name, "status": "in_progress"}})
+		e.line(map[string]interface{}{"type": "item.completed", "item": map[string]interface{}{"id": id, "type": "command_execution", "command": tool.Name, "aggregated_output": tool.Output, "status": status}})
+	case "gemini":
+		status := "success"
+		if tool.Error {
+			status = "error"
+		}
+		e.line(map[string]interface{}{"type": "tool_use", "tool_name": tool.Name, "tool_id": id, "parameters": input})
+		e.line(map[string]interface{}{"type": "tool_result", "tool_id": id, "status": status, "output": tool.Output})
+	case "opencode":
+		status := "completed"
+		state := map[string]interface{}{"status": status, "input": input, "output": tool.Output}
+		if tool.Error {
+			state = map[string]interface{}{"status": "error", "input": input, "error": tool.Output}
+		}
+		e.line(map[string]interface{}{"type": "tool_use", "sessionID": e.sessionID, "part": map[string]interface{}{"callID": id, "tool": tool.Name, "state": state}})
+	}
+}
+
+func (e *emitter) text(text string) {
+	if text == "" {
+		return
+	}
+	switch e.cli {
+	case "claude":
+		e.line(map[string]interface{}{"type": "assistant", "message": map[string]interface{}{"content": []interface{}{
+			map[string]interface{}{"type": "text", "text": text},
+		}}})
+	case "codex":
+		e.line(map[string]interface{}{"type": "item.completed", "item": map[string]interface{}{"id": "msg_1", "type": "agent_message", "text": text}})
+	case "gemini":
+		e.line(map[string]interface{}{"type": "message", "role": "assistant", "content": text})
+	case "opencode":
+		e.line(map[string]interface{}{"type": "text", "sessionID": e.sessionID, "part": map[string]interface{}{"text": text}})
+	}
+}
+
+func (e *emitter) finish(usage *Usage) {
+	if usage == nil {
+		usage = &Usage{}
+	}
+	switch e.cli {
+	case "claude":
+		e.line(map[string]interface{}{"type": "result", "subtype": "success", "session_id": e.sessionID, "total_cost_usd": usage.CostUSD, "usage": map[string]interface{}{
+			"input_tokens": usage.InputTokens, "output_tokens": usage.OutputTokens, "cache_read_input_tokens": usage.CacheReadTokens,
+		}})
+	case "codex":
+		// codex 的 input_tokens 包含缓存命中的部分
+		e.line(map[string]interface{}{"type": "turn.completed", "usage": map[string]interface{}{
+			"input_tokens": usage.InputTokens + usage.CacheReadTokens, "cached_input_tokens": usage.CacheReadTokens, "output_tokens": usage.OutputTokens,
+		}})
+	case "gemini":
+		e.line(map[string]interface{}{"type": "result", "status": "success", "stats": map[string]interface{}{
+			"input_tokens": usage.InputTokens, "output_tokens": usage.OutputTokens, "cached": usage.CacheReadTokens,
+		}})
+	case "opencode":
+		e.line(map[string]interface{}{"type": "step_finish", "sessionID": e.sessionID, "part": map[string]interface{}{
+			"cost": usage.CostUSD, "tokens": map[string]interface{}{"input": usage.InputTokens, "output": usage.OutputTokens, "cache": map[string]interface{}{"read": usage.CacheReadTokens}},
+		}})
+	}
+}
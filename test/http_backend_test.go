@@ -0,0 +1,235 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cat-cafe/src/agentcli"
+)
+
+// HTTP 后端简化版本用于测试（请求流程从 agentcli/http.go 复制，会话历史改为内存传递，流式解析使用 agentcli.HTTPAdapter）
+// 使用本地 SSE 桩服务模拟 OpenAI / Anthropic 接口
+
+type httpMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// invokeHTTPBackend 发送一轮对话，返回回复、用量和追加了本轮问答的历史
+func invokeHTTPBackend(baseURL, format, apiKey string, history []httpMessage, prompt string) (string, *CLIUsage, []httpMessage, error) {
+	messages := append(history, httpMessage{Role: "user", Content: prompt})
+	body := map[string]interface{}{"model": "test-model", "messages": messages, "stream": true}
+
+	var url string
+	headers := map[string]string{"Content-Type": "application/json"}
+	if format == "anthropic" {
+		url = strings.TrimRight(baseURL, "/") + "/messages"
+		body["max_tokens"] = 4096
+		headers["anthropic-version"] = "2023-06-01"
+		headers["x-api-key"] = apiKey
+	} else {
+		url = strings.TrimRight(baseURL, "/") + "/chat/completions"
+		body["stream_options"] = map[string]bool{"include_usage": true}
+		headers["Authorization"] = "Bearer " + apiKey
+	}
+
+	data, _ := json.Marshal(body)
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return "", nil, history, err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", nil, history, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return "", nil, history, fmt.Errorf("模型接口返回 %d: %s", resp.StatusCode, msg)
+	}
+
+	var response string
+	var usage *CLIUsage
+	adapter := agentcli.HTTPAdapter{}
+	state := agentcli.NewParseState()
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		parsed := adapter.ParseLine(scanner.Text(), state)
+		if parsed.Error != "" {
+			return "", nil, history, fmt.Errorf("模型接口返回错误: %s", parsed.Error)
+		}
+		if parsed.Usage != nil {
+			usage = usage.Add(parsed.Usage)
+		}
+		for _, event := range parsed.Events {
+			response += event.Text
+		}
+	}
+	return response, usage, append(messages, httpMessage{Role: "assistant", Content: response}), scanner.Err()
+}
+
+// stubModelServer 记录每次请求的消息列表并按固定 SSE 内容回复
+type stubModelServer struct {
+	*httptest.Server
+	requests [][]httpMessage
+	headers  []http.Header
+}
+
+func newStubModelServer(t *testing.T, path string, sse string) *stubModelServer {
+	stub := &stubModelServer{}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		var body struct {
+			Messages []httpMessage `json:"messages"`
+			Stream   bool          `json:"stream"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || !body.Stream {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		stub.requests = append(stub.requests, body.Messages)
+		stub.headers = append(stub.headers, r.Header.Clone())
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, sse)
+	}))
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+// TestHTTPBackendOpenAI 测试 OpenAI 兼容接口的流式解析、用量和多轮历史
+func TestHTTPBackendOpenAI(t *testing.T) {
+	sse := `data: {"choices":[{"delta":{"role":"assistant"}}]}
+
+data: {"choices":[{"delta":{"content":"喵，"}}]}
+
+data: {"choices":[{"delta":{"content":"代码没问题"}}]}
+
+data: {"choices":[],"usage":{"prompt_tokens":120,"completion_tokens":8,"prompt_tokens_details":{"cached_tokens":100}}}
+
+data: [DONE]
+
+`
+	stub := newStubModelServer(t, "/v1/chat/completions", sse)
+
+	response, usage, history, err := invokeHTTPBackend(stub.URL+"/v1", "openai", "sk-test", nil, "帮忙看看")
+	if err != nil {
+		t.Fatalf("Invoke failed: %v", err)
+	}
+	if response != "喵，代码没问题" {
+		t.Errorf("Unexpected response: %q", response)
+	}
+	if usage == nil || usage.InputTokens != 20 || usage.CacheReadTokens != 100 || usage.OutputTokens != 8 {
+		t.Errorf("Unexpected usage: %+v", usage)
+	}
+	if got := stub.headers[0].Get("Authorization"); got != "Bearer sk-test" {
+		t.Errorf("Unexpected Authorization header: %q", got)
+	}
+
+	// 第二轮带上完整历史
+	if _, _, _, err := invokeHTTPBackend(stub.URL+"/v1", "openai", "sk-test", history, "再看一遍"); err != nil {
+		t.Fatalf("Second invoke failed: %v", err)
+	}
+	second := stub.requests[1]
+	if len(second) != 3 || second[1].Role != "assistant" || second[1].Content != "喵，代码没问题" || second[2].Content != "再看一遍" {
+		t.Errorf("Second turn should carry history: %+v", second)
+	}
+}
+
+// TestHTTPBackendAnthropic 测试 Anthropic 接口的流式解析、用量和请求头
+func TestHTTPBackendAnthropic(t *testing.T) {
+	sse := `event: message_start
+data: {"type":"message_start","message":{"usage":{"input_tokens":50,"cache_read_input_tokens":30,"output_tokens":1}}}
+
+event: content_block_start
+data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}
+
+event: ping
+data: {"type":"ping"}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"LGTM"}}
+
+event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":12}}
+
+event: message_stop
+data: {"type":"message_stop"}
+
+`
+	stub := newStubModelServer(t, "/v1/messages", sse)
+
+	response, usage, _, err := invokeHTTPBackend(stub.URL+"/v1", "anthropic", "sk-ant", nil, "review")
+	if err != nil {
+		t.Fatalf("Invoke failed: %v", err)
+	}
+	if response != "LGTM" {
+		t.Errorf("Unexpected response: %q", response)
+	}
+	// 输出用量以 message_delta 为准，不叠加 message_start 中的占位值
+	if usage == nil || usage.InputTokens != 50 || usage.CacheReadTokens != 30 || usage.OutputTokens != 12 {
+		t.Errorf("Unexpected usage: %+v", usage)
+	}
+	if stub.headers[0].Get("x-api-key") != "sk-ant" || stub.headers[0].Get("anthropic-version") == "" {
+		t.Errorf("Missing Anthropic headers: %v", stub.headers[0])
+	}
+}
+
+// TestHTTPBackendErrorStatus 测试非 200 响应返回错误并带上响应内容
+func TestHTTPBackendErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"invalid api key"}`, http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	_, _, history, err := invokeHTTPBackend(server.URL, "openai", "bad", nil, "hi")
+	if err == nil || !strings.Contains(err.Error(), "401") || !strings.Contains(err.Error(), "invalid api key") {
+		t.Errorf("Expected 401 error with body, got %v", err)
+	}
+	if len(history) != 0 {
+		t.Errorf("Failed turn should not be added to history: %+v", history)
+	}
+}
+
+// TestHTTPBackendStreamError 测试流中途的 error 事件作为调用失败返回，以便 failover 按错误分类
+func TestHTTPBackendStreamError(t *testing.T) {
+	sse := `event: message_start
+data: {"type":"message_start","message":{"usage":{"input_tokens":50,"output_tokens":1}}}
+
+event: error
+data: {"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}
+
+`
+	stub := newStubModelServer(t, "/v1/messages", sse)
+
+	result, err := agentcli.HTTPAdapter{}.Invoke(context.Background(), "review", agentcli.Options{
+		Model:     "test-model",
+		BaseURL:   stub.URL + "/v1",
+		APIFormat: agentcli.HTTPFormatAnthropic,
+	})
+	if err == nil || !strings.Contains(err.Error(), "overloaded") {
+		t.Fatalf("Expected overloaded error, got %v", err)
+	}
+	if result.SessionID != "" || result.Response != "" {
+		t.Errorf("Failed stream should not produce a reply or conversation: %+v", result)
+	}
+
+	// OpenAI 兼容接口在流中返回的 error 块
+	parsed := agentcli.HTTPAdapter{}.ParseLine(`data: {"error":{"type":"server_error","message":"upstream failed"}}`, agentcli.NewParseState())
+	if parsed.Error != "server_error: upstream failed" {
+		t.Errorf("Unexpected error: %q", parsed.Error)
+	}
+}
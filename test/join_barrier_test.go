@@ -0,0 +1,93 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// 汇合屏障合并逻辑简化版本用于测试（从 mode_free_discussion.go 复制）
+
+type JoinResult struct {
+	AgentName string
+	Status    string
+	Response  string
+}
+
+func mergeJoinMentions(sessionID string, results []JoinResult) []AgentCall {
+	merged := []AgentCall{}
+	index := make(map[string]int)
+	callers := make(map[string][]string)
+
+	for _, result := range results {
+		if result.Status != "completed" {
+			continue
+		}
+		for _, catName := range parseMentions(result.Response) {
+			if catName == result.AgentName {
+				continue
+			}
+			call := AgentCall{AgentName: catName, Prompt: result.Response, SessionID: sessionID, CallerName: result.AgentName}
+
+			i, exists := index[catName]
+			if !exists {
+				index[catName] = len(merged)
+				callers[catName] = []string{result.AgentName}
+				merged = append(merged, call)
+				continue
+			}
+
+			existing := &merged[i]
+			if len(callers[catName]) == 1 {
+				existing.Prompt = fmt.Sprintf("【%s】%s", existing.CallerName, existing.Prompt)
+			}
+			existing.Prompt = fmt.Sprintf("%s\n\n【%s】%s", existing.Prompt, result.AgentName, call.Prompt)
+			callers[catName] = append(callers[catName], result.AgentName)
+			existing.CallerName = strings.Join(callers[catName], "、")
+		}
+	}
+
+	return merged
+}
+
+// TestJoinMergesMentionsToSameCat 测试多只猫猫 @ 同一只猫猫时合并为一次调用
+func TestJoinMergesMentionsToSameCat(t *testing.T) {
+	calls := mergeJoinMentions("session-1", []JoinResult{
+		{AgentName: "花花", Status: "completed", Response: "@小乔 看看设计"},
+		{AgentName: "薇薇", Status: "completed", Response: "@小乔 看看实现"},
+	})
+
+	if len(calls) != 1 {
+		t.Fatalf("Expected 1 merged call, got %d: %+v", len(calls), calls)
+	}
+	if calls[0].AgentName != "小乔" || calls[0].CallerName != "花花、薇薇" {
+		t.Errorf("Unexpected merged call: %+v", calls[0])
+	}
+	if calls[0].Prompt != "【花花】@小乔 看看设计\n\n【薇薇】@小乔 看看实现" {
+		t.Errorf("Unexpected merged prompt: %q", calls[0].Prompt)
+	}
+}
+
+// TestJoinSkipsTimedOutResults 测试超时的子任务不产生后续调用
+func TestJoinSkipsTimedOutResults(t *testing.T) {
+	calls := mergeJoinMentions("session-1", []JoinResult{
+		{AgentName: "花花", Status: "completed", Response: "@薇薇 继续"},
+		{AgentName: "小乔", Status: "timeout", Response: "@薇薇 不该出现"},
+	})
+
+	if len(calls) != 1 || calls[0].CallerName != "花花" || calls[0].Prompt != "@薇薇 继续" {
+		t.Errorf("Unexpected calls: %+v", calls)
+	}
+}
+
+// TestJoinKeepsDispatchOrder 测试按派发顺序保留不同目标的调用
+func TestJoinKeepsDispatchOrder(t *testing.T) {
+	calls := mergeJoinMentions("session-1", []JoinResult{
+		{AgentName: "花花", Status: "completed", Response: "@薇薇 实现"},
+		{AgentName: "薇薇", Status: "completed", Response: "@小乔 测试"},
+	})
+
+	if len(calls) != 2 || calls[0].AgentName != "薇薇" || calls[1].AgentName != "小乔" {
+		t.Errorf("Unexpected call order: %+v", calls)
+	}
+}
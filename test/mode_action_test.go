@@ -0,0 +1,50 @@
+package test
+
+import (
+	"testing"
+
+	"cat-cafe/src/modeaction"
+)
+
+// TestModeActionValidateParams 测试动作参数校验
+func TestModeActionValidateParams(t *testing.T) {
+	action := modeaction.Action{
+		Name: "submit_code",
+		Params: []modeaction.Param{
+			{Name: "pr_url", Type: "string", Required: true},
+			{Name: "round", Type: "number"},
+			{Name: "draft", Type: "boolean"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		params  map[string]interface{}
+		wantErr bool
+	}{
+		{"必填参数齐全", map[string]interface{}{"pr_url": "https://example.com/pr/1"}, false},
+		{"可选参数类型正确", map[string]interface{}{"pr_url": "x", "round": float64(2), "draft": true}, false},
+		{"缺少必填参数", map[string]interface{}{"round": float64(1)}, true},
+		{"nil 参数", nil, true},
+		{"字符串类型错误", map[string]interface{}{"pr_url": 123}, true},
+		{"数字类型错误", map[string]interface{}{"pr_url": "x", "round": "two"}, true},
+		{"布尔类型错误", map[string]interface{}{"pr_url": "x", "draft": "yes"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := action.ValidateParams(tt.params)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateParams() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestModeActionNoParams 测试无参数动作
+func TestModeActionNoParams(t *testing.T) {
+	action := modeaction.Action{Name: "approve"}
+	if err := action.ValidateParams(map[string]interface{}{"extra": 1}); err != nil {
+		t.Errorf("Expected no error for action without params, got %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+package test
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+// 共识模式计票简化版本用于测试（从 mode_consensus.go 复制）
+
+type ConsensusBallot struct {
+	Voter   string
+	Ranking []string
+}
+
+type ConsensusTally struct {
+	Scores     map[string]int
+	Winner     string
+	Tie        []string
+	ValidVotes int
+}
+
+func parseConsensusRanking(response string, candidates []string) []string {
+	lines := strings.Split(response, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		lower := strings.ToLower(lines[i])
+		if !strings.Contains(lower, "排名") && !strings.Contains(lower, "投票") &&
+			!strings.Contains(lower, "ranking") && !strings.Contains(lower, "vote") {
+			continue
+		}
+		if ranking := orderByAppearance(lines[i], candidates); len(ranking) > 0 {
+			return ranking
+		}
+	}
+	return nil
+}
+
+func orderByAppearance(text string, candidates []string) []string {
+	type pos struct {
+		name  string
+		index int
+	}
+	found := make([]pos, 0, len(candidates))
+	for _, name := range candidates {
+		if idx := strings.Index(text, name); idx >= 0 {
+			found = append(found, pos{name: name, index: idx})
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].index < found[j].index })
+
+	ranking := make([]string, 0, len(found))
+	for _, p := range found {
+		ranking = append(ranking, p.name)
+	}
+	return ranking
+}
+
+func tallyConsensusBallots(ballots map[string]ConsensusBallot, proposals map[string]string) *ConsensusTally {
+	tally := &ConsensusTally{Scores: make(map[string]int)}
+	for name := range proposals {
+		tally.Scores[name] = 0
+	}
+
+	for _, ballot := range ballots {
+		if len(ballot.Ranking) == 0 {
+			continue
+		}
+		tally.ValidVotes++
+		n := len(ballot.Ranking)
+		for i, name := range ballot.Ranking {
+			if _, ok := tally.Scores[name]; ok {
+				tally.Scores[name] += n - i
+			}
+		}
+	}
+
+	best := -1
+	for name, score := range tally.Scores {
+		switch {
+		case score > best:
+			best = score
+			tally.Tie = []string{name}
+		case score == best:
+			tally.Tie = append(tally.Tie, name)
+		}
+	}
+	sort.Strings(tally.Tie)
+	if len(tally.Tie) == 1 {
+		tally.Winner = tally.Tie[0]
+		tally.Tie = nil
+	}
+	return tally
+}
+
+// TestParseConsensusRanking 测试选票解析
+func TestParseConsensusRanking(t *testing.T) {
+	candidates := []string{"薇薇", "小乔"}
+
+	tests := []struct {
+		name     string
+		response string
+		expected []string
+	}{
+		{"排名行", "小乔的方案更稳妥。\n排名：小乔 > 薇薇", []string{"小乔", "薇薇"}},
+		{"只投一票", "我投票给薇薇", []string{"薇薇"}},
+		{"英文标记", "Ranking: 薇薇, 小乔", []string{"薇薇", "小乔"}},
+		{"以最后的排名行为准", "排名：薇薇 > 小乔\n想了想改一下\n排名：小乔 > 薇薇", []string{"小乔", "薇薇"}},
+		{"没有排名", "两个方案都不错", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseConsensusRanking(tt.response, candidates)
+			if strings.Join(got, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestTallyConsensusBallots 测试 Borda 计分
+func TestTallyConsensusBallots(t *testing.T) {
+	proposals := map[string]string{"花花": "PG", "薇薇": "MySQL", "小乔": "Mongo"}
+
+	ballots := map[string]ConsensusBallot{
+		"花花": {Voter: "花花", Ranking: []string{"薇薇", "小乔"}},
+		"薇薇": {Voter: "薇薇", Ranking: []string{"花花", "小乔"}},
+		"小乔": {Voter: "小乔", Ranking: []string{"薇薇", "花花"}},
+	}
+	tally := tallyConsensusBallots(ballots, proposals)
+
+	if tally.ValidVotes != 3 {
+		t.Errorf("Expected 3 valid votes, got %d", tally.ValidVotes)
+	}
+	if tally.Scores["薇薇"] != 4 || tally.Scores["花花"] != 3 || tally.Scores["小乔"] != 2 {
+		t.Errorf("Unexpected scores: %v", tally.Scores)
+	}
+	if tally.Winner != "薇薇" {
+		t.Errorf("Expected winner 薇薇, got %s", tally.Winner)
+	}
+}
+
+// TestTallyConsensusTie 测试平票
+func TestTallyConsensusTie(t *testing.T) {
+	proposals := map[string]string{"花花": "A", "薇薇": "B"}
+	ballots := map[string]ConsensusBallot{
+		"花花": {Voter: "花花", Ranking: []string{"薇薇"}},
+		"薇薇": {Voter: "薇薇", Ranking: []string{"花花"}},
+	}
+	tally := tallyConsensusBallots(ballots, proposals)
+
+	if tally.Winner != "" {
+		t.Errorf("Expected no winner, got %s", tally.Winner)
+	}
+	if strings.Join(tally.Tie, ",") != "花花,薇薇" {
+		t.Errorf("Expected tie 花花,薇薇, got %v", tally.Tie)
+	}
+}
@@ -0,0 +1,164 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"cat-cafe/src/ipdflow"
+)
+
+// 测试 ipdflow 包中真实的 IPD 状态机和评审结论解析
+
+func newIPDFlow() (ipdflow.Flow, *ipdflow.State) {
+	flow := ipdflow.Flow{Architect: "花花", Reviewer: "薇薇"}
+	return flow, flow.NewState(time.Now())
+}
+
+// TestParseIPDVerdict 测试评审结论解析：只识别「结论：APPROVE/REJECT」标记
+func TestParseIPDVerdict(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		expected ipdflow.Verdict
+	}{
+		{"英文批准标记", "整体没问题。\n结论：APPROVE", ipdflow.VerdictApprove},
+		{"英文拒绝标记", "有内存泄漏。\n结论：REJECT", ipdflow.VerdictReject},
+		{"半角冒号和小写", "结论: approve", ipdflow.VerdictApprove},
+		{"以最后一个标记为准", "结论：REJECT\n修复后复查。结论：APPROVE", ipdflow.VerdictApprove},
+		{"标记优先于正文单词", "结论：REJECT\n修复后可以 APPROVE", ipdflow.VerdictReject},
+		{"APPROVED 不算标记", "结论：APPROVED", ipdflow.VerdictNone},
+		{"正文中的 APPROVE 不算", "修复后我会 APPROVE", ipdflow.VerdictNone},
+		{"正文中的 REJECT 不算", "一开始想 REJECT，看完后改为 APPROVE", ipdflow.VerdictNone},
+		{"未通过", "审查未通过", ipdflow.VerdictNone},
+		{"没通过", "这次没通过，请补充测试", ipdflow.VerdictNone},
+		{"暂不批准", "暂不批准，需要修改", ipdflow.VerdictNone},
+		{"中文通过", "代码审查通过", ipdflow.VerdictNone},
+		{"LGTM", "lgtm", ipdflow.VerdictNone},
+		{"无结论", "我还需要再看看", ipdflow.VerdictNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ipdflow.ParseVerdict(tt.response); got != tt.expected {
+				t.Errorf("ParseVerdict(%q) = %d, want %d", tt.response, got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestIPDFullFlow 测试 TR3 → TR5 → 完成 的完整流程
+func TestIPDFullFlow(t *testing.T) {
+	flow, state := newIPDFlow()
+
+	for _, phase := range []string{"tr3", "tr5"} {
+		if state.StepName() != phase+":coding" {
+			t.Fatalf("Expected %s:coding, got %s", phase, state.StepName())
+		}
+
+		next, err := flow.HandleAction(state, ipdflow.ActionSubmitCode, "", "")
+		if err != nil {
+			t.Fatalf("submit_code failed: %v", err)
+		}
+		if next != ipdflow.NextReview {
+			t.Fatalf("Expected review call, got %d", next)
+		}
+
+		if next = flow.OnResponse(state, "薇薇", "结论：APPROVE"); next != ipdflow.NextDebate || state.StepName() != phase+":debate" {
+			t.Fatalf("Expected debate, got step %s next %d", state.StepName(), next)
+		}
+		if next = flow.OnResponse(state, "花花", "我认为接口设计需要再斟酌"); next != ipdflow.NextRebuttal {
+			t.Fatalf("Expected rebuttal, got %d", next)
+		}
+		if next = flow.OnResponse(state, "薇薇", "这个风险可以接受"); next != ipdflow.NextFinalApproval || state.StepName() != phase+":final_approval" {
+			t.Fatalf("Expected final approval, got step %s next %d", state.StepName(), next)
+		}
+		flow.OnResponse(state, "花花", "结论：APPROVE")
+	}
+
+	if state.StepName() != "done" {
+		t.Errorf("Expected done, got %s", state.StepName())
+	}
+	if _, err := flow.HandleAction(state, ipdflow.ActionSubmitCode, "", ""); err == nil {
+		t.Error("Expected error after flow is done")
+	}
+}
+
+// TestIPDRejectReturnsToCoding 测试审查拒绝后回退到编码阶段并保留意见
+func TestIPDRejectReturnsToCoding(t *testing.T) {
+	flow, state := newIPDFlow()
+
+	if _, err := flow.HandleAction(state, ipdflow.ActionSubmitCode, "https://example.com/pr/1", ""); err != nil {
+		t.Fatalf("submit_code failed: %v", err)
+	}
+	flow.OnResponse(state, "薇薇", "缺少错误处理。结论：REJECT")
+
+	if state.StepName() != "tr3:coding" {
+		t.Errorf("Expected tr3:coding, got %s", state.StepName())
+	}
+	if len(state.PRInfo.Comments) != 1 {
+		t.Errorf("Expected 1 review comment, got %d", len(state.PRInfo.Comments))
+	}
+
+	// 第二轮提交
+	if _, err := flow.HandleAction(state, ipdflow.ActionSubmitCode, "", ""); err != nil {
+		t.Fatalf("second submit_code failed: %v", err)
+	}
+	if state.ReviewRound != 2 || state.PRInfo.URL != "https://example.com/pr/1" {
+		t.Errorf("Expected review round 2 with the PR kept, got %d %q", state.ReviewRound, state.PRInfo.URL)
+	}
+}
+
+// TestIPDNoVerdictAsksAgain 测试没有结论标记的回复不推进流程，而是追问同一只猫猫，超过次数后等待铲屎官
+func TestIPDNoVerdictAsksAgain(t *testing.T) {
+	flow, state := newIPDFlow()
+	flow.HandleAction(state, ipdflow.ActionSubmitCode, "", "")
+
+	for i := 0; i < ipdflow.MaxVerdictRetries; i++ {
+		if next := flow.OnResponse(state, "薇薇", "审查未通过"); next != ipdflow.NextAskVerdict {
+			t.Fatalf("Attempt %d: expected to ask for a verdict, got %d", i+1, next)
+		}
+	}
+	if next := flow.OnResponse(state, "薇薇", "暂不批准，需要修改"); next != ipdflow.NextNone {
+		t.Errorf("Expected to stop asking after %d retries, got %d", ipdflow.MaxVerdictRetries, next)
+	}
+	if state.StepName() != "tr3:review" || state.Approvals["薇薇"] {
+		t.Fatalf("Expected to stay in tr3:review without approval, got %s %v", state.StepName(), state.Approvals)
+	}
+
+	// 给出结论后追问次数清零
+	flow.OnResponse(state, "薇薇", "结论：APPROVE")
+	flow.OnResponse(state, "花花", "观点")
+	flow.OnResponse(state, "薇薇", "反驳")
+	if next := flow.OnResponse(state, "花花", "修复后我会 APPROVE"); next != ipdflow.NextAskVerdict {
+		t.Errorf("Expected to ask the architect for a verdict, got %d", next)
+	}
+	if state.StepName() != "tr3:final_approval" {
+		t.Errorf("Expected to stay in tr3:final_approval, got %s", state.StepName())
+	}
+}
+
+// TestIPDActionPhaseRestrictions 测试动作的阶段限制
+func TestIPDActionPhaseRestrictions(t *testing.T) {
+	flow, state := newIPDFlow()
+
+	if _, err := flow.HandleAction(state, ipdflow.ActionApprove, "", ""); err == nil {
+		t.Error("approve should fail in coding phase")
+	}
+	if _, err := flow.HandleAction(state, ipdflow.ActionFinalApprove, "", ""); err == nil {
+		t.Error("final_approve should fail in coding phase")
+	}
+	if _, err := flow.HandleAction(state, "unknown", "", ""); err == nil {
+		t.Error("unknown action should fail")
+	}
+
+	flow.HandleAction(state, ipdflow.ActionSubmitCode, "", "")
+	if _, err := flow.HandleAction(state, ipdflow.ActionSubmitCode, "", ""); err == nil {
+		t.Error("submit_code should fail in review phase")
+	}
+	if _, err := flow.HandleAction(state, ipdflow.ActionReject, "", "命名不规范"); err != nil {
+		t.Errorf("reject should succeed in review phase: %v", err)
+	}
+	if state.StepName() != "tr3:coding" {
+		t.Errorf("Expected tr3:coding after reject, got %s", state.StepName())
+	}
+}
@@ -0,0 +1,140 @@
+package test
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// 规划模式子任务解析简化版本用于测试（从 mode_planner.go 复制）
+
+type PlannerSubtask struct {
+	Agent string `json:"agent"`
+	Task  string `json:"task"`
+}
+
+var (
+	plannerJSONBlockRe = regexp.MustCompile("(?s)```(?:json)?\\s*(\\[.*?\\])\\s*```")
+	plannerListItemRe  = regexp.MustCompile(`^\s*(?:[-*]|\d+[.)、])\s*@?([^\s:：]+)\s*[:：]\s*(.+)$`)
+)
+
+func parsePlannerSubtasks(response string, workers []string) []PlannerSubtask {
+	candidates := []string{}
+	if match := plannerJSONBlockRe.FindStringSubmatch(response); match != nil {
+		candidates = append(candidates, match[1])
+	}
+	if start, end := strings.Index(response, "["), strings.LastIndex(response, "]"); start >= 0 && end > start {
+		candidates = append(candidates, response[start:end+1])
+	}
+
+	for _, candidate := range candidates {
+		var raw []map[string]interface{}
+		if err := json.Unmarshal([]byte(candidate), &raw); err != nil {
+			continue
+		}
+		subtasks := make([]PlannerSubtask, 0, len(raw))
+		for _, item := range raw {
+			agent, _ := item["agent"].(string)
+			task, _ := item["task"].(string)
+			if task == "" {
+				task, _ = item["description"].(string)
+			}
+			if task = strings.TrimSpace(task); task != "" {
+				subtasks = append(subtasks, PlannerSubtask{Agent: strings.TrimPrefix(strings.TrimSpace(agent), "@"), Task: task})
+			}
+		}
+		if len(subtasks) > 0 {
+			return subtasks
+		}
+	}
+
+	var subtasks []PlannerSubtask
+	for _, line := range strings.Split(response, "\n") {
+		match := plannerListItemRe.FindStringSubmatch(line)
+		if match == nil || !inList(workers, match[1]) {
+			continue
+		}
+		subtasks = append(subtasks, PlannerSubtask{Agent: match[1], Task: strings.TrimSpace(match[2])})
+	}
+	return subtasks
+}
+
+// SubtaskGroup 子任务组简化版本用于测试（从 mode_interface.go 复制）
+type SubtaskGroup struct {
+	ID       string
+	Subtasks map[string]string // subtaskID -> status
+}
+
+func (g *SubtaskGroup) Done() bool {
+	for _, status := range g.Subtasks {
+		if status == "pending" {
+			return false
+		}
+	}
+	return true
+}
+
+// TestParsePlannerSubtasks 测试规划回复解析
+func TestParsePlannerSubtasks(t *testing.T) {
+	workers := []string{"薇薇", "小乔"}
+
+	tests := []struct {
+		name     string
+		response string
+		expected []PlannerSubtask
+	}{
+		{
+			name:     "JSON 代码块",
+			response: "拆分如下：\n```json\n[{\"agent\": \"薇薇\", \"task\": \"实现接口\"}, {\"agent\": \"@小乔\", \"task\": \"写测试\"}]\n```\n完成后汇总。",
+			expected: []PlannerSubtask{{Agent: "薇薇", Task: "实现接口"}, {Agent: "小乔", Task: "写测试"}},
+		},
+		{
+			name:     "裸 JSON 数组并兼容 description 字段",
+			response: "[{\"agent\": \"小乔\", \"description\": \"调研方案\"}]",
+			expected: []PlannerSubtask{{Agent: "小乔", Task: "调研方案"}},
+		},
+		{
+			name:     "列表格式",
+			response: "1. @薇薇：实现后端\n2. @小乔: 实现前端\n- @路人: 不在执行名单",
+			expected: []PlannerSubtask{{Agent: "薇薇", Task: "实现后端"}, {Agent: "小乔", Task: "实现前端"}},
+		},
+		{
+			name:     "没有子任务",
+			response: "这个问题很简单，答案是 42。",
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parsePlannerSubtasks(tt.response, workers)
+			if len(got) != len(tt.expected) {
+				t.Fatalf("Expected %d subtasks, got %d: %+v", len(tt.expected), len(got), got)
+			}
+			for i := range got {
+				if got[i] != tt.expected[i] {
+					t.Errorf("Subtask %d: expected %+v, got %+v", i, tt.expected[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+// TestSubtaskGroupDone 测试子任务组在全部结束后才算完成
+func TestSubtaskGroupDone(t *testing.T) {
+	group := &SubtaskGroup{
+		ID:       "plan_1",
+		Subtasks: map[string]string{"plan_1_1": "pending", "plan_1_2": "pending"},
+	}
+
+	group.Subtasks["plan_1_1"] = "completed"
+	if group.Done() {
+		t.Error("Group should not be done with pending subtasks")
+	}
+
+	group.Subtasks["plan_1_2"] = "failed"
+	if !group.Done() {
+		t.Error("Group should be done when all subtasks finished")
+	}
+}
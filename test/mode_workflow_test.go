@@ -0,0 +1,347 @@
+package test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+// 工作流引擎简化版本用于测试（与 src/mode_workflow.go 保持一致）
+
+type WorkflowCondition struct {
+	Contains    string
+	NotContains string
+}
+
+type WorkflowTransition struct {
+	When WorkflowCondition
+	Next []string
+}
+
+type WorkflowStep struct {
+	Name        string
+	Agent       string
+	Prompt      string
+	DependsOn   []string
+	Transitions []WorkflowTransition
+	Next        []string
+}
+
+type WorkflowState struct {
+	Status    string
+	Input     string
+	Active    []string
+	Completed map[string]bool
+	Outputs   map[string]string
+	Visits    map[string]int
+}
+
+type WorkflowMode struct {
+	start     string
+	maxVisits int
+	steps     map[string]*WorkflowStep
+	state     *WorkflowState
+}
+
+func NewWorkflowMode(start string, steps []WorkflowStep) *WorkflowMode {
+	m := &WorkflowMode{start: start, maxVisits: 3, steps: make(map[string]*WorkflowStep)}
+	for i := range steps {
+		m.steps[steps[i].Name] = &steps[i]
+	}
+	return m
+}
+
+func (m *WorkflowMode) Start(input string) []AgentCall {
+	m.state = &WorkflowState{
+		Status:    "running",
+		Input:     input,
+		Completed: make(map[string]bool),
+		Outputs:   make(map[string]string),
+		Visits:    make(map[string]int),
+	}
+	return []AgentCall{m.activate(m.start, input)}
+}
+
+func (m *WorkflowMode) OnAgentResponse(agentName string, response string) []AgentCall {
+	wf := m.state
+	stepName := ""
+	for _, name := range wf.Active {
+		if m.steps[name].Agent == agentName {
+			stepName = name
+			break
+		}
+	}
+	if stepName == "" {
+		return nil
+	}
+
+	step := m.steps[stepName]
+	wf.Active = removeFromList(wf.Active, stepName)
+	wf.Completed[stepName] = true
+	wf.Outputs[stepName] = response
+
+	nextSteps := step.Next
+	for _, tr := range step.Transitions {
+		if matchesCondition(tr.When, response) {
+			nextSteps = tr.Next
+			break
+		}
+	}
+
+	var calls []AgentCall
+	for _, next := range nextSteps {
+		if next == "end" || inList(wf.Active, next) || !m.depsSatisfied(next) {
+			continue
+		}
+		if wf.Visits[next] >= m.maxVisits {
+			wf.Status = "stopped"
+			wf.Active = nil
+			return nil
+		}
+		if wf.Completed[next] {
+			m.clearDownstream(next)
+		}
+		calls = append(calls, m.activate(next, response))
+	}
+
+	if len(wf.Active) == 0 {
+		wf.Status = "completed"
+	}
+	return calls
+}
+
+func (m *WorkflowMode) clearDownstream(start string) {
+	visited := map[string]bool{start: true}
+	queue := []string{start}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		delete(m.state.Completed, name)
+
+		step := m.steps[name]
+		successors := append([]string{}, step.Next...)
+		for _, tr := range step.Transitions {
+			successors = append(successors, tr.Next...)
+		}
+		for _, other := range m.steps {
+			if inList(other.DependsOn, name) {
+				successors = append(successors, other.Name)
+			}
+		}
+		for _, next := range successors {
+			if next == "end" || visited[next] {
+				continue
+			}
+			visited[next] = true
+			queue = append(queue, next)
+		}
+	}
+}
+
+func (m *WorkflowMode) depsSatisfied(stepName string) bool {
+	for _, dep := range m.steps[stepName].DependsOn {
+		if !m.state.Completed[dep] {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *WorkflowMode) activate(stepName string, previous string) AgentCall {
+	step := m.steps[stepName]
+	m.state.Visits[stepName]++
+	m.state.Active = append(m.state.Active, stepName)
+
+	prompt := step.Prompt
+	if prompt == "" {
+		prompt = "{{.Previous}}"
+	}
+	tmpl := template.Must(template.New(stepName).Option("missingkey=zero").Parse(prompt))
+	var buf bytes.Buffer
+	tmpl.Execute(&buf, map[string]interface{}{
+		"Input":    m.state.Input,
+		"Previous": previous,
+		"Outputs":  m.state.Outputs,
+	})
+	return AgentCall{AgentName: step.Agent, Prompt: buf.String(), CallerName: "工作流"}
+}
+
+func matchesCondition(cond WorkflowCondition, output string) bool {
+	if cond.Contains != "" && !strings.Contains(output, cond.Contains) {
+		return false
+	}
+	if cond.NotContains != "" && strings.Contains(output, cond.NotContains) {
+		return false
+	}
+	return true
+}
+
+func inList(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func removeFromList(list []string, s string) []string {
+	for i, item := range list {
+		if item == s {
+			return append(list[:i:i], list[i+1:]...)
+		}
+	}
+	return list
+}
+
+func newPipelineWorkflow() *WorkflowMode {
+	return NewWorkflowMode("design", []WorkflowStep{
+		{Name: "design", Agent: "花花", Prompt: "设计：{{.Input}}", Next: []string{"implement"}},
+		{Name: "implement", Agent: "薇薇", Prompt: "按设计实现：{{index .Outputs \"design\"}}", Next: []string{"review"}},
+		{
+			Name:        "review",
+			Agent:       "小乔",
+			Transitions: []WorkflowTransition{{When: WorkflowCondition{Contains: "LGTM"}, Next: []string{"end"}}},
+			Next:        []string{"implement"},
+		},
+	})
+}
+
+// TestWorkflowPipeline 测试 设计 → 实现 → 审查 流水线
+func TestWorkflowPipeline(t *testing.T) {
+	mode := newPipelineWorkflow()
+
+	calls := mode.Start("做一个登录页")
+	if len(calls) != 1 || calls[0].AgentName != "花花" || calls[0].Prompt != "设计：做一个登录页" {
+		t.Fatalf("Unexpected start calls: %+v", calls)
+	}
+
+	calls = mode.OnAgentResponse("花花", "方案A")
+	if len(calls) != 1 || calls[0].AgentName != "薇薇" || calls[0].Prompt != "按设计实现：方案A" {
+		t.Fatalf("Unexpected implement calls: %+v", calls)
+	}
+
+	calls = mode.OnAgentResponse("薇薇", "实现完成")
+	if len(calls) != 1 || calls[0].AgentName != "小乔" || calls[0].Prompt != "实现完成" {
+		t.Fatalf("Unexpected review calls: %+v", calls)
+	}
+
+	calls = mode.OnAgentResponse("小乔", "LGTM")
+	if len(calls) != 0 {
+		t.Errorf("Expected no calls after LGTM, got %+v", calls)
+	}
+	if mode.state.Status != "completed" {
+		t.Errorf("Expected completed, got %s", mode.state.Status)
+	}
+}
+
+// TestWorkflowReviewLoopStops 测试审查不通过的回环超过上限后停止
+func TestWorkflowReviewLoopStops(t *testing.T) {
+	mode := newPipelineWorkflow()
+	mode.Start("需求")
+	mode.OnAgentResponse("花花", "方案")
+
+	for i := 0; i < 10 && mode.state.Status == "running"; i++ {
+		mode.OnAgentResponse("薇薇", "实现")
+		mode.OnAgentResponse("小乔", "还有问题")
+	}
+
+	if mode.state.Status != "stopped" {
+		t.Errorf("Expected stopped after exceeding max visits, got %s", mode.state.Status)
+	}
+	if mode.state.Visits["implement"] != 3 {
+		t.Errorf("Expected implement visited 3 times, got %d", mode.state.Visits["implement"])
+	}
+}
+
+// TestWorkflowDAGJoin 测试并行分支在 depends_on 处汇合
+func TestWorkflowDAGJoin(t *testing.T) {
+	mode := NewWorkflowMode("plan", []WorkflowStep{
+		{Name: "plan", Agent: "花花", Next: []string{"backend", "frontend"}},
+		{Name: "backend", Agent: "薇薇", Next: []string{"integrate"}},
+		{Name: "frontend", Agent: "小乔", Next: []string{"integrate"}},
+		{
+			Name:      "integrate",
+			Agent:     "花花",
+			DependsOn: []string{"backend", "frontend"},
+			Prompt:    "{{index .Outputs \"backend\"}}+{{index .Outputs \"frontend\"}}",
+			Next:      []string{"end"},
+		},
+	})
+
+	mode.Start("需求")
+	calls := mode.OnAgentResponse("花花", "计划")
+	if len(calls) != 2 {
+		t.Fatalf("Expected 2 parallel calls, got %d", len(calls))
+	}
+
+	if calls = mode.OnAgentResponse("薇薇", "API"); len(calls) != 0 {
+		t.Fatalf("Join step should wait for frontend, got %+v", calls)
+	}
+
+	calls = mode.OnAgentResponse("小乔", "UI")
+	if len(calls) != 1 || calls[0].Prompt != "API+UI" {
+		t.Fatalf("Unexpected join calls: %+v", calls)
+	}
+
+	mode.OnAgentResponse("花花", "集成完成")
+	if mode.state.Status != "completed" {
+		t.Errorf("Expected completed, got %s", mode.state.Status)
+	}
+}
+
+// TestWorkflowLoopBackResetsJoin 测试回环后汇合点等待本轮所有分支重新完成，不使用上一轮的完成标记
+func TestWorkflowLoopBackResetsJoin(t *testing.T) {
+	mode := NewWorkflowMode("plan", []WorkflowStep{
+		{Name: "plan", Agent: "花花", Next: []string{"backend", "frontend"}},
+		{Name: "backend", Agent: "薇薇", Next: []string{"integrate"}},
+		{Name: "frontend", Agent: "小乔", Next: []string{"integrate"}},
+		{
+			Name:        "integrate",
+			Agent:       "花花",
+			DependsOn:   []string{"backend", "frontend"},
+			Prompt:      "{{index .Outputs \"backend\"}}+{{index .Outputs \"frontend\"}}",
+			Transitions: []WorkflowTransition{{When: WorkflowCondition{Contains: "LGTM"}, Next: []string{"end"}}},
+			Next:        []string{"plan"},
+		},
+	})
+
+	mode.Start("需求")
+	mode.OnAgentResponse("花花", "计划")
+	mode.OnAgentResponse("薇薇", "API v1")
+	mode.OnAgentResponse("小乔", "UI v1")
+
+	calls := mode.OnAgentResponse("花花", "集成失败")
+	if len(calls) != 1 || calls[0].AgentName != "花花" {
+		t.Fatalf("Expected loop back to plan, got %+v", calls)
+	}
+	if calls = mode.OnAgentResponse("花花", "计划 v2"); len(calls) != 2 {
+		t.Fatalf("Expected 2 parallel calls in the second pass, got %+v", calls)
+	}
+
+	if calls = mode.OnAgentResponse("薇薇", "API v2"); len(calls) != 0 {
+		t.Fatalf("Join step should wait for frontend in the second pass, got %+v", calls)
+	}
+	calls = mode.OnAgentResponse("小乔", "UI v2")
+	if len(calls) != 1 || calls[0].Prompt != "API v2+UI v2" {
+		t.Fatalf("Unexpected join calls: %+v", calls)
+	}
+}
+
+// TestWorkflowStopDispatchesNothing 测试超过回环上限停止时不再派发同一轮已激活的步骤
+func TestWorkflowStopDispatchesNothing(t *testing.T) {
+	mode := NewWorkflowMode("review", []WorkflowStep{
+		{Name: "review", Agent: "小乔", Next: []string{"docs", "review"}},
+		{Name: "docs", Agent: "薇薇", Next: []string{"end"}},
+	})
+	mode.maxVisits = 1
+
+	mode.Start("需求")
+	if calls := mode.OnAgentResponse("小乔", "还有问题"); calls != nil {
+		t.Errorf("Stopped workflow should dispatch nothing, got %+v", calls)
+	}
+	if mode.state.Status != "stopped" {
+		t.Errorf("Expected stopped, got %s", mode.state.Status)
+	}
+}
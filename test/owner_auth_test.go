@@ -0,0 +1,77 @@
+package test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// 本机请求判断简化版本用于测试（从 owner_auth.go 复制）
+
+func isLocalRequest(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil || !isLocalHost(host) {
+		return false
+	}
+	if r.Header.Get("X-Forwarded-For") != "" || r.Header.Get("X-Real-IP") != "" {
+		return false
+	}
+	if !isLocalHost(hostWithoutPort(r.Host)) {
+		return false
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || !isLocalHost(u.Hostname()) {
+			return false
+		}
+	}
+	return true
+}
+
+func hostWithoutPort(hostport string) string {
+	if host, _, err := net.SplitHostPort(hostport); err == nil {
+		return host
+	}
+	return strings.Trim(hostport, "[]")
+}
+
+func isLocalHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// TestIsLocalRequest 测试未设置铲屎官令牌时只接受本机直接发起的请求
+func TestIsLocalRequest(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		host       string
+		headers    map[string]string
+		want       bool
+	}{
+		{"curl", "127.0.0.1:51234", "localhost:8080", nil, true},
+		{"ipv6 loopback", "[::1]:51234", "[::1]:8080", nil, true},
+		{"local frontend", "127.0.0.1:51234", "localhost:8080", map[string]string{"Origin": "http://localhost:3000"}, true},
+		{"remote client", "192.168.1.20:51234", "192.168.1.10:8080", nil, false},
+		{"other website", "127.0.0.1:51234", "localhost:8080", map[string]string{"Origin": "https://evil.example"}, false},
+		{"dns rebinding", "127.0.0.1:51234", "evil.example:8080", map[string]string{"Origin": "http://evil.example:8080"}, false},
+		{"reverse proxy", "127.0.0.1:51234", "localhost:8080", map[string]string{"X-Forwarded-For": "203.0.113.7"}, false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/api/cats", nil)
+		req.RemoteAddr = tt.remoteAddr
+		req.Host = tt.host
+		for name, value := range tt.headers {
+			req.Header.Set(name, value)
+		}
+		if got := isLocalRequest(req); got != tt.want {
+			t.Errorf("%s: isLocalRequest = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package test
+
+import (
+	"strings"
+	"testing"
+)
+
+// @铲屎官 提问解析简化版本用于测试（从 owner_handoff.go 复制）
+
+const OwnerName = "铲屎官"
+
+func parseOwnerQuestion(response string) (string, bool) {
+	lines := strings.Split(response, "\n")
+	found := false
+	var question strings.Builder
+
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+
+		if strings.HasPrefix(line, "@") {
+			parts := strings.SplitN(line[1:], " ", 2)
+			if strings.TrimSpace(parts[0]) != OwnerName {
+				if found {
+					break
+				}
+				continue
+			}
+			found = true
+			if len(parts) > 1 {
+				question.WriteString(strings.TrimSpace(parts[1]))
+			}
+			continue
+		}
+
+		if found && line != "" {
+			if question.Len() > 0 {
+				question.WriteString("\n")
+			}
+			question.WriteString(line)
+		}
+	}
+
+	if !found {
+		return "", false
+	}
+	if question.Len() == 0 {
+		return strings.TrimSpace(response), true
+	}
+	return question.String(), true
+}
+
+// TestParseOwnerQuestion 测试 @铲屎官 提问解析
+func TestParseOwnerQuestion(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		question string
+		found    bool
+	}{
+		{"同一行提问", "接口写好了。\n@铲屎官 数据库用 MySQL 还是 PG？", "数据库用 MySQL 还是 PG？", true},
+		{"多行提问", "@铲屎官 有两个问题：\n1. 部署环境\n2. 域名", "有两个问题：\n1. 部署环境\n2. 域名", true},
+		{"遇到下一个 @ 停止", "@铲屎官 确认需求\n@薇薇 先别动", "确认需求", true},
+		{"只有 @铲屎官", "方案写完了，请过目\n@铲屎官", "方案写完了，请过目\n@铲屎官", true},
+		{"没有提问", "@薇薇 帮我审查一下", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			question, found := parseOwnerQuestion(tt.response)
+			if found != tt.found || question != tt.question {
+				t.Errorf("Expected (%q, %v), got (%q, %v)", tt.question, tt.found, question, found)
+			}
+		})
+	}
+}
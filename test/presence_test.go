@@ -0,0 +1,86 @@
+package test
+
+import (
+	"testing"
+	"time"
+)
+
+// 猫猫在线状态简化版本用于测试（从 presence.go 复制）
+
+const (
+	CatStatusIdle    = "idle"
+	CatStatusBusy    = "busy"
+	CatStatusOffline = "offline"
+)
+
+type WorkerPresence struct {
+	AgentName     string
+	Worker        string
+	Status        string
+	TaskID        string
+	TaskStartedAt *time.Time
+	UpdatedAt     time.Time
+}
+
+type CatPresence struct {
+	Status      string
+	Workers     int
+	CurrentTask string
+	LastSeen    *time.Time
+}
+
+func summarizePresence(workers []WorkerPresence) CatPresence {
+	summary := CatPresence{Status: CatStatusOffline, Workers: len(workers)}
+	var earliest *time.Time
+	for i := range workers {
+		worker := &workers[i]
+		if summary.LastSeen == nil || worker.UpdatedAt.After(*summary.LastSeen) {
+			summary.LastSeen = &worker.UpdatedAt
+		}
+		if worker.Status != CatStatusBusy {
+			summary.Status = CatStatusIdle
+			continue
+		}
+		if summary.Status == CatStatusOffline {
+			summary.Status = CatStatusBusy
+		}
+		if worker.TaskStartedAt != nil && (earliest == nil || worker.TaskStartedAt.Before(*earliest)) {
+			earliest = worker.TaskStartedAt
+			summary.CurrentTask = worker.TaskID
+		}
+	}
+	if summary.Status != CatStatusBusy {
+		summary.CurrentTask = ""
+	}
+	return summary
+}
+
+// TestSummarizePresence 测试由工作进程心跳汇总猫猫的在线状态
+func TestSummarizePresence(t *testing.T) {
+	now := time.Now()
+	earlier := now.Add(-time.Minute)
+
+	summary := summarizePresence(nil)
+	if summary.Status != CatStatusOffline || summary.Workers != 0 || summary.LastSeen != nil {
+		t.Errorf("Expected offline without workers, got %+v", summary)
+	}
+
+	idle := WorkerPresence{AgentName: "花花", Worker: "w1", Status: CatStatusIdle, UpdatedAt: earlier}
+	busy := WorkerPresence{AgentName: "花花", Worker: "w2", Status: CatStatusBusy, TaskID: "task_2", TaskStartedAt: &now, UpdatedAt: now}
+	busyEarlier := WorkerPresence{AgentName: "花花", Worker: "w3", Status: CatStatusBusy, TaskID: "task_1", TaskStartedAt: &earlier, UpdatedAt: earlier}
+
+	// 有空闲进程即可立即回答
+	summary = summarizePresence([]WorkerPresence{busy, idle})
+	if summary.Status != CatStatusIdle || summary.Workers != 2 || summary.CurrentTask != "" {
+		t.Errorf("Expected idle with a free worker, got %+v", summary)
+	}
+	if !summary.LastSeen.Equal(now) {
+		t.Errorf("Expected last seen to be the latest heartbeat, got %v", summary.LastSeen)
+	}
+
+	// 全部忙碌时报告最早开始的任务
+	summary = summarizePresence([]WorkerPresence{busy, busyEarlier})
+	if summary.Status != CatStatusBusy || summary.CurrentTask != "task_1" {
+		t.Errorf("Expected busy with the earliest task, got %+v", summary)
+	}
+}
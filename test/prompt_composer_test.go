@@ -0,0 +1,174 @@
+package test
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cat-cafe/src/prompt"
+)
+
+// 测试 prompt 包中真实的提示词组合器
+// 期望输出保存在 testdata/prompts/*.golden，修改模板后用 go test -run TestPromptComposer -update 重新生成
+
+var updateGolden = flag.Bool("update", false, "重新生成 golden 文件")
+
+// testdataPrompts 返回 testdata/prompts 下的文件路径
+func testdataPrompts(names ...string) []string {
+	paths := make([]string, len(names))
+	for i, name := range names {
+		paths[i] = filepath.Join("testdata", "prompts", name)
+	}
+	return paths
+}
+
+// writePromptFile 在临时目录中写入一个提示词文件
+func writePromptFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Write %s failed: %v", name, err)
+	}
+	return path
+}
+
+func newPromptComposer(t *testing.T, cfg prompt.Config) *prompt.Composer {
+	t.Helper()
+	composer, err := prompt.New(cfg)
+	if err != nil {
+		t.Fatalf("New composer failed: %v", err)
+	}
+	return composer
+}
+
+// assertGolden 比较输出与 golden 文件，-update 时改为写入
+func assertGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", "prompts", name+".golden")
+	if *updateGolden {
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatalf("Write golden failed: %v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Read golden failed: %v", err)
+	}
+	if got != string(want) {
+		t.Errorf("%s mismatch\n--- got ---\n%s\n--- want ---\n%s", name, got, want)
+	}
+}
+
+// TestPromptComposerGolden 测试各上下文策略下组合后的 prompt 与 golden 文件一致
+func TestPromptComposerGolden(t *testing.T) {
+	composer := newPromptComposer(t, prompt.Config{
+		Files: testdataPrompts("system.md", "dev_sop.md"),
+		ModeFiles: map[string][]string{
+			"ipd":        testdataPrompts("mode_ipd.md"),
+			"ipd:review": testdataPrompts("mode_ipd_review.md"),
+		},
+	})
+
+	base := prompt.Data{
+		CatName:       "花花",
+		SessionID:     "sess_abc123",
+		TaskID:        "task_1",
+		WorkspacePath: "/work/cat-cafe",
+		Message:       "@花花 帮忙实现登录接口",
+	}
+
+	tests := []struct {
+		name   string
+		layout string
+		data   func(prompt.Data) prompt.Data
+	}{
+		{"orchestrated", prompt.LayoutOrchestrated, func(d prompt.Data) prompt.Data {
+			d.Summaries = "[Session #1] 讨论了登录方案"
+			d.History = "[用户] 我们需要一个登录接口\n[薇薇] 建议使用 JWT"
+			return d
+		}},
+		{"orchestrated_mode_step", prompt.LayoutOrchestrated, func(d prompt.Data) prompt.Data {
+			d.Mode, d.ModeStep = "ipd", "review"
+			d.History = "[用户] 请评审"
+			return d
+		}},
+		{"cli_managed_first", prompt.LayoutCLIManaged, func(d prompt.Data) prompt.Data {
+			d.Mode = "ipd"
+			d.History = "[用户] 我们需要一个登录接口"
+			return d
+		}},
+		{"cli_managed_resumed", prompt.LayoutCLIManaged, func(d prompt.Data) prompt.Data {
+			d.Resumed = true
+			d.History = "[薇薇] 接口定义已更新"
+			return d
+		}},
+		{"cli_managed_compressed", prompt.LayoutCLIManaged, func(d prompt.Data) prompt.Data {
+			d.Compressed = true
+			d.Summaries = "[Session #1] 讨论了登录方案"
+			return d
+		}},
+		{"legacy_no_history", prompt.LayoutLegacy, func(d prompt.Data) prompt.Data {
+			d.WorkspacePath = ""
+			return d
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := composer.Render(tt.layout, tt.data(base))
+			if err != nil {
+				t.Fatalf("Render failed: %v", err)
+			}
+			assertGolden(t, tt.name, got)
+		})
+	}
+}
+
+// TestPromptComposerLayoutOverride 测试自定义骨架只覆盖重新定义的部分
+func TestPromptComposerLayoutOverride(t *testing.T) {
+	composer := newPromptComposer(t, prompt.Config{
+		Files:      testdataPrompts("system.md"),
+		LayoutPath: writePromptFile(t, "layout.tmpl", `{{define "reply"}}[{{.TaskID}}] {{.Message}}{{end}}`),
+	})
+
+	got, err := composer.Render(prompt.LayoutCLIManaged, prompt.Data{CatName: "小乔", TaskID: "task_9", Message: "喵", Resumed: true})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if got != "[task_9] 喵" {
+		t.Errorf("Unexpected prompt: %q", got)
+	}
+
+	got, err = composer.Render(prompt.LayoutLegacy, prompt.Data{CatName: "小乔", TaskID: "task_9", Message: "喵"})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if !strings.HasPrefix(got, "你是小乔，一只认真负责的猫猫。\n\n====") || !strings.HasSuffix(got, "用户需求：\n喵") {
+		t.Errorf("Unexpected legacy prompt: %q", got)
+	}
+}
+
+// TestPromptComposerUnknownField 测试引用不存在的变量在创建时试渲染即报错
+func TestPromptComposerUnknownField(t *testing.T) {
+	bad := writePromptFile(t, "bad.md", "{{.CatNmae}}")
+
+	if _, err := prompt.New(prompt.Config{Files: append(testdataPrompts("system.md"), bad)}); err == nil {
+		t.Error("Expected an error for an unknown field in a prompt file")
+	}
+	if _, err := prompt.New(prompt.Config{
+		Files:     testdataPrompts("system.md"),
+		ModeFiles: map[string][]string{"ipd": {bad}},
+	}); err == nil {
+		t.Error("Expected an error for an unknown field in a mode prompt file")
+	}
+}
+
+// TestPromptComposerMissingFile 测试提示词文件缺失时创建失败
+func TestPromptComposerMissingFile(t *testing.T) {
+	if _, err := prompt.New(prompt.Config{Files: testdataPrompts("missing.md")}); err == nil {
+		t.Error("Expected an error for a missing prompt file")
+	}
+}
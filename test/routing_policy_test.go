@@ -0,0 +1,65 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+)
+
+// 任务路由策略简化版本用于测试（从 scheduler.go 复制）
+
+const (
+	RoutingOrchestrator = "orchestrator"
+	RoutingWorker       = "worker"
+)
+
+func ParseRoutingPolicy(policy string) (string, error) {
+	switch policy {
+	case "", RoutingOrchestrator:
+		return RoutingOrchestrator, nil
+	case RoutingWorker:
+		return RoutingWorker, nil
+	}
+	return "", fmt.Errorf("未知的路由策略: %s", policy)
+}
+
+// workerShouldDispatch 工作进程是否自行派发回复中的 @ 调用（与 agent_worker.go 的判断一致）
+func workerShouldDispatch(task TaskMessage) bool {
+	return task.Routing == RoutingWorker
+}
+
+// TestParseRoutingPolicy 测试路由策略参数校验
+func TestParseRoutingPolicy(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{"", RoutingOrchestrator, false},
+		{"orchestrator", RoutingOrchestrator, false},
+		{"worker", RoutingWorker, false},
+		{"both", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseRoutingPolicy(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRoutingPolicy(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+		}
+		if got != tt.expected {
+			t.Errorf("ParseRoutingPolicy(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+// TestWorkerDispatchOptIn 测试只有显式选择 worker 路由的任务才由工作进程派发
+func TestWorkerDispatchOptIn(t *testing.T) {
+	sessionTask := TaskMessage{TaskID: "task_1"}
+	if workerShouldDispatch(sessionTask) {
+		t.Error("Task without routing should be dispatched by orchestrator")
+	}
+
+	standalone := TaskMessage{TaskID: "task_2", Routing: RoutingWorker}
+	if !workerShouldDispatch(standalone) {
+		t.Error("Standalone task with worker routing should be dispatched by worker")
+	}
+}
@@ -17,8 +17,18 @@ import (
 type AgentConfig struct {
 	Name             string `yaml:"name"`
 	Pipe             string `yaml:"pipe"`
+	CLIType          string `yaml:"cli_type"`
 	ExecCmd          string `yaml:"exec_cmd"`
 	SystemPromptPath string `yaml:"system_prompt_path"`
+	Timeout          int    `yaml:"timeout,omitempty"`
+
+	Model          string            `yaml:"model,omitempty"`
+	PermissionMode string            `yaml:"permission_mode,omitempty"`
+	ApprovalMode   string            `yaml:"approval_mode,omitempty"`
+	AllowedTools   []string          `yaml:"allowed_tools,omitempty"`
+	DeniedTools    []string          `yaml:"denied_tools,omitempty"`
+	ExtraArgs      []string          `yaml:"extra_args,omitempty"`
+	Env            map[string]string `yaml:"env,omitempty"`
 }
 
 // Config 系统配置
@@ -43,6 +53,8 @@ type TaskMessage struct {
 	MaxRetries  int       `json:"max_retries"`
 	CreatedAt   time.Time `json:"created_at"`
 	Status      string    `json:"status"`
+	Routing     string    `json:"routing,omitempty"`
+	Timeout     int       `json:"timeout,omitempty"`
 }
 
 // AgentState Agent 状态
@@ -139,6 +139,27 @@ func TestStorage_SessionMarkdown_Read(t *testing.T) {
 	assert.Equal(t, "收到", events[1].Content)
 }
 
+func TestStorage_OwnerRequestEvent_RoundTrip(t *testing.T) {
+	// 猫猫 @铲屎官 的提问写入 Markdown 后能按类型解析回来
+	mgr, _, cleanup := setupSessionChainTest(t)
+	defer cleanup()
+
+	threadID := "thread-storage-owner"
+	_, err := mgr.GetOrCreateChain(threadID)
+	require.NoError(t, err)
+
+	require.NoError(t, mgr.AppendEvent(threadID, makeCatEvent("花花", "@铲屎官 用 MySQL 还是 PG？")))
+	require.NoError(t, mgr.AppendEvent(threadID, makeEvent(EventOwnerRequest, "花花", "用 MySQL 还是 PG？")))
+
+	_, events, err := mgr.ReadSessionMarkdown(threadID, "S001")
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	assert.Equal(t, EventOwnerRequest, events[1].Type)
+	assert.Equal(t, "花花", events[1].Sender)
+	assert.Equal(t, "用 MySQL 还是 PG？", events[1].Content)
+}
+
 func TestStorage_InvocationJSON_ReadWrite(t *testing.T) {
 	// TC-2.6: Invocation JSON 写入后读回，字段完全一致
 	mgr, _, cleanup := setupSessionChainTest(t)
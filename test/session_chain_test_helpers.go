@@ -32,6 +32,8 @@ const (
 	EventCat        EventType = "cat"
 	EventSystem     EventType = "system"
 	EventInvocation EventType = "invocation"
+
+	EventOwnerRequest EventType = "owner_request"
 )
 
 // --- 类型定义 ---
@@ -875,6 +877,8 @@ func (m *SessionChainManager) writeSessionMarkdownToDisk(threadID string, sessio
 		case EventInvocation:
 			sb.WriteString(fmt.Sprintf("### #%d [%s] **[调用:%s]** invocation_id=%s\n\n%s\n\n",
 				e.EventNo, ts, e.Sender, e.InvocationID, e.Content))
+		case EventOwnerRequest:
+			sb.WriteString(fmt.Sprintf("### #%d [%s] **[询问铲屎官:%s]**\n\n%s\n\n", e.EventNo, ts, e.Sender, e.Content))
 		}
 	}
 
@@ -985,6 +989,13 @@ func parseEventsFromMarkdown(body string) []SessionEvent {
 			} else if strings.Contains(rest, "**[系统]**") {
 				e.Type = EventSystem
 				e.Sender = "系统"
+			} else if strings.Contains(rest, "**[询问铲屎官:") {
+				e.Type = EventOwnerRequest
+				start := strings.Index(rest, "**[询问铲屎官:") + len("**[询问铲屎官:")
+				end := strings.Index(rest[start:], "]**")
+				if end > 0 {
+					e.Sender = rest[start : start+end]
+				}
 			} else if strings.Contains(rest, "**[调用:") {
 				e.Type = EventInvocation
 				// 提取 sender
@@ -0,0 +1,51 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// 增量输出消息简化版本用于测试（从 stream_delta.go 复制，StreamEvent 使用 agentcli 包中的定义）
+
+type TaskDelta struct {
+	TaskID    string `json:"taskId"`
+	SessionID string `json:"sessionId"`
+	AgentName string `json:"agentName"`
+	Seq       int    `json:"seq"`
+	StreamEvent
+}
+
+// TestTaskDeltaJSONIsFlat 测试增量事件字段平铺在消息顶层（前端按 delta.type / delta.text 读取）
+func TestTaskDeltaJSONIsFlat(t *testing.T) {
+	delta := TaskDelta{
+		TaskID:      "task_1",
+		SessionID:   "sess_1",
+		AgentName:   "花花",
+		Seq:         3,
+		StreamEvent: StreamEvent{Type: "tool_start", Tool: "Bash", ToolID: "toolu_1"},
+	}
+
+	data, err := json.Marshal(delta)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if fields["type"] != "tool_start" || fields["tool"] != "Bash" || fields["toolId"] != "toolu_1" {
+		t.Errorf("Event fields should be top-level: %s", data)
+	}
+	if _, exists := fields["text"]; exists {
+		t.Errorf("Empty text should be omitted: %s", data)
+	}
+
+	var decoded TaskDelta
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Round trip failed: %v", err)
+	}
+	if decoded != delta {
+		t.Errorf("Round trip mismatch: %+v", decoded)
+	}
+}
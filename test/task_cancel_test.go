@@ -0,0 +1,71 @@
+package test
+
+import "testing"
+
+// 调用历史匹配简化版本用于测试（从 api_server.go 复制）
+
+type CallHistoryItem struct {
+	CatName  string
+	Response string
+	TaskID   string
+	Status   string
+}
+
+const (
+	TaskStatusPending   = "pending"
+	TaskStatusCompleted = "completed"
+	TaskStatusCancelled = "cancelled"
+)
+
+func findCallHistoryItem(history []CallHistoryItem, taskID string, catName string) *CallHistoryItem {
+	if taskID != "" {
+		for i := len(history) - 1; i >= 0; i-- {
+			if history[i].TaskID == taskID {
+				return &history[i]
+			}
+		}
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		item := &history[i]
+		if item.CatName == catName && item.Response == "" && item.Status != TaskStatusCancelled {
+			return item
+		}
+	}
+	return nil
+}
+
+// TestFindCallHistoryItemByTaskID 测试同一只猫猫有多个调用时按任务 ID 匹配
+func TestFindCallHistoryItemByTaskID(t *testing.T) {
+	history := []CallHistoryItem{
+		{CatName: "花花", TaskID: "task_1", Status: TaskStatusPending},
+		{CatName: "花花", TaskID: "task_2", Status: TaskStatusPending},
+	}
+
+	item := findCallHistoryItem(history, "task_1", "花花")
+	if item == nil || item.TaskID != "task_1" {
+		t.Fatalf("Expected task_1, got %+v", item)
+	}
+	item.Response = "喵"
+	item.Status = TaskStatusCompleted
+
+	if history[0].Status != TaskStatusCompleted || history[1].Status != TaskStatusPending {
+		t.Errorf("Only task_1 should be completed: %+v", history)
+	}
+}
+
+// TestFindCallHistoryItemSkipsCancelled 测试没有任务 ID 的结果不会落到已取消的调用上
+func TestFindCallHistoryItemSkipsCancelled(t *testing.T) {
+	history := []CallHistoryItem{
+		{CatName: "薇薇"},
+		{CatName: "薇薇", TaskID: "task_2", Status: TaskStatusCancelled},
+	}
+
+	item := findCallHistoryItem(history, "", "薇薇")
+	if item != &history[0] {
+		t.Errorf("Expected the earlier uncancelled call, got %+v", item)
+	}
+
+	if findCallHistoryItem(history, "", "小乔") != nil {
+		t.Error("Expected no match for a cat without calls")
+	}
+}
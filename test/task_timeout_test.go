@@ -0,0 +1,41 @@
+package test
+
+import (
+	"testing"
+	"time"
+)
+
+// 任务超时解析简化版本用于测试（从 task_control.go 复制）
+
+const DefaultAgentTimeout = 30 * time.Minute
+
+func resolveTaskTimeout(agent AgentConfig, task *TaskMessage) time.Duration {
+	if task != nil && task.Timeout > 0 {
+		return time.Duration(task.Timeout) * time.Second
+	}
+	if agent.Timeout > 0 {
+		return time.Duration(agent.Timeout) * time.Second
+	}
+	return DefaultAgentTimeout
+}
+
+// TestResolveTaskTimeout 测试任务级超时优先于 Agent 配置，都未配置时使用默认值
+func TestResolveTaskTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		agent    AgentConfig
+		task     *TaskMessage
+		expected time.Duration
+	}{
+		{"default", AgentConfig{Name: "花花"}, &TaskMessage{}, DefaultAgentTimeout},
+		{"agent", AgentConfig{Name: "薇薇", Timeout: 900}, &TaskMessage{}, 900 * time.Second},
+		{"task overrides agent", AgentConfig{Name: "薇薇", Timeout: 900}, &TaskMessage{Timeout: 60}, 60 * time.Second},
+		{"nil task", AgentConfig{Name: "小乔", Timeout: 120}, nil, 120 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := resolveTaskTimeout(tt.agent, tt.task); got != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+}
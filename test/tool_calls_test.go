@@ -0,0 +1,167 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"cat-cafe/src/agentcli"
+)
+
+// 工具调用记录简化版本用于测试（从 invoke.go / cli_adapter.go 复制）
+
+const maxToolIOLength = 8 * 1024
+
+type ToolCall struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Input      string    `json:"input,omitempty"`
+	Output     string    `json:"output,omitempty"`
+	IsError    bool      `json:"isError,omitempty"`
+	Finished   bool      `json:"finished"`
+	StartedAt  time.Time `json:"startedAt"`
+	DurationMs int64     `json:"durationMs"`
+}
+
+type toolCallRecorder struct {
+	calls []ToolCall
+	index map[string]int
+}
+
+func newToolCallRecorder() *toolCallRecorder {
+	return &toolCallRecorder{index: make(map[string]int)}
+}
+
+func (r *toolCallRecorder) Observe(event StreamEvent) {
+	if event.Type != StreamEventToolStart && event.Type != StreamEventToolEnd {
+		return
+	}
+	now := time.Now()
+
+	i, exists := r.index[event.ToolID]
+	if !exists || event.ToolID == "" {
+		r.calls = append(r.calls, ToolCall{ID: event.ToolID, Name: event.Tool, StartedAt: now})
+		i = len(r.calls) - 1
+		r.index[event.ToolID] = i
+	}
+	call := &r.calls[i]
+	if call.Name == "" {
+		call.Name = event.Tool
+	}
+	if event.Input != "" {
+		call.Input = truncateToolIO(event.Input)
+	}
+	if event.Type == StreamEventToolEnd {
+		call.Output = truncateToolIO(event.Output)
+		call.IsError = event.IsError
+		call.Finished = true
+		call.DurationMs = now.Sub(call.StartedAt).Milliseconds()
+	}
+}
+
+func truncateToolIO(s string) string {
+	if len(s) <= maxToolIOLength {
+		return s
+	}
+	cut := maxToolIOLength
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + fmt.Sprintf("\n...（已截断，共 %d 字节）", len(s))
+}
+
+func toolIOText(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var blocks []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if json.Unmarshal(raw, &blocks) == nil {
+		var texts []string
+		for _, block := range blocks {
+			if block.Type == "text" {
+				texts = append(texts, block.Text)
+			}
+		}
+		if len(texts) > 0 {
+			return strings.Join(texts, "\n")
+		}
+	}
+	var compact bytes.Buffer
+	if json.Compact(&compact, raw) == nil {
+		return compact.String()
+	}
+	return string(raw)
+}
+
+// TestToolCallRecorderFromRecording 测试录制的 Claude 输出汇总为工具调用记录
+func TestToolCallRecorderFromRecording(t *testing.T) {
+	run := replayRecorded(t, "claude.jsonl", agentcli.ClaudeAdapter{})
+
+	recorder := newToolCallRecorder()
+	for _, event := range run.Tools {
+		recorder.Observe(event)
+	}
+
+	if len(recorder.calls) != 2 {
+		t.Fatalf("Expected 2 tool calls, got %+v", recorder.calls)
+	}
+	bash, read := recorder.calls[0], recorder.calls[1]
+	if bash.Name != "Bash" || bash.Input != `{"command":"ls"}` || bash.Output != "README.md\nsrc" || bash.IsError || !bash.Finished {
+		t.Errorf("Unexpected Bash call: %+v", bash)
+	}
+	if read.Name != "Read" || !read.IsError || read.Output != "File does not exist." {
+		t.Errorf("Unexpected Read call: %+v", read)
+	}
+}
+
+// TestToolCallRecorderUnfinished 测试 CLI 中途退出时未结束的调用保留为 finished=false
+func TestToolCallRecorderUnfinished(t *testing.T) {
+	recorder := newToolCallRecorder()
+	recorder.Observe(StreamEvent{Type: StreamEventText, Text: "稍等"})
+	recorder.Observe(StreamEvent{Type: StreamEventToolStart, Tool: "Bash", ToolID: "t1", Input: "sleep 100"})
+
+	if len(recorder.calls) != 1 {
+		t.Fatalf("Text events should be ignored: %+v", recorder.calls)
+	}
+	if call := recorder.calls[0]; call.Finished || call.DurationMs != 0 || call.Input != "sleep 100" {
+		t.Errorf("Unexpected unfinished call: %+v", call)
+	}
+}
+
+// TestToolIOText 测试工具结果的几种内容形式
+func TestToolIOText(t *testing.T) {
+	cases := map[string]string{
+		`"plain"`: "plain",
+		`[{"type":"text","text":"a"},{"type":"image"},{"type":"text","text":"b"}]`: "a\nb",
+		`{ "path" : "." }`: `{"path":"."}`,
+		`null`:             "",
+	}
+	for raw, want := range cases {
+		if got := toolIOText(json.RawMessage(raw)); got != want {
+			t.Errorf("toolIOText(%s) = %q, want %q", raw, got, want)
+		}
+	}
+}
+
+// TestTruncateToolIO 测试超长输出按 UTF-8 边界截断
+func TestTruncateToolIO(t *testing.T) {
+	long := strings.Repeat("喵", maxToolIOLength)
+	got := truncateToolIO(long)
+	if !utf8.ValidString(got) {
+		t.Error("Truncated output should be valid UTF-8")
+	}
+	if !strings.Contains(got, "已截断") || len(got) > maxToolIOLength+100 {
+		t.Errorf("Unexpected truncation, length %d", len(got))
+	}
+}
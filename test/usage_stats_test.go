@@ -0,0 +1,265 @@
+package test
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 用量统计简化版本用于测试（从 usage_stats.go 复制）
+
+type ModelPrice struct {
+	Input     float64
+	Output    float64
+	CacheRead float64
+}
+
+type CLIResult struct {
+	Response string
+	Model    string
+	Usage    *CLIUsage
+}
+
+type InvocationUsage struct {
+	Model           string
+	TokensIn        int
+	TokensOut       int
+	CacheReadTokens int
+	CostUSD         float64
+	DurationMs      int64
+	Estimated       bool
+}
+
+func lookupModelPrice(pricing map[string]ModelPrice, model string) (ModelPrice, bool) {
+	if model == "" {
+		return ModelPrice{}, false
+	}
+	if price, ok := pricing[model]; ok {
+		return price, true
+	}
+	bestKey := ""
+	for key := range pricing {
+		if strings.HasPrefix(model, key) && len(key) > len(bestKey) {
+			bestKey = key
+		}
+	}
+	if bestKey == "" {
+		return ModelPrice{}, false
+	}
+	return pricing[bestKey], true
+}
+
+func resolveInvocationUsage(result *CLIResult, prompt string, configuredModel, cliType string, pricing map[string]ModelPrice, duration time.Duration) InvocationUsage {
+	usage := InvocationUsage{
+		Model:      result.Model,
+		DurationMs: duration.Milliseconds(),
+	}
+	if usage.Model == "" {
+		usage.Model = configuredModel
+	}
+
+	if result.Usage != nil {
+		usage.TokensIn = result.Usage.InputTokens
+		usage.TokensOut = result.Usage.OutputTokens
+		usage.CacheReadTokens = result.Usage.CacheReadTokens
+		usage.CostUSD = result.Usage.CostUSD
+	} else {
+		usage.TokensIn = EstimateTokens(prompt)
+		usage.TokensOut = EstimateTokens(result.Response)
+		usage.Estimated = true
+	}
+
+	if usage.CostUSD == 0 {
+		price, ok := lookupModelPrice(pricing, usage.Model)
+		if !ok {
+			price, ok = lookupModelPrice(pricing, cliType)
+		}
+		if ok {
+			cacheRead := price.CacheRead
+			if cacheRead == 0 {
+				cacheRead = price.Input
+			}
+			usage.CostUSD = (float64(usage.TokensIn)*price.Input +
+				float64(usage.TokensOut)*price.Output +
+				float64(usage.CacheReadTokens)*cacheRead) / 1e6
+		}
+	}
+	return usage
+}
+
+type UsageTotals struct {
+	Invocations     int64
+	TokensIn        int64
+	TokensOut       int64
+	CacheReadTokens int64
+	CostUSD         float64
+	DurationMs      int64
+	Estimated       int64
+}
+
+func (t *UsageTotals) add(other UsageTotals) {
+	t.Invocations += other.Invocations
+	t.TokensIn += other.TokensIn
+	t.TokensOut += other.TokensOut
+	t.CacheReadTokens += other.CacheReadTokens
+	t.CostUSD += other.CostUSD
+	t.DurationMs += other.DurationMs
+	t.Estimated += other.Estimated
+}
+
+type UsageStats struct {
+	Total UsageTotals
+	ByCat map[string]UsageTotals
+}
+
+func parseUsageStats(values map[string]string) *UsageStats {
+	stats := &UsageStats{ByCat: make(map[string]UsageTotals)}
+	for field, value := range values {
+		sep := strings.LastIndex(field, "|")
+		if sep < 0 {
+			continue
+		}
+		cat, metric := field[:sep], field[sep+1:]
+		totals := stats.ByCat[cat]
+
+		n, _ := strconv.ParseInt(value, 10, 64)
+		switch metric {
+		case "invocations":
+			totals.Invocations = n
+		case "tokens_in":
+			totals.TokensIn = n
+		case "tokens_out":
+			totals.TokensOut = n
+		case "cache_read_tokens":
+			totals.CacheReadTokens = n
+		case "cost_usd":
+			totals.CostUSD, _ = strconv.ParseFloat(value, 64)
+		case "duration_ms":
+			totals.DurationMs = n
+		case "estimated":
+			totals.Estimated = n
+		}
+		stats.ByCat[cat] = totals
+	}
+	for _, totals := range stats.ByCat {
+		stats.Total.add(totals)
+	}
+	return stats
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+var testPricing = map[string]ModelPrice{
+	"claude-sonnet-4-5": {Input: 3, Output: 15, CacheRead: 0.3},
+	"claude":            {Input: 1, Output: 5},
+	"gpt-4o":            {Input: 2.5, Output: 10},
+	"gpt-4o-mini":       {Input: 0.15, Output: 0.6},
+	"codex":             {Input: 1.25, Output: 10},
+}
+
+// TestLookupModelPrice 测试精确匹配优先，其次最长前缀
+func TestLookupModelPrice(t *testing.T) {
+	cases := map[string]float64{
+		"gpt-4o":                     2.5,
+		"gpt-4o-mini-2024-07-18":     0.15,
+		"claude-sonnet-4-5-20250929": 3,
+		"claude-haiku-4-5":           1,
+	}
+	for model, wantInput := range cases {
+		price, ok := lookupModelPrice(testPricing, model)
+		if !ok || price.Input != wantInput {
+			t.Errorf("lookupModelPrice(%s) = %+v, %v; want input %v", model, price, ok, wantInput)
+		}
+	}
+	if _, ok := lookupModelPrice(testPricing, "gemini-2.5-pro"); ok {
+		t.Error("Unknown model should not match")
+	}
+}
+
+// TestResolveUsageKeepsReportedCost 测试 CLI 报告了费用时直接使用
+func TestResolveUsageKeepsReportedCost(t *testing.T) {
+	result := &CLIResult{
+		Model: "claude-sonnet-4-5-20250929",
+		Usage: &CLIUsage{InputTokens: 1000, OutputTokens: 200, CacheReadTokens: 5000, CostUSD: 0.042},
+	}
+	usage := resolveInvocationUsage(result, "prompt", "", "claude", testPricing, 1500*time.Millisecond)
+
+	if usage.Estimated || usage.TokensIn != 1000 || usage.TokensOut != 200 || usage.CacheReadTokens != 5000 {
+		t.Errorf("Unexpected usage: %+v", usage)
+	}
+	if !almostEqual(usage.CostUSD, 0.042) || usage.DurationMs != 1500 {
+		t.Errorf("Expected reported cost and duration, got %+v", usage)
+	}
+}
+
+// TestResolveUsageComputesCost 测试 CLI 未报告费用时按价格表计算（缓存读取有单独价格）
+func TestResolveUsageComputesCost(t *testing.T) {
+	result := &CLIResult{
+		Model: "claude-sonnet-4-5-20250929",
+		Usage: &CLIUsage{InputTokens: 1000000, OutputTokens: 100000, CacheReadTokens: 1000000},
+	}
+	usage := resolveInvocationUsage(result, "", "", "claude", testPricing, 0)
+
+	// 1M * $3 + 0.1M * $15 + 1M * $0.3
+	if !almostEqual(usage.CostUSD, 4.8) {
+		t.Errorf("Expected cost 4.8, got %v", usage.CostUSD)
+	}
+}
+
+// TestResolveUsageFallbacks 测试未报告用量时估算 token，未报告模型时按配置模型和 cli_type 查价
+func TestResolveUsageFallbacks(t *testing.T) {
+	result := &CLIResult{Response: "好的喵"}
+	usage := resolveInvocationUsage(result, "请帮忙看看这段代码", "", "codex", testPricing, 0)
+
+	if !usage.Estimated {
+		t.Error("Usage should be marked as estimated")
+	}
+	if usage.TokensIn != EstimateTokens("请帮忙看看这段代码") || usage.TokensOut != EstimateTokens("好的喵") {
+		t.Errorf("Unexpected estimated tokens: %+v", usage)
+	}
+	want := (float64(usage.TokensIn)*1.25 + float64(usage.TokensOut)*10) / 1e6
+	if !almostEqual(usage.CostUSD, want) {
+		t.Errorf("Expected cost by cli_type price %v, got %v", want, usage.CostUSD)
+	}
+
+	configured := resolveInvocationUsage(&CLIResult{Usage: &CLIUsage{InputTokens: 1000000}}, "", "gpt-4o", "http", testPricing, 0)
+	if configured.Model != "gpt-4o" || !almostEqual(configured.CostUSD, 2.5) {
+		t.Errorf("Expected configured model price, got %+v", configured)
+	}
+
+	unpriced := resolveInvocationUsage(&CLIResult{Usage: &CLIUsage{InputTokens: 10}}, "", "", "gemini", testPricing, 0)
+	if unpriced.CostUSD != 0 {
+		t.Errorf("Unpriced model should cost 0, got %v", unpriced.CostUSD)
+	}
+}
+
+// TestParseUsageStats 测试 Redis Hash 按猫猫汇总并计算合计
+func TestParseUsageStats(t *testing.T) {
+	stats := parseUsageStats(map[string]string{
+		"花花|invocations": "2",
+		"花花|tokens_in":   "1200",
+		"花花|tokens_out":  "300",
+		"花花|cost_usd":    "0.05",
+		"花花|duration_ms": "4000",
+		"薇薇|invocations": "1",
+		"薇薇|tokens_in":   "800",
+		"薇薇|cost_usd":    "0.01",
+		"薇薇|estimated":   "1",
+		"malformed":      "1",
+	})
+
+	if len(stats.ByCat) != 2 {
+		t.Fatalf("Expected 2 cats, got %+v", stats.ByCat)
+	}
+	if huahua := stats.ByCat["花花"]; huahua.Invocations != 2 || huahua.TokensOut != 300 || huahua.DurationMs != 4000 {
+		t.Errorf("Unexpected 花花 totals: %+v", huahua)
+	}
+	total := stats.Total
+	if total.Invocations != 3 || total.TokensIn != 2000 || total.Estimated != 1 || !almostEqual(total.CostUSD, 0.06) {
+		t.Errorf("Unexpected total: %+v", total)
+	}
+}
@@ -0,0 +1,256 @@
+package test
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 工作进程并发执行简化版本用于测试（从 worker_pool.go 复制，Redis 消息替换为内存消息）
+
+type poolMessage struct {
+	ID        string
+	SessionID string
+}
+
+type workerPool struct {
+	slots   chan struct{}
+	waiting chan struct{}
+	lanesMu sync.Mutex
+	lanes   map[string][]poolMessage
+	tasks   sync.WaitGroup
+	handle  func(poolMessage) error
+}
+
+// poolMaxAttempts 对应 TaskMessage.MaxRetries：首次执行加重试共 3 次
+const poolMaxAttempts = 3
+
+func newWorkerPool(concurrency int, handle func(poolMessage) error) *workerPool {
+	return &workerPool{
+		slots:   make(chan struct{}, concurrency),
+		waiting: make(chan struct{}, concurrency),
+		lanes:   make(map[string][]poolMessage),
+		handle:  handle,
+	}
+}
+
+// read 对应 processMessages：先占排队名额和槽位再取消息，任一用完时阻塞（消息留在队列中）
+func (p *workerPool) read(message poolMessage) {
+	p.waiting <- struct{}{}
+	p.slots <- struct{}{}
+	p.dispatch(message)
+}
+
+func (p *workerPool) dispatch(message poolMessage) {
+	lane := message.SessionID
+	if lane == "" {
+		lane = "message:" + message.ID
+	}
+
+	p.lanesMu.Lock()
+	if queue, running := p.lanes[lane]; running {
+		p.lanes[lane] = append(queue, message)
+		p.lanesMu.Unlock()
+		<-p.slots
+		return
+	}
+	p.lanes[lane] = nil
+	p.lanesMu.Unlock()
+	<-p.waiting
+
+	p.tasks.Add(1)
+	go p.runLane(lane, message)
+}
+
+func (p *workerPool) runLane(lane string, message poolMessage) {
+	defer p.tasks.Done()
+	for {
+		p.process(message)
+		<-p.slots
+
+		p.lanesMu.Lock()
+		queue := p.lanes[lane]
+		if len(queue) == 0 {
+			delete(p.lanes, lane)
+			p.lanesMu.Unlock()
+			return
+		}
+		message, p.lanes[lane] = queue[0], queue[1:]
+		p.lanesMu.Unlock()
+
+		p.slots <- struct{}{}
+		<-p.waiting
+	}
+}
+
+// process 对应 processMessage：失败时在原位重试，重试结束前不执行同一会话的后续消息
+func (p *workerPool) process(message poolMessage) {
+	for attempt := 1; ; attempt++ {
+		if p.handle(message) == nil || attempt >= poolMaxAttempts {
+			return
+		}
+	}
+}
+
+// TestWorkerPoolOrdering 测试同一会话的任务串行且保持顺序，不同会话的任务并行执行，并发数不超过上限
+func TestWorkerPoolOrdering(t *testing.T) {
+	var mu sync.Mutex
+	order := make(map[string][]string)
+	running := make(map[string]int)
+	current, peak := 0, 0
+
+	pool := newWorkerPool(3, func(m poolMessage) error {
+		mu.Lock()
+		running[m.SessionID]++
+		if running[m.SessionID] > 1 {
+			t.Errorf("Session %s ran two tasks at once", m.SessionID)
+		}
+		current++
+		if current > peak {
+			peak = current
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		running[m.SessionID]--
+		current--
+		order[m.SessionID] = append(order[m.SessionID], m.ID)
+		mu.Unlock()
+		return nil
+	})
+
+	messages := []poolMessage{
+		{"a1", "A"}, {"b1", "B"}, {"a2", "A"}, {"c1", "C"}, {"b2", "B"}, {"a3", "A"}, {"c2", "C"},
+	}
+	start := time.Now()
+	for _, m := range messages {
+		pool.read(m)
+	}
+	pool.tasks.Wait()
+
+	want := map[string][]string{"A": {"a1", "a2", "a3"}, "B": {"b1", "b2"}, "C": {"c1", "c2"}}
+	for session, ids := range want {
+		got := order[session]
+		if len(got) != len(ids) {
+			t.Fatalf("Session %s: got %v, want %v", session, got, ids)
+		}
+		for i := range ids {
+			if got[i] != ids[i] {
+				t.Errorf("Session %s out of order: got %v, want %v", session, got, ids)
+				break
+			}
+		}
+	}
+	if peak > 3 {
+		t.Errorf("Concurrency exceeded the limit: %d", peak)
+	}
+	if peak < 2 {
+		t.Errorf("Expected sessions to run in parallel, peak was %d", peak)
+	}
+	// 7 个任务串行需要 140ms，并行时应明显更快
+	if elapsed := time.Since(start); elapsed >= 140*time.Millisecond {
+		t.Errorf("Expected parallel execution, took %v", elapsed)
+	}
+}
+
+// expectBlocked 在后台执行 read，断言它在 release 关闭前阻塞、之后继续
+func expectBlocked(t *testing.T, pool *workerPool, message poolMessage, release chan struct{}) {
+	t.Helper()
+	read := make(chan struct{})
+	go func() {
+		pool.read(message)
+		close(read)
+	}()
+
+	select {
+	case <-read:
+		t.Fatalf("Expected reading %s to block", message.ID)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-read:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected reading %s to proceed after release", message.ID)
+	}
+}
+
+// TestWorkerPoolBackPressure 测试等待同会话前序任务的消息不占用槽位，正在执行的任务占满槽位时不再读取新消息
+func TestWorkerPoolBackPressure(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan string, 4)
+	pool := newWorkerPool(2, func(m poolMessage) error {
+		started <- m.ID
+		<-release
+		return nil
+	})
+
+	pool.read(poolMessage{"a1", "A"})
+	pool.read(poolMessage{"a2", "A"}) // 排在 a1 之后，不占用槽位
+	pool.read(poolMessage{"b1", "B"})
+
+	running := make(map[string]bool)
+	for len(running) < 2 {
+		select {
+		case id := <-started:
+			running[id] = true
+		case <-time.After(time.Second):
+			t.Fatalf("Expected a1 and b1 to run while a2 waits, running: %v", running)
+		}
+	}
+	if !running["a1"] || !running["b1"] {
+		t.Fatalf("Expected a1 and b1 to run while a2 waits, running: %v", running)
+	}
+
+	expectBlocked(t, pool, poolMessage{"c1", "C"}, release)
+	pool.tasks.Wait()
+}
+
+// TestWorkerPoolWaitingLimit 测试排队名额用完时即使有空闲槽位也不再读取新消息
+func TestWorkerPoolWaitingLimit(t *testing.T) {
+	release := make(chan struct{})
+	pool := newWorkerPool(2, func(m poolMessage) error {
+		<-release
+		return nil
+	})
+
+	pool.read(poolMessage{"a1", "A"})
+	pool.read(poolMessage{"a2", "A"})
+	pool.read(poolMessage{"a3", "A"})
+
+	expectBlocked(t, pool, poolMessage{"b1", "B"}, release)
+	pool.tasks.Wait()
+}
+
+// TestWorkerPoolRetryInPlace 测试失败的任务在原位重试，同一会话的后续任务不会插到重试之前
+func TestWorkerPoolRetryInPlace(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	failures := map[string]int{"a1": 1, "a3": poolMaxAttempts}
+
+	pool := newWorkerPool(2, func(m poolMessage) error {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, m.ID)
+		if failures[m.ID] > 0 {
+			failures[m.ID]--
+			return errors.New("cli failed")
+		}
+		return nil
+	})
+
+	for _, m := range []poolMessage{{"a1", "A"}, {"a2", "A"}, {"a3", "A"}, {"a4", "A"}} {
+		pool.read(m)
+	}
+	pool.tasks.Wait()
+
+	want := []string{"a1", "a1", "a2", "a3", "a3", "a3", "a4"}
+	if strings.Join(order, ",") != strings.Join(want, ",") {
+		t.Errorf("Unexpected execution order: got %v, want %v", order, want)
+	}
+}
@@ -0,0 +1,212 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 工作区隔离简化版本用于测试（从 worktree.go 复制，去掉 Redis 中的分支记录）
+
+var errWorktreeConflict = errors.New("合并冲突")
+
+type Worktree struct {
+	ID       string
+	Branch   string
+	Path     string
+	Base     string
+	Changed  bool
+	DiffStat string
+	Diff     string
+}
+
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func gitIdentity(name string) []string {
+	return []string{"-c", "user.name=" + name, "-c", "user.email=cat-cafe@localhost"}
+}
+
+func worktreeRoot(repo string) (string, error) {
+	gitDir, err := runGit(repo, "rev-parse", "--git-common-dir")
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(repo, gitDir)
+	}
+	return filepath.Join(gitDir, "cat-cafe-worktrees"), nil
+}
+
+// prepareWorktree 对应 PrepareWorktree 中创建 worktree 的部分
+func prepareWorktree(repo, id string) (*Worktree, error) {
+	base, err := runGit(repo, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	root, err := worktreeRoot(repo)
+	if err != nil {
+		return nil, err
+	}
+	wt := &Worktree{ID: id, Branch: "cat-cafe/" + id, Path: filepath.Join(root, id), Base: base}
+	if _, err := runGit(repo, "worktree", "add", "-b", wt.Branch, wt.Path, base); err != nil {
+		return nil, err
+	}
+	return wt, nil
+}
+
+// finishWorktree 对应 FinishWorktree（不保存记录）
+func finishWorktree(wt *Worktree, agentName string) {
+	if _, err := runGit(wt.Path, "add", "-A"); err == nil {
+		if _, err := runGit(wt.Path, "diff", "--cached", "--quiet"); err != nil {
+			args := append(gitIdentity(agentName), "commit", "--quiet", "--no-verify", "-m", agentName+": "+wt.ID)
+			runGit(wt.Path, args...)
+		}
+	}
+	wt.DiffStat, _ = runGit(wt.Path, "diff", "--stat", wt.Base, "HEAD")
+	wt.Changed = wt.DiffStat != ""
+	wt.Diff, _ = runGit(wt.Path, "diff", wt.Base, "HEAD")
+}
+
+// mergeWorktree 对应 MergeWorktree（冲突时中止合并）
+func mergeWorktree(repo string, wt *Worktree) error {
+	args := append(gitIdentity("cat-cafe"), "merge", "--no-ff", "--no-edit", "-m", "合并 "+wt.Branch, wt.Branch)
+	if _, err := runGit(repo, args...); err != nil {
+		conflicts, _ := runGit(repo, "diff", "--name-only", "--diff-filter=U")
+		if conflicts != "" {
+			runGit(repo, "merge", "--abort")
+			return fmt.Errorf("%w: %s", errWorktreeConflict, strings.Join(strings.Fields(conflicts), ", "))
+		}
+		return err
+	}
+	runGit(repo, "worktree", "remove", "--force", wt.Path)
+	runGit(repo, "branch", "-D", wt.Branch)
+	return nil
+}
+
+func newTestRepo(t *testing.T) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	repo := t.TempDir()
+	if _, err := runGit(repo, "init", "--quiet"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(repo, "README.md"), "line 1\nline 2\n")
+	runGit(repo, "add", "-A")
+	if _, err := runGit(repo, append(gitIdentity("铲屎官"), "commit", "--quiet", "-m", "init")...); err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func writeFile(t *testing.T, path, content string) {
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// TestWorktreeIsolation 测试两只猫猫在各自的 worktree 中修改互不影响，合并后工作区包含双方的修改
+func TestWorktreeIsolation(t *testing.T) {
+	repo := newTestRepo(t)
+
+	huahua, err := prepareWorktree(repo, "task_花花_1")
+	if err != nil {
+		t.Fatalf("prepareWorktree failed: %v", err)
+	}
+	weiwei, err := prepareWorktree(repo, "task_薇薇_2")
+	if err != nil {
+		t.Fatalf("prepareWorktree failed: %v", err)
+	}
+
+	writeFile(t, filepath.Join(huahua.Path, "README.md"), "line 1 by 花花\nline 2\n")
+	writeFile(t, filepath.Join(weiwei.Path, "notes.md"), "薇薇的笔记\n")
+	finishWorktree(huahua, "花花")
+	finishWorktree(weiwei, "薇薇")
+
+	// 工作区本身不受影响，worktree 不出现在未跟踪文件中
+	if got := readFile(t, filepath.Join(repo, "README.md")); got != "line 1\nline 2\n" {
+		t.Errorf("Expected the workspace to be untouched, got %q", got)
+	}
+	if status, _ := runGit(repo, "status", "--porcelain"); status != "" {
+		t.Errorf("Expected a clean workspace, got %q", status)
+	}
+
+	if !huahua.Changed || !strings.Contains(huahua.DiffStat, "README.md") || !strings.Contains(huahua.Diff, "+line 1 by 花花") {
+		t.Errorf("Expected the diff to report the change, got stat %q diff %q", huahua.DiffStat, huahua.Diff)
+	}
+
+	if err := mergeWorktree(repo, huahua); err != nil {
+		t.Fatalf("merge failed: %v", err)
+	}
+	if err := mergeWorktree(repo, weiwei); err != nil {
+		t.Fatalf("merge failed: %v", err)
+	}
+	if got := readFile(t, filepath.Join(repo, "README.md")); got != "line 1 by 花花\nline 2\n" {
+		t.Errorf("Expected 花花's change to be merged, got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "notes.md")); err != nil {
+		t.Errorf("Expected 薇薇's file to be merged: %v", err)
+	}
+	if branches, _ := runGit(repo, "branch", "--list", "cat-cafe/*"); branches != "" {
+		t.Errorf("Expected merged branches to be deleted, got %q", branches)
+	}
+}
+
+// TestWorktreeMergeConflict 测试合并冲突时中止合并，工作区保持不变
+func TestWorktreeMergeConflict(t *testing.T) {
+	repo := newTestRepo(t)
+
+	first, err := prepareWorktree(repo, "task_花花_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := prepareWorktree(repo, "task_小乔_2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(first.Path, "README.md"), "line 1 by 花花\nline 2\n")
+	writeFile(t, filepath.Join(second.Path, "README.md"), "line 1 by 小乔\nline 2\n")
+	finishWorktree(first, "花花")
+	finishWorktree(second, "小乔")
+
+	if err := mergeWorktree(repo, first); err != nil {
+		t.Fatalf("merge failed: %v", err)
+	}
+	err = mergeWorktree(repo, second)
+	if !errors.Is(err, errWorktreeConflict) || !strings.Contains(err.Error(), "README.md") {
+		t.Fatalf("Expected a conflict on README.md, got %v", err)
+	}
+
+	if status, _ := runGit(repo, "status", "--porcelain"); status != "" {
+		t.Errorf("Expected the merge to be aborted, got %q", status)
+	}
+	if got := readFile(t, filepath.Join(repo, "README.md")); got != "line 1 by 花花\nline 2\n" {
+		t.Errorf("Expected the workspace to keep the first merge, got %q", got)
+	}
+	// 冲突的分支保留，可以继续修改或丢弃
+	if _, err := runGit(repo, "rev-parse", "--verify", "--quiet", "refs/heads/"+second.Branch); err != nil {
+		t.Errorf("Expected the conflicting branch to be kept: %v", err)
+	}
+}